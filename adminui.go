@@ -0,0 +1,222 @@
+package mockoidc
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// AdminUIEndpoint serves a small web UI to inspect & change the state of a
+// running MockOIDC, for QA engineers using a standalone server.
+const AdminUIEndpoint = "/oidc/admin/ui"
+
+var adminUITemplate = template.Must(template.New(AdminUIPage).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>mockoidc admin</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+td, th { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; }
+form.inline { display: inline; }
+</style>
+</head>
+<body>
+<h1>mockoidc</h1>
+<p>Issuer: <code data-testid="issuer">{{.Issuer}}</code></p>
+
+<h2>Clients</h2>
+<table data-testid="clients">
+<tr><th>Client ID</th><th>Client Secret</th><th>Access TTL</th><th>Refresh TTL</th></tr>
+{{range .Clients}}<tr data-testid="client"><td><code data-testid="client-id">{{.ID}}</code></td><td><code data-testid="client-secret">{{.Secret}}</code></td>
+<td>{{$.Config.AccessTTL}}</td><td>{{$.Config.RefreshTTL}}</td></tr>
+{{end}}</table>
+
+<h2>Queued Users</h2>
+<table data-testid="users">
+<tr><th>Subject</th><th>Email</th></tr>
+{{range .Users}}<tr data-testid="user"><td>{{.ID}}</td><td>{{.Email}}</td></tr>
+{{else}}<tr><td colspan="2">None, the default user logs in</td></tr>
+{{end}}</table>
+<form method="post" data-testid="queue-user">
+<input type="hidden" name="action" value="queue_user">
+<input name="subject" placeholder="Subject" required>
+<input name="email" placeholder="Email">
+<input name="preferred_username" placeholder="Username">
+<input name="groups" placeholder="Groups (comma separated)">
+<button>Queue user</button>
+</form>
+<form method="post" data-testid="clear-users"><input type="hidden" name="action" value="clear_users"><button>Clear users</button></form>
+
+<h2>Faults</h2>
+<table data-testid="errors">
+<tr><th>Status</th><th>Error</th><th>Description</th></tr>
+{{range .Errors}}<tr data-testid="error"><td>{{.Code}}</td><td>{{.Error}}</td><td>{{.Description}}</td></tr>
+{{else}}<tr><td colspan="3">None, requests succeed</td></tr>
+{{end}}</table>
+<form method="post" data-testid="queue-error">
+<input type="hidden" name="action" value="queue_error">
+<input name="code" type="number" value="500" required>
+<input name="error" value="server_error" required>
+<input name="description" placeholder="Description">
+<button>Queue error</button>
+</form>
+<form method="post" data-testid="clear-errors"><input type="hidden" name="action" value="clear_errors"><button>Clear errors</button></form>
+
+<h2>Active Sessions</h2>
+{{if .Sessions}}<table data-testid="sessions">
+<tr><th>Session</th><th>Subject</th><th>Scopes</th><th>Code Exchanged</th><th></th></tr>
+{{range .Sessions}}<tr data-testid="session"><td><code>{{.SessionID}}</code></td><td>{{.User.ID}}</td>
+<td>{{range .Scopes}}{{.}} {{end}}</td><td>{{.Granted}}</td>
+<td><form class="inline" method="post" data-testid="delete-session"><input type="hidden" name="action" value="delete_session">
+<input type="hidden" name="session_id" value="{{.SessionID}}"><button>Delete</button></form>
+{{if not .Revoked}}<form class="inline" method="post" data-testid="revoke-session"><input type="hidden" name="action" value="revoke_session">
+<input type="hidden" name="session_id" value="{{.SessionID}}"><button>Revoke</button></form>{{end}}</td></tr>
+{{end}}</table>
+{{else if .SessionsListable}}<p>None</p>
+{{else}}<p>The session store can't list its sessions</p>
+{{end}}
+
+<form method="post" data-testid="reset"><input type="hidden" name="action" value="reset"><button>Reset everything</button></form>
+</body>
+</html>
+`))
+
+// AdminUIUser is a queued User listed by the admin UI
+type AdminUIUser struct {
+	ID    string
+	Email string
+}
+
+// AdminUIData is rendered by the `AdminUIPage` template
+type AdminUIData struct {
+	Issuer           string
+	Config           *Config
+	Clients          []*Client
+	Users            []AdminUIUser
+	Errors           []*ServerError
+	Sessions         []*Session
+	SessionsListable bool
+}
+
+// Sessions returns all Sessions in the store ordered by ID
+func (ss *MemorySessionStore) Sessions() []*Session {
+	ss.Lock()
+	defer ss.Unlock()
+
+	sessions := make([]*Session, 0, len(ss.Store))
+	for _, session := range ss.Store {
+		sessions = append(sessions, session)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].SessionID < sessions[j].SessionID
+	})
+	return sessions
+}
+
+// AdminUI implements the `AdminUIEndpoint`. It renders the clients, queued
+// users & errors and active sessions on `GET` and applies the changes made
+// with its forms on `POST`.
+func (m *MockOIDC) AdminUI(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		m.renderAdminUI(rw, req)
+	case http.MethodPost:
+		if err := m.applyAdminUIAction(req); err != nil {
+			errorResponse(rw, InvalidRequest, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Redirect(rw, req, req.URL.Path, http.StatusSeeOther)
+	default:
+		errorResponse(rw, InvalidRequest, "Admin UI only supports GET & POST",
+			http.StatusMethodNotAllowed)
+	}
+}
+
+func (m *MockOIDC) renderAdminUI(rw http.ResponseWriter, req *http.Request) {
+	page := &AdminUIData{
+		Issuer: m.requestConfig(req).Issuer,
+		Config: m.Config(),
+	}
+	page.Clients = append(page.Clients,
+		&Client{ID: page.Config.ClientID, Secret: page.Config.ClientSecret})
+	if cs, ok := m.ClientStore.(*MemoryClientStore); ok {
+		page.Clients = append(page.Clients, cs.List()...)
+	}
+
+	var queued []User
+	if q, ok := m.users().(*UserQueue); ok {
+		q.Lock()
+		queued = append(queued, q.Queue...)
+		q.Unlock()
+	}
+	for _, user := range queued {
+		if bu, ok := user.(*boundUser); ok {
+			user = bu.User
+		}
+		u := AdminUIUser{ID: user.ID()}
+		if mu, ok := user.(*MockUser); ok {
+			u.Email = mu.Email
+		}
+		page.Users = append(page.Users, u)
+	}
+
+	m.ErrorQueue.Lock()
+	page.Errors = append(page.Errors, m.ErrorQueue.Queue...)
+	m.ErrorQueue.Unlock()
+
+	if ss, ok := m.SessionStore.(*MemorySessionStore); ok {
+		page.Sessions = ss.Sessions()
+		page.SessionsListable = true
+	}
+
+	m.renderPage(rw, http.StatusOK, AdminUIPage, page)
+}
+
+func (m *MockOIDC) applyAdminUIAction(req *http.Request) error {
+	if err := req.ParseForm(); err != nil {
+		return err
+	}
+
+	switch action := req.PostForm.Get("action"); action {
+	case "queue_user":
+		user := &MockUser{
+			Subject:           req.PostForm.Get("subject"),
+			Email:             req.PostForm.Get("email"),
+			PreferredUsername: req.PostForm.Get("preferred_username"),
+		}
+		if groups := req.PostForm.Get("groups"); groups != "" {
+			for _, group := range strings.Split(groups, ",") {
+				user.Groups = append(user.Groups, strings.TrimSpace(group))
+			}
+		}
+		m.QueueUser(user)
+	case "clear_users":
+		m.users().Clear()
+	case "queue_error":
+		code, err := strconv.Atoi(req.PostForm.Get("code"))
+		if err != nil {
+			return err
+		}
+		m.QueueError(&ServerError{
+			Code:        code,
+			Error:       req.PostForm.Get("error"),
+			Description: req.PostForm.Get("description"),
+		})
+	case "clear_errors":
+		m.ErrorQueue.Clear()
+	case "delete_session":
+		return m.SessionStore.Delete(req.PostForm.Get("session_id"))
+	case "revoke_session":
+		return m.RevokeSession(req.PostForm.Get("session_id"))
+	case "reset":
+		return m.Reset()
+	default:
+		return fmt.Errorf("unknown admin action: %s", action)
+	}
+	return nil
+}
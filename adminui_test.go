@@ -0,0 +1,120 @@
+package mockoidc_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_AdminUI(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ServeAdminUI = true
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start(ln, nil))
+	defer m.Shutdown()
+	endpoint := m.Addr() + mockoidc.AdminUIEndpoint
+
+	post := func(form url.Values) *http.Response {
+		resp, err := httpClient.PostForm(endpoint, form)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	page := func() string {
+		resp, err := httpClient.Get(endpoint)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return string(body)
+	}
+
+	registered := m.RegisterTestClient(t)
+	m.ClientStore.(*mockoidc.MemoryClientStore).Add(&mockoidc.Client{ID: "spa"})
+
+	body := page()
+	assert.Contains(t, body, `<code data-testid="client-id">`+m.ClientID+`</code>`)
+	assert.Contains(t, body, `<code data-testid="client-id">`+registered.ID+`</code>`)
+	assert.Contains(t, body, `<code data-testid="client-secret">`+registered.Secret+`</code>`)
+	assert.Contains(t, body, `<code data-testid="client-id">spa</code>`)
+	assert.Contains(t, body, "None, the default user logs in")
+
+	resp := post(url.Values{
+		"action":  {"queue_user"},
+		"subject": {"qa-1"},
+		"email":   {"qa@example.com"},
+		"groups":  {"qa, admins"},
+	})
+	assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+	assert.Equal(t, mockoidc.AdminUIEndpoint, resp.Header.Get("Location"))
+	post(url.Values{"action": {"queue_error"}, "code": {"503"}, "error": {"temporarily_unavailable"}})
+
+	body = page()
+	assert.Contains(t, body, "qa@example.com")
+	assert.Contains(t, body, "temporarily_unavailable")
+	// Rendering the UI doesn't consume the queued error
+	assert.Len(t, m.ErrorQueue.Queue, 1)
+
+	user := m.UserQueue.Pop().(*mockoidc.MockUser)
+	assert.Equal(t, []string{"qa", "admins"}, user.Groups)
+
+	session, err := m.SessionStore.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+	assert.Contains(t, page(), session.SessionID)
+	assert.Contains(t, page(), `data-testid="revoke-session"`)
+	post(url.Values{"action": {"revoke_session"}, "session_id": {session.SessionID}})
+	revoked, err := m.SessionStore.GetSessionByID(session.SessionID)
+	assert.NoError(t, err)
+	assert.True(t, revoked.Revoked)
+	assert.NotContains(t, page(), `data-testid="revoke-session"`)
+	post(url.Values{"action": {"delete_session"}, "session_id": {session.SessionID}})
+	_, err = m.SessionStore.GetSessionByID(session.SessionID)
+	assert.Error(t, err)
+
+	post(url.Values{"action": {"clear_errors"}})
+	assert.Empty(t, m.ErrorQueue.Queue)
+
+	resp = post(url.Values{"action": {"explode"}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	req, err := http.NewRequest(http.MethodDelete, endpoint, nil)
+	assert.NoError(t, err)
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestMockOIDC_AdminUI_Disabled(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	resp, err := httpClient.Get(m.Addr() + mockoidc.AdminUIEndpoint)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestMemorySessionStore_Sessions(t *testing.T) {
+	ss := mockoidc.NewSessionStore()
+	for i := 0; i < 3; i++ {
+		_, err := ss.NewSession("openid", "", mockoidc.DefaultUser())
+		assert.NoError(t, err)
+	}
+
+	sessions := ss.Sessions()
+	assert.Len(t, sessions, 3)
+	assert.True(t, strings.Compare(sessions[0].SessionID, sessions[1].SessionID) < 0)
+	assert.True(t, strings.Compare(sessions[1].SessionID, sessions[2].SessionID) < 0)
+}
@@ -0,0 +1,54 @@
+package mockoidc
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// accessTokenClaims are the claims of an access token with an explicit
+// audience besides the client
+type accessTokenClaims struct {
+	*jwt.StandardClaims
+	Audience []string `json:"aud"`
+}
+
+// audiences returns the `aud` of a token, be it a string or an array
+func audiences(claims jwt.MapClaims) []string {
+	switch aud := claims["aud"].(type) {
+	case string:
+		return []string{aud}
+	case []interface{}:
+		auds := make([]string, 0, len(aud))
+		for _, a := range aud {
+			if s, ok := a.(string); ok {
+				auds = append(auds, s)
+			}
+		}
+		return auds
+	}
+	return nil
+}
+
+// checkUserinfoAudience rejects userinfo requests with tokens lacking the
+// AccessTokenAudience, like ID tokens sent as bearer tokens. It returns
+// false if it already responded.
+func (m *MockOIDC) checkUserinfoAudience(token *jwt.Token, rw http.ResponseWriter) bool {
+	audience := m.Config().AccessTokenAudience
+	if audience == "" {
+		return true
+	}
+	claims, _ := token.Claims.(jwt.MapClaims)
+	if containsString(audiences(claims), audience) {
+		return true
+	}
+	if m.LenientAudience {
+		m.logger().Info("accepted token for another audience", "audience", audiences(claims))
+		return true
+	}
+	description := fmt.Sprintf("The token wasn't issued for %s", audience)
+	bearerChallenge(rw, InvalidToken, description)
+	errorResponse(rw, InvalidToken, description, http.StatusUnauthorized)
+	return false
+}
@@ -0,0 +1,41 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_AccessTokenAudience(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.AccessTokenAudience = "https://api.example.com"
+	tokens, err := m.SeedSession(nil, nil, nil)
+	assert.NoError(t, err)
+
+	claims := m.DecodeToken(t, tokens.AccessToken)
+	assert.Equal(t, []interface{}{m.ClientID, "https://api.example.com"}, claims["aud"])
+	assert.Equal(t, m.ClientID, tokens.IDTokenClaims["aud"])
+
+	userinfo := func(token string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		m.Userinfo(rr, req)
+		return rr
+	}
+	assert.Equal(t, http.StatusOK, userinfo(tokens.AccessToken).Code)
+
+	// ID tokens sent as bearer tokens are for the client only
+	rr := userinfo(tokens.IDToken)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t,
+		`Bearer error="invalid_token", error_description="The token wasn't issued for https://api.example.com"`,
+		rr.Header().Get("WWW-Authenticate"))
+
+	m.LenientAudience = true
+	assert.Equal(t, http.StatusOK, userinfo(tokens.IDToken).Code)
+}
@@ -0,0 +1,183 @@
+package mockoidc
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ServerBuilder collects a MockOIDC's configuration fluently and validates
+// it as a whole in Build, e.g.
+//
+//	m, err := mockoidc.Builder().
+//		Client("my-client", "my-secret").
+//		User(user).
+//		TTL(time.Minute, time.Hour).
+//		Build()
+type ServerBuilder struct {
+	opts    []Option
+	clients []*Client
+	users   []User
+
+	clientID     string
+	clientSecret string
+	clientSet    bool
+	accessTTL    time.Duration
+	refreshTTL   time.Duration
+	scopes       []string
+	compliance   ComplianceMode
+}
+
+// Builder starts configuring a MockOIDC
+func Builder() *ServerBuilder {
+	return &ServerBuilder{}
+}
+
+// Client sets the credentials of the MockOIDC's own client
+func (b *ServerBuilder) Client(clientID, clientSecret string) *ServerBuilder {
+	b.clientID, b.clientSecret, b.clientSet = clientID, clientSecret, true
+	b.opts = append(b.opts, WithClientCredentials(clientID, clientSecret))
+	return b
+}
+
+// RegisterClient adds a Client to the ClientStore
+func (b *ServerBuilder) RegisterClient(client *Client) *ServerBuilder {
+	b.clients = append(b.clients, client)
+	return b
+}
+
+// User queues a User to log in
+func (b *ServerBuilder) User(user User) *ServerBuilder {
+	b.users = append(b.users, user)
+	return b
+}
+
+// TTL sets the AccessTTL & RefreshTTL
+func (b *ServerBuilder) TTL(access, refresh time.Duration) *ServerBuilder {
+	b.accessTTL, b.refreshTTL = access, refresh
+	b.opts = append(b.opts, WithAccessTTL(access), WithRefreshTTL(refresh))
+	return b
+}
+
+// Scopes sets the scopes the server accepts & advertises
+func (b *ServerBuilder) Scopes(scopes ...string) *ServerBuilder {
+	b.scopes = scopes
+	b.opts = append(b.opts, WithScopes(scopes...))
+	return b
+}
+
+// Compliance sets the ComplianceMode
+func (b *ServerBuilder) Compliance(mode ComplianceMode) *ServerBuilder {
+	b.compliance = mode
+	b.opts = append(b.opts, func(m *MockOIDC) error {
+		m.Compliance = mode
+		return nil
+	})
+	return b
+}
+
+// FAPIMode enables the FAPIMode. The configured client gets a random ES256
+// ClientKeypair unless one is set.
+func (b *ServerBuilder) FAPIMode() *ServerBuilder {
+	b.opts = append(b.opts, func(m *MockOIDC) error {
+		m.FAPIMode = true
+		if m.ClientKeypair != nil {
+			return nil
+		}
+		var err error
+		m.ClientKeypair, err = NewECKeypair(nil)
+		return err
+	})
+	return b
+}
+
+// Keypair signs tokens with the Keypair
+func (b *ServerBuilder) Keypair(keypair *Keypair) *ServerBuilder {
+	b.opts = append(b.opts, WithKeypair(keypair))
+	return b
+}
+
+// With applies any other Options
+func (b *ServerBuilder) With(opts ...Option) *ServerBuilder {
+	b.opts = append(b.opts, opts...)
+	return b
+}
+
+// Build validates the configuration and creates the (unstarted) MockOIDC.
+// All problems found are reported in the error.
+func (b *ServerBuilder) Build() (*MockOIDC, error) {
+	if problems := b.validate(); len(problems) > 0 {
+		return nil, fmt.Errorf("mockoidc: invalid configuration: %s",
+			strings.Join(problems, "; "))
+	}
+
+	m, err := New(b.opts...)
+	if err != nil {
+		return nil, fmt.Errorf("mockoidc: invalid configuration: %v", err)
+	}
+	if len(b.clients) > 0 {
+		store, ok := m.ClientStore.(*MemoryClientStore)
+		if !ok {
+			return nil, fmt.Errorf("mockoidc: invalid configuration: " +
+				"clients can only be registered in a MemoryClientStore")
+		}
+		for _, client := range b.clients {
+			store.Add(client)
+		}
+	}
+	for _, user := range b.users {
+		m.QueueUser(user)
+	}
+	return m, nil
+}
+
+// validate checks the settings combine into a working configuration
+func (b *ServerBuilder) validate() []string {
+	var problems []string
+	if b.refreshTTL > 0 && b.refreshTTL < b.accessTTL {
+		problems = append(problems, fmt.Sprintf(
+			"refresh ttl %s is shorter than the access ttl %s", b.refreshTTL, b.accessTTL))
+	}
+	if b.scopes != nil && !containsString(b.scopes, "openid") {
+		problems = append(problems, "scopes must include openid")
+	}
+
+	seen := make(map[string]bool)
+	for _, client := range b.clients {
+		switch {
+		case client.ID == "":
+			problems = append(problems, "registered client has no id")
+		case seen[client.ID] || client.ID == b.clientID:
+			problems = append(problems, fmt.Sprintf("client %s is registered twice", client.ID))
+		}
+		seen[client.ID] = true
+	}
+	for _, user := range b.users {
+		if user == nil || user.ID() == "" {
+			problems = append(problems, "queued user has no subject")
+		}
+	}
+
+	if _, ok := ParseComplianceMode(string(b.compliance)); !ok {
+		problems = append(problems, fmt.Sprintf("unknown compliance mode %s", b.compliance))
+	}
+	if b.compliance == ComplianceStrict && !b.hasPublicClient() {
+		problems = append(problems,
+			"strict compliance requires PKCE, but no public client (without a secret) is registered")
+	}
+	return problems
+}
+
+// hasPublicClient reports whether the MockOIDC's own client or a registered
+// one has no secret, as the public clients PKCE protects
+func (b *ServerBuilder) hasPublicClient() bool {
+	if b.clientSet && b.clientSecret == "" {
+		return true
+	}
+	for _, client := range b.clients {
+		if client.Secret == "" {
+			return true
+		}
+	}
+	return false
+}
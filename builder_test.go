@@ -0,0 +1,83 @@
+package mockoidc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuilder(t *testing.T) {
+	m, err := mockoidc.Builder().
+		Client("my-client", "my-secret").
+		RegisterClient(&mockoidc.Client{ID: "other-client", Secret: "other-secret"}).
+		User(&mockoidc.MockUser{Subject: "built"}).
+		TTL(time.Minute, time.Hour).
+		Scopes("openid", "email").
+		Build()
+	assert.NoError(t, err)
+	assert.Equal(t, "my-client", m.ClientID)
+	assert.Equal(t, time.Minute, m.AccessTTL)
+	_, err = m.ClientStore.GetClient("other-client")
+	assert.NoError(t, err)
+
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "built", tokens.IDTokenClaims["sub"])
+}
+
+func TestBuilder_Invalid(t *testing.T) {
+	_, err := mockoidc.Builder().
+		Client("my-client", "my-secret").
+		RegisterClient(&mockoidc.Client{ID: "my-client"}).
+		RegisterClient(&mockoidc.Client{}).
+		User(&mockoidc.MockUser{}).
+		TTL(time.Hour, time.Minute).
+		Scopes("email").
+		Build()
+	assert.EqualError(t, err, "mockoidc: invalid configuration: "+
+		"refresh ttl 1m0s is shorter than the access ttl 1h0m0s; "+
+		"scopes must include openid; "+
+		"client my-client is registered twice; "+
+		"registered client has no id; "+
+		"queued user has no subject")
+
+	_, err = mockoidc.Builder().TTL(0, time.Hour).Build()
+	assert.EqualError(t, err, "mockoidc: invalid configuration: access ttl 0s is not positive")
+}
+
+func TestBuilder_PKCEClients(t *testing.T) {
+	_, err := mockoidc.Builder().
+		Client("my-client", "my-secret").
+		Compliance(mockoidc.ComplianceStrict).
+		Build()
+	assert.EqualError(t, err, "mockoidc: invalid configuration: "+
+		"strict compliance requires PKCE, but no public client (without a secret) is registered")
+
+	// FAPI requires PKCE from confidential clients too
+	m, err := mockoidc.Builder().Client("my-client", "my-secret").FAPIMode().Build()
+	assert.NoError(t, err)
+	assert.True(t, m.FAPIMode)
+	assert.Equal(t, "ES256", m.ClientKeypair.Alg)
+
+	_, err = mockoidc.Builder().Compliance("pedantic").Build()
+	assert.EqualError(t, err, "mockoidc: invalid configuration: unknown compliance mode pedantic")
+
+	m, err = mockoidc.Builder().
+		Compliance(mockoidc.ComplianceStrict).
+		RegisterClient(&mockoidc.Client{ID: "spa"}).
+		Build()
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.ComplianceStrict, m.Compliance)
+
+	// The public client strict compliance requires can log in
+	m, err = mockoidc.Builder().
+		Client("public-client", "").
+		Compliance(mockoidc.ComplianceStrict).
+		Build()
+	assert.NoError(t, err)
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "public-client", tokens.IDTokenClaims["aud"])
+}
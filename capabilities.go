@@ -0,0 +1,101 @@
+package mockoidc
+
+import (
+	"net/http"
+	"strings"
+)
+
+// capability is a protocol feature MockOIDC implements, e.g. a grant type.
+// Handlers accept and the discovery document advertises the capabilities
+// that are both supported by the instance's metadata and enabled by its
+// features, so the two can't diverge.
+type capability struct {
+	name string
+	// enabled reports whether the MockOIDC's features turn the capability
+	// on. Nil means it is always available.
+	enabled func(*MockOIDC) bool
+}
+
+func (c *capability) on(m *MockOIDC) bool {
+	return c.enabled == nil || c.enabled(m)
+}
+
+// grant is a `grant_type` of the `token_endpoint`. validate checks the
+// grant's parameters and returns the Session to issue tokens for, or false
+// if it already responded.
+type grant struct {
+	capability
+	validate func(*MockOIDC, http.ResponseWriter, *http.Request) (*Session, bool)
+}
+
+// grantRegistry holds the grant types the `token_endpoint` implements
+var grantRegistry = []*grant{
+	{capability{name: "authorization_code"}, (*MockOIDC).validateCodeGrant},
+	{capability{name: "refresh_token"}, (*MockOIDC).validateRefreshGrant},
+	{capability{clientCredentialsGrant, (*MockOIDC).clientCredentialsEnabled},
+		(*MockOIDC).validateClientCredentialsGrant},
+	{capability{deviceCodeGrant, (*MockOIDC).deviceFlowEnabled}, (*MockOIDC).validateDeviceCodeGrant},
+}
+
+// responseTypeRegistry holds the `response_type`s the
+// `authorization_endpoint` implements
+var responseTypeRegistry = []*capability{
+	{name: "code"},
+	{"id_token", (*MockOIDC).implicitFlowEnabled},
+	{"token", (*MockOIDC).implicitFlowEnabled},
+	{"id_token token", (*MockOIDC).implicitFlowEnabled},
+	{"code id_token", (*MockOIDC).hybridFlowEnabled},
+	{"code token", (*MockOIDC).hybridFlowEnabled},
+	{"code id_token token", (*MockOIDC).hybridFlowEnabled},
+}
+
+func (m *MockOIDC) clientCredentialsEnabled() bool { return !m.DisableClientCredentials }
+func (m *MockOIDC) deviceFlowEnabled() bool        { return !m.DisableDeviceFlow }
+func (m *MockOIDC) implicitFlowEnabled() bool      { return !m.DisableImplicitFlow }
+func (m *MockOIDC) hybridFlowEnabled() bool        { return !m.DisableHybridFlow }
+
+// grantTypes returns the supported grant types that are enabled, in the
+// order of the metadata
+func (m *MockOIDC) grantTypes(md *metadata) []string {
+	grantTypes := make([]string, 0, len(md.grantTypes))
+	for _, grantType := range md.grantTypes {
+		if m.grant(md, grantType) != nil {
+			grantTypes = append(grantTypes, grantType)
+		}
+	}
+	return grantTypes
+}
+
+// grant looks up the grant type if it is supported and enabled
+func (m *MockOIDC) grant(md *metadata, grantType string) *grant {
+	if !containsString(md.grantTypes, grantType) {
+		return nil
+	}
+	for _, g := range grantRegistry {
+		if g.name == grantType && g.on(m) {
+			return g
+		}
+	}
+	return nil
+}
+
+// capabilitiesKey identifies the enabled capabilities, for caches of
+// responses advertising them
+func (m *MockOIDC) capabilitiesKey(md *metadata) string {
+	return strings.Join(m.grantTypes(md), ",") + "|" + strings.Join(m.responseTypes(md), ",")
+}
+
+// responseTypes returns the supported `response_type`s that are enabled, in
+// the order of the metadata
+func (m *MockOIDC) responseTypes(md *metadata) []string {
+	responseTypes := make([]string, 0, len(md.responseTypes))
+	for _, responseType := range md.responseTypes {
+		for _, c := range responseTypeRegistry {
+			if c.name == responseType && c.on(m) {
+				responseTypes = append(responseTypes, responseType)
+				break
+			}
+		}
+	}
+	return responseTypes
+}
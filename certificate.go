@@ -0,0 +1,184 @@
+package mockoidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"time"
+)
+
+// DefaultCertificateHosts are the SANs a Certificate is minted for when
+// no hosts are passed to `NewCertificate`
+var DefaultCertificateHosts = []string{"127.0.0.1", "::1", "localhost"}
+
+// Certificate is a throwaway CA and a server certificate signed by it. It
+// lets TLS MockOIDC servers be trusted by browsers & clients in e2e test
+// environments by importing the CA PEM.
+type Certificate struct {
+	CA         *x509.Certificate
+	CAKey      crypto.Signer
+	Leaf       *x509.Certificate
+	PrivateKey crypto.Signer
+}
+
+// NewCertificate mints a CA and a server certificate valid for the passed
+// hosts. Hosts that parse as IP addresses are added as IP SANs; all others
+// are added as DNS SANs (e.g. `idp.test.local`).
+func NewCertificate(hosts ...string) (*Certificate, error) {
+	if len(hosts) == 0 {
+		hosts = DefaultCertificateHosts
+	}
+	// TLS stacks verify against the wall clock, not MockOIDC's view of time
+	now := time.Now()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate, err := certificateTemplate(now)
+	if err != nil {
+		return nil, err
+	}
+	caTemplate.Subject = pkix.Name{CommonName: "mockoidc CA"}
+	caTemplate.IsCA = true
+	caTemplate.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	caTemplate.BasicConstraintsValid = true
+
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return nil, err
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	leafTemplate, err := certificateTemplate(now)
+	if err != nil {
+		return nil, err
+	}
+	leafTemplate.Subject = pkix.Name{CommonName: hosts[0]}
+	leafTemplate.KeyUsage = x509.KeyUsageDigitalSignature
+	leafTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			leafTemplate.IPAddresses = append(leafTemplate.IPAddresses, ip)
+		} else {
+			leafTemplate.DNSNames = append(leafTemplate.DNSNames, host)
+		}
+	}
+
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, leafKey.Public(), caKey)
+	if err != nil {
+		return nil, err
+	}
+	leaf, err := x509.ParseCertificate(leafDER)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Certificate{
+		CA:         ca,
+		CAKey:      caKey,
+		Leaf:       leaf,
+		PrivateKey: leafKey,
+	}, nil
+}
+
+// TLSConfig returns a server tls.Config presenting the leaf certificate.
+// Pass it to `RunTLS` or `Start`. Clients may present any certificate for
+// `tls_client_auth` and certificate-bound tokens.
+func (c *Certificate) TLSConfig() *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{{
+			Certificate: [][]byte{c.Leaf.Raw, c.CA.Raw},
+			PrivateKey:  c.PrivateKey,
+			Leaf:        c.Leaf,
+		}},
+		ClientAuth: tls.RequestClientCert,
+	}
+}
+
+// ClientCertificate mints a client certificate signed by the CA for test
+// clients' `tls.Config.Certificates`. Its subject DN, e.g. `CN=client` for
+// the common name `client`, is a Client's `TLSClientAuthSubjectDN`.
+func (c *Certificate) ClientCertificate(commonName string) (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template, err := certificateTemplate(time.Now())
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	template.Subject = pkix.Name{CommonName: commonName}
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, c.CA, key.Public(), c.CAKey)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{
+		Certificate: [][]byte{der, c.CA.Raw},
+		PrivateKey:  key,
+		Leaf:        leaf,
+	}, nil
+}
+
+// CertPool returns an x509.CertPool trusting the CA for use in test
+// clients' `tls.Config.RootCAs`.
+func (c *Certificate) CertPool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.CA)
+	return pool
+}
+
+// CAPEM returns the PEM encoded CA certificate
+func (c *Certificate) CAPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.CA.Raw})
+}
+
+// CertificatePEM returns the PEM encoded certificate chain (leaf + CA)
+func (c *Certificate) CertificatePEM() []byte {
+	return append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Leaf.Raw}),
+		c.CAPEM()...,
+	)
+}
+
+// PrivateKeyPEM returns the PEM encoded PKCS #8 private key of the leaf
+func (c *Certificate) PrivateKeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(c.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+func certificateTemplate(now time.Time) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	return &x509.Certificate{
+		SerialNumber: serial,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(24 * time.Hour),
+	}, nil
+}
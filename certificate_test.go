@@ -0,0 +1,77 @@
+package mockoidc_test
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCertificate(t *testing.T) {
+	cert, err := mockoidc.NewCertificate("idp.test.local", "10.1.2.3")
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"idp.test.local"}, cert.Leaf.DNSNames)
+	assert.Len(t, cert.Leaf.IPAddresses, 1)
+	assert.True(t, cert.Leaf.IPAddresses[0].Equal(net.ParseIP("10.1.2.3")))
+	assert.True(t, cert.CA.IsCA)
+
+	for _, host := range []string{"idp.test.local", "10.1.2.3"} {
+		_, err = cert.Leaf.Verify(x509.VerifyOptions{
+			DNSName: host,
+			Roots:   cert.CertPool(),
+		})
+		assert.NoError(t, err)
+	}
+	_, err = cert.Leaf.Verify(x509.VerifyOptions{
+		DNSName: "other.test.local",
+		Roots:   cert.CertPool(),
+	})
+	assert.Error(t, err)
+}
+
+func TestCertificate_PEM(t *testing.T) {
+	cert, err := mockoidc.NewCertificate()
+	assert.NoError(t, err)
+
+	block, rest := pem.Decode(cert.CAPEM())
+	assert.NotNil(t, block)
+	assert.Empty(t, rest)
+	assert.Equal(t, cert.CA.Raw, block.Bytes)
+
+	leafBlock, rest := pem.Decode(cert.CertificatePEM())
+	assert.NotNil(t, leafBlock)
+	assert.Equal(t, cert.Leaf.Raw, leafBlock.Bytes)
+	caBlock, _ := pem.Decode(rest)
+	assert.NotNil(t, caBlock)
+	assert.Equal(t, cert.CA.Raw, caBlock.Bytes)
+
+	keyPEM, err := cert.PrivateKeyPEM()
+	assert.NoError(t, err)
+	_, err = tls.X509KeyPair(cert.CertificatePEM(), keyPEM)
+	assert.NoError(t, err)
+}
+
+func TestCertificate_TLSConfig(t *testing.T) {
+	cert, err := mockoidc.NewCertificate()
+	assert.NoError(t, err)
+
+	m, err := mockoidc.RunTLS(cert.TLSConfig())
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{RootCAs: cert.CertPool()},
+		},
+	}
+	resp, err := client.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
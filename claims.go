@@ -0,0 +1,280 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// ClaimsRequest is the `claims` parameter of an authorization request (OIDC
+// Core §5.5), requesting individual claims for the userinfo response & the
+// ID token on top of the ones the scopes release. Value constraints aren't
+// checked.
+type ClaimsRequest struct {
+	Userinfo map[string]*IndividualClaimRequest `json:"userinfo,omitempty"`
+	IDToken  map[string]*IndividualClaimRequest `json:"id_token,omitempty"`
+}
+
+// IndividualClaimRequest is a claim's entry of a ClaimsRequest. It is nil for
+// claims requested with `null`.
+type IndividualClaimRequest struct {
+	Essential bool          `json:"essential,omitempty"`
+	Value     interface{}   `json:"value,omitempty"`
+	Values    []interface{} `json:"values,omitempty"`
+}
+
+// ClaimsTarget is the response claims are released to
+type ClaimsTarget string
+
+const (
+	ClaimsIDToken  ClaimsTarget = "id_token"
+	ClaimsUserinfo ClaimsTarget = "userinfo"
+)
+
+// ClaimDecision explains whether a claim of the User was released
+type ClaimDecision struct {
+	// Claim is the name of the claim as the User returns it
+	Claim string
+	// As is the name the claim is released under after the client's
+	// `ClaimMappings`
+	As       string
+	Released bool
+	Reason   string
+}
+
+// standardClaims are always released to ID tokens, under their own name
+var standardClaims = []string{"iss", "sub", "aud", "exp", "iat", "nbf", "jti", "nonce"}
+
+// parseClaimsRequest validates the `claims` parameter of an authorization
+// request. It returns false if it already responded.
+func (m *MockOIDC) parseClaimsRequest(rw http.ResponseWriter, req *http.Request) (*ClaimsRequest, bool) {
+	param := req.Form.Get("claims")
+	if param == "" {
+		return nil, true
+	}
+	cr := &ClaimsRequest{}
+	if err := json.Unmarshal([]byte(param), cr); err != nil {
+		m.authorizeError(rw, req, InvalidRequest,
+			fmt.Sprintf("Invalid claims parameter: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+	return cr, true
+}
+
+// ExplainClaims tells why each claim of the Session's User is or isn't
+// released to the target, sorted by claim, for tests debugging missing
+// claims. Requested claims the User has no value for are listed as well.
+func (m *MockOIDC) ExplainClaims(sessionID string, target ClaimsTarget) ([]ClaimDecision, error) {
+	session, err := m.SessionStore.GetSessionByID(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	config := m.Config()
+	var base *IDTokenClaims
+	if target == ClaimsIDToken {
+		base = session.idTokenClaims(config, m.Now())
+	}
+	_, decisions, err := m.releaseClaims(session, target, base, config)
+	return decisions, err
+}
+
+// releaseClaims is the one pipeline deciding the claims of ID tokens (with
+// the base claims) & userinfo responses: the claims released for the
+// Session's scopes, plus the ones requested with the `claims` parameter,
+// renamed or dropped by the client's `ClaimMappings`.
+func (m *MockOIDC) releaseClaims(session *Session, target ClaimsTarget, base *IDTokenClaims,
+	config *Config) (map[string]interface{}, []ClaimDecision, error) {
+
+	scoped, err := userClaims(session.User, target, session.Scopes, base)
+	if err != nil {
+		return nil, nil, err
+	}
+	all, err := userClaims(session.User, target,
+		append(copyStrings(m.supported().scopes), session.Scopes...), base)
+	if err != nil {
+		return nil, nil, err
+	}
+	for name, value := range scoped {
+		all[name] = value
+	}
+	requested := session.ClaimsRequest.claims(target)
+	mappings, err := m.claimMappings(session, config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	for name := range requested {
+		if _, ok := all[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	released := make(map[string]interface{}, len(scoped))
+	decisions := make([]ClaimDecision, 0, len(names))
+	for _, name := range names {
+		decision := ClaimDecision{Claim: name, As: name}
+		_, inScope := scoped[name]
+		_, isRequested := requested[name]
+		value, hasValue := all[name]
+		standard := containsString(standardClaims, name)
+		switch {
+		case !hasValue:
+			decision.Reason = "requested with the claims parameter, but the user has no value"
+		case standard:
+			decision.Released, decision.Reason = true, "standard claim"
+		case inScope:
+			decision.Released, decision.Reason = true, scopeReason(name)
+		case isRequested:
+			decision.Released, decision.Reason = true, "requested with the claims parameter"
+		default:
+			decision.Reason = fmt.Sprintf("not released for the scopes %q nor requested",
+				strings.Join(session.Scopes, " "))
+		}
+		if mapped, ok := mappings[name]; ok && decision.Released && !standard {
+			if mapped == "" {
+				decision.Released = false
+				decision.Reason = "dropped by the client's ClaimMappings"
+			} else {
+				decision.As = mapped
+				decision.Reason += ", renamed to " + mapped + " by the client's ClaimMappings"
+			}
+		}
+		if decision.Released {
+			released[decision.As] = value
+		}
+		decisions = append(decisions, decision)
+	}
+	if m.ShapeClaims != nil {
+		decisions = m.shapeClaims(released, decisions, session, target)
+	}
+	return released, decisions, nil
+}
+
+// shapeClaims runs ShapeClaims on the released claims & records the claims
+// it added or removed
+func (m *MockOIDC) shapeClaims(released map[string]interface{}, decisions []ClaimDecision,
+	session *Session, target ClaimsTarget) []ClaimDecision {
+
+	before := make(map[string]bool, len(released))
+	for name := range released {
+		before[name] = true
+	}
+	m.ShapeClaims(released, session, target)
+
+	for i := range decisions {
+		if _, ok := released[decisions[i].As]; decisions[i].Released && !ok {
+			decisions[i].Released = false
+			decisions[i].Reason = "removed by ShapeClaims"
+		}
+	}
+	added := false
+	for name := range released {
+		if !before[name] {
+			decisions = append(decisions, ClaimDecision{
+				Claim: name, As: name, Released: true, Reason: "added by ShapeClaims",
+			})
+			added = true
+		}
+	}
+	if added {
+		sort.Slice(decisions, func(i, j int) bool {
+			return decisions[i].Claim < decisions[j].Claim
+		})
+	}
+	return decisions
+}
+
+func scopeReason(claim string) string {
+	if scope, ok := claimScopes[claim]; ok {
+		return fmt.Sprintf("released for the %s scope", scope)
+	}
+	return "released for every scope"
+}
+
+// userClaims returns the claims the User releases to the target for the
+// scopes
+func userClaims(user User, target ClaimsTarget, scopes []string,
+	base *IDTokenClaims) (map[string]interface{}, error) {
+
+	var (
+		data []byte
+		err  error
+	)
+	if target == ClaimsIDToken {
+		// The User builds off the base, so each call gets its own copy
+		copied := *base
+		if base.StandardClaims != nil {
+			standard := *base.StandardClaims
+			copied.StandardClaims = &standard
+		}
+		var claims jwt.Claims
+		if claims, err = user.Claims(scopes, &copied); err != nil {
+			return nil, err
+		}
+		data, err = json.Marshal(claims)
+	} else {
+		data, err = user.Userinfo(scopes)
+	}
+	if err != nil {
+		return nil, err
+	}
+	claims := map[string]interface{}{}
+	if err = json.Unmarshal(data, &claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// claims returns the claims requested for the target, if any
+func (cr *ClaimsRequest) claims(target ClaimsTarget) map[string]*IndividualClaimRequest {
+	if cr == nil {
+		return nil
+	}
+	if target == ClaimsIDToken {
+		return cr.IDToken
+	}
+	return cr.Userinfo
+}
+
+// claimMappings returns the `ClaimMappings` of the Session's client
+func (m *MockOIDC) claimMappings(session *Session, config *Config) (map[string]string, error) {
+	clientID := session.ClientID
+	if clientID == "" {
+		clientID = config.ClientID
+	}
+	// The config of a token request carries the requesting client instead
+	// of the MockOIDC's own
+	client, err := m.lookupClient(m.Config(), clientID)
+	if errors.Is(err, ErrUnknownClient) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client.ClaimMappings, nil
+}
+
+// idToken signs the Session's ID token with the released claims, plus the
+// `at_hash` & `c_hash` of the implicit & hybrid flows, if any
+func (m *MockOIDC) idToken(session *Session, config *Config, hashes map[string]interface{}) (string, error) {
+	base := session.idTokenClaims(config, m.Now())
+	claims, _, err := m.releaseClaims(session, ClaimsIDToken, base, config)
+	if err != nil {
+		return "", err
+	}
+	for name, hash := range hashes {
+		claims[name] = hash
+	}
+	m.fapiIDTokenClaims(session, claims)
+	return m.signingKey().SignJWT(jwt.MapClaims(claims))
+}
@@ -0,0 +1,111 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_ReleaseClaims(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	m.ClientStore.(*mockoidc.MemoryClientStore).Add(&mockoidc.Client{
+		ID:            "mapped-client",
+		Secret:        "mapped-secret",
+		ClaimMappings: map[string]string{"groups": "roles", "phone_number": "", "sub": "id"},
+	})
+
+	authorize := func(claims string) *url.URL {
+		resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+			"client_id":     {"mapped-client"},
+			"response_type": {"code"},
+			"redirect_uri":  {"https://app.example.com/callback"},
+			"scope":         {"openid profile groups"},
+			"state":         {"state"},
+			"claims":        {claims},
+		}.Encode())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		location, err := resp.Location()
+		assert.NoError(t, err)
+		return location
+	}
+	location := authorize(`{"userinfo":{"email":null},"id_token":{"email":{"essential":true},"acr":null}}`)
+	code := location.Query().Get("code")
+
+	resp, err := httpClient.PostForm(m.TokenEndpoint(), url.Values{
+		"client_id":     {"mapped-client"},
+		"client_secret": {"mapped-secret"},
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+	})
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+
+	claims := m.DecodeToken(t, tokens.IDToken)
+	assert.Equal(t, "jane.doe@example.com", claims["email"])
+	assert.Equal(t, "jane.doe", claims["preferred_username"])
+	assert.Equal(t, []interface{}{"engineering", "design"}, claims["roles"])
+	assert.Equal(t, "1234567890", claims["sub"])
+	for _, claim := range []string{"groups", "phone_number", "email_verified", "acr", "id"} {
+		assert.NotContains(t, claims, claim)
+	}
+
+	req, err := http.NewRequest(http.MethodGet, m.UserinfoEndpoint(), nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	userinfo := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&userinfo))
+	assert.Equal(t, map[string]interface{}{
+		"email":              "jane.doe@example.com",
+		"preferred_username": "jane.doe",
+		"address":            "123 Main Street",
+		"roles":              []interface{}{"engineering", "design"},
+	}, userinfo)
+
+	decisions, err := m.ExplainClaims(code, mockoidc.ClaimsIDToken)
+	assert.NoError(t, err)
+	reasons := map[string]mockoidc.ClaimDecision{}
+	for _, decision := range decisions {
+		reasons[decision.Claim] = decision
+	}
+	assert.Equal(t, mockoidc.ClaimDecision{
+		Claim: "acr", As: "acr",
+		Reason: "requested with the claims parameter, but the user has no value",
+	}, reasons["acr"])
+	assert.Equal(t, mockoidc.ClaimDecision{
+		Claim: "email", As: "email", Released: true,
+		Reason: "requested with the claims parameter",
+	}, reasons["email"])
+	assert.Equal(t, mockoidc.ClaimDecision{
+		Claim: "email_verified", As: "email_verified",
+		Reason: `not released for the scopes "openid profile groups" nor requested`,
+	}, reasons["email_verified"])
+	assert.Equal(t, mockoidc.ClaimDecision{
+		Claim: "groups", As: "roles", Released: true,
+		Reason: "released for the groups scope, renamed to roles by the client's ClaimMappings",
+	}, reasons["groups"])
+	assert.Equal(t, mockoidc.ClaimDecision{
+		Claim: "phone_number", As: "phone_number",
+		Reason: "dropped by the client's ClaimMappings",
+	}, reasons["phone_number"])
+	assert.Equal(t, mockoidc.ClaimDecision{
+		Claim: "sub", As: "sub", Released: true, Reason: "standard claim",
+	}, reasons["sub"])
+
+	location = authorize("{not json")
+	assert.Equal(t, mockoidc.InvalidRequest, location.Query().Get("error"))
+	assert.True(t, strings.HasPrefix(location.Query().Get("error_description"), "Invalid claims parameter"))
+}
@@ -0,0 +1,166 @@
+package mockoidc
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// JWTBearerAssertionType is the `client_assertion_type` of `private_key_jwt`
+// client authentication (RFC 7523 §2.2)
+const JWTBearerAssertionType = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+// authenticateClient checks the credentials of the client's
+// `usedAuthMethod`: the signature of its `private_key_jwt` assertion, the
+// subject of its `tls_client_auth` certificate or its secret.
+func (m *MockOIDC) authenticateClient(config *Config, client *Client, rw http.ResponseWriter, req *http.Request) bool {
+	switch m.usedAuthMethod(req) {
+	case "private_key_jwt":
+		if assertionType := req.Form.Get("client_assertion_type"); assertionType != JWTBearerAssertionType {
+			errorResponse(rw, InvalidClient,
+				fmt.Sprintf("Unsupported client_assertion_type: %s", assertionType), http.StatusUnauthorized)
+			return false
+		}
+		audiences := []string{config.Issuer, m.requestAddr(req) + req.URL.Path}
+		if _, err := m.verifyClientJWT(client, req.Form.Get("client_assertion"), audiences, true); err != nil {
+			errorResponse(rw, InvalidClient, fmt.Sprintf("Invalid client assertion: %v", err),
+				http.StatusUnauthorized)
+			return false
+		}
+		return true
+	case "tls_client_auth":
+		cert := clientCertificate(req)
+		if cert == nil {
+			errorResponse(rw, InvalidClient, "The client certificate is missing", http.StatusUnauthorized)
+			return false
+		}
+		if subject := cert.Subject.String(); subject != client.TLSClientAuthSubjectDN {
+			errorResponse(rw, InvalidClient,
+				fmt.Sprintf("The client certificate subject %s isn't the registered one", subject),
+				http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	return assertEqual("client_secret", client.Secret, InvalidClient, "Invalid client secret", rw, req)
+}
+
+// verifyClientJWT verifies a JWT signed by the client, a `private_key_jwt`
+// assertion or a request object: its signature by one of the client's JWKS,
+// that it was issued by the client to one of the allowed audiences, and that it
+// isn't expired. The `exp` is optional unless requireExp is set.
+func (m *MockOIDC) verifyClientJWT(client *Client, raw string, allowed []string, requireExp bool) (jwt.MapClaims, error) {
+	if client.JWKS == nil {
+		return nil, fmt.Errorf("the client %s has no registered keys", client.ID)
+	}
+	parser := &jwt.Parser{ValidMethods: m.clientSigningAlgs(), SkipClaimsValidation: true}
+	token, err := parser.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		keys := client.JWKS.Keys
+		if kid, ok := token.Header["kid"].(string); ok {
+			keys = client.JWKS.Key(kid)
+		}
+		if len(keys) == 0 {
+			return nil, errors.New("no registered key matches the kid")
+		}
+		return keys[0].Public().Key, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("unable to extract the claims")
+	}
+	now := m.Now().Unix()
+	if !claims.VerifyExpiresAt(now, requireExp) {
+		return nil, errors.New("the token is expired or has no exp")
+	}
+	if !claims.VerifyNotBefore(now, false) {
+		return nil, errors.New("the token is not valid yet")
+	}
+	if !claims.VerifyIssuer(client.ID, true) {
+		return nil, fmt.Errorf("the token wasn't issued by %s", client.ID)
+	}
+	for _, aud := range audiences(claims) {
+		if containsString(allowed, aud) {
+			return claims, nil
+		}
+	}
+	return nil, fmt.Errorf("the token's audience isn't %s", allowed[0])
+}
+
+// clientSigningAlgs are the algorithms clients may sign their JWTs with; the
+// FAPI profiles don't allow RS256
+func (m *MockOIDC) clientSigningAlgs() []string {
+	if m.FAPIMode {
+		return []string{"PS256", "ES256"}
+	}
+	return []string{"RS256", "PS256", "ES256"}
+}
+
+// assertionSubject is the `sub` of a client assertion, without verifying it
+func assertionSubject(raw string) string {
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(raw, claims); err != nil {
+		return ""
+	}
+	sub, _ := claims["sub"].(string)
+	return sub
+}
+
+// clientCertificate is the certificate the client presented over TLS, if any
+func clientCertificate(req *http.Request) *x509.Certificate {
+	if req.TLS == nil || len(req.TLS.PeerCertificates) == 0 {
+		return nil
+	}
+	return req.TLS.PeerCertificates[0]
+}
+
+// certificateThumbprint is the `x5t#S256` of the request's client
+// certificate, or empty without one
+func certificateThumbprint(req *http.Request) string {
+	cert := clientCertificate(req)
+	if cert == nil {
+		return ""
+	}
+	sum := sha256.Sum256(cert.Raw)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// bindToCertificate adds the `cnf` claim binding an access token to the
+// client certificate with the thumbprint (RFC 8705 §3.1)
+func bindToCertificate(claims jwt.Claims, thumbprint string) (jwt.Claims, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return nil, err
+	}
+	bound := jwt.MapClaims{}
+	if err = json.Unmarshal(data, &bound); err != nil {
+		return nil, err
+	}
+	bound["cnf"] = map[string]interface{}{"x5t#S256": thumbprint}
+	return bound, nil
+}
+
+// certificateBound checks an access token bound to a client certificate is
+// presented over a connection authenticated with it (RFC 8705 §3),
+// challenging the client otherwise
+func certificateBound(token *jwt.Token, rw http.ResponseWriter, req *http.Request) bool {
+	claims, _ := token.Claims.(jwt.MapClaims)
+	cnf, _ := claims["cnf"].(map[string]interface{})
+	thumbprint, _ := cnf["x5t#S256"].(string)
+	if thumbprint == "" || thumbprint == certificateThumbprint(req) {
+		return true
+	}
+	description := "The access token is bound to another client certificate"
+	bearerChallenge(rw, InvalidToken, description)
+	errorResponse(rw, InvalidToken, description, http.StatusUnauthorized)
+	return false
+}
@@ -0,0 +1,184 @@
+package mockoidc_test
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestMockOIDC_PrivateKeyJWT(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	keypair, err := mockoidc.RandomKeypair(2048)
+	assert.NoError(t, err)
+	keypair.Alg = "PS256"
+	kid, err := keypair.KeyID()
+	assert.NoError(t, err)
+	m.ClientStore.(*mockoidc.MemoryClientStore).Add(&mockoidc.Client{
+		ID: "key-client",
+		JWKS: &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+			Key:       keypair.PublicKey,
+			KeyID:     kid,
+			Algorithm: "PS256",
+			Use:       "sig",
+		}}},
+	})
+
+	claims := func() *jwt.StandardClaims {
+		return &jwt.StandardClaims{
+			Issuer:    "key-client",
+			Subject:   "key-client",
+			Audience:  m.TokenEndpoint(),
+			ExpiresAt: m.Now().Add(time.Minute).Unix(),
+		}
+	}
+	token := func(signer *mockoidc.Keypair, claims *jwt.StandardClaims, form url.Values) (int, string) {
+		assertion, err := signer.SignJWT(claims)
+		assert.NoError(t, err)
+		params := url.Values{
+			"grant_type":            {"client_credentials"},
+			"client_assertion_type": {mockoidc.JWTBearerAssertionType},
+			"client_assertion":      {assertion},
+		}
+		for k, v := range form {
+			params[k] = v
+		}
+		resp, err := httpClient.PostForm(m.TokenEndpoint(), params)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		errorCode, _ := body["error"].(string)
+		return resp.StatusCode, errorCode
+	}
+	status, _ := token(keypair, claims(), nil)
+	assert.Equal(t, http.StatusOK, status)
+
+	// The issuer is an audience too
+	issuerAudience := claims()
+	issuerAudience.Audience = m.Issuer()
+	status, _ = token(keypair, issuerAudience, url.Values{"client_id": {"key-client"}})
+	assert.Equal(t, http.StatusOK, status)
+
+	for name, claims := range map[string]*jwt.StandardClaims{
+		"audience": {Issuer: "key-client", Audience: "https://other.example.com",
+			ExpiresAt: m.Now().Add(time.Minute).Unix()},
+		"expired": {Issuer: "key-client", Subject: "key-client", Audience: m.TokenEndpoint(),
+			ExpiresAt: m.Now().Add(-time.Minute).Unix()},
+		"exp":    {Issuer: "key-client", Subject: "key-client", Audience: m.TokenEndpoint()},
+		"issuer": {Issuer: "other-client", Subject: "key-client", Audience: m.TokenEndpoint()},
+	} {
+		status, errorCode := token(keypair, claims, url.Values{"client_id": {"key-client"}})
+		assert.Equal(t, http.StatusUnauthorized, status, name)
+		assert.Equal(t, mockoidc.InvalidClient, errorCode, name)
+	}
+
+	other, err := mockoidc.RandomKeypair(2048)
+	assert.NoError(t, err)
+	other.Kid = kid
+	status, errorCode := token(other, claims(), nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, mockoidc.InvalidClient, errorCode)
+
+	status, _ = token(keypair, claims(), url.Values{"client_assertion_type": {"urn:example:other"}})
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// FAPI doesn't allow RS256 client assertions
+	keypair.Alg = "RS256"
+	status, _ = token(keypair, claims(), nil)
+	assert.Equal(t, http.StatusOK, status)
+	m.FAPIMode = true
+	status, _ = token(keypair, claims(), nil)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	keypair.Alg = "PS256"
+	status, _ = token(keypair, claims(), nil)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestMockOIDC_TLSClientAuth(t *testing.T) {
+	cert, err := mockoidc.NewCertificate()
+	assert.NoError(t, err)
+	m := mockoidc.RunTB(t, mockoidc.WithTLS(cert.TLSConfig()))
+	m.ClientStore.(*mockoidc.MemoryClientStore).Add(&mockoidc.Client{
+		ID:                     "mtls-client",
+		TLSClientAuthSubjectDN: "CN=mtls-client",
+	})
+	clientCert, err := cert.ClientCertificate("mtls-client")
+	assert.NoError(t, err)
+	otherCert, err := cert.ClientCertificate("other-client")
+	assert.NoError(t, err)
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{
+			Transport: &http.Transport{
+				DisableKeepAlives: true,
+				TLSClientConfig:   &tls.Config{RootCAs: cert.CertPool(), Certificates: certs},
+			},
+			CheckRedirect: httpClient.CheckRedirect,
+		}
+	}
+
+	resp, err := client().Get(m.AuthorizationEndpoint() + "?" + url.Values{
+		"client_id":     {"mtls-client"},
+		"response_type": {"code"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"scope":         {"openid"},
+		"state":         {"state"},
+	}.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	location, err := resp.Location()
+	assert.NoError(t, err)
+
+	token := func(client *http.Client) (int, map[string]interface{}) {
+		resp, err := client.PostForm(m.TokenEndpoint(), url.Values{
+			"client_id":    {"mtls-client"},
+			"grant_type":   {"authorization_code"},
+			"code":         {location.Query().Get("code")},
+			"redirect_uri": {"https://app.example.com/callback"},
+		})
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp.StatusCode, body
+	}
+	status, body := token(client())
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, "The client certificate is missing", body["error_description"])
+	status, body = token(client(otherCert))
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, mockoidc.InvalidClient, body["error"])
+
+	status, body = token(client(clientCert))
+	assert.Equal(t, http.StatusOK, status)
+	accessToken := body["access_token"].(string)
+
+	// The access token is bound to the certificate
+	sum := sha256.Sum256(clientCert.Certificate[0])
+	claims := m.DecodeToken(t, accessToken)
+	assert.Equal(t, map[string]interface{}{
+		"x5t#S256": base64.RawURLEncoding.EncodeToString(sum[:]),
+	}, claims["cnf"])
+
+	userinfo := func(client *http.Client) int {
+		req, err := http.NewRequest(http.MethodGet, m.UserinfoEndpoint(), nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+		resp, err := client.Do(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusOK, userinfo(client(clientCert)))
+	assert.Equal(t, http.StatusUnauthorized, userinfo(client()))
+	assert.Equal(t, http.StatusUnauthorized, userinfo(client(otherCert)))
+}
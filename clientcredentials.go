@@ -0,0 +1,89 @@
+package mockoidc
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// clientCredentialsGrant is the `grant_type` of machine-to-machine token
+// requests (RFC 6749 section 4.4)
+const clientCredentialsGrant = "client_credentials"
+
+// clientCredentialsClaims are the claims of a `client_credentials` access
+// token, carrying its granted `scope`
+type clientCredentialsClaims struct {
+	*jwt.StandardClaims
+	Audience interface{} `json:"aud"`
+	Scope    string      `json:"scope"`
+}
+
+// validateClientCredentialsGrant creates the Session of a
+// `client_credentials` token request, for the authenticated client itself:
+// its User's subject is the client ID. The requested `scope`, or the
+// ClientCredentialsScopes without one, must be supported or among the
+// ClientCredentialsScopes.
+func (m *MockOIDC) validateClientCredentialsGrant(rw http.ResponseWriter, req *http.Request) (*Session, bool) {
+	normalizeScope(m.supported().scopes, req)
+	if req.Form.Get("scope") == "" {
+		req.Form.Set("scope", strings.Join(m.ClientCredentialsScopes, " "))
+	}
+	supported := append(copyStrings(m.supported().scopes), m.ClientCredentialsScopes...)
+	if !validateScope(supported, rw, req) {
+		return nil, false
+	}
+
+	clientID := req.Form.Get("client_id")
+	user := &MockUser{Subject: clientID}
+	scope := req.Form.Get("scope")
+	var (
+		session *Session
+		err     error
+	)
+	// Queued codes are meant for the `authorization_endpoint`
+	if store, ok := m.SessionStore.(sessionIDStore); ok {
+		var sessionID string
+		if sessionID, err = randomNonce(24); err == nil {
+			session, err = store.NewSessionWithID(sessionID, scope, "", user)
+		}
+	} else {
+		session, err = m.SessionStore.NewSession(scope, "", user)
+	}
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return nil, false
+	}
+	session.Scopes = strings.Fields(scope)
+	session.ClientID = clientID
+	session.Granted = true
+	session.IssuedAt = m.Now()
+	if err = m.SessionStore.Save(session); err != nil {
+		internalServerError(rw, err.Error())
+		return nil, false
+	}
+	return session, true
+}
+
+// clientCredentialsToken signs the access token of a `client_credentials`
+// Session, like `Session.AccessToken` plus its `scope`
+func (s *Session) clientCredentialsToken(config *Config, kp *Keypair, now time.Time) (string, error) {
+	claims := s.standardClaims(config, config.AccessTTL, now)
+	var audience interface{} = claims.Audience
+	if config.AccessTokenAudience != "" {
+		audience = []string{claims.Audience, config.AccessTokenAudience}
+	}
+	var signed jwt.Claims = &clientCredentialsClaims{
+		StandardClaims: claims,
+		Audience:       audience,
+		Scope:          strings.Join(s.Scopes, " "),
+	}
+	if s.CertificateThumbprint != "" {
+		var err error
+		if signed, err = bindToCertificate(signed, s.CertificateThumbprint); err != nil {
+			return "", err
+		}
+	}
+	return kp.SignJWT(signed)
+}
@@ -0,0 +1,74 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_ClientCredentialsGrant(t *testing.T) {
+	m := mockoidc.RunTB(t, func(m *mockoidc.MockOIDC) error {
+		m.ClientCredentialsScopes = []string{"orders:read", "orders:write"}
+		return nil
+	})
+	// Queued codes are left for the authorization_endpoint
+	m.QueueCode("queued")
+
+	token := func(form url.Values) (*http.Response, map[string]interface{}) {
+		form.Set("grant_type", "client_credentials")
+		req, err := http.NewRequest(http.MethodPost, m.TokenEndpoint(),
+			strings.NewReader(form.Encode()))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(m.ClientID, m.ClientSecret)
+		resp, err := httpClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp, body
+	}
+
+	resp, body := token(url.Values{})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "orders:read orders:write", body["scope"])
+	assert.Nil(t, body["id_token"])
+	assert.Nil(t, body["refresh_token"])
+
+	parsed, err := m.Keypair.VerifyJWT(body["access_token"].(string))
+	assert.NoError(t, err)
+	claims := parsed.Claims.(jwt.MapClaims)
+	assert.Equal(t, m.ClientID, claims["sub"])
+	assert.Equal(t, m.ClientID, claims["aud"])
+	assert.Equal(t, "orders:read orders:write", claims["scope"])
+
+	session, err := m.SessionStore.GetSessionByID(claims["jti"].(string))
+	assert.NoError(t, err)
+	assert.NotEqual(t, "queued", session.SessionID)
+	assert.Equal(t, m.ClientID, session.ClientID)
+
+	resp, body = token(url.Values{"scope": {"orders:read email"}})
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "orders:read email", body["scope"])
+
+	resp, body = token(url.Values{"scope": {"orders:delete"}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, mockoidc.InvalidScope, body["error"])
+
+	// The grant needs the client's secret
+	req, err := http.NewRequest(http.MethodPost, m.TokenEndpoint(), strings.NewReader(
+		url.Values{"grant_type": {"client_credentials"}}.Encode()))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(m.ClientID, "WRONG")
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
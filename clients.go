@@ -0,0 +1,143 @@
+package mockoidc
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"gopkg.in/square/go-jose.v2"
+)
+
+// ErrUnknownClient is returned by ClientStores for clients that aren't
+// registered
+var ErrUnknownClient = errors.New("unknown client")
+
+// Client is an OAuth2 client allowed to use a MockOIDC
+type Client struct {
+	ID     string
+	Secret string
+
+	// RedirectURIs are the only `redirect_uri`s the client may use, compared
+	// exactly. Any URI is accepted if it's empty.
+	RedirectURIs []string
+
+	// PostLogoutRedirectURIs are the only `post_logout_redirect_uri`s the
+	// client may use at the `end_session_endpoint`, compared exactly. Any
+	// URI is accepted if it's empty.
+	PostLogoutRedirectURIs []string
+
+	// ClaimMappings rename the claims released to the client's ID tokens &
+	// userinfo responses, e.g. `groups` to `roles`, or drop them if mapped
+	// to "". Standard claims like `sub` can't be mapped.
+	ClaimMappings map[string]string
+
+	// TokenEndpointAuthMethod is the `token_endpoint_auth_method` the
+	// client registered, e.g. `client_secret_basic` or `private_key_jwt`.
+	// Requests authenticating the client with another method are rejected.
+	// Any supported method is accepted if it's empty.
+	TokenEndpointAuthMethod string
+
+	// JWKS are the client's public keys, verifying its `private_key_jwt`
+	// client assertions & signed request objects
+	JWKS *jose.JSONWebKeySet
+	// TLSClientAuthSubjectDN is the subject of the certificate the client
+	// authenticates with using `tls_client_auth` (RFC 8705 §2.1.2), e.g.
+	// `CN=client.example.com`
+	TLSClientAuthSubjectDN string
+
+	// Interactive clients get the `LoginPage` unless their authorization
+	// requests set `mockoidc_interactive=false`
+	Interactive bool
+}
+
+// ClientStore looks up the clients registered besides the MockOIDC's own
+// `ClientID`. Lookup errors other than ErrUnknownClient fail requests with
+// a server error, so mocks can script store faults.
+type ClientStore interface {
+	// GetClient returns the Client, or ErrUnknownClient if it isn't
+	// registered
+	GetClient(id string) (*Client, error)
+}
+
+// MemoryClientStore keeps Clients in a map
+type MemoryClientStore struct {
+	sync.Mutex
+	Clients map[string]*Client
+}
+
+// NewClientStore initializes an empty MemoryClientStore
+func NewClientStore() *MemoryClientStore {
+	return &MemoryClientStore{
+		Clients: make(map[string]*Client),
+	}
+}
+
+// Add registers the Client, replacing any with the same ID
+func (cs *MemoryClientStore) Add(client *Client) {
+	cs.Lock()
+	defer cs.Unlock()
+	cs.Clients[client.ID] = client
+}
+
+// Remove unregisters the Client
+func (cs *MemoryClientStore) Remove(id string) {
+	cs.Lock()
+	defer cs.Unlock()
+	delete(cs.Clients, id)
+}
+
+// GetClient looks up the Client
+func (cs *MemoryClientStore) GetClient(id string) (*Client, error) {
+	cs.Lock()
+	defer cs.Unlock()
+	client, ok := cs.Clients[id]
+	if !ok {
+		return nil, ErrUnknownClient
+	}
+	return client, nil
+}
+
+// List returns the registered Clients sorted by ID
+func (cs *MemoryClientStore) List() []*Client {
+	cs.Lock()
+	defer cs.Unlock()
+	clients := make([]*Client, 0, len(cs.Clients))
+	for _, client := range cs.Clients {
+		clients = append(clients, client)
+	}
+	sort.Slice(clients, func(i, j int) bool { return clients[i].ID < clients[j].ID })
+	return clients
+}
+
+// lookupClient returns the configured client, or one of the ClientStore's
+func (m *MockOIDC) lookupClient(config *Config, id string) (*Client, error) {
+	if id == config.ClientID {
+		client := &Client{ID: config.ClientID, Secret: config.ClientSecret}
+		if m.ClientKeypair != nil {
+			jwk, err := m.ClientKeypair.jwk()
+			if err != nil {
+				return nil, err
+			}
+			client.JWKS = &jose.JSONWebKeySet{Keys: []jose.JSONWebKey{jwk}}
+		}
+		return client, nil
+	}
+	if m.ClientStore == nil {
+		return nil, ErrUnknownClient
+	}
+	return m.ClientStore.GetClient(id)
+}
+
+// publicClient reports whether the client is a public one, registered
+// without a secret or keys to authenticate with
+func (m *MockOIDC) publicClient(config *Config, id string) bool {
+	client, err := m.lookupClient(config, id)
+	return err == nil && client.Secret == "" && client.JWKS == nil &&
+		client.TLSClientAuthSubjectDN == ""
+}
+
+// tlsClient reports whether the client authenticates with `tls_client_auth`
+func (m *MockOIDC) tlsClient(config *Config, id string) bool {
+	client, err := m.lookupClient(config, id)
+	return err == nil && client.TLSClientAuthSubjectDN != ""
+}
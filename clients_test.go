@@ -0,0 +1,296 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_ClientStore(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	clients := m.ClientStore.(*mockoidc.MemoryClientStore)
+	clients.Add(&mockoidc.Client{ID: "other-client", Secret: "other-secret"})
+
+	assert.Len(t, clients.List(), 1)
+
+	claims, err := loginAs(t, m, "other-client", "other-secret")
+	assert.NoError(t, err)
+	assert.Equal(t, "other-client", claims["aud"])
+
+	_, err = loginAs(t, m, "other-client", "wrong-secret")
+	assert.EqualError(t, err, "token: 401 invalid_client")
+
+	clients.Remove("other-client")
+	assert.Empty(t, clients.List())
+	_, err = loginAs(t, m, "other-client", "other-secret")
+	assert.EqualError(t, err, "authorize: 401 invalid_client")
+
+	// The configured client is always accepted
+	claims, err = loginAs(t, m, m.ClientID, m.ClientSecret)
+	assert.NoError(t, err)
+	assert.Equal(t, m.ClientID, claims["aud"])
+}
+
+func TestMockOIDC_ClientRedirectURIs(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	m.ClientStore.(*mockoidc.MemoryClientStore).Add(&mockoidc.Client{
+		ID:           "strict-client",
+		Secret:       "strict-secret",
+		RedirectURIs: []string{"https://app.example.com/callback"},
+	})
+
+	authorize := func(redirectURI string) *http.Response {
+		resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+			"client_id":     {"strict-client"},
+			"response_type": {"code"},
+			"redirect_uri":  {redirectURI},
+			"scope":         {"openid"},
+			"state":         {"state"},
+		}.Encode())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	exchange := func(code string, redirectURI ...string) int {
+		form := url.Values{
+			"client_id":     {"strict-client"},
+			"client_secret": {"strict-secret"},
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+		}
+		if len(redirectURI) > 0 {
+			form.Set("redirect_uri", redirectURI[0])
+		}
+		resp, err := httpClient.PostForm(m.TokenEndpoint(), form)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// Unregistered redirect URIs aren't redirected to
+	for _, redirectURI := range []string{
+		"https://app.example.com/callback/",
+		"https://app.example.com/callback?next=/",
+		"https://evil.example.com/callback",
+	} {
+		assert.Equal(t, http.StatusBadRequest, authorize(redirectURI).StatusCode, redirectURI)
+	}
+
+	resp := authorize("https://app.example.com/callback")
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := resp.Location()
+	assert.NoError(t, err)
+	code := location.Query().Get("code")
+
+	assert.Equal(t, http.StatusBadRequest, exchange(code))
+	assert.Equal(t, http.StatusBadRequest, exchange(code, "https://app.example.com/other"))
+	// Mismatches don't burn the code
+	assert.Equal(t, http.StatusOK, exchange(code, "https://app.example.com/callback"))
+
+	// Clients without registered URIs may use any, and leave it out of the
+	// exchange
+	claims, err := loginAs(t, m, m.ClientID, m.ClientSecret)
+	assert.NoError(t, err)
+	assert.Equal(t, m.ClientID, claims["aud"])
+}
+
+func TestMockOIDC_ClientBoundCodes(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	clients := m.ClientStore.(*mockoidc.MemoryClientStore)
+	clients.Add(&mockoidc.Client{ID: "client-a", Secret: "secret-a"})
+	clients.Add(&mockoidc.Client{ID: "client-b", Secret: "secret-b"})
+
+	resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+		"client_id":     {"client-a"},
+		"response_type": {"code"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"scope":         {"openid"},
+		"state":         {"state"},
+	}.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	location, err := resp.Location()
+	assert.NoError(t, err)
+
+	exchange := func(clientID, clientSecret string) error {
+		resp, err := httpClient.Post(m.TokenEndpoint(), "application/x-www-form-urlencoded",
+			strings.NewReader(url.Values{
+				"client_id":     {clientID},
+				"client_secret": {clientSecret},
+				"grant_type":    {"authorization_code"},
+				"code":          {location.Query().Get("code")},
+			}.Encode()))
+		assert.NoError(t, err)
+		if err = responseError("token", resp, http.StatusOK); err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	// Another registered client can't redeem the code, nor the configured one
+	assert.EqualError(t, exchange("client-b", "secret-b"), "token: 400 invalid_grant")
+	assert.EqualError(t, exchange(m.ClientID, m.ClientSecret), "token: 400 invalid_grant")
+	assert.NoError(t, exchange("client-a", "secret-a"))
+}
+
+// loginAs runs the code flow as the client and returns the ID token claims
+func loginAs(t *testing.T, m *mockoidc.MockOIDC, clientID, clientSecret string) (jwt.MapClaims, error) {
+	resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+		"client_id":     {clientID},
+		"response_type": {"code"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"scope":         {"openid"},
+		"state":         {"state"},
+	}.Encode())
+	assert.NoError(t, err)
+	if err = responseError("authorize", resp, http.StatusFound); err != nil {
+		return nil, err
+	}
+	location, err := resp.Location()
+	assert.NoError(t, err)
+
+	resp, err = httpClient.Post(m.TokenEndpoint(), "application/x-www-form-urlencoded",
+		strings.NewReader(url.Values{
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+			"grant_type":    {"authorization_code"},
+			"code":          {location.Query().Get("code")},
+		}.Encode()))
+	assert.NoError(t, err)
+	if err = responseError("token", resp, http.StatusOK); err != nil {
+		return nil, err
+	}
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+	resp.Body.Close()
+	return m.DecodeToken(t, tokens.IDToken), nil
+}
+
+func responseError(step string, resp *http.Response, expected int) error {
+	if resp.StatusCode == expected {
+		return nil
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Error string `json:"error"`
+	}
+	data, _ := ioutil.ReadAll(resp.Body)
+	_ = json.Unmarshal(data, &body)
+	return fmt.Errorf("%s: %d %s", step, resp.StatusCode, body.Error)
+}
+
+// brokenClientStore fails all lookups
+type brokenClientStore struct{}
+
+func (brokenClientStore) GetClient(string) (*mockoidc.Client, error) {
+	return nil, errors.New("client store unavailable")
+}
+
+// fixedUserStore always logs in the same User
+type fixedUserStore struct {
+	user   mockoidc.User
+	pushed []mockoidc.User
+}
+
+func (s *fixedUserStore) Push(user mockoidc.User) { s.pushed = append(s.pushed, user) }
+func (s *fixedUserStore) Pop() mockoidc.User      { return s.user }
+func (s *fixedUserStore) Clear()                  { s.pushed = nil }
+
+// lostSessionStore loses every Session between the authorize & token
+// requests
+type lostSessionStore struct {
+	mockoidc.SessionStore
+}
+
+func (lostSessionStore) GetSessionByID(string) (*mockoidc.Session, error) {
+	return nil, errors.New("session lookup failed")
+}
+
+func TestNewServerWithStores(t *testing.T) {
+	users := &fixedUserStore{user: &mockoidc.MockUser{Subject: "fixed"}}
+	m, err := mockoidc.NewServerWithStores(nil, mockoidc.Stores{Users: users})
+	assert.NoError(t, err)
+
+	m.QueueUser(mockoidc.DefaultUser())
+	assert.Len(t, users.pushed, 1)
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "fixed", tokens.IDTokenClaims["sub"])
+	assert.NoError(t, m.Reset())
+	assert.Empty(t, users.pushed)
+
+	m, err = mockoidc.NewServerWithStores(nil, mockoidc.Stores{Clients: brokenClientStore{}})
+	assert.NoError(t, err)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start(ln, nil))
+	defer m.Shutdown()
+	_, err = loginAs(t, m, m.ClientID, m.ClientSecret)
+	assert.NoError(t, err)
+	_, err = loginAs(t, m, "other-client", "other-secret")
+	assert.EqualError(t, err, "authorize: 500 internal_server_error")
+
+	m, err = mockoidc.NewServerWithStores(nil, mockoidc.Stores{
+		Sessions: lostSessionStore{SessionStore: mockoidc.NewSessionStore()},
+	})
+	assert.NoError(t, err)
+	_, err = m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.Contains(t, err.Error(), "token: unexpected status code 401: invalid_grant")
+}
+
+func TestMockOIDC_ClientTokenEndpointAuthMethod(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	m.ClientStore.(*mockoidc.MemoryClientStore).Add(&mockoidc.Client{
+		ID:                      "post-client",
+		Secret:                  "post-secret",
+		TokenEndpointAuthMethod: "client_secret_post",
+	})
+
+	exchange := func(basic bool) *http.Response {
+		session, err := m.SessionStore.NewSession("openid", "", mockoidc.DefaultUser())
+		assert.NoError(t, err)
+		form := url.Values{
+			"grant_type": {"authorization_code"},
+			"code":       {session.SessionID},
+		}
+		if !basic {
+			form.Set("client_id", "post-client")
+			form.Set("client_secret", "post-secret")
+		}
+		req, err := http.NewRequest(http.MethodPost, m.TokenEndpoint(), strings.NewReader(form.Encode()))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if basic {
+			req.SetBasicAuth("post-client", "post-secret")
+		}
+		resp, err := httpClient.Do(req)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	resp := exchange(false)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = exchange(true)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), mockoidc.InvalidClient)
+	assert.Contains(t, string(body),
+		"The client registered the client_secret_post token_endpoint_auth_method, not client_secret_basic")
+}
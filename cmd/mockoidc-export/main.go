@@ -0,0 +1,54 @@
+// Command mockoidc-export writes a bundle of test vectors: tokens signed by
+// a MockOIDC, the claims they must verify to, the JWKS and the discovery
+// document, so services that aren't written in Go can run their unit tests
+// against the same fixtures.
+//
+// Bundles are reproducible: the same -seed, -issuer & -config export the
+// same tokens.
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+
+	"github.com/oauth2-proxy/mockoidc"
+)
+
+func main() {
+	out := flag.String("out", "testvectors", "directory to write the bundle to")
+	issuer := flag.String("issuer", "http://127.0.0.1:8080/oidc", "issuer of the tokens")
+	seed := flag.Int64("seed", 1, "seed of the client credentials")
+	configFile := flag.String("config", "",
+		"JSON config file of the client credentials, TTLs & users; the first user gets the tokens")
+	scopes := flag.String("scopes", "openid email profile groups", "space separated scopes of the tokens")
+	nonce := flag.String("nonce", "", "nonce of the ID token")
+	flag.Parse()
+
+	m, err := mockoidc.NewDeterministicServer(*seed)
+	if err != nil {
+		log.Fatalf("unable to create server: %v", err)
+	}
+	opts := &mockoidc.TestVectorOptions{
+		Issuer: *issuer,
+		Scopes: strings.Fields(*scopes),
+		Nonce:  *nonce,
+	}
+	if *configFile != "" {
+		fc, err := mockoidc.LoadFileConfig(*configFile)
+		if err != nil {
+			log.Fatalf("unable to load config: %v", err)
+		}
+		if err = m.ApplyFileConfig(fc); err != nil {
+			log.Fatalf("invalid config: %v", err)
+		}
+		if len(fc.Users) > 0 {
+			opts.User = fc.Users[0]
+		}
+	}
+
+	if _, err = m.ExportTestVectors(*out, opts); err != nil {
+		log.Fatalf("unable to export test vectors: %v", err)
+	}
+	log.Printf("test vectors written to %s", *out)
+}
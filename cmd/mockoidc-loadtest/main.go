@@ -0,0 +1,79 @@
+// Command mockoidc-loadtest benchmarks a relying party's logins: it serves
+// a MockOIDC as the relying party's IdP and drives concurrent code flows
+// through the relying party's login URL, reporting latency percentiles.
+//
+// Configure the relying party with the issuer & client credentials it
+// prints (or pass fixed ones), then point -login-url at it.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/oauth2-proxy/mockoidc/loadtest"
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:8080", "address the MockOIDC listens on")
+	clientID := flag.String("client-id", "", "client id of the relying party, random if empty")
+	clientSecret := flag.String("client-secret", "", "client secret of the relying party, random if empty")
+	loginURL := flag.String("login-url", "", "URL starting a login at the relying party")
+	flows := flag.Int("flows", 1000, "number of logins to run")
+	concurrency := flag.Int("concurrency", 10, "number of logins to run at once")
+	timeout := flag.Duration("timeout", 30*time.Second, "timeout of a single login")
+	wait := flag.Duration("wait", 0, "time to wait for the relying party before starting")
+	flag.Parse()
+	if *loginURL == "" {
+		log.Fatal("-login-url is required")
+	}
+
+	m, err := mockoidc.NewServer(nil)
+	if err != nil {
+		log.Fatalf("unable to create server: %v", err)
+	}
+	m.PerformanceMode = true
+	if *clientID != "" {
+		m.ClientID = *clientID
+	}
+	if *clientSecret != "" {
+		m.ClientSecret = *clientSecret
+	}
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("unable to listen: %v", err)
+	}
+	if err = m.Start(ln, nil); err != nil {
+		log.Fatalf("unable to start server: %v", err)
+	}
+	defer m.Shutdown()
+	log.Printf("mockoidc issuer: %s", m.Issuer())
+	log.Printf("mockoidc client id: %s", m.ClientID)
+	log.Printf("mockoidc client secret: %s", m.ClientSecret)
+	time.Sleep(*wait)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	result, err := loadtest.Run(ctx, loadtest.Config{
+		LoginURL:    *loginURL,
+		Flows:       *flows,
+		Concurrency: *concurrency,
+		Timeout:     *timeout,
+	})
+	if result != nil {
+		fmt.Print(result)
+	}
+	if err != nil {
+		log.Printf("load test interrupted: %v", err)
+	}
+	if err != nil || result.Failures > 0 {
+		m.Shutdown()
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+)
+
+// Environment variables configuring the server, e.g. in CI containers and
+// Kubernetes pods. Flags take precedence over them.
+const (
+	envAddr          = "MOCKOIDC_ADDR"
+	envPort          = "MOCKOIDC_PORT"
+	envConfigFile    = "MOCKOIDC_CONFIG_FILE"
+	envSessionsFile  = "MOCKOIDC_SESSIONS_FILE"
+	envRedisAddr     = "MOCKOIDC_REDIS_ADDR"
+	envRedisTTL      = "MOCKOIDC_REDIS_TTL"
+	envRedisPassword = "MOCKOIDC_REDIS_PASSWORD"
+	envGCInterval    = "MOCKOIDC_GC_INTERVAL"
+	envMaxSessions   = "MOCKOIDC_MAX_SESSIONS"
+	envAdminUI       = "MOCKOIDC_ADMIN_UI"
+	envPerformance   = "MOCKOIDC_PERFORMANCE"
+	envHarness       = "MOCKOIDC_HARNESS"
+	envTemplatesDir  = "MOCKOIDC_TEMPLATES_DIR"
+	envInteractive   = "MOCKOIDC_INTERACTIVE"
+	envConformance   = "MOCKOIDC_CONFORMANCE"
+	envRequireNonce  = "MOCKOIDC_REQUIRE_NONCE"
+	envMetadataCache = "MOCKOIDC_METADATA_CACHE"
+	envMetadataETags = "MOCKOIDC_METADATA_ETAGS"
+	envCompliance    = "MOCKOIDC_COMPLIANCE"
+	envFAPI          = "MOCKOIDC_FAPI"
+	envSigningAlg    = "MOCKOIDC_SIGNING_ALG"
+	envClientKey     = "MOCKOIDC_CLIENT_KEY"
+	envIssuerSlash   = "MOCKOIDC_ISSUER_SLASH"
+	envIssuerPort    = "MOCKOIDC_ISSUER_PORT"
+	envJSONToken     = "MOCKOIDC_JSON_TOKEN"
+	envPreset        = "MOCKOIDC_PRESET"
+	envNoRefreshID   = "MOCKOIDC_NO_REFRESH_ID"
+	envAccessAud     = "MOCKOIDC_ACCESS_AUD"
+	envCCScopes      = "MOCKOIDC_CC_SCOPES"
+	envDeviceTTL     = "MOCKOIDC_DEVICE_TTL"
+	envDevicePoll    = "MOCKOIDC_DEVICE_POLL"
+	envDeviceLenient = "MOCKOIDC_DEVICE_LENIENT"
+	envKeyRotation   = "MOCKOIDC_KEY_ROTATION"
+	envKeyOverlap    = "MOCKOIDC_KEY_OVERLAP"
+	envClientID      = "MOCKOIDC_CLIENT_ID"
+	envClientSecret  = "MOCKOIDC_CLIENT_SECRET"
+	envAccessTTL     = "MOCKOIDC_ACCESS_TTL"
+	envRefreshTTL    = "MOCKOIDC_REFRESH_TTL"
+	envUsersFile     = "MOCKOIDC_USERS_FILE"
+)
+
+// defaultAddr listens on all interfaces if only a port is configured, as
+// containers need to
+func defaultAddr() string {
+	if addr := os.Getenv(envAddr); addr != "" {
+		return addr
+	}
+	if port := os.Getenv(envPort); port != "" {
+		return ":" + port
+	}
+	return "127.0.0.1:8080"
+}
+
+func envString(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return d
+}
+
+func envInt(key string, fallback int) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return i
+}
+
+func envBool(key string, fallback bool) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalf("invalid %s: %v", key, err)
+	}
+	return b
+}
+
+// envFileConfig collects the server settings set in the environment. Users
+// are read from the JSON list in the MOCKOIDC_USERS_FILE.
+func envFileConfig() (*mockoidc.FileConfig, error) {
+	fc := &mockoidc.FileConfig{
+		ClientID:     os.Getenv(envClientID),
+		ClientSecret: os.Getenv(envClientSecret),
+		AccessTTL:    os.Getenv(envAccessTTL),
+		RefreshTTL:   os.Getenv(envRefreshTTL),
+	}
+	if path := os.Getenv(envUsersFile); path != "" {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = json.Unmarshal(data, &fc.Users); err != nil {
+			return nil, err
+		}
+	}
+	return fc, nil
+}
@@ -0,0 +1,234 @@
+// Command mockoidc runs a standalone MockOIDC server, e.g. for e2e test
+// environments running relying parties that aren't written in Go.
+//
+// Every flag can also be set with a MOCKOIDC_* environment variable, as can
+// the client credentials, TTLs and a JSON file of users to queue.
+//
+// Send the process a SIGHUP (or POST to the admin reload endpoint) to
+// reload the -config file without dropping the listener.
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+)
+
+func main() {
+	addr := flag.String("addr", defaultAddr(),
+		"address to listen on ($MOCKOIDC_ADDR, or all interfaces at $MOCKOIDC_PORT)")
+	configFile := flag.String("config", envString(envConfigFile, ""),
+		"path to a JSON config file ($MOCKOIDC_CONFIG_FILE)")
+	sessionsFile := flag.String("sessions", envString(envSessionsFile, ""),
+		"path to a JSON file persisting sessions across restarts ($MOCKOIDC_SESSIONS_FILE)")
+	redisAddr := flag.String("redis", envString(envRedisAddr, ""),
+		"host:port of a Redis server sharing sessions between replicas ($MOCKOIDC_REDIS_ADDR)")
+	redisTTL := flag.Duration("redis-ttl", envDuration(envRedisTTL, 24*time.Hour),
+		"expiry of sessions in Redis ($MOCKOIDC_REDIS_TTL)")
+	gcInterval := flag.Duration("gc-interval", envDuration(envGCInterval, 10*time.Minute),
+		"how often expired sessions are pruned, 0 disables it ($MOCKOIDC_GC_INTERVAL)")
+	maxSessions := flag.Int("max-sessions", envInt(envMaxSessions, 0),
+		"evict the least recently used sessions above this count, 0 disables it "+
+			"($MOCKOIDC_MAX_SESSIONS)")
+	adminUI := flag.Bool("admin-ui", envBool(envAdminUI, false),
+		"serve a web UI to inspect & change the server state ($MOCKOIDC_ADMIN_UI)")
+	performance := flag.Bool("performance", envBool(envPerformance, false),
+		"cache responses & token signatures for load tests ($MOCKOIDC_PERFORMANCE)")
+	harness := flag.Bool("harness", envBool(envHarness, false),
+		"serve callback & token pages for browser tests ($MOCKOIDC_HARNESS)")
+	templatesDir := flag.String("templates", envString(envTemplatesDir, ""),
+		"directory of <page>.html templates replacing the built-in pages ($MOCKOIDC_TEMPLATES_DIR)")
+	interactive := flag.Bool("interactive", envBool(envInteractive, false),
+		"render a login page on authorization requests by default ($MOCKOIDC_INTERACTIVE)")
+	conformance := flag.Bool("conformance", envBool(envConformance, false),
+		"fix the deviations from the OIDC specs checked by certification suites ($MOCKOIDC_CONFORMANCE)")
+	requireNonce := flag.Bool("require-nonce", envBool(envRequireNonce, false),
+		"reject openid authorization requests without a nonce ($MOCKOIDC_REQUIRE_NONCE)")
+	metadataCache := flag.String("metadata-cache-control", envString(envMetadataCache, ""),
+		"Cache-Control header of the discovery document & JWKS, e.g. max-age=300 ($MOCKOIDC_METADATA_CACHE)")
+	metadataETags := flag.Bool("metadata-etags", envBool(envMetadataETags, false),
+		"serve the discovery document & JWKS with ETags & 304s ($MOCKOIDC_METADATA_ETAGS)")
+	compliance := flag.String("compliance", envString(envCompliance, ""),
+		"emulate a strict, lenient or quirky provider ($MOCKOIDC_COMPLIANCE)")
+	fapi := flag.Bool("fapi", envBool(envFAPI, false),
+		"require FAPI pushed or signed authorization requests & key based client auth ($MOCKOIDC_FAPI)")
+	signingAlg := flag.String("signing-alg", envString(envSigningAlg, ""),
+		"sign tokens with RS256, PS256 or ES256, PS256 with -fapi ($MOCKOIDC_SIGNING_ALG)")
+	clientKey := flag.String("client-key", envString(envClientKey, ""),
+		"PEM private key the client signs private_key_jwt assertions & request objects with ($MOCKOIDC_CLIENT_KEY)")
+	issuerSlash := flag.Bool("issuer-trailing-slash", envBool(envIssuerSlash, false),
+		"end the issuer with a / ($MOCKOIDC_ISSUER_SLASH)")
+	jsonToken := flag.Bool("json-token-requests", envBool(envJSONToken, false),
+		"accept application/json token requests from non-compliant clients ($MOCKOIDC_JSON_TOKEN)")
+	issuerPort := flag.String("issuer-port", envString(envIssuerPort, ""),
+		"omit or include the default port of the scheme in the issuer ($MOCKOIDC_ISSUER_PORT)")
+	noRefreshID := flag.Bool("omit-refresh-id-token", envBool(envNoRefreshID, false),
+		"don't issue ID tokens to refresh_token grants ($MOCKOIDC_NO_REFRESH_ID)")
+	accessAud := flag.String("access-token-audience", envString(envAccessAud, ""),
+		"add the audience to access tokens & require it at userinfo ($MOCKOIDC_ACCESS_AUD)")
+	ccScopes := flag.String("client-credentials-scopes", envString(envCCScopes, ""),
+		"space-separated scopes of client_credentials grants without a scope ($MOCKOIDC_CC_SCOPES)")
+	deviceTTL := flag.Duration("device-code-ttl", envDuration(envDeviceTTL, 10*time.Minute),
+		"how long device codes can be approved & polled ($MOCKOIDC_DEVICE_TTL)")
+	deviceInterval := flag.Duration("device-poll-interval", envDuration(envDevicePoll, 5*time.Second),
+		"interval device clients must poll at, or get slow_down ($MOCKOIDC_DEVICE_POLL)")
+	deviceLenient := flag.Bool("lenient-device-polling", envBool(envDeviceLenient, false),
+		"don't answer fast device code polls with slow_down ($MOCKOIDC_DEVICE_LENIENT)")
+	keyRotation := flag.Duration("key-rotation-interval", envDuration(envKeyRotation, 0),
+		"how often the signing key is rotated, 0 disables it ($MOCKOIDC_KEY_ROTATION)")
+	keyOverlap := flag.Duration("key-rotation-overlap", envDuration(envKeyOverlap, 5*time.Minute),
+		"how long a rotated key is still served ($MOCKOIDC_KEY_OVERLAP)")
+	presetName := flag.String("preset", envString(envPreset, ""),
+		"behave like azure_ad, google, okta or keycloak ($MOCKOIDC_PRESET)")
+	flag.Parse()
+	if *sessionsFile != "" && *redisAddr != "" {
+		log.Fatal("-sessions and -redis are mutually exclusive")
+	}
+
+	m, err := mockoidc.NewServer(nil)
+	if err != nil {
+		log.Fatalf("unable to create server: %v", err)
+	}
+	m.Logger = mockoidc.StdLogger(log.Default())
+	m.GCInterval = *gcInterval
+	m.ServeAdminUI = *adminUI
+	m.PerformanceMode = *performance
+	m.ServeHarnessPages = *harness
+	m.InteractiveLogin = *interactive
+	m.ConformanceMode = *conformance
+	m.RequireNonce = *requireNonce
+	m.MetadataCacheControl = *metadataCache
+	m.MetadataETags = *metadataETags
+	if *clientKey != "" {
+		data, err := ioutil.ReadFile(*clientKey)
+		if err != nil {
+			log.Fatalf("unable to read -client-key: %v", err)
+		}
+		if m.ClientKeypair, err = mockoidc.ParseKeypairPEM(data); err != nil {
+			log.Fatalf("invalid -client-key: %v", err)
+		}
+	}
+	if *fapi {
+		if m.ClientKeypair == nil {
+			log.Fatal("-fapi needs the -client-key the client authenticates with")
+		}
+		m.FAPIMode = true
+		if *signingAlg == "" {
+			*signingAlg = "PS256"
+		}
+	}
+	if *signingAlg != "" {
+		if err = mockoidc.WithSigningAlg(*signingAlg)(m); err != nil {
+			log.Fatalf("invalid -signing-alg: %v", err)
+		}
+	}
+	var ok bool
+	if m.Compliance, ok = mockoidc.ParseComplianceMode(*compliance); !ok {
+		log.Fatalf("invalid -compliance: %s", *compliance)
+	}
+	m.IssuerTrailingSlash = *issuerSlash
+	m.AcceptJSONTokenRequests = *jsonToken
+	m.OmitRefreshIDToken = *noRefreshID
+	m.AccessTokenAudience = *accessAud
+	m.ClientCredentialsScopes = strings.Fields(*ccScopes)
+	m.DeviceCodeTTL = *deviceTTL
+	m.DevicePollInterval = *deviceInterval
+	m.LenientDevicePolling = *deviceLenient
+	m.KeyRotationInterval = *keyRotation
+	m.KeyRotationOverlap = *keyOverlap
+	if m.IssuerPort, ok = mockoidc.ParseIssuerPort(*issuerPort); !ok {
+		log.Fatalf("invalid -issuer-port: %s", *issuerPort)
+	}
+	preset, ok := mockoidc.ParsePreset(*presetName)
+	if !ok {
+		log.Fatalf("invalid -preset: %s", *presetName)
+	}
+	if *templatesDir != "" {
+		if m.PageTemplates, err = mockoidc.LoadPageTemplates(*templatesDir); err != nil {
+			log.Fatalf("unable to load templates: %v", err)
+		}
+	}
+
+	fc, err := envFileConfig()
+	if err != nil {
+		log.Fatalf("unable to load environment config: %v", err)
+	}
+	if err = m.ApplyFileConfig(fc); err != nil {
+		log.Fatalf("invalid environment config: %v", err)
+	}
+
+	store := mockoidc.NewSessionStore()
+	if *sessionsFile != "" {
+		if store, err = mockoidc.NewFileSessionStore(*sessionsFile); err != nil {
+			log.Fatalf("unable to load sessions: %v", err)
+		}
+	}
+	if *redisAddr != "" {
+		store, err = mockoidc.NewRedisSessionStore(&mockoidc.RedisOptions{
+			Addr:     *redisAddr,
+			Password: envString(envRedisPassword, os.Getenv("REDIS_PASSWORD")),
+			TTL:      *redisTTL,
+		})
+		if err != nil {
+			log.Fatalf("unable to connect to redis: %v", err)
+		}
+	}
+	store.MaxSessions = *maxSessions
+	m.SessionStore = store
+	if *configFile != "" {
+		m.ConfigFile = *configFile
+		if err = m.Reload(); err != nil {
+			log.Fatalf("unable to load config: %v", err)
+		}
+	}
+
+	// Presets read the TTLs of the config
+	if err = m.ApplyPreset(preset); err != nil {
+		log.Fatalf("unable to apply preset: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("unable to listen: %v", err)
+	}
+	if err = m.Start(ln, nil); err != nil {
+		log.Fatalf("unable to start server: %v", err)
+	}
+	log.Printf("mockoidc issuer: %s", m.Issuer())
+	log.Printf("mockoidc client id: %s", m.ClientID)
+	if m.ServeAdminUI {
+		log.Printf("mockoidc admin ui: %s%s", m.Addr(), mockoidc.AdminUIEndpoint)
+	}
+	if m.ServeHarnessPages {
+		log.Printf("mockoidc harness callback: %s%s", m.Addr(), mockoidc.HarnessCallbackEndpoint)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	for sig := range signals {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		if m.ConfigFile == "" {
+			log.Printf("no config file to reload")
+			continue
+		}
+		if err = m.Reload(); err != nil {
+			log.Printf("unable to reload config: %v", err)
+			continue
+		}
+		log.Printf("reloaded config: %s", m.ConfigFile)
+	}
+
+	if err = m.Shutdown(); err != nil {
+		log.Fatalf("unable to shutdown: %v", err)
+	}
+}
@@ -0,0 +1,322 @@
+package mockoidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// TokenSet is the result of a completed authorization code flow
+type TokenSet struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+	TokenType    string
+	ExpiresIn    time.Duration
+
+	// IDTokenClaims are the verified claims of the IDToken, if any
+	IDTokenClaims jwt.MapClaims
+}
+
+// CompleteCodeFlow logs the user in through the `authorization_endpoint`
+// and exchanges the code at the `token_endpoint`, for tests that only need
+// tokens issued by this MockOIDC. Requests are dispatched in-process through
+// the full handler chain, so they are counted and queued errors apply. A nil
+// user logs in the next queued User; nil scopes request `openid`. If the
+// authorization request fails, the passed user stays queued. A `nonce` and
+// an S256 `code_challenge` are sent, so the flow passes RequireNonce, strict
+// compliance & FAPIMode too. In FAPIMode the authorization request is pushed
+// to the `pushed_authorization_request_endpoint` and the client
+// authenticates with `private_key_jwt` assertions signed by the MockOIDC's
+// ClientKeypair.
+func (m *MockOIDC) CompleteCodeFlow(user User, redirectURI string, scopes []string) (*TokenSet, error) {
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+	if m.FAPIMode && m.ClientKeypair == nil {
+		return nil, errors.New("the FAPIMode flow needs a ClientKeypair to authenticate the client")
+	}
+	if user != nil {
+		m.queueUserFirst(user)
+	}
+
+	client, base := m.flowClient()
+	config := m.Config()
+
+	newNonce := randomNonce
+	if m.flowNonce != nil {
+		newNonce = m.flowNonce
+	}
+	state, err := newNonce(16)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := newNonce(16)
+	if err != nil {
+		return nil, err
+	}
+	authorize := url.Values{
+		"client_id":     {config.ClientID},
+		"response_type": {"code"},
+		"redirect_uri":  {redirectURI},
+		"scope":         {strings.Join(scopes, " ")},
+		"state":         {state},
+		"nonce":         {nonce},
+	}
+	var verifier string
+	if containsString(m.supported().codeChallengeMethods, "S256") {
+		if verifier, err = newNonce(32); err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256([]byte(verifier))
+		authorize.Set("code_challenge", base64.RawURLEncoding.EncodeToString(sum[:]))
+		authorize.Set("code_challenge_method", "S256")
+	}
+	if m.FAPIMode {
+		if authorize, err = m.pushAuthorization(client, base, authorize); err != nil {
+			return nil, err
+		}
+	}
+	resp, err := client.Get(base + m.endpointPath(AuthorizationEndpoint) + "?" + authorize.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		return nil, flowError("authorize", resp)
+	}
+	location, err := resp.Location()
+	if err != nil {
+		return nil, err
+	}
+	if authErr := location.Query().Get("error"); authErr != "" {
+		if description := location.Query().Get("error_description"); description != "" {
+			authErr += ": " + description
+		}
+		return nil, fmt.Errorf("authorize: redirected with error %s", authErr)
+	}
+	if location.Query().Get("state") != state {
+		return nil, fmt.Errorf("authorize: state mismatch in redirect %s", location)
+	}
+
+	tokens, err := m.exchangeCode(client, base, location.Query().Get("code"), redirectURI, verifier)
+	if err != nil {
+		return nil, err
+	}
+	if tokens.IDTokenClaims != nil && tokens.IDTokenClaims["nonce"] != nonce {
+		return nil, fmt.Errorf("token: nonce mismatch in the ID token: %v", tokens.IDTokenClaims["nonce"])
+	}
+	return tokens, nil
+}
+
+// flowClient dispatches requests in-process through the full handler chain
+// without following redirects. It returns the base URL of the requests.
+func (m *MockOIDC) flowClient() (*http.Client, string) {
+	handler := m.Handler()
+	if m.Server != nil && m.Server.Handler != nil {
+		handler = m.Server.Handler
+	}
+	client := &http.Client{
+		Transport: &inProcessTransport{handler: handler},
+		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return client, "http://" + InProcessHost
+}
+
+// pushAuthorization pushes the parameters of an authorization request to the
+// `pushed_authorization_request_endpoint`, and returns the ones to send to
+// the `authorization_endpoint` instead
+func (m *MockOIDC) pushAuthorization(client *http.Client, base string, authorize url.Values) (url.Values, error) {
+	form, err := m.flowClientAuth(PushedAuthorizationEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range authorize {
+		form[name] = values
+	}
+	resp, err := client.PostForm(base+m.endpointPath(PushedAuthorizationEndpoint), form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		return nil, flowError("par", resp)
+	}
+
+	pushed := &pushedAuthorizationResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(pushed); err != nil {
+		return nil, err
+	}
+	return url.Values{
+		"client_id":   {authorize.Get("client_id")},
+		"request_uri": {pushed.RequestURI},
+	}, nil
+}
+
+// flowClientAuth are the parameters authenticating the MockOIDC's client at
+// the endpoint: its secret, or in FAPIMode a `private_key_jwt` assertion
+// for the endpoint's URL signed by the ClientKeypair
+func (m *MockOIDC) flowClientAuth(endpoint string) (url.Values, error) {
+	config := m.Config()
+	if !m.FAPIMode {
+		return url.Values{
+			"client_id":     {config.ClientID},
+			"client_secret": {config.ClientSecret},
+		}, nil
+	}
+
+	jti, err := randomNonce(16)
+	if err != nil {
+		return nil, err
+	}
+	now := m.Now()
+	assertion, err := m.ClientKeypair.SignJWT(jwt.StandardClaims{
+		Issuer:    config.ClientID,
+		Subject:   config.ClientID,
+		Audience:  m.Addr() + m.endpointPath(endpoint),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+		IssuedAt:  now.Unix(),
+		Id:        jti,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return url.Values{
+		"client_id":             {config.ClientID},
+		"client_assertion_type": {JWTBearerAssertionType},
+		"client_assertion":      {assertion},
+	}, nil
+}
+
+// exchangeCode redeems a code at the `token_endpoint` with the MockOIDC's
+// client credentials, and the PKCE `code_verifier` if not empty
+func (m *MockOIDC) exchangeCode(client *http.Client, base, code, redirectURI, verifier string) (*TokenSet, error) {
+	form, err := m.flowClientAuth(TokenEndpoint)
+	if err != nil {
+		return nil, err
+	}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	if verifier != "" {
+		form.Set("code_verifier", verifier)
+	}
+	resp, err := client.PostForm(base+m.endpointPath(TokenEndpoint), form)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, flowError("token", resp)
+	}
+
+	tr := &tokenResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(tr); err != nil {
+		return nil, err
+	}
+	if m.ConformanceMode || m.ExpiresInSeconds {
+		tr.ExpiresIn *= time.Second
+	}
+	return m.tokenSet(tr)
+}
+
+// SeedOptions customize the Session created by SeedSession
+type SeedOptions struct {
+	// Code is the ID of the Session, random if empty
+	Code string
+	// Nonce is set in the ID token
+	Nonce string
+}
+
+// SeedSession creates a Session for the user as if it had logged in and
+// exchanged its code, and returns live tokens for it. Tests of refresh &
+// userinfo paths can start from there. opts may be nil.
+func (m *MockOIDC) SeedSession(user User, scopes []string, opts *SeedOptions) (*TokenSet, error) {
+	return m.seedSession(user, scopes, opts, m.Config())
+}
+
+func (m *MockOIDC) seedSession(user User, scopes []string, opts *SeedOptions, config *Config) (*TokenSet, error) {
+	if opts == nil {
+		opts = &SeedOptions{}
+	}
+	if user == nil {
+		user = DefaultUser()
+	}
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+	scope := strings.Join(scopes, " ")
+
+	var (
+		session *Session
+		err     error
+	)
+	if opts.Code == "" {
+		session, err = m.SessionStore.NewSession(scope, opts.Nonce, user)
+	} else if store, ok := m.SessionStore.(sessionIDStore); ok {
+		session, err = store.NewSessionWithID(opts.Code, scope, opts.Nonce, user)
+	} else {
+		err = errors.New("the session store can't create sessions with preset codes")
+	}
+	if err != nil {
+		return nil, err
+	}
+	session.Granted = true
+	session.IssuedAt = m.Now()
+	session.AuthTime = session.IssuedAt
+	if err = m.SessionStore.Save(session); err != nil {
+		return nil, err
+	}
+
+	tr := &tokenResponse{
+		TokenType: m.tokenType(),
+		ExpiresIn: config.AccessTTL,
+	}
+	if err = m.setTokens(tr, session, "authorization_code", config); err != nil {
+		return nil, err
+	}
+	return m.tokenSet(tr)
+}
+
+// tokenSet parses the claims of a token response's ID token
+func (m *MockOIDC) tokenSet(tr *tokenResponse) (*TokenSet, error) {
+	ts := &TokenSet{
+		AccessToken:  tr.AccessToken,
+		RefreshToken: tr.RefreshToken,
+		IDToken:      tr.IDToken,
+		TokenType:    tr.TokenType,
+		ExpiresIn:    tr.ExpiresIn,
+	}
+	if tr.IDToken == "" {
+		return ts, nil
+	}
+	idToken, err := m.signingKey().verifyJWTSignature(tr.IDToken)
+	if err != nil {
+		return nil, err
+	}
+	ts.IDTokenClaims, _ = idToken.Claims.(jwt.MapClaims)
+	return ts, nil
+}
+
+// flowError describes the OAuth2 error response of a step of a flow
+func flowError(step string, resp *http.Response) error {
+	var body struct {
+		Error       string `json:"error"`
+		Description string `json:"error_description"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	if body.Description != "" {
+		body.Error += ": " + body.Description
+	}
+	return fmt.Errorf("%s: unexpected status code %d: %s", step, resp.StatusCode, body.Error)
+}
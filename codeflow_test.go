@@ -0,0 +1,134 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_CompleteCodeFlow(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	m.QueueUser(&mockoidc.MockUser{Subject: "queued"})
+
+	user := &mockoidc.MockUser{Subject: "flow-user", Email: "flow@example.com"}
+	tokens, err := m.CompleteCodeFlow(user, "https://app.example.com/callback",
+		[]string{"openid", "email"})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tokens.AccessToken)
+	assert.NotEmpty(t, tokens.RefreshToken)
+	assert.Equal(t, "bearer", tokens.TokenType)
+	assert.Equal(t, m.AccessTTL, tokens.ExpiresIn)
+	assert.Equal(t, "flow-user", tokens.IDTokenClaims["sub"])
+	assert.Equal(t, "flow@example.com", tokens.IDTokenClaims["email"])
+	assert.Equal(t, m.Issuer(), tokens.IDTokenClaims["iss"])
+
+	// The passed user jumps the queue
+	assert.Equal(t, "queued", m.UserQueue.Pop().ID())
+	assert.Equal(t, uint64(1), m.RequestCount(mockoidc.TokenEndpoint))
+
+	tokens, err = m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.DefaultUser().ID(), tokens.IDTokenClaims["sub"])
+	_, ok := tokens.IDTokenClaims["email"]
+	assert.False(t, ok)
+}
+
+func TestMockOIDC_CompleteCodeFlow_Errors(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	m.QueueError(&mockoidc.ServerError{
+		Code:  http.StatusServiceUnavailable,
+		Error: "temporarily_unavailable",
+	})
+	_, err = m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.EqualError(t, err, "authorize: unexpected status code 503: temporarily_unavailable")
+
+	_, err = m.CompleteCodeFlow(nil, "https://app.example.com/callback", []string{"admin"})
+	assert.EqualError(t, err,
+		"authorize: redirected with error invalid_scope: Unsupported scope: admin")
+
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, tokens.IDToken)
+}
+
+func TestMockOIDC_SeedSession(t *testing.T) {
+	m := mockoidc.RunTB(t)
+
+	user := &mockoidc.MockUser{Subject: "seeded", Email: "seeded@example.com"}
+	tokens, err := m.SeedSession(user, []string{"openid", "email"},
+		&mockoidc.SeedOptions{Code: "seeded-code", Nonce: "seeded-nonce"})
+	assert.NoError(t, err)
+	assert.Equal(t, "seeded", tokens.IDTokenClaims["sub"])
+	assert.Equal(t, "seeded-nonce", tokens.IDTokenClaims["nonce"])
+	assert.Equal(t, m.AccessTTL, tokens.ExpiresIn)
+
+	session, err := m.SessionStore.GetSessionByID("seeded-code")
+	assert.NoError(t, err)
+	assert.True(t, session.Granted)
+
+	req, err := http.NewRequest(http.MethodGet, m.UserinfoEndpoint(), nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	resp, err := httpClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp, err = httpClient.Post(m.TokenEndpoint(), "application/x-www-form-urlencoded",
+		strings.NewReader(url.Values{
+			"client_id":     {m.ClientID},
+			"client_secret": {m.ClientSecret},
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {tokens.RefreshToken},
+		}.Encode()))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Nothing went through the authorize & token endpoints to seed it
+	assert.Equal(t, uint64(0), m.RequestCount(mockoidc.AuthorizationEndpoint))
+
+	tokens, err = m.SeedSession(nil, nil, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.DefaultUser().ID(), tokens.IDTokenClaims["sub"])
+}
+
+func TestMockOIDC_CompleteCodeFlow_RequireNonce(t *testing.T) {
+	m := mockoidc.RunTB(t, func(m *mockoidc.MockOIDC) error {
+		m.RequireNonce = true
+		return nil
+	})
+
+	var nonce, challenge string
+	m.OnAuthorize = func(session *mockoidc.Session, _ *http.Request) error {
+		nonce, challenge = session.OIDCNonce, session.CodeChallenge
+		return nil
+	}
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, nonce)
+	assert.Equal(t, nonce, tokens.IDTokenClaims["nonce"])
+	assert.NotEmpty(t, challenge)
+
+	m.Compliance = mockoidc.ComplianceStrict
+	_, err = m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+
+	m.Compliance = ""
+	m.FAPIMode = true
+	_, err = m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.EqualError(t, err, "the FAPIMode flow needs a ClientKeypair to authenticate the client")
+
+	// It pushes the request & authenticates with private_key_jwt
+	m.ClientKeypair, err = mockoidc.NewECKeypair(nil)
+	assert.NoError(t, err)
+	_, err = m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), m.RequestCount(mockoidc.PushedAuthorizationEndpoint))
+}
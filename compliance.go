@@ -0,0 +1,86 @@
+package mockoidc
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ComplianceMode sets how pedantic MockOIDC's validation is, to emulate
+// rigorous or sloppy real-world providers with one mock. The zero value
+// keeps the behavior of the individual settings (`RequireNonce`,
+// `AuthorizeErrorsAsJSON`, ...). Modes don't turn those off.
+type ComplianceMode string
+
+const (
+	// ComplianceStrict requires a `nonce` on `openid` requests and PKCE
+	// from public clients (registered without a Secret), and the code
+	// exchange must present the authorization request's `redirect_uri`
+	ComplianceStrict ComplianceMode = "strict"
+	// ComplianceLenient doesn't require any optional parameter and accepts
+	// any `redirect_uri` at the code exchange
+	ComplianceLenient ComplianceMode = "lenient"
+	// ComplianceQuirky is lenient, matches registered `redirect_uri`s by
+	// prefix and renders authorization errors as JSON instead of
+	// redirecting them to the client, like some legacy providers do
+	ComplianceQuirky ComplianceMode = "quirky"
+)
+
+// ParseComplianceMode validates the name of a ComplianceMode. An empty name
+// is the zero value.
+func ParseComplianceMode(name string) (ComplianceMode, bool) {
+	switch mode := ComplianceMode(name); mode {
+	case "", ComplianceStrict, ComplianceLenient, ComplianceQuirky:
+		return mode, true
+	}
+	return "", false
+}
+
+func (m *MockOIDC) requireNonce() bool {
+	return m.RequireNonce || m.Compliance == ComplianceStrict
+}
+
+func (m *MockOIDC) authorizeErrorsAsJSON() bool {
+	return m.AuthorizeErrorsAsJSON || m.Compliance == ComplianceQuirky
+}
+
+func (m *MockOIDC) lenientRedirectURIs() bool {
+	return m.Compliance == ComplianceLenient || m.Compliance == ComplianceQuirky
+}
+
+// redirectURIRegistered compares the `redirect_uri` to the client's exactly,
+// or by prefix with ComplianceQuirky
+func (m *MockOIDC) redirectURIRegistered(client *Client, redirectURI string) bool {
+	if len(client.RedirectURIs) == 0 || containsString(client.RedirectURIs, redirectURI) {
+		return true
+	}
+	if m.Compliance != ComplianceQuirky {
+		return false
+	}
+	for _, registered := range client.RedirectURIs {
+		if strings.HasPrefix(redirectURI, registered) {
+			return true
+		}
+	}
+	return false
+}
+
+// requirePKCE rejects authorization requests of public clients without a
+// `code_challenge` under ComplianceStrict. It returns false if it already
+// responded.
+func (m *MockOIDC) requirePKCE(rw http.ResponseWriter, req *http.Request) bool {
+	if m.Compliance != ComplianceStrict || req.Form.Get("code_challenge") != "" {
+		return true
+	}
+	client, err := m.lookupClient(m.Config(), req.Form.Get("client_id"))
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return false
+	}
+	if client.Secret != "" {
+		return true
+	}
+	m.authorizeError(rw, req, InvalidRequest,
+		"Public clients must use PKCE: the request is missing the code_challenge",
+		http.StatusBadRequest)
+	return false
+}
@@ -0,0 +1,153 @@
+package mockoidc_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Compliance(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	m.ClientStore.(*mockoidc.MemoryClientStore).Add(&mockoidc.Client{
+		ID:           "public",
+		RedirectURIs: []string{"https://app.example.com/callback"},
+	})
+
+	authorize := func(params url.Values) *http.Response {
+		query := url.Values{
+			"client_id":     {m.ClientID},
+			"response_type": {"code"},
+			"scope":         {"openid"},
+			"state":         {"state"},
+			"redirect_uri":  {"https://app.example.com/callback"},
+		}
+		for k, v := range params {
+			query[k] = v
+		}
+		resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + query.Encode())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	authorizeError := func(params url.Values) string {
+		resp := authorize(params)
+		if resp.StatusCode != http.StatusFound {
+			return resp.Status
+		}
+		location, err := resp.Location()
+		assert.NoError(t, err)
+		return location.Query().Get("error")
+	}
+	exchange := func(code string, redirectURI []string) int {
+		form := url.Values{
+			"client_id":     {m.ClientID},
+			"client_secret": {m.ClientSecret},
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+		}
+		if redirectURI != nil {
+			form["redirect_uri"] = redirectURI
+		}
+		resp, err := httpClient.PostForm(m.TokenEndpoint(), form)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	code := func() string {
+		location, err := authorize(url.Values{"nonce": {"nonce"}}).Location()
+		assert.NoError(t, err)
+		return location.Query().Get("code")
+	}
+
+	m.Compliance = mockoidc.ComplianceStrict
+	assert.Equal(t, mockoidc.InvalidRequest, authorizeError(nil))
+	assert.Equal(t, mockoidc.InvalidRequest,
+		authorizeError(url.Values{"client_id": {"public"}, "nonce": {"nonce"}}))
+	assert.Equal(t, "", authorizeError(url.Values{
+		"client_id":      {"public"},
+		"nonce":          {"nonce"},
+		"code_challenge": {"challenge"},
+	}))
+	assert.Equal(t, http.StatusBadRequest, exchange(code(), nil))
+	assert.Equal(t, http.StatusOK, exchange(code(), []string{"https://app.example.com/callback"}))
+
+	m.Compliance = mockoidc.ComplianceLenient
+	assert.Equal(t, "", authorizeError(url.Values{"client_id": {"public"}}))
+	assert.Equal(t, http.StatusOK, exchange(code(), []string{"https://app.example.com/other"}))
+
+	m.Compliance = mockoidc.ComplianceQuirky
+	assert.Equal(t, "", authorizeError(url.Values{
+		"client_id":    {"public"},
+		"redirect_uri": {"https://app.example.com/callback/extra"},
+	}))
+	assert.Equal(t, "400 Bad Request", authorizeError(url.Values{"scope": {"unsupported"}}))
+}
+
+func TestMockOIDC_Compliance_PublicClient(t *testing.T) {
+	m := mockoidc.RunTB(t, func(m *mockoidc.MockOIDC) error {
+		m.Compliance = mockoidc.ComplianceStrict
+		return nil
+	})
+	m.ClientStore.(*mockoidc.MemoryClientStore).Add(&mockoidc.Client{
+		ID:           "public",
+		RedirectURIs: []string{"https://app.example.com/callback"},
+	})
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	login := func(verifier string) error {
+		resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+			"client_id":             {"public"},
+			"response_type":         {"code"},
+			"scope":                 {"openid"},
+			"state":                 {"state"},
+			"nonce":                 {"nonce"},
+			"redirect_uri":          {"https://app.example.com/callback"},
+			"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+			"code_challenge_method": {"S256"},
+		}.Encode())
+		assert.NoError(t, err)
+		if err = responseError("authorize", resp, http.StatusFound); err != nil {
+			return err
+		}
+		resp.Body.Close()
+		location, err := resp.Location()
+		assert.NoError(t, err)
+		assert.Empty(t, location.Query().Get("error"))
+
+		form := url.Values{
+			"client_id":    {"public"},
+			"grant_type":   {"authorization_code"},
+			"code":         {location.Query().Get("code")},
+			"redirect_uri": {"https://app.example.com/callback"},
+		}
+		if verifier != "" {
+			form.Set("code_verifier", verifier)
+		}
+		resp, err = httpClient.PostForm(m.TokenEndpoint(), form)
+		assert.NoError(t, err)
+		if err = responseError("token", resp, http.StatusOK); err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	// The PKCE strict mode requires from public clients is enough to log in
+	assert.NoError(t, login(verifier))
+	assert.EqualError(t, login(""), "token: 400 invalid_request")
+	assert.EqualError(t, login("wrong-verifier-wrong-verifier-wrong-verifier"), "token: 400 invalid_grant")
+}
+
+func TestParseComplianceMode(t *testing.T) {
+	mode, ok := mockoidc.ParseComplianceMode("quirky")
+	assert.True(t, ok)
+	assert.Equal(t, mockoidc.ComplianceQuirky, mode)
+	_, ok = mockoidc.ParseComplianceMode("pedantic")
+	assert.False(t, ok)
+}
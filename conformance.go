@@ -0,0 +1,152 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// authorizeParams are the required parameters of authorization requests.
+// `state` is only RECOMMENDED by the specs, ConformanceMode accepts requests
+// without it.
+func (m *MockOIDC) authorizeParams() []string {
+	if m.ConformanceMode {
+		return []string{"scope", "client_id", "response_type", "redirect_uri"}
+	}
+	return []string{"scope", "state", "client_id", "response_type", "redirect_uri"}
+}
+
+// ignoreUnsupportedScopes drops the scopes that aren't supported from an
+// authorization request, as RFC 6749 §3.3 lets servers do, instead of
+// failing it
+func ignoreUnsupportedScopes(supported []string, req *http.Request) {
+	allowed := make(map[string]struct{})
+	for _, scope := range supported {
+		allowed[scope] = struct{}{}
+	}
+	var scopes []string
+	for _, scope := range strings.Fields(req.Form.Get("scope")) {
+		if _, ok := allowed[scope]; ok {
+			scopes = append(scopes, scope)
+		}
+	}
+	req.Form.Set("scope", strings.Join(scopes, " "))
+}
+
+// clientAuthMethod applies the `token_endpoint_auth_methods_supported` to a
+// token request: `client_secret_basic` credentials are moved to the form,
+// the `client_id` of `private_key_jwt` requests defaults to the subject of
+// their assertion, and the other methods (`none` for public clients) are
+// rejected unless supported. It returns false if it already responded.
+func (m *MockOIDC) clientAuthMethod(rw http.ResponseWriter, req *http.Request) bool {
+	methods := m.tokenEndpointAuthMethods(m.supported())
+	if _, _, basic := req.BasicAuth(); basic && containsString(methods, "client_secret_basic") {
+		clientSecretBasic(req)
+		return true
+	}
+	if assertion := req.Form.Get("client_assertion"); assertion != "" && req.Form.Get("client_id") == "" {
+		// RFC 7523 §3 identifies the client by the assertion's subject
+		req.Form.Set("client_id", assertionSubject(assertion))
+	}
+
+	method := m.usedAuthMethod(req)
+	if method == "none" && !m.publicClient(m.Config(), req.Form.Get("client_id")) {
+		// Confidential clients are told which credentials they're missing
+		return true
+	}
+	if !containsString(methods, method) {
+		errorResponse(rw, InvalidClient, fmt.Sprintf("The %s method is not supported", method),
+			http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// usedAuthMethod is the `token_endpoint_auth_method` the client of a
+// request authenticated with, after `clientAuthMethod`
+func (m *MockOIDC) usedAuthMethod(req *http.Request) string {
+	methods := m.tokenEndpointAuthMethods(m.supported())
+	switch _, _, basic := req.BasicAuth(); {
+	case basic && containsString(methods, "client_secret_basic"):
+		return "client_secret_basic"
+	case req.Form.Get("client_assertion") != "" || req.Form.Get("client_assertion_type") != "":
+		return "private_key_jwt"
+	case req.Form.Get("client_secret") != "":
+		return "client_secret_post"
+	case m.tlsClient(m.Config(), req.Form.Get("client_id")):
+		return "tls_client_auth"
+	}
+	return "none"
+}
+
+// keyAuthenticated reports whether the client of a request authenticates
+// with a key (`private_key_jwt` or `tls_client_auth`) instead of a secret
+func (m *MockOIDC) keyAuthenticated(req *http.Request) bool {
+	method := m.usedAuthMethod(req)
+	return method == "private_key_jwt" || method == "tls_client_auth"
+}
+
+// clientSecretBasic moves `client_secret_basic` credentials from the
+// Authorization header to the form, where the token endpoint reads them.
+// Both are form-urlencoded per RFC 6749 §2.3.1.
+func clientSecretBasic(req *http.Request) {
+	id, secret, ok := req.BasicAuth()
+	if !ok {
+		return
+	}
+	if unescaped, err := url.QueryUnescape(id); err == nil {
+		id = unescaped
+	}
+	if unescaped, err := url.QueryUnescape(secret); err == nil {
+		secret = unescaped
+	}
+	req.Form.Set("client_id", id)
+	req.Form.Set("client_secret", secret)
+}
+
+// marshalTokenResponse renders `expires_in` in seconds in ConformanceMode
+// or with ExpiresInSeconds, rather than as a time.Duration, and adds the
+// TokenResponseExtras
+func (m *MockOIDC) marshalTokenResponse(tr *tokenResponse) ([]byte, error) {
+	rendered := *tr
+	if m.ConformanceMode || m.ExpiresInSeconds {
+		rendered.ExpiresIn = tr.ExpiresIn / time.Second
+	}
+	data, err := json.Marshal(&rendered)
+	if err != nil || len(m.TokenResponseExtras) == 0 {
+		return data, err
+	}
+
+	merged := make(map[string]interface{})
+	if err = json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range m.TokenResponseExtras {
+		if _, ok := merged[key]; !ok {
+			merged[key] = value
+		}
+	}
+	return json.Marshal(merged)
+}
+
+// tokenType is the `token_type` of token responses
+func (m *MockOIDC) tokenType() string {
+	if m.TokenType == "" {
+		return "bearer"
+	}
+	return m.TokenType
+}
+
+// userinfoWithSubject adds the `sub` claim, that userinfo responses must
+// have, to the ones rendered by a User
+func userinfoWithSubject(user User, userinfo []byte) ([]byte, error) {
+	claims := map[string]interface{}{}
+	if err := json.Unmarshal(userinfo, &claims); err != nil {
+		return nil, err
+	}
+	claims["sub"] = user.ID()
+	return json.Marshal(claims)
+}
@@ -0,0 +1,87 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_ConformanceMode(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+	m.ConformanceMode = true
+
+	// No state and an unsupported scope
+	resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+		"client_id":     {m.ClientID},
+		"response_type": {"code"},
+		"scope":         {"openid email address"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+	}.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := resp.Location()
+	assert.NoError(t, err)
+	code := location.Query().Get("code")
+	session, err := m.SessionStore.GetSessionByID(code)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"openid", "email"}, session.Scopes)
+
+	// client_secret_basic
+	req, err := http.NewRequest(http.MethodPost, m.TokenEndpoint(), strings.NewReader(url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {"https://app.example.com/callback"},
+	}.Encode()))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(m.ClientID), url.QueryEscape(m.ClientSecret))
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	tokens := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+	assert.EqualValues(t, m.AccessTTL/time.Second, tokens["expires_in"])
+
+	req, err = http.NewRequest(http.MethodGet, m.UserinfoEndpoint(), nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+tokens["access_token"].(string))
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	userinfo := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&userinfo))
+	assert.Equal(t, mockoidc.DefaultUser().ID(), userinfo["sub"])
+
+	tokenSet, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, m.AccessTTL, tokenSet.ExpiresIn)
+}
+
+func TestMockOIDC_ConformanceMode_Disabled(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+		"client_id":     {m.ClientID},
+		"response_type": {"code"},
+		"scope":         {"openid"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+	}.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := resp.Location()
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.InvalidRequest, location.Query().Get("error"))
+}
@@ -0,0 +1,125 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// AdminRequestCountsEndpoint serves the RequestCounts of a running
+// MockOIDC. A `DELETE` resets them.
+const AdminRequestCountsEndpoint = "/oidc/admin/request_counts"
+
+// RequestCount is the number of requests an endpoint (one of the
+// `*Endpoint` constants) received from a client with a grant type.
+type RequestCount struct {
+	Endpoint  string `json:"endpoint"`
+	ClientID  string `json:"client_id"`
+	GrantType string `json:"grant_type"`
+	Count     uint64 `json:"count"`
+}
+
+type requestCountKey struct {
+	endpoint  string
+	clientID  string
+	grantType string
+}
+
+// RequestCounter counts requests per endpoint, client & grant type since
+// it was created or last reset.
+type RequestCounter struct {
+	sync.Mutex
+	counts map[requestCountKey]uint64
+}
+
+// NewRequestCounter initializes an empty RequestCounter
+func NewRequestCounter() *RequestCounter {
+	return &RequestCounter{
+		counts: make(map[requestCountKey]uint64),
+	}
+}
+
+// Increment counts a request
+func (rc *RequestCounter) Increment(endpoint, clientID, grantType string) {
+	rc.Lock()
+	defer rc.Unlock()
+	rc.counts[requestCountKey{endpoint: endpoint, clientID: clientID, grantType: grantType}]++
+}
+
+// Count returns the number of requests to the endpoint. Non-empty clientID
+// and grantType filters only count matching requests.
+func (rc *RequestCounter) Count(endpoint, clientID, grantType string) uint64 {
+	rc.Lock()
+	defer rc.Unlock()
+
+	var total uint64
+	for key, count := range rc.counts {
+		if key.endpoint != endpoint ||
+			(clientID != "" && key.clientID != clientID) ||
+			(grantType != "" && key.grantType != grantType) {
+			continue
+		}
+		total += count
+	}
+	return total
+}
+
+// Counts returns all the non-zero RequestCounts
+func (rc *RequestCounter) Counts() []RequestCount {
+	rc.Lock()
+	defer rc.Unlock()
+
+	counts := make([]RequestCount, 0, len(rc.counts))
+	for key, count := range rc.counts {
+		counts = append(counts, RequestCount{
+			Endpoint:  key.endpoint,
+			ClientID:  key.clientID,
+			GrantType: key.grantType,
+			Count:     count,
+		})
+	}
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Endpoint != counts[j].Endpoint {
+			return counts[i].Endpoint < counts[j].Endpoint
+		}
+		if counts[i].ClientID != counts[j].ClientID {
+			return counts[i].ClientID < counts[j].ClientID
+		}
+		return counts[i].GrantType < counts[j].GrantType
+	})
+	return counts
+}
+
+// Reset clears all counts
+func (rc *RequestCounter) Reset() {
+	rc.Lock()
+	defer rc.Unlock()
+	rc.counts = make(map[requestCountKey]uint64)
+}
+
+// RequestCount returns the number of requests the endpoint (one of the
+// `*Endpoint` constants) received, e.g. to assert a relying party only hit
+// the `token_endpoint` once.
+func (m *MockOIDC) RequestCount(endpoint string) uint64 {
+	return m.RequestCounter.Count(endpoint, "", "")
+}
+
+// AdminRequestCounts implements the `AdminRequestCountsEndpoint`
+func (m *MockOIDC) AdminRequestCounts(rw http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		resp, err := json.Marshal(m.RequestCounter.Counts())
+		if err != nil {
+			internalServerError(rw, err.Error())
+			return
+		}
+		jsonResponse(rw, resp)
+	case http.MethodDelete:
+		m.RequestCounter.Reset()
+		rw.WriteHeader(http.StatusNoContent)
+	default:
+		errorResponse(rw, InvalidRequest, "Request counts only support GET & DELETE",
+			http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,90 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestCounter(t *testing.T) {
+	rc := mockoidc.NewRequestCounter()
+	rc.Increment(mockoidc.TokenEndpoint, "a", "authorization_code")
+	rc.Increment(mockoidc.TokenEndpoint, "a", "refresh_token")
+	rc.Increment(mockoidc.TokenEndpoint, "b", "refresh_token")
+	rc.Increment(mockoidc.TokenEndpoint, "b", "refresh_token")
+	rc.Increment(mockoidc.UserinfoEndpoint, "", "")
+
+	assert.Equal(t, uint64(4), rc.Count(mockoidc.TokenEndpoint, "", ""))
+	assert.Equal(t, uint64(2), rc.Count(mockoidc.TokenEndpoint, "a", ""))
+	assert.Equal(t, uint64(3), rc.Count(mockoidc.TokenEndpoint, "", "refresh_token"))
+	assert.Equal(t, uint64(2), rc.Count(mockoidc.TokenEndpoint, "b", "refresh_token"))
+	assert.Equal(t, uint64(1), rc.Count(mockoidc.UserinfoEndpoint, "", ""))
+	assert.Equal(t, uint64(0), rc.Count(mockoidc.JWKSEndpoint, "", ""))
+
+	assert.Equal(t, []mockoidc.RequestCount{
+		{Endpoint: mockoidc.TokenEndpoint, ClientID: "a", GrantType: "authorization_code", Count: 1},
+		{Endpoint: mockoidc.TokenEndpoint, ClientID: "a", GrantType: "refresh_token", Count: 1},
+		{Endpoint: mockoidc.TokenEndpoint, ClientID: "b", GrantType: "refresh_token", Count: 2},
+		{Endpoint: mockoidc.UserinfoEndpoint, Count: 1},
+	}, rc.Counts())
+
+	rc.Reset()
+	assert.Empty(t, rc.Counts())
+	assert.Equal(t, uint64(0), rc.Count(mockoidc.TokenEndpoint, "", ""))
+}
+
+func TestMockOIDC_RequestCount(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	for i := 0; i < 2; i++ {
+		resp, err := httpClient.Get(m.DiscoveryEndpoint())
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+	tokenForm := url.Values{}
+	tokenForm.Set("client_id", m.ClientID)
+	tokenForm.Set("grant_type", "refresh_token")
+	resp, err := httpClient.Post(m.TokenEndpoint(), "application/x-www-form-urlencoded",
+		strings.NewReader(tokenForm.Encode()))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, uint64(2), m.RequestCount(mockoidc.DiscoveryEndpoint))
+	assert.Equal(t, uint64(1), m.RequestCount(mockoidc.TokenEndpoint))
+	assert.Equal(t, uint64(1),
+		m.RequestCounter.Count(mockoidc.TokenEndpoint, m.ClientID, "refresh_token"))
+	assert.Equal(t, uint64(0), m.RequestCount(mockoidc.UserinfoEndpoint))
+
+	// Admin endpoint
+	countsURL := m.Addr() + mockoidc.AdminRequestCountsEndpoint
+	resp, err = httpClient.Get(countsURL)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var counts []mockoidc.RequestCount
+	err = json.NewDecoder(resp.Body).Decode(&counts)
+	assert.NoError(t, err)
+	assert.Contains(t, counts, mockoidc.RequestCount{
+		Endpoint: mockoidc.DiscoveryEndpoint, Count: 2})
+	assert.Contains(t, counts, mockoidc.RequestCount{
+		Endpoint: mockoidc.TokenEndpoint, ClientID: m.ClientID, GrantType: "refresh_token", Count: 1})
+
+	req, err := http.NewRequest(http.MethodDelete, countsURL, nil)
+	assert.NoError(t, err)
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	// Only the reset request itself remains
+	assert.Equal(t, uint64(0), m.RequestCount(mockoidc.DiscoveryEndpoint))
+	assert.Equal(t, uint64(1), m.RequestCount(mockoidc.AdminRequestCountsEndpoint))
+}
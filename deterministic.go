@@ -0,0 +1,56 @@
+package mockoidc
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// DeterministicEpoch is the time the clock of deterministic servers is
+// frozen at
+var DeterministicEpoch = time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// NewDeterministicServer configures a MockOIDC that isn't started and whose
+// tokens are byte-for-byte reproducible across runs, for golden file tests:
+// its clock is frozen at DeterministicEpoch (`FastForward` still moves it),
+// the client credentials are derived from the seed, tokens are signed with
+// the `DefaultKeypair`, sessions get sequential IDs and the nonces of
+// `CompleteCodeFlow` are derived from the seed too. Issuers are part of
+// the tokens, so serve it on a fixed address or with the in-process
+// `Transport`, and keep the default SessionStore.
+func NewDeterministicServer(seed int64) (*MockOIDC, error) {
+	m, err := NewServer(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	m.ClientID = seededNonce(rng, 24)
+	m.ClientSecret = seededNonce(rng, 24)
+	m.frozenAt = DeterministicEpoch
+	m.epoch = DeterministicEpoch
+
+	// Codes are generated with the queue locked
+	sequence := 0
+	m.SessionStore.(*MemorySessionStore).CodeQueue.NewCode = func() (string, error) {
+		sequence++
+		return fmt.Sprintf("session-%06d", sequence), nil
+	}
+	// CompleteCodeFlow may run concurrently, unlike rand.Rand
+	var rngMu sync.Mutex
+	m.flowNonce = func(length int) (string, error) {
+		rngMu.Lock()
+		defer rngMu.Unlock()
+		return seededNonce(rng, length), nil
+	}
+	return m, nil
+}
+
+func seededNonce(rng *rand.Rand, length int) string {
+	b := make([]byte, length)
+	// rand.Rand.Read always succeeds
+	_, _ = rng.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,39 @@
+package mockoidc_test
+
+import (
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewDeterministicServer(t *testing.T) {
+	flow := func(seed int64) (*mockoidc.MockOIDC, *mockoidc.TokenSet) {
+		m, err := mockoidc.NewDeterministicServer(seed)
+		assert.NoError(t, err)
+		m.Transport()
+
+		user := &mockoidc.MockUser{Subject: "golden", Email: "golden@example.com"}
+		tokens, err := m.CompleteCodeFlow(user, "https://app.example.com/callback",
+			[]string{"openid", "email"})
+		assert.NoError(t, err)
+		return m, tokens
+	}
+
+	first, tokens := flow(42)
+	second, replayed := flow(42)
+	assert.Equal(t, first.ClientID, second.ClientID)
+	assert.Equal(t, first.ClientSecret, second.ClientSecret)
+	assert.Equal(t, tokens.AccessToken, replayed.AccessToken)
+	assert.Equal(t, tokens.RefreshToken, replayed.RefreshToken)
+	assert.Equal(t, tokens.IDToken, replayed.IDToken)
+
+	assert.Equal(t, mockoidc.DeterministicEpoch, first.Now())
+	assert.Equal(t, "session-000001", tokens.IDTokenClaims["jti"])
+	assert.Equal(t, float64(mockoidc.DeterministicEpoch.Unix()), tokens.IDTokenClaims["iat"])
+
+	_, tokens = flow(42)
+	other, _ := flow(7)
+	assert.NotEqual(t, first.ClientID, other.ClientID)
+	assert.Equal(t, replayed.IDToken, tokens.IDToken)
+}
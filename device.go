@@ -0,0 +1,332 @@
+package mockoidc
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// The Device Authorization Grant (RFC 8628) lets input-constrained clients
+// like CLIs log users in on another device: the `DeviceAuthorizationEndpoint`
+// issues a `device_code` & `user_code` pair, the user approves the code at
+// the `DeviceVerificationEndpoint`, and the client polls the
+// `token_endpoint` with the `device_code` meanwhile. The device
+// authorization endpoint is advertised as the `device_authorization_endpoint`
+// in the discovery document.
+const (
+	DeviceAuthorizationEndpoint = "/oidc/device_authorization"
+	DeviceVerificationEndpoint  = "/oidc/device"
+
+	AuthorizationPending = "authorization_pending"
+	ExpiredToken         = "expired_token"
+
+	deviceCodeGrant = "urn:ietf:params:oauth:grant-type:device_code"
+
+	// defaultDeviceCodeTTL is the TTL when DeviceCodeTTL is zero
+	defaultDeviceCodeTTL = 10 * time.Minute
+
+	// User codes are 8 consonants (RFC 8628 section 6.1), hyphenated
+	// in the middle for display
+	userCodeAlphabet = "BCDFGHJKLMNPQRSTVWXZ"
+	userCodeLength   = 8
+)
+
+// deviceAuthorization is a pending device authorization request, until its
+// `device_code` is exchanged
+type deviceAuthorization struct {
+	deviceCode string
+	userCode   string
+	clientID   string
+	scope      string
+	expiresAt  time.Time
+	pacer      pollPacer
+	// sessionID is set once a User approved the `user_code`
+	sessionID string
+}
+
+// deviceAuthorizationResponse is the response of the
+// `DeviceAuthorizationEndpoint` (RFC 8628 section 3.2)
+type deviceAuthorizationResponse struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete"`
+	ExpiresIn               int64  `json:"expires_in"`
+	Interval                int64  `json:"interval"`
+}
+
+// DeviceVerificationData is rendered by the `DeviceVerificationPage`
+// template. UserCode is empty until a code was entered; Error is set when
+// it couldn't be approved.
+type DeviceVerificationData struct {
+	UserCode string
+	Approved bool
+	Error    string
+}
+
+var deviceVerificationTemplate = template.Must(template.New(DeviceVerificationPage).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>mockoidc device verification</title>
+` + harnessStyle + `
+</head>
+<body>
+<h1>Device Verification</h1>
+{{if .Approved}}<p data-testid="approved">The device with the code {{.UserCode}} is approved. You may close this page.</p>
+{{else}}{{if .Error}}<p data-testid="error">{{.Error}}</p>
+{{end}}<form method="post">
+<label>Code <input data-testid="user-code" name="user_code" value="{{.UserCode}}" autofocus></label>
+<button data-testid="approve" type="submit">Approve</button>
+</form>
+{{end}}</body>
+</html>
+`))
+
+// DeviceAuthorizationEndpoint returns the OAuth2
+// `device_authorization_endpoint`
+func (m *MockOIDC) DeviceAuthorizationEndpoint() string {
+	if m.Server == nil {
+		return ""
+	}
+	return m.Addr() + m.endpointPath(DeviceAuthorizationEndpoint)
+}
+
+// DeviceVerificationEndpoint returns the `verification_uri` users approve
+// device codes at
+func (m *MockOIDC) DeviceVerificationEndpoint() string {
+	if m.Server == nil {
+		return ""
+	}
+	return m.Addr() + m.endpointPath(DeviceVerificationEndpoint)
+}
+
+// DeviceAuthorization implements the `device_authorization_endpoint`. The
+// client's credentials are only checked if it sends them, as device clients
+// are often public. Requests are rejected while the device grant isn't
+// supported or is disabled.
+func (m *MockOIDC) DeviceAuthorization(rw http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	if m.grant(m.supported(), deviceCodeGrant) == nil {
+		errorResponse(rw, UnauthorizedClient, "The device authorization grant is not enabled",
+			http.StatusBadRequest)
+		return
+	}
+
+	config := m.requestConfig(req)
+	if !m.clientAuthMethod(rw, req) {
+		return
+	}
+	if !assertPresence([]string{"client_id"}, rw, req) {
+		return
+	}
+	authenticated := req.Form.Get("client_secret") != "" || m.keyAuthenticated(req)
+	if !m.validateClient(config, authenticated, rw, req) {
+		return
+	}
+	normalizeScope(m.supported().scopes, req)
+	if !validateScope(m.supported().scopes, rw, req) {
+		return
+	}
+
+	device, err := m.newDeviceAuthorization(config.ClientID, req.Form.Get("scope"))
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	verificationURI := m.requestAddr(req) + m.endpointPath(DeviceVerificationEndpoint)
+	resp, err := json.Marshal(&deviceAuthorizationResponse{
+		DeviceCode:      device.deviceCode,
+		UserCode:        device.userCode,
+		VerificationURI: verificationURI,
+		VerificationURIComplete: verificationURI + "?" +
+			url.Values{"user_code": {device.userCode}}.Encode(),
+		ExpiresIn: int64(m.deviceCodeTTL() / time.Second),
+		Interval:  int64(device.pacer.interval / time.Second),
+	})
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	jsonResponse(rw, resp)
+}
+
+// newDeviceAuthorization issues a `device_code` & `user_code` pair
+func (m *MockOIDC) newDeviceAuthorization(clientID, scope string) (*deviceAuthorization, error) {
+	deviceCode, err := randomNonce(24)
+	if err != nil {
+		return nil, err
+	}
+	userCode, err := randomUserCode()
+	if err != nil {
+		return nil, err
+	}
+	device := &deviceAuthorization{
+		deviceCode: deviceCode,
+		userCode:   userCode,
+		clientID:   clientID,
+		scope:      scope,
+		expiresAt:  m.Now().Add(m.deviceCodeTTL()),
+		pacer:      m.newPollPacer(),
+	}
+
+	m.devicesMu.Lock()
+	defer m.devicesMu.Unlock()
+	if m.devices == nil {
+		m.devices = map[string]*deviceAuthorization{}
+	}
+	m.devices[deviceCode] = device
+	return device, nil
+}
+
+// deviceCodeTTL is the configured TTL or its default
+func (m *MockOIDC) deviceCodeTTL() time.Duration {
+	if m.DeviceCodeTTL <= 0 {
+		return defaultDeviceCodeTTL
+	}
+	return m.DeviceCodeTTL
+}
+
+// DeviceVerification implements the `DeviceVerificationEndpoint`. The
+// `user_code`, entered in its form or passed in the
+// `verification_uri_complete`, is approved for the next queued User.
+func (m *MockOIDC) DeviceVerification(rw http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+
+	page := &DeviceVerificationData{UserCode: req.Form.Get("user_code")}
+	if page.UserCode == "" {
+		m.renderPage(rw, http.StatusOK, DeviceVerificationPage, page)
+		return
+	}
+	if err := m.ApproveDevice(page.UserCode); err != nil {
+		page.Error = err.Error()
+		m.renderPage(rw, http.StatusBadRequest, DeviceVerificationPage, page)
+		return
+	}
+	page.Approved = true
+	m.renderPage(rw, http.StatusOK, DeviceVerificationPage, page)
+}
+
+// ApproveDevice logs the next queued User in for the pending device
+// authorization of the `user_code`, like the `DeviceVerificationEndpoint`
+// does. User codes are case-insensitive and their hyphens optional.
+func (m *MockOIDC) ApproveDevice(userCode string) error {
+	userCode = normalizeUserCode(userCode)
+	now := m.Now()
+
+	m.devicesMu.Lock()
+	defer m.devicesMu.Unlock()
+	var device *deviceAuthorization
+	for _, d := range m.devices {
+		if normalizeUserCode(d.userCode) == userCode && now.Before(d.expiresAt) {
+			device = d
+			break
+		}
+	}
+	if device == nil {
+		return errors.New("the code is invalid or expired")
+	}
+	if device.sessionID != "" {
+		return errors.New("the code was already approved")
+	}
+
+	session, err := m.newLoginSession(device.scope, "")
+	if err != nil {
+		return err
+	}
+	session.ClientID = device.clientID
+	session.IssuedAt, session.AuthTime = now, now
+	if err = m.SessionStore.Save(session); err != nil {
+		return err
+	}
+	device.sessionID = session.SessionID
+	return nil
+}
+
+// validateDeviceCodeGrant answers the polling of a `device_code` with
+// `authorization_pending` until it is approved, `slow_down` if it is polled
+// faster than its interval (unless LenientDevicePolling) and
+// `expired_token` once expired. Approved codes can be exchanged once.
+func (m *MockOIDC) validateDeviceCodeGrant(rw http.ResponseWriter, req *http.Request) (*Session, bool) {
+	if !assertPresence([]string{"device_code"}, rw, req) {
+		return nil, false
+	}
+	now := m.Now()
+
+	m.devicesMu.Lock()
+	defer m.devicesMu.Unlock()
+	deviceCode := req.Form.Get("device_code")
+	device, ok := m.devices[deviceCode]
+	if !ok || device.clientID != req.Form.Get("client_id") {
+		errorResponse(rw, InvalidGrant, "Invalid device code", http.StatusBadRequest)
+		return nil, false
+	}
+	if !now.Before(device.expiresAt) {
+		delete(m.devices, deviceCode)
+		errorResponse(rw, ExpiredToken, "The device code expired", http.StatusBadRequest)
+		return nil, false
+	}
+	if !device.pacer.poll(now, m.LenientDevicePolling) {
+		errorResponse(rw, SlowDown, "The device code is polled too fast",
+			http.StatusBadRequest)
+		return nil, false
+	}
+	if device.sessionID == "" {
+		errorResponse(rw, AuthorizationPending, "The device code is not approved yet",
+			http.StatusBadRequest)
+		return nil, false
+	}
+
+	delete(m.devices, deviceCode)
+	session, err := m.SessionStore.GetSessionByID(device.sessionID)
+	if err != nil {
+		errorResponse(rw, InvalidGrant, "Invalid device code", http.StatusBadRequest)
+		return nil, false
+	}
+	session.Granted = true
+	if err = m.SessionStore.Save(session); err != nil {
+		internalServerError(rw, err.Error())
+		return nil, false
+	}
+	return session, true
+}
+
+// clearDevices drops the pending device authorizations
+func (m *MockOIDC) clearDevices() {
+	m.devicesMu.Lock()
+	defer m.devicesMu.Unlock()
+	m.devices = nil
+}
+
+func randomUserCode() (string, error) {
+	code := make([]byte, 0, userCodeLength+1)
+	max := big.NewInt(int64(len(userCodeAlphabet)))
+	for i := 0; i < userCodeLength; i++ {
+		if i == userCodeLength/2 {
+			code = append(code, '-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code = append(code, userCodeAlphabet[n.Int64()])
+	}
+	return string(code), nil
+}
+
+// normalizeUserCode makes user codes typed in by users comparable
+func normalizeUserCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
@@ -0,0 +1,211 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_DeviceAuthorizationGrant(t *testing.T) {
+	m := mockoidc.RunTB(t)
+
+	post := func(endpoint string, form url.Values) (int, map[string]interface{}) {
+		req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := httpClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp.StatusCode, body
+	}
+	authorize := func() map[string]interface{} {
+		code, body := post(m.DeviceAuthorizationEndpoint(), url.Values{
+			"client_id": {m.ClientID},
+			"scope":     {"openid email"},
+		})
+		assert.Equal(t, http.StatusOK, code)
+		return body
+	}
+	poll := func(deviceCode string) (int, map[string]interface{}) {
+		return post(m.TokenEndpoint(), url.Values{
+			"client_id":     {m.ClientID},
+			"client_secret": {m.ClientSecret},
+			"grant_type":    {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code":   {deviceCode},
+		})
+	}
+	verify := func(uri string) (int, string) {
+		resp, err := httpClient.Get(uri)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	resp, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	discovery := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&discovery))
+	resp.Body.Close()
+	assert.Equal(t, m.DeviceAuthorizationEndpoint(), discovery["device_authorization_endpoint"])
+	assert.Contains(t, discovery["grant_types_supported"],
+		"urn:ietf:params:oauth:grant-type:device_code")
+
+	device := authorize()
+	deviceCode := device["device_code"].(string)
+	assert.Regexp(t, `^[B-Z]{4}-[B-Z]{4}$`, device["user_code"])
+	assert.Equal(t, m.DeviceVerificationEndpoint(), device["verification_uri"])
+	assert.Equal(t, m.DeviceVerificationEndpoint()+"?user_code="+device["user_code"].(string),
+		device["verification_uri_complete"])
+	assert.Equal(t, float64(600), device["expires_in"])
+	assert.Equal(t, float64(5), device["interval"])
+
+	code, body := poll(deviceCode)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, mockoidc.AuthorizationPending, body["error"])
+
+	// Polling faster than the interval slows the client down by 5 seconds
+	code, body = poll(deviceCode)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, mockoidc.SlowDown, body["error"])
+	m.FastForward(5 * time.Second)
+	_, body = poll(deviceCode)
+	assert.Equal(t, mockoidc.SlowDown, body["error"])
+	m.FastForward(15 * time.Second)
+	_, body = poll(deviceCode)
+	assert.Equal(t, mockoidc.AuthorizationPending, body["error"])
+
+	// A queued User approves the code, typed in lowercase without a hyphen
+	status, page := verify(m.DeviceVerificationEndpoint())
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, page, `data-testid="user-code"`)
+	m.QueueUser(&mockoidc.MockUser{Subject: "device-user", Email: "device@example.com"})
+	userCode := strings.ToLower(strings.Replace(device["user_code"].(string), "-", "", 1))
+	status, page = verify(m.DeviceVerificationEndpoint() + "?user_code=" + userCode)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Contains(t, page, `data-testid="approved"`)
+	status, page = verify(device["verification_uri_complete"].(string))
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Contains(t, page, "the code was already approved")
+
+	m.FastForward(15 * time.Second)
+	code, body = poll(deviceCode)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEmpty(t, body["refresh_token"])
+	claims := jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(body["id_token"].(string), claims)
+	assert.NoError(t, err)
+	assert.Equal(t, "device-user", claims["sub"])
+	assert.Equal(t, "device@example.com", claims["email"])
+
+	// Device codes are exchanged once
+	code, body = poll(deviceCode)
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, mockoidc.InvalidGrant, body["error"])
+
+	device = authorize()
+	m.FastForward(11 * time.Minute)
+	status, _ = verify(device["verification_uri_complete"].(string))
+	assert.Equal(t, http.StatusBadRequest, status)
+	_, body = poll(device["device_code"].(string))
+	assert.Equal(t, mockoidc.ExpiredToken, body["error"])
+
+	// Other clients can't poll the code
+	m.ClientStore.(*mockoidc.MemoryClientStore).Add(&mockoidc.Client{ID: "other", Secret: "secret"})
+	device = authorize()
+	code, body = post(m.TokenEndpoint(), url.Values{
+		"client_id":     {"other"},
+		"client_secret": {"secret"},
+		"grant_type":    {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code":   {device["device_code"].(string)},
+	})
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, mockoidc.InvalidGrant, body["error"])
+}
+
+func TestMockOIDC_DeviceAuthorizationGrant_Pacing(t *testing.T) {
+	m := mockoidc.RunTB(t, func(m *mockoidc.MockOIDC) error {
+		m.DevicePollInterval = time.Minute
+		m.DeviceCodeTTL = time.Hour
+		m.LenientDevicePolling = true
+		return nil
+	})
+
+	form := url.Values{"client_id": {m.ClientID}, "scope": {"openid"}}
+	resp, err := httpClient.PostForm(m.DeviceAuthorizationEndpoint(), form)
+	assert.NoError(t, err)
+	device := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&device))
+	resp.Body.Close()
+	assert.Equal(t, float64(3600), device["expires_in"])
+	assert.Equal(t, float64(60), device["interval"])
+
+	for i := 0; i < 3; i++ {
+		resp, err = httpClient.PostForm(m.TokenEndpoint(), url.Values{
+			"client_id":     {m.ClientID},
+			"client_secret": {m.ClientSecret},
+			"grant_type":    {"urn:ietf:params:oauth:grant-type:device_code"},
+			"device_code":   {device["device_code"].(string)},
+		})
+		assert.NoError(t, err)
+		body := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		resp.Body.Close()
+		assert.Equal(t, mockoidc.AuthorizationPending, body["error"])
+	}
+}
+
+func TestMockOIDC_DeviceAuthorizationGrant_PublicClient(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	m.ClientStore.(*mockoidc.MemoryClientStore).Add(&mockoidc.Client{ID: "public-device"})
+
+	post := func(endpoint string, form url.Values) (int, map[string]interface{}) {
+		resp, err := httpClient.PostForm(endpoint, form)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp.StatusCode, body
+	}
+
+	code, device := post(m.DeviceAuthorizationEndpoint(), url.Values{
+		"client_id": {"public-device"},
+		"scope":     {"openid"},
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.NoError(t, m.ApproveDevice(device["user_code"].(string)))
+
+	code, body := post(m.TokenEndpoint(), url.Values{
+		"client_id":   {"public-device"},
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {device["device_code"].(string)},
+	})
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotEmpty(t, body["access_token"])
+	assert.NotEmpty(t, body["id_token"])
+
+	// Confidential clients still need their secret
+	code, device = post(m.DeviceAuthorizationEndpoint(), url.Values{
+		"client_id": {m.ClientID},
+		"scope":     {"openid"},
+	})
+	assert.Equal(t, http.StatusOK, code)
+	code, body = post(m.TokenEndpoint(), url.Values{
+		"client_id":   {m.ClientID},
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {device["device_code"].(string)},
+	})
+	assert.Equal(t, http.StatusUnauthorized, code)
+	assert.Equal(t, mockoidc.InvalidClient, body["error"])
+}
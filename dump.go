@@ -0,0 +1,139 @@
+package mockoidc
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Redacted replaces sensitive values in wire dumps when RedactDumps is set
+const Redacted = "REDACTED"
+
+// RedactedParams are the form, query & JSON parameters that are redacted
+// in wire dumps.
+var RedactedParams = []string{
+	"access_token",
+	"refresh_token",
+	"id_token",
+	"client_secret",
+	"code",
+	"code_verifier",
+	"client_assertion",
+	"device_code",
+}
+
+var redactedHeaders = regexp.MustCompile(`(?im)^(Authorization|Cookie|Set-Cookie):.*$`)
+
+// paramRedactor holds the patterns compiled for one RedactedParams value
+type paramRedactor struct {
+	form      *regexp.Regexp
+	jsonField *regexp.Regexp
+}
+
+var (
+	paramRedactorsMutex sync.Mutex
+	paramRedactors      = make(map[string]*paramRedactor)
+)
+
+// redactorFor compiles the patterns for the params once and caches them,
+// so changing RedactedParams takes effect on the next dump.
+func redactorFor(params []string) *paramRedactor {
+	quoted := make([]string, 0, len(params))
+	for _, param := range params {
+		quoted = append(quoted, regexp.QuoteMeta(param))
+	}
+	alternation := strings.Join(quoted, "|")
+
+	paramRedactorsMutex.Lock()
+	defer paramRedactorsMutex.Unlock()
+	if r, ok := paramRedactors[alternation]; ok {
+		return r
+	}
+	r := &paramRedactor{
+		form:      regexp.MustCompile(`([?&\s]|^)(` + alternation + `)=[^&\s]*`),
+		jsonField: regexp.MustCompile(`"(` + alternation + `)"(\s*):(\s*)"[^"]*"`),
+	}
+	paramRedactors[alternation] = r
+	return r
+}
+
+// dump wraps an endpoint handler to log the full wire format of the request
+// and response when DumpRequests is enabled.
+func (m *MockOIDC) dump(endpoint string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		if !m.DumpRequests {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		reqDump, err := httputil.DumpRequest(req, true)
+		if err != nil {
+			m.logger().Error("unable to dump request",
+				"endpoint", endpointName(endpoint), "error", err)
+		}
+		dr := &dumpRecorder{ResponseWriter: rw, code: http.StatusOK}
+		next.ServeHTTP(dr, req)
+
+		m.logger().Info("wire dump",
+			"endpoint", endpointName(endpoint),
+			"request", m.redact(string(reqDump)),
+			"response", m.redact(dr.String()),
+		)
+	})
+}
+
+func (m *MockOIDC) redact(dump string) string {
+	if !m.RedactDumps {
+		return dump
+	}
+	dump = redactedHeaders.ReplaceAllString(dump, "$1: "+Redacted)
+	r := redactorFor(RedactedParams)
+	dump = r.form.ReplaceAllString(dump, "$1$2="+Redacted)
+	return r.jsonField.ReplaceAllString(dump, `"$1"$2:$3"`+Redacted+`"`)
+}
+
+// dumpRecorder keeps a copy of everything written to the response
+type dumpRecorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+}
+
+func (dr *dumpRecorder) Unwrap() http.ResponseWriter {
+	return dr.ResponseWriter
+}
+
+func (dr *dumpRecorder) WriteHeader(code int) {
+	dr.code = code
+	dr.ResponseWriter.WriteHeader(code)
+}
+
+func (dr *dumpRecorder) Write(data []byte) (int, error) {
+	dr.body.Write(data)
+	return dr.ResponseWriter.Write(data)
+}
+
+// String renders the response in its HTTP/1.1 wire format
+func (dr *dumpRecorder) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "HTTP/1.1 %d %s\r\n", dr.code, http.StatusText(dr.code))
+	header := dr.Header()
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		for _, value := range header[key] {
+			fmt.Fprintf(&b, "%s: %s\r\n", key, value)
+		}
+	}
+	b.WriteString("\r\n")
+	b.Write(dr.body.Bytes())
+	return b.String()
+}
@@ -0,0 +1,145 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+type logEvent struct {
+	msg    string
+	fields map[string]interface{}
+}
+
+// recordingLogger keeps all events for test assertions
+type recordingLogger struct {
+	sync.Mutex
+	events []logEvent
+}
+
+func (l *recordingLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.record(msg, keysAndValues)
+}
+
+func (l *recordingLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.record(msg, keysAndValues)
+}
+
+func (l *recordingLogger) record(msg string, keysAndValues []interface{}) {
+	l.Lock()
+	defer l.Unlock()
+	fields := make(map[string]interface{})
+	for i := 0; i+1 < len(keysAndValues); i += 2 {
+		fields[keysAndValues[i].(string)] = keysAndValues[i+1]
+	}
+	l.events = append(l.events, logEvent{msg: msg, fields: fields})
+}
+
+func (l *recordingLogger) find(msg string) []logEvent {
+	l.Lock()
+	defer l.Unlock()
+	var found []logEvent
+	for _, event := range l.events {
+		if event.msg == msg {
+			found = append(found, event)
+		}
+	}
+	return found
+}
+
+func TestMockOIDC_DumpRequests(t *testing.T) {
+	for name, redact := range map[string]bool{
+		"plain":    false,
+		"redacted": true,
+	} {
+		t.Run(name, func(t *testing.T) {
+			logger := &recordingLogger{}
+			m, err := mockoidc.NewServer(nil)
+			assert.NoError(t, err)
+			m.Logger = logger
+			m.DumpRequests = true
+			m.RedactDumps = redact
+			client := m.Client()
+
+			session, err := m.SessionStore.NewSession("openid", "", mockoidc.DefaultUser())
+			assert.NoError(t, err)
+
+			tokenForm := url.Values{}
+			tokenForm.Set("client_id", m.ClientID)
+			tokenForm.Set("client_secret", m.ClientSecret)
+			tokenForm.Set("grant_type", "authorization_code")
+			tokenForm.Set("code", session.SessionID)
+			resp, err := client.Post(m.TokenEndpoint(), "application/x-www-form-urlencoded",
+				strings.NewReader(tokenForm.Encode()))
+			assert.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			dumps := logger.find("wire dump")
+			assert.Len(t, dumps, 1)
+			assert.Equal(t, "token", dumps[0].fields["endpoint"])
+			request := dumps[0].fields["request"].(string)
+			response := dumps[0].fields["response"].(string)
+
+			assert.True(t, strings.HasPrefix(request, "POST "+mockoidc.TokenEndpoint+" HTTP/1.1"))
+			assert.Contains(t, request, "client_id="+m.ClientID)
+			assert.Contains(t, request, "grant_type=authorization_code")
+			assert.True(t, strings.HasPrefix(response, "HTTP/1.1 200 OK\r\n"))
+			assert.Contains(t, response, "Content-Type: application/json")
+
+			if redact {
+				assert.NotContains(t, request, m.ClientSecret)
+				assert.NotContains(t, request, session.SessionID)
+				assert.Contains(t, request, "client_secret="+mockoidc.Redacted)
+				assert.Contains(t, request, "code="+mockoidc.Redacted)
+				assert.Contains(t, response, `"access_token":"`+mockoidc.Redacted+`"`)
+				assert.Contains(t, response, `"id_token":"`+mockoidc.Redacted+`"`)
+			} else {
+				assert.Contains(t, request, "client_secret="+m.ClientSecret)
+				assert.Contains(t, request, "code="+session.SessionID)
+				assert.NotContains(t, response, mockoidc.Redacted)
+			}
+		})
+	}
+}
+
+func TestMockOIDC_DumpRequests_Disabled(t *testing.T) {
+	logger := &recordingLogger{}
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.Logger = logger
+
+	resp, err := m.Client().Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Empty(t, logger.find("wire dump"))
+	assert.Len(t, logger.find("request"), 1)
+}
+
+func TestMockOIDC_DumpRequests_RedactedParamsQuoted(t *testing.T) {
+	defer func(params []string) { mockoidc.RedactedParams = params }(mockoidc.RedactedParams)
+	mockoidc.RedactedParams = []string{"id.token"}
+
+	logger := &recordingLogger{}
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.Logger = logger
+	m.DumpRequests = true
+	m.RedactDumps = true
+
+	resp, err := m.Client().Get(m.DiscoveryEndpoint() + "?id.token=secret&idxtoken=visible")
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	dumps := logger.find("wire dump")
+	assert.Len(t, dumps, 1)
+	request := dumps[0].fields["request"].(string)
+	assert.Contains(t, request, "id.token="+mockoidc.Redacted)
+	assert.Contains(t, request, "idxtoken=visible")
+}
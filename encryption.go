@@ -2,12 +2,16 @@ package mockoidc
 
 import (
 	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
+	"fmt"
 
 	"github.com/dgrijalva/jwt-go"
 	"gopkg.in/square/go-jose.v2"
@@ -37,11 +41,18 @@ const DefaultKey = `MIIEowIBAAKCAQEAtI1Jf2zmfwLzpAjVarORtjKtmCHQtgNxqWDdVNVa` +
 	`b-reOmP3tZyZxDyX2zFyjkJpu2SWd5TlAL59vP3dzx-uyj6boWCCZHxzepli5eHXOeVW-S-` +
 	`gwlCAF0U0n_XJ7Qhv0_SQnxSqT-D6V1-KbbeXnO7w`
 
-// Keypair is an RSA Keypair & JWT KeyID used for OIDC Token signing
+// Keypair is an RSA (or ECDSA) Keypair & JWT KeyID used for OIDC Token
+// signing
 type Keypair struct {
 	PrivateKey *rsa.PrivateKey
 	PublicKey  *rsa.PublicKey
-	Kid        string
+	// ECPrivateKey is a P-256 key signing with `ES256` instead of the RSA
+	// key, see `NewECKeypair`
+	ECPrivateKey *ecdsa.PrivateKey
+	Kid          string
+	// Alg is the JWT signing algorithm of the RSA key, `RS256` if empty or
+	// `PS256`
+	Alg string
 }
 
 // NewKeypair makes a Keypair off the provided rsa.PrivateKey or returns
@@ -72,6 +83,25 @@ func RandomKeypair(size int) (*Keypair, error) {
 	}, nil
 }
 
+// NewECKeypair makes an `ES256` Keypair off the provided P-256
+// ecdsa.PrivateKey, or a random one if nil was passed
+func NewECKeypair(key *ecdsa.PrivateKey) (*Keypair, error) {
+	if key == nil {
+		var err error
+		if key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+			return nil, err
+		}
+	}
+	if key.Curve != elliptic.P256() {
+		return nil, errors.New("ES256 requires a P-256 key")
+	}
+
+	return &Keypair{
+		ECPrivateKey: key,
+		Alg:          jwt.SigningMethodES256.Alg(),
+	}, nil
+}
+
 // Returns the default Keypair built from DefaultKey
 func DefaultKeypair() (*Keypair, error) {
 	keyBytes, err := base64.RawURLEncoding.DecodeString(DefaultKey)
@@ -89,13 +119,39 @@ func DefaultKeypair() (*Keypair, error) {
 	}, nil
 }
 
+// ParseKeypairPEM makes a Keypair off a PEM encoded RSA (PKCS #1) or EC
+// (SEC 1) private key, or either in PKCS #8
+func ParseKeypairPEM(data []byte) (*Keypair, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM encoded key found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return NewKeypair(key)
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return NewECKeypair(key)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse the private key: %v", err)
+	}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		return NewKeypair(key)
+	case *ecdsa.PrivateKey:
+		return NewECKeypair(key)
+	}
+	return nil, fmt.Errorf("unsupported private key type %T", key)
+}
+
 // If not manually set, computes the JWT headers' `kid`
 func (k *Keypair) KeyID() (string, error) {
 	if k.Kid != "" {
 		return k.Kid, nil
 	}
 
-	publicKeyDERBytes, err := x509.MarshalPKIXPublicKey(k.PublicKey)
+	publicKeyDERBytes, err := x509.MarshalPKIXPublicKey(k.publicKey())
 	if err != nil {
 		return "", err
 	}
@@ -111,19 +167,12 @@ func (k *Keypair) KeyID() (string, error) {
 	return k.Kid, nil
 }
 
-// JWKS is the JSON JWKS representation of the rsa.PublicKey
+// JWKS is the JSON JWKS representation of the public key
 func (k *Keypair) JWKS() ([]byte, error) {
-	kid, err := k.KeyID()
+	jwk, err := k.jwk()
 	if err != nil {
 		return nil, err
 	}
-
-	jwk := jose.JSONWebKey{
-		Use:       "sig",
-		Algorithm: string(jose.RS256),
-		Key:       k.PublicKey,
-		KeyID:     kid,
-	}
 	jwks := &jose.JSONWebKeySet{
 		Keys: []jose.JSONWebKey{jwk},
 	}
@@ -131,31 +180,95 @@ func (k *Keypair) JWKS() ([]byte, error) {
 	return json.Marshal(jwks)
 }
 
+// jwk is the JWK of the public key
+func (k *Keypair) jwk() (jose.JSONWebKey, error) {
+	kid, err := k.KeyID()
+	if err != nil {
+		return jose.JSONWebKey{}, err
+	}
+
+	return jose.JSONWebKey{
+		Use:       "sig",
+		Algorithm: k.signingMethod().Alg(),
+		Key:       k.publicKey(),
+		KeyID:     kid,
+	}, nil
+}
+
 // SignJWT signs jwt.Claims with the Keypair and returns a token string
 func (k *Keypair) SignJWT(claims jwt.Claims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-
+	method := k.signingMethod()
 	kid, err := k.KeyID()
 	if err != nil {
 		return "", err
 	}
-	token.Header["kid"] = kid
-
-	return token.SignedString(k.PrivateKey)
+	header, err := encodedHeader(method.Alg(), kid)
+	if err != nil {
+		return "", err
+	}
+	signingString, err := appendSigningString(header, claims)
+	if err != nil {
+		return "", err
+	}
+	signature, err := method.Sign(signingString, k.privateKey())
+	if err != nil {
+		return "", err
+	}
+	return signingString + "." + signature, nil
 }
 
 // VerifyJWT verifies the signature of a token was signed with this Keypair
 func (k *Keypair) VerifyJWT(token string) (*jwt.Token, error) {
-	return jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		kid, err := k.KeyID()
-		if err != nil {
-			return nil, err
-		}
-		if tk, ok := token.Header["kid"]; ok && tk == kid {
-			return k.PublicKey, nil
-		}
-		return nil, errors.New("token kid does not match or is not present")
-	})
+	return jwt.Parse(token, k.keyFunc)
+}
+
+// verifyJWTSignature verifies only the signature of a token. Its time based
+// claims are left to check against the MockOIDC's view of time instead of
+// the global `jwt.TimeFunc`.
+func (k *Keypair) verifyJWTSignature(token string) (*jwt.Token, error) {
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	return parser.Parse(token, k.keyFunc)
+}
+
+// signingMethod returns the jwt.SigningMethod of the Alg
+func (k *Keypair) signingMethod() jwt.SigningMethod {
+	if k.ECPrivateKey != nil {
+		return jwt.SigningMethodES256
+	}
+	if k.Alg == jwt.SigningMethodPS256.Alg() {
+		return jwt.SigningMethodPS256
+	}
+	return jwt.SigningMethodRS256
+}
+
+func (k *Keypair) keyFunc(token *jwt.Token) (interface{}, error) {
+	if alg := k.signingMethod().Alg(); token.Method.Alg() != alg {
+		return nil, fmt.Errorf("token alg %s is not %s", token.Method.Alg(), alg)
+	}
+	kid, err := k.KeyID()
+	if err != nil {
+		return nil, err
+	}
+	if tk, ok := token.Header["kid"]; ok && tk == kid {
+		return k.publicKey(), nil
+	}
+	return nil, errors.New("token kid does not match or is not present")
+}
+
+// privateKey is the key signing tokens, the ECPrivateKey if set
+func (k *Keypair) privateKey() crypto.Signer {
+	if k.ECPrivateKey != nil {
+		return k.ECPrivateKey
+	}
+	return k.PrivateKey
+}
+
+// publicKey is the key verifying tokens, the ECPrivateKey's if set
+func (k *Keypair) publicKey() crypto.PublicKey {
+	if k.ECPrivateKey != nil {
+		return &k.ECPrivateKey.PublicKey
+	}
+	return k.PublicKey
 }
 
 func randomNonce(length int) (string, error) {
@@ -1,8 +1,13 @@
 package mockoidc_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"testing"
 	"time"
@@ -90,3 +95,58 @@ func TestKeypair_SignJWTVerifyJWT(t *testing.T) {
 		})
 	}
 }
+
+func TestNewECKeypair(t *testing.T) {
+	alice, err := mockoidc.NewECKeypair(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "ES256", alice.Alg)
+	bob, err := mockoidc.NewECKeypair(nil)
+	assert.NoError(t, err)
+
+	tokenStr, err := alice.SignJWT(standardClaims)
+	assert.NoError(t, err)
+	_, err = bob.VerifyJWT(tokenStr)
+	assert.Error(t, err)
+	token, err := alice.VerifyJWT(tokenStr)
+	assert.NoError(t, err)
+	assert.Equal(t, "ES256", token.Header["alg"])
+
+	jwks, err := alice.JWKS()
+	assert.NoError(t, err)
+	assert.Contains(t, string(jwks), `"crv":"P-256"`)
+	assert.Contains(t, string(jwks), `"alg":"ES256"`)
+
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	_, err = mockoidc.NewECKeypair(key)
+	assert.EqualError(t, err, "ES256 requires a P-256 key")
+}
+
+func TestParseKeypairPEM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	assert.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	sec1, err := x509.MarshalECPrivateKey(ecKey)
+	assert.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	assert.NoError(t, err)
+
+	for name, block := range map[string]*pem.Block{
+		"pkcs1": {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)},
+		"sec1":  {Type: "EC PRIVATE KEY", Bytes: sec1},
+		"pkcs8": {Type: "PRIVATE KEY", Bytes: pkcs8},
+	} {
+		t.Run(name, func(t *testing.T) {
+			keypair, err := mockoidc.ParseKeypairPEM(pem.EncodeToMemory(block))
+			assert.NoError(t, err)
+			tokenStr, err := keypair.SignJWT(standardClaims)
+			assert.NoError(t, err)
+			_, err = keypair.VerifyJWT(tokenStr)
+			assert.NoError(t, err)
+		})
+	}
+
+	_, err = mockoidc.ParseKeypairPEM([]byte("not a key"))
+	assert.EqualError(t, err, "no PEM encoded key found")
+}
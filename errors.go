@@ -0,0 +1,168 @@
+package mockoidc
+
+import (
+	"bytes"
+	"net/http"
+	"text/template"
+	"time"
+)
+
+// ErrorTemplate changes the error responses of MockOIDC to imitate a
+// provider's error payloads, e.g. Azure AD's `error_codes`, `trace_id` and
+// `timestamp`. The Description and string Fields are `text/template`s
+// executed with the ErrorData.
+type ErrorTemplate struct {
+	// Description replaces the `error_description`, if set
+	Description string
+	// Fields are added to JSON error responses, overriding `error` &
+	// `error_description`. Redirected errors only get the Description.
+	Fields map[string]interface{}
+}
+
+// ErrorData is what an ErrorTemplate is executed with
+type ErrorData struct {
+	Error       string
+	Description string
+	StatusCode  int
+	// Endpoint is the `*Endpoint` constant of the request
+	Endpoint string
+	// Time is when the error occurred by MockOIDC's clock
+	Time time.Time
+}
+
+type errorTemplate struct {
+	description *template.Template
+	fields      map[string]interface{}
+}
+
+// SetErrorTemplate applies the ErrorTemplate to the responses with the
+// `error` code, or to all errors without their own template if the code is
+// empty. A nil ErrorTemplate removes it. It is safe to call while serving
+// requests.
+func (m *MockOIDC) SetErrorTemplate(code string, et *ErrorTemplate) error {
+	var parsed *errorTemplate
+	if et != nil {
+		parsed = &errorTemplate{fields: make(map[string]interface{}, len(et.Fields))}
+		if et.Description != "" {
+			tmpl, err := template.New("error_description").Parse(et.Description)
+			if err != nil {
+				return err
+			}
+			parsed.description = tmpl
+		}
+		for name, value := range et.Fields {
+			if s, ok := value.(string); ok {
+				tmpl, err := template.New(name).Parse(s)
+				if err != nil {
+					return err
+				}
+				value = tmpl
+			}
+			parsed.fields[name] = value
+		}
+	}
+
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+	if parsed == nil {
+		delete(m.errorTemplates, code)
+		return nil
+	}
+	if m.errorTemplates == nil {
+		m.errorTemplates = make(map[string]*errorTemplate)
+	}
+	m.errorTemplates[code] = parsed
+	return nil
+}
+
+func (m *MockOIDC) errorTemplate(code string) *errorTemplate {
+	m.configMu.RLock()
+	defer m.configMu.RUnlock()
+	if et, ok := m.errorTemplates[code]; ok {
+		return et
+	}
+	return m.errorTemplates[""]
+}
+
+// errorWriter lets the package's error helpers find the MockOIDC & endpoint
+// of a response to apply its ErrorTemplates
+type errorWriter struct {
+	http.ResponseWriter
+	m        *MockOIDC
+	endpoint string
+}
+
+func (ew *errorWriter) Unwrap() http.ResponseWriter {
+	return ew.ResponseWriter
+}
+
+// templateError applies the ErrorTemplate of the error to its payload, if
+// the response is written by a MockOIDC endpoint with one. Templates that
+// fail to execute leave their field unchanged.
+func templateError(rw http.ResponseWriter, payload map[string]interface{}, statusCode int) {
+	ew := findErrorWriter(rw)
+	if ew == nil {
+		return
+	}
+	code, _ := payload["error"].(string)
+	et := ew.m.errorTemplate(code)
+	if et == nil {
+		return
+	}
+
+	description, _ := payload["error_description"].(string)
+	data := &ErrorData{
+		Error:       code,
+		Description: description,
+		StatusCode:  statusCode,
+		Endpoint:    ew.endpoint,
+		Time:        ew.m.Now(),
+	}
+	execute := func(tmpl *template.Template) (string, bool) {
+		var buf bytes.Buffer
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return "", false
+		}
+		return buf.String(), true
+	}
+	if et.description != nil {
+		if description, ok := execute(et.description); ok {
+			payload["error_description"] = description
+		}
+	}
+	for name, value := range et.fields {
+		if tmpl, ok := value.(*template.Template); ok {
+			if value, ok = execute(tmpl); !ok {
+				continue
+			}
+		}
+		payload[name] = value
+	}
+}
+
+// templateDescription returns the `error_description` of a redirected error
+func templateDescription(rw http.ResponseWriter, code, description string) string {
+	ew := findErrorWriter(rw)
+	if ew == nil {
+		return description
+	}
+	payload := map[string]interface{}{"error": code, "error_description": description}
+	templateError(rw, payload, http.StatusFound)
+	if templated, ok := payload["error_description"].(string); ok {
+		return templated
+	}
+	return description
+}
+
+func findErrorWriter(rw http.ResponseWriter) *errorWriter {
+	for {
+		switch w := rw.(type) {
+		case *errorWriter:
+			return w
+		case interface{ Unwrap() http.ResponseWriter }:
+			rw = w.Unwrap()
+		default:
+			return nil
+		}
+	}
+}
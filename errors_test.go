@@ -0,0 +1,69 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_SetErrorTemplate(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	assert.NoError(t, m.SetErrorTemplate(mockoidc.InvalidGrant, &mockoidc.ErrorTemplate{
+		Description: "AADSTS70008: {{.Description}}",
+		Fields: map[string]interface{}{
+			"error_codes":    []int{70008},
+			"timestamp":      `{{.Time.UTC.Format "2006-01-02 15:04:05Z"}}`,
+			"correlation_id": "fixed-correlation-id",
+		},
+	}))
+	assert.NoError(t, m.SetErrorTemplate("", &mockoidc.ErrorTemplate{
+		Description: "{{.Endpoint}}: {{.Description}}",
+	}))
+	assert.Error(t, m.SetErrorTemplate("", &mockoidc.ErrorTemplate{Description: "{{"}))
+
+	token := func(code string) map[string]interface{} {
+		resp, err := httpClient.PostForm(m.TokenEndpoint(), url.Values{
+			"client_id":     {m.ClientID},
+			"client_secret": {m.ClientSecret},
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+		})
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body := make(map[string]interface{})
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return body
+	}
+
+	body := token("unknown-code")
+	assert.Equal(t, mockoidc.InvalidGrant, body["error"])
+	assert.Regexp(t, "^AADSTS70008: ", body["error_description"])
+	assert.Equal(t, []interface{}{float64(70008)}, body["error_codes"])
+	assert.Equal(t, "fixed-correlation-id", body["correlation_id"])
+	assert.Equal(t, m.Now().UTC().Format("2006-01-02 15:04:05Z"), body["timestamp"])
+
+	// Other errors get the catch-all template, also when redirected
+	body = token("")
+	assert.Equal(t, mockoidc.InvalidRequest, body["error"])
+	assert.Equal(t, mockoidc.TokenEndpoint+": The request is missing the required parameter: code",
+		body["error_description"])
+	assert.NotContains(t, body, "error_codes")
+
+	resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+		"client_id":    {m.ClientID},
+		"redirect_uri": {"https://app.example.com/callback"},
+	}.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := resp.Location()
+	assert.NoError(t, err)
+	assert.Regexp(t, "^"+mockoidc.AuthorizationEndpoint+": ", location.Query().Get("error_description"))
+
+	assert.NoError(t, m.SetErrorTemplate(mockoidc.InvalidGrant, nil))
+	assert.NotContains(t, token("unknown-code"), "error_codes")
+}
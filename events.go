@@ -0,0 +1,96 @@
+package mockoidc
+
+import (
+	"net/http"
+	"time"
+)
+
+// EventType identifies what happened in an Event
+type EventType string
+
+const (
+	// EventSessionCreated is emitted when a login at the
+	// `authorization_endpoint` starts a Session
+	EventSessionCreated EventType = "session_created"
+	// EventTokenIssued is emitted when the `token_endpoint` issues tokens, or
+	// an implicit authorization request
+	EventTokenIssued EventType = "token_issued"
+	// EventRefreshUsed is emitted when a refresh token is exchanged, before
+	// the EventTokenIssued for the new tokens
+	EventRefreshUsed EventType = "refresh_used"
+	// EventCodeReused is emitted when an already exchanged code is presented
+	// again, after the tokens issued from it were revoked
+	EventCodeReused EventType = "code_reused"
+	// EventSessionEnded is emitted when a relying party logs the user out
+	// at the `end_session_endpoint`
+	EventSessionEnded EventType = "session_ended"
+	// EventSessionRevoked is emitted when a Session's tokens are revoked at
+	// the `revocation_endpoint` or with `RevokeSession`
+	EventSessionRevoked EventType = "session_revoked"
+	// EventRefreshRejected is emitted when a refresh token of a revoked
+	// Session is presented
+	EventRefreshRejected EventType = "refresh_rejected"
+)
+
+// Event describes an authentication event of a MockOIDC, for asynchronous
+// tests to wait on instead of sleeping.
+type Event struct {
+	Type      EventType
+	SessionID string
+	Subject   string
+	// GrantType of the `token_endpoint` request, if any
+	GrantType string
+	// Time of the event by MockOIDC's clock
+	Time time.Time
+}
+
+// Subscribe returns a channel receiving all Events from now on, and a
+// function to unsubscribe & close it. Events are dropped (and logged) while
+// the channel's buffer of the passed size is full, so a slow subscriber
+// can't stall the server.
+func (m *MockOIDC) Subscribe(buffer int) (<-chan Event, func()) {
+	events := make(chan Event, buffer)
+
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	if m.subscribers == nil {
+		m.subscribers = make(map[chan Event]struct{})
+	}
+	m.subscribers[events] = struct{}{}
+
+	return events, func() {
+		m.eventsMu.Lock()
+		defer m.eventsMu.Unlock()
+		if _, ok := m.subscribers[events]; ok {
+			delete(m.subscribers, events)
+			close(events)
+		}
+	}
+}
+
+// emit sends an Event about the Session of a request, if any, to all
+// subscribers
+func (m *MockOIDC) emit(eventType EventType, session *Session, req *http.Request) {
+	event := Event{
+		Type:      eventType,
+		SessionID: session.SessionID,
+		Time:      m.Now(),
+	}
+	if req != nil {
+		event.GrantType = req.Form.Get("grant_type")
+	}
+	if session.User != nil {
+		event.Subject = session.User.ID()
+	}
+
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+	for events := range m.subscribers {
+		select {
+		case events <- event:
+		default:
+			m.logger().Error("event dropped, subscriber is full",
+				"event", string(eventType), "session_id", session.SessionID)
+		}
+	}
+}
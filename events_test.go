@@ -0,0 +1,70 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Subscribe(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	events, unsubscribe := m.Subscribe(10)
+
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	resp, err := httpClient.Post(m.TokenEndpoint(), "application/x-www-form-urlencoded",
+		strings.NewReader(url.Values{
+			"client_id":     {m.ClientID},
+			"client_secret": {m.ClientSecret},
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {tokens.RefreshToken},
+		}.Encode()))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	unsubscribe()
+	var received []mockoidc.Event
+	for event := range events {
+		received = append(received, event)
+	}
+	assert.Len(t, received, 4)
+	for i, expected := range []struct {
+		eventType mockoidc.EventType
+		grantType string
+	}{
+		{mockoidc.EventSessionCreated, ""},
+		{mockoidc.EventTokenIssued, "authorization_code"},
+		{mockoidc.EventRefreshUsed, "refresh_token"},
+		{mockoidc.EventTokenIssued, "refresh_token"},
+	} {
+		assert.Equal(t, expected.eventType, received[i].Type)
+		assert.Equal(t, expected.grantType, received[i].GrantType)
+		assert.Equal(t, received[0].SessionID, received[i].SessionID)
+		assert.Equal(t, mockoidc.DefaultUser().ID(), received[i].Subject)
+		assert.False(t, received[i].Time.IsZero())
+	}
+
+	// Unsubscribing twice is a no-op
+	unsubscribe()
+}
+
+func TestMockOIDC_Subscribe_Full(t *testing.T) {
+	logger := &recordingLogger{}
+	m := mockoidc.RunTB(t, func(m *mockoidc.MockOIDC) error {
+		m.Logger = logger
+		return nil
+	})
+	events, unsubscribe := m.Subscribe(1)
+	defer unsubscribe()
+
+	_, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+
+	assert.Equal(t, mockoidc.EventSessionCreated, (<-events).Type)
+	assert.NotEmpty(t, logger.find("event dropped, subscriber is full"))
+}
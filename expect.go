@@ -0,0 +1,68 @@
+package mockoidc
+
+import (
+	"sort"
+	"testing"
+)
+
+// ExpectRequests expects the endpoint (one of the `*Endpoint` constants) to
+// have received exactly count requests, since the server started or was last
+// reset, when `AssertExpectations` is called.
+func (m *MockOIDC) ExpectRequests(endpoint string, count int) {
+	m.expectMu.Lock()
+	defer m.expectMu.Unlock()
+	if m.expected == nil {
+		m.expected = make(map[string]int)
+	}
+	m.expected[endpoint] = count
+}
+
+// ExpectTokenRequests expects count requests to the `token_endpoint`, e.g.
+// to catch relying parties refreshing tokens on every request.
+func (m *MockOIDC) ExpectTokenRequests(count int) {
+	m.ExpectRequests(TokenEndpoint, count)
+}
+
+// ExpectNoUserinfoCalls expects the `userinfo_endpoint` not to be called
+func (m *MockOIDC) ExpectNoUserinfoCalls() {
+	m.ExpectRequests(UserinfoEndpoint, 0)
+}
+
+// AssertExpectations fails the test for every endpoint whose request count
+// doesn't match its expectation. It returns whether all were met.
+func (m *MockOIDC) AssertExpectations(t testing.TB) bool {
+	t.Helper()
+
+	m.expectMu.Lock()
+	endpoints := make([]string, 0, len(m.expected))
+	for endpoint := range m.expected {
+		endpoints = append(endpoints, endpoint)
+	}
+	expected := make(map[string]int, len(m.expected))
+	for endpoint, count := range m.expected {
+		expected[endpoint] = count
+	}
+	m.expectMu.Unlock()
+	sort.Strings(endpoints)
+
+	if len(endpoints) > 0 && m.RequestCounter == nil {
+		t.Errorf("mockoidc: expectations need a RequestCounter")
+		return false
+	}
+	met := true
+	for _, endpoint := range endpoints {
+		if actual := m.RequestCount(endpoint); actual != uint64(expected[endpoint]) {
+			t.Errorf("mockoidc: expected %d requests to %s, got %d",
+				expected[endpoint], endpointName(endpoint), actual)
+			met = false
+		}
+	}
+	return met
+}
+
+// clearExpectations forgets all expectations
+func (m *MockOIDC) clearExpectations() {
+	m.expectMu.Lock()
+	defer m.expectMu.Unlock()
+	m.expected = nil
+}
@@ -0,0 +1,66 @@
+package mockoidc_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeTB records the failures of assertions under test
+type fakeTB struct {
+	testing.TB
+	errors []string
+}
+
+func (f *fakeTB) Helper() {}
+
+func (f *fakeTB) Errorf(format string, args ...interface{}) {
+	f.errors = append(f.errors, fmt.Sprintf(format, args...))
+}
+
+func (f *fakeTB) Fatalf(format string, args ...interface{}) {
+	f.Errorf(format, args...)
+	panic(f)
+}
+
+// run calls fn, stopping it at the first Fatalf like testing.T would
+func (f *fakeTB) run(fn func()) {
+	defer func() {
+		if r := recover(); r != nil && r != f {
+			panic(r)
+		}
+	}()
+	fn()
+}
+
+func TestMockOIDC_AssertExpectations(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	m.ExpectTokenRequests(1)
+	m.ExpectNoUserinfoCalls()
+
+	_, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	assert.True(t, m.AssertExpectations(t))
+
+	resp, err := httpClient.Get(m.UserinfoEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	_, err = m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+
+	ft := &fakeTB{}
+	assert.False(t, m.AssertExpectations(ft))
+	assert.Equal(t, []string{
+		"mockoidc: expected 1 requests to token, got 2",
+		"mockoidc: expected 0 requests to userinfo, got 1",
+	}, ft.errors)
+
+	assert.NoError(t, m.Reset())
+	ft = &fakeTB{}
+	assert.True(t, m.AssertExpectations(ft))
+	assert.Empty(t, ft.errors)
+}
@@ -0,0 +1,137 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Files of a test vector bundle written by ExportTestVectors
+const (
+	TestVectorsFile   = "vectors.json"
+	TestJWKSFile      = "jwks.json"
+	TestDiscoveryFile = "openid-configuration.json"
+)
+
+// TestVectorOptions configure the tokens exported by ExportTestVectors
+type TestVectorOptions struct {
+	// Issuer of the tokens & discovery document, ending with the BasePath
+	// (`/oidc` by default). It is required if the server isn't started.
+	Issuer string
+	// User the tokens are issued to, DefaultUser if nil
+	User User
+	// Scopes of the tokens, `openid` if empty
+	Scopes []string
+	// Nonce is set in the ID token
+	Nonce string
+}
+
+// TestVectors are signed tokens along with the claims they must verify to,
+// for test suites of services that aren't written in Go. They are written to
+// TestVectorsFile, next to the JWKS & discovery document that verify them.
+type TestVectors struct {
+	Issuer   string `json:"issuer"`
+	ClientID string `json:"client_id"`
+	// IssuedAt is the unix time the tokens were issued at. Verifiers should
+	// pin their clock to it, since the tokens expire.
+	IssuedAt int64 `json:"issued_at"`
+
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token,omitempty"`
+	// Claims are the expected claims of the tokens, keyed by token name
+	Claims   map[string]jwt.MapClaims `json:"claims"`
+	Userinfo json.RawMessage          `json:"userinfo"`
+}
+
+// ExportTestVectors issues tokens for a seeded Session (see SeedSession)
+// and writes them as TestVectors to the directory, along with the JWKS in
+// TestJWKSFile & the discovery document in TestDiscoveryFile. The directory
+// is created if needed; opts may be nil. Use a `NewDeterministicServer` for
+// bundles that are reproducible across runs.
+func (m *MockOIDC) ExportTestVectors(dir string, opts *TestVectorOptions) (*TestVectors, error) {
+	if opts == nil {
+		opts = &TestVectorOptions{}
+	}
+	config := m.Config()
+	if opts.Issuer != "" {
+		config.Issuer = strings.TrimSuffix(opts.Issuer, "/")
+	}
+	if config.Issuer == "" {
+		return nil, errors.New("an issuer is required to export from a server that isn't started")
+	}
+	user := opts.User
+	if user == nil {
+		user = DefaultUser()
+	}
+	scopes := opts.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid"}
+	}
+
+	tokens, err := m.seedSession(user, scopes, &SeedOptions{Nonce: opts.Nonce}, config)
+	if err != nil {
+		return nil, err
+	}
+	userinfo, err := user.Userinfo(scopes)
+	if err != nil {
+		return nil, err
+	}
+	vectors := &TestVectors{
+		Issuer:       config.Issuer,
+		ClientID:     config.ClientID,
+		IssuedAt:     m.Now().Unix(),
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Claims:       map[string]jwt.MapClaims{},
+		Userinfo:     userinfo,
+	}
+	for name, raw := range map[string]string{
+		"access_token":  tokens.AccessToken,
+		"refresh_token": tokens.RefreshToken,
+		"id_token":      tokens.IDToken,
+	} {
+		if raw == "" {
+			continue
+		}
+		claims := jwt.MapClaims{}
+		if _, _, err = new(jwt.Parser).ParseUnverified(raw, claims); err != nil {
+			return nil, err
+		}
+		vectors.Claims[name] = claims
+	}
+
+	jwks, err := m.jwks()
+	if err != nil {
+		return nil, err
+	}
+	discovery, err := m.renderDiscovery(
+		strings.TrimSuffix(strings.TrimSuffix(config.Issuer, "/"), m.BasePath), config.Issuer,
+		m.supported())
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := json.MarshalIndent(vectors, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	for name, data := range map[string][]byte{
+		TestVectorsFile:   manifest,
+		TestJWKSFile:      jwks,
+		TestDiscoveryFile: discovery,
+	} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), append(data, '\n'), 0644); err != nil {
+			return nil, err
+		}
+	}
+	return vectors, nil
+}
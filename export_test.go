@@ -0,0 +1,75 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestMockOIDC_ExportTestVectors(t *testing.T) {
+	dir := t.TempDir()
+	m, err := mockoidc.NewDeterministicServer(1)
+	assert.NoError(t, err)
+	_, err = m.ExportTestVectors(dir, nil)
+	assert.Error(t, err)
+
+	user := &mockoidc.MockUser{Subject: "vector-user", Email: "vector@example.com"}
+	vectors, err := m.ExportTestVectors(dir, &mockoidc.TestVectorOptions{
+		Issuer: "https://idp.example.com/oidc",
+		User:   user,
+		Scopes: []string{"openid", "email"},
+		Nonce:  "vector-nonce",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.DeterministicEpoch.Unix(), vectors.IssuedAt)
+	idClaims := vectors.Claims["id_token"]
+	assert.Equal(t, "https://idp.example.com/oidc", idClaims["iss"])
+	assert.Equal(t, "vector-nonce", idClaims["nonce"])
+	assert.Equal(t, "vector@example.com", idClaims["email"])
+	assert.Contains(t, vectors.Claims, "access_token")
+	assert.Contains(t, vectors.Claims, "refresh_token")
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, mockoidc.TestVectorsFile))
+	assert.NoError(t, err)
+	written := &mockoidc.TestVectors{}
+	assert.NoError(t, json.Unmarshal(data, written))
+	assert.Equal(t, vectors.IDToken, written.IDToken)
+	assert.Contains(t, string(written.Userinfo), "vector@example.com")
+
+	discovery := map[string]interface{}{}
+	data, err = ioutil.ReadFile(filepath.Join(dir, mockoidc.TestDiscoveryFile))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &discovery))
+	assert.Equal(t, "https://idp.example.com/oidc", discovery["issuer"])
+
+	// The exported JWKS verifies the tokens
+	data, err = ioutil.ReadFile(filepath.Join(dir, mockoidc.TestJWKSFile))
+	assert.NoError(t, err)
+	jwks := &jose.JSONWebKeySet{}
+	assert.NoError(t, json.Unmarshal(data, jwks))
+	assert.Len(t, jwks.Keys, 1)
+	// The tokens expire relative to the frozen clock
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	_, err = parser.Parse(vectors.IDToken, func(token *jwt.Token) (interface{}, error) {
+		return jwks.Keys[0].Key, nil
+	})
+	assert.NoError(t, err)
+
+	// Exports with the same seed are identical
+	again, err := mockoidc.NewDeterministicServer(1)
+	assert.NoError(t, err)
+	vectorsAgain, err := again.ExportTestVectors(t.TempDir(), &mockoidc.TestVectorOptions{
+		Issuer: "https://idp.example.com/oidc",
+		User:   user,
+		Scopes: []string{"openid", "email"},
+		Nonce:  "vector-nonce",
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, vectors.IDToken, vectorsAgain.IDToken)
+}
@@ -0,0 +1,36 @@
+package mockoidc
+
+import (
+	"net/http"
+	"strings"
+)
+
+// fapiAuthorize applies the authorization request requirements of the FAPI
+// profiles in FAPIMode: PKCE with `S256`, and a `nonce` on `openid`
+// requests. It returns false if it already responded.
+func (m *MockOIDC) fapiAuthorize(rw http.ResponseWriter, req *http.Request) bool {
+	if !m.FAPIMode {
+		return true
+	}
+	if req.Form.Get("code_challenge") == "" || req.Form.Get("code_challenge_method") != "S256" {
+		m.authorizeError(rw, req, InvalidRequest,
+			"FAPI requires PKCE with the S256 code_challenge_method", http.StatusBadRequest)
+		return false
+	}
+	if req.Form.Get("nonce") == "" &&
+		containsString(strings.Fields(req.Form.Get("scope")), openidScope) {
+		m.authorizeError(rw, req, InvalidRequest,
+			"The request is missing the required parameter: nonce", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// fapiIDTokenClaims adds the `s_hash` of the authorization request's `state`
+// to the ID token claims in FAPIMode, which FAPI 1.0 Advanced clients check
+// to detect tampered responses
+func (m *MockOIDC) fapiIDTokenClaims(session *Session, claims map[string]interface{}) {
+	if m.FAPIMode && session.State != "" {
+		claims["s_hash"] = tokenHash(session.State)
+	}
+}
@@ -0,0 +1,166 @@
+package mockoidc_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_FAPIMode(t *testing.T) {
+	m, err := mockoidc.New(mockoidc.WithSigningAlg("PS256"))
+	assert.NoError(t, err)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start(ln, nil))
+	defer m.Shutdown()
+
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	_, verifier, err := m.OIDCProvider(context.Background())
+	assert.NoError(t, err)
+	_, err = verifier.Verify(context.Background(), tokens.IDToken)
+	assert.NoError(t, err)
+	jwks, err := m.Keypair.JWKS()
+	assert.NoError(t, err)
+	assert.Contains(t, string(jwks), `"alg":"PS256"`)
+
+	m.FAPIMode = true
+	m.ClientKeypair, err = mockoidc.NewECKeypair(nil)
+	assert.NoError(t, err)
+	query := url.Values{
+		"client_id":             {m.ClientID},
+		"response_type":         {"code"},
+		"scope":                 {"openid"},
+		"state":                 {"state"},
+		"nonce":                 {"nonce"},
+		"redirect_uri":          {"https://app.example.com/callback"},
+		"code_challenge":        {"challenge"},
+		"code_challenge_method": {"S256"},
+	}
+	// Requests must be pushed or signed
+	resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + query.Encode())
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Contains(t, string(body), "FAPI requires a pushed authorization request")
+
+	// Secrets don't authenticate clients
+	form := url.Values{"client_secret": {m.ClientSecret}}
+	for k, v := range query {
+		form[k] = v
+	}
+	resp, err = httpClient.PostForm(m.PushedAuthorizationEndpoint(), form)
+	assert.NoError(t, err)
+	body, err = ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Contains(t, string(body), "The client_secret_post method is not supported")
+
+	authorize := func(params url.Values) string {
+		pushed := url.Values{
+			"client_id":     {m.ClientID},
+			"response_type": {"code"},
+			"scope":         {"openid"},
+			"state":         {"state"},
+			"redirect_uri":  {"https://app.example.com/callback"},
+		}
+		for k, v := range params {
+			pushed[k] = v
+		}
+		resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+			"client_id":   {m.ClientID},
+			"request_uri": {pushAuthorization(t, m, pushed)},
+		}.Encode())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+		location, err := resp.Location()
+		assert.NoError(t, err)
+		return location.Query().Get("error_description")
+	}
+	assert.Contains(t, authorize(nil), "S256")
+	assert.Contains(t, authorize(url.Values{
+		"code_challenge":        {"challenge"},
+		"code_challenge_method": {"plain"},
+	}), "S256")
+	assert.True(t, strings.HasSuffix(authorize(url.Values{
+		"code_challenge":        {"challenge"},
+		"code_challenge_method": {"S256"},
+	}), "nonce"))
+	assert.Equal(t, "", authorize(url.Values{
+		"code_challenge":        {"challenge"},
+		"code_challenge_method": {"S256"},
+		"nonce":                 {"nonce"},
+	}))
+}
+
+func TestMockOIDC_FAPIMode_StateHash(t *testing.T) {
+	m := mockoidc.RunTB(t, mockoidc.WithClientKeypair(clientKeypair(t)))
+	m.FAPIMode = true
+
+	verifier := "a-code-verifier-long-enough-for-rfc-7636-pkce"
+	sum := sha256.Sum256([]byte(verifier))
+	request, err := m.ClientKeypair.SignJWT(jwt.MapClaims{
+		"iss":                   m.ClientID,
+		"aud":                   m.Issuer(),
+		"exp":                   m.Now().Add(time.Minute).Unix(),
+		"response_type":         "code id_token",
+		"scope":                 "openid",
+		"state":                 "state",
+		"nonce":                 "nonce",
+		"redirect_uri":          "https://app.example.com/callback",
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(sum[:]),
+		"code_challenge_method": "S256",
+	})
+	assert.NoError(t, err)
+	rr := testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, url.Values{
+		"client_id": {m.ClientID},
+		"request":   {request},
+	})
+	assert.Equal(t, http.StatusFound, rr.Code)
+	location, err := url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	fragment, err := url.ParseQuery(location.Fragment)
+	assert.NoError(t, err)
+
+	sum = sha256.Sum256([]byte("state"))
+	sHash := base64.RawURLEncoding.EncodeToString(sum[:16])
+	claims := func(raw string) jwt.MapClaims {
+		token, err := m.Keypair.VerifyJWT(raw)
+		assert.NoError(t, err)
+		return token.Claims.(jwt.MapClaims)
+	}
+	assert.Equal(t, sHash, claims(fragment.Get("id_token"))["s_hash"])
+
+	// The ID token of the code exchange has it too
+	form := clientAssertion(t, m, m.Issuer())
+	form.Set("code", fragment.Get("code"))
+	form.Set("code_verifier", verifier)
+	form.Set("grant_type", "authorization_code")
+	form.Set("redirect_uri", "https://app.example.com/callback")
+	rr = testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, form)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	tokens := map[string]interface{}{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tokens))
+	assert.Equal(t, sHash, claims(tokens["id_token"].(string))["s_hash"])
+
+	m.FAPIMode = false
+	flow, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	assert.NotContains(t, flow.IDTokenClaims, "s_hash")
+}
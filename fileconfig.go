@@ -0,0 +1,133 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// AdminReloadEndpoint reloads the ConfigFile of a running MockOIDC
+const AdminReloadEndpoint = "/oidc/admin/reload"
+
+// FileConfig is the JSON configuration file format used by standalone
+// MockOIDC servers. Empty fields keep the server's current settings.
+type FileConfig struct {
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+
+	// TTLs are in `time.ParseDuration` format, e.g. `10m`
+	AccessTTL  string `json:"access_ttl,omitempty"`
+	RefreshTTL string `json:"refresh_ttl,omitempty"`
+
+	// Users replace the UserQueue & Errors replace the ErrorQueue. Codes
+	// replace the CodeQueue of a MemorySessionStore, other SessionStores
+	// have them queued.
+	Users  []*MockUser    `json:"users,omitempty"`
+	Codes  []string       `json:"codes,omitempty"`
+	Errors []*ServerError `json:"errors,omitempty"`
+}
+
+// LoadFileConfig reads a FileConfig from a JSON file
+func LoadFileConfig(path string) (*FileConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fc := &FileConfig{}
+	if err = json.Unmarshal(data, fc); err != nil {
+		return nil, err
+	}
+	return fc, nil
+}
+
+// ApplyFileConfig updates the MockOIDC settings & queues with the
+// FileConfig. It can be called while the server is running.
+func (m *MockOIDC) ApplyFileConfig(fc *FileConfig) error {
+	var accessTTL, refreshTTL time.Duration
+	var err error
+	if fc.AccessTTL != "" {
+		if accessTTL, err = time.ParseDuration(fc.AccessTTL); err != nil {
+			return err
+		}
+	}
+	if fc.RefreshTTL != "" {
+		if refreshTTL, err = time.ParseDuration(fc.RefreshTTL); err != nil {
+			return err
+		}
+	}
+
+	m.configMu.Lock()
+	if fc.ClientID != "" {
+		m.ClientID = fc.ClientID
+	}
+	if fc.ClientSecret != "" {
+		m.ClientSecret = fc.ClientSecret
+	}
+	if accessTTL != 0 {
+		m.AccessTTL = accessTTL
+	}
+	if refreshTTL != 0 {
+		m.RefreshTTL = refreshTTL
+	}
+	m.configMu.Unlock()
+
+	if q, ok := m.users().(*UserQueue); ok {
+		users := make([]User, 0, len(fc.Users))
+		for _, user := range fc.Users {
+			users = append(users, user)
+		}
+		q.Lock()
+		q.Queue = users
+		q.Unlock()
+	} else {
+		m.users().Clear()
+		for _, user := range fc.Users {
+			m.users().Push(user)
+		}
+	}
+
+	if ss, ok := m.SessionStore.(*MemorySessionStore); ok {
+		ss.CodeQueue.Lock()
+		ss.CodeQueue.Queue = append([]string{}, fc.Codes...)
+		ss.CodeQueue.Unlock()
+	} else {
+		for _, code := range fc.Codes {
+			m.QueueCode(code)
+		}
+	}
+
+	m.ErrorQueue.Lock()
+	m.ErrorQueue.Queue = append([]*ServerError{}, fc.Errors...)
+	m.ErrorQueue.Unlock()
+
+	return nil
+}
+
+// Reload loads the ConfigFile and applies it without dropping the listener
+func (m *MockOIDC) Reload() error {
+	if m.ConfigFile == "" {
+		return errors.New("no config file set")
+	}
+	fc, err := LoadFileConfig(m.ConfigFile)
+	if err != nil {
+		return err
+	}
+	return m.ApplyFileConfig(fc)
+}
+
+// AdminReload implements the `AdminReloadEndpoint`. It calls `Reload` and
+// is only served when a ConfigFile is set.
+func (m *MockOIDC) AdminReload(rw http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		errorResponse(rw, InvalidRequest, "Reloading requires a POST",
+			http.StatusMethodNotAllowed)
+		return
+	}
+	if err := m.Reload(); err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,137 @@
+package mockoidc_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+const testFileConfig = `{
+	"client_id": "file-client",
+	"client_secret": "file-secret",
+	"access_ttl": "5m",
+	"refresh_ttl": "2h",
+	"users": [{"subject": "file-user", "email": "file.user@example.com"}],
+	"codes": ["fixed-code-123"],
+	"errors": [{"code": 503, "error": "temporarily_unavailable", "description": "Down"}]
+}`
+
+func TestLoadFileConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := ioutil.WriteFile(path, []byte(testFileConfig), 0600)
+	assert.NoError(t, err)
+
+	fc, err := mockoidc.LoadFileConfig(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "file-client", fc.ClientID)
+	assert.Equal(t, "file-secret", fc.ClientSecret)
+	assert.Equal(t, "5m", fc.AccessTTL)
+	assert.Equal(t, "2h", fc.RefreshTTL)
+	assert.Equal(t, "file-user", fc.Users[0].Subject)
+	assert.Equal(t, "file.user@example.com", fc.Users[0].Email)
+	assert.Equal(t, []string{"fixed-code-123"}, fc.Codes)
+	assert.Equal(t, http.StatusServiceUnavailable, fc.Errors[0].Code)
+
+	_, err = mockoidc.LoadFileConfig(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestMockOIDC_ApplyFileConfig(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.QueueUser(mockoidc.DefaultUser())
+	m.QueueCode("replaced")
+
+	err = m.ApplyFileConfig(&mockoidc.FileConfig{
+		ClientID:  "file-client",
+		AccessTTL: "5m",
+		Users:     []*mockoidc.MockUser{{Subject: "file-user"}},
+		Codes:     []string{"fixed-code-123"},
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, "file-client", m.ClientID)
+	assert.NotEmpty(t, m.ClientSecret)
+	assert.Equal(t, 5*time.Minute, m.AccessTTL)
+	assert.Equal(t, 60*time.Minute, m.RefreshTTL)
+	assert.Equal(t, "file-user", m.UserQueue.Pop().ID())
+	assert.Equal(t, mockoidc.DefaultUser().ID(), m.UserQueue.Pop().ID())
+	session, err := m.SessionStore.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+	assert.Equal(t, "fixed-code-123", session.SessionID)
+	session, err = m.SessionStore.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+	assert.NotEqual(t, "replaced", session.SessionID)
+
+	err = m.ApplyFileConfig(&mockoidc.FileConfig{AccessTTL: "forever"})
+	assert.Error(t, err)
+}
+
+func TestMockOIDC_AdminReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	err := ioutil.WriteFile(path, []byte(`{"client_id": "before"}`), 0600)
+	assert.NoError(t, err)
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ConfigFile = path
+	assert.NoError(t, m.Reload())
+	assert.Equal(t, "before", m.ClientID)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	err = m.Start(ln, nil)
+	assert.NoError(t, err)
+	defer m.Shutdown()
+	// Spare pooled connections would delay Shutdown
+	defer httpClient.CloseIdleConnections()
+
+	err = ioutil.WriteFile(path, []byte(testFileConfig), 0600)
+	assert.NoError(t, err)
+
+	reloadURL := m.Addr() + mockoidc.AdminReloadEndpoint
+	resp, err := httpClient.Get(reloadURL)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, err = httpClient.Post(reloadURL, "", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "file-client", m.ClientID)
+	assert.Equal(t, 5*time.Minute, m.AccessTTL)
+
+	// The queued error from the config file
+	resp, err = httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+
+	// Broken config files fail the reload
+	err = ioutil.WriteFile(path, []byte(`{`), 0600)
+	assert.NoError(t, err)
+	resp, err = httpClient.Post(reloadURL, "", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+}
+
+func TestMockOIDC_AdminReload_NoConfigFile(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	assert.Error(t, m.Reload())
+
+	resp, err := httpClient.Post(m.Addr()+mockoidc.AdminReloadEndpoint, "", nil)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
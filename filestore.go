@@ -0,0 +1,158 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// persistedSession is the JSON representation of a Session outside of memory
+type persistedSession struct {
+	SessionID           string                 `json:"session_id"`
+	Scopes              []string               `json:"scopes"`
+	OIDCNonce           string                 `json:"nonce,omitempty"`
+	User                *MockUser              `json:"user"`
+	Granted             bool                   `json:"granted"`
+	CodeChallenge       string                 `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string                 `json:"code_challenge_method,omitempty"`
+	RedirectURI         string                 `json:"redirect_uri,omitempty"`
+	State               string                 `json:"state,omitempty"`
+	UILocales           []string               `json:"ui_locales,omitempty"`
+	Display             string                 `json:"display,omitempty"`
+	Hints               map[string]string      `json:"hints,omitempty"`
+	ClientID            string                 `json:"client_id,omitempty"`
+	ClaimsRequest       *ClaimsRequest         `json:"claims_request,omitempty"`
+	IntrospectionExtras map[string]interface{} `json:"introspection_extras,omitempty"`
+	Revoked             bool                   `json:"revoked,omitempty"`
+	CertThumbprint      string                 `json:"cnf_x5t_s256,omitempty"`
+	IssuedAt            time.Time              `json:"issued_at"`
+	AuthTime            time.Time              `json:"auth_time,omitempty"`
+}
+
+func newPersistedSession(session *Session) (*persistedSession, error) {
+	user, ok := session.User.(*MockUser)
+	if !ok {
+		return nil, fmt.Errorf("unable to persist session %s: only *MockUser users are supported",
+			session.SessionID)
+	}
+	return &persistedSession{
+		SessionID:           session.SessionID,
+		Scopes:              session.Scopes,
+		OIDCNonce:           session.OIDCNonce,
+		User:                user,
+		Granted:             session.Granted,
+		CodeChallenge:       session.CodeChallenge,
+		CodeChallengeMethod: session.CodeChallengeMethod,
+		RedirectURI:         session.RedirectURI,
+		State:               session.State,
+		UILocales:           session.UILocales,
+		Display:             session.Display,
+		Hints:               session.Hints,
+		ClientID:            session.ClientID,
+		ClaimsRequest:       session.ClaimsRequest,
+		IntrospectionExtras: session.IntrospectionExtras,
+		Revoked:             session.Revoked,
+		CertThumbprint:      session.CertificateThumbprint,
+		IssuedAt:            session.IssuedAt,
+		AuthTime:            session.AuthTime,
+	}, nil
+}
+
+func (ps *persistedSession) session() *Session {
+	return &Session{
+		SessionID:             ps.SessionID,
+		Scopes:                ps.Scopes,
+		OIDCNonce:             ps.OIDCNonce,
+		User:                  ps.User,
+		Granted:               ps.Granted,
+		CodeChallenge:         ps.CodeChallenge,
+		CodeChallengeMethod:   ps.CodeChallengeMethod,
+		RedirectURI:           ps.RedirectURI,
+		State:                 ps.State,
+		UILocales:             ps.UILocales,
+		Display:               ps.Display,
+		Hints:                 ps.Hints,
+		ClientID:              ps.ClientID,
+		ClaimsRequest:         ps.ClaimsRequest,
+		IntrospectionExtras:   ps.IntrospectionExtras,
+		Revoked:               ps.Revoked,
+		CertificateThumbprint: ps.CertThumbprint,
+		IssuedAt:              ps.IssuedAt,
+		AuthTime:              ps.AuthTime,
+	}
+}
+
+// NewFileSessionStore initializes a SessionStore persisted as JSON to the
+// file at path. Sessions already in the file are loaded, so a restarted
+// standalone MockOIDC keeps honoring outstanding codes & refresh tokens
+// (if it signs with the same Keypair). Only `*MockUser` Users can be
+// persisted.
+func NewFileSessionStore(path string) (*MemorySessionStore, error) {
+	ss := NewSessionStore()
+	ss.backend = &fileBackend{path: path}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ss, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []*persistedSession
+	if err = json.Unmarshal(data, &sessions); err != nil {
+		return nil, err
+	}
+	for _, ps := range sessions {
+		ss.Store[ps.SessionID] = ps.session()
+		ss.touch(ps.SessionID)
+	}
+	return ss, nil
+}
+
+// fileBackend rewrites the whole file on every change. All sessions are
+// loaded upfront, so lookups are served from memory.
+type fileBackend struct {
+	path string
+}
+
+func (b *fileBackend) persist(store map[string]*Session, _ *Session) error {
+	sessions := make([]*persistedSession, 0, len(store))
+	for _, session := range store {
+		ps, err := newPersistedSession(session)
+		if err != nil {
+			return err
+		}
+		sessions = append(sessions, ps)
+	}
+	data, err := json.Marshal(sessions)
+	if err != nil {
+		return err
+	}
+
+	// Write & rename so a crash never leaves a truncated file behind
+	tmp, err := ioutil.TempFile(filepath.Dir(b.path), filepath.Base(b.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), b.path)
+}
+
+func (b *fileBackend) remove(store map[string]*Session, _ ...string) error {
+	return b.persist(store, nil)
+}
+
+func (b *fileBackend) lookup(string) (*Session, error) {
+	return nil, nil
+}
@@ -0,0 +1,44 @@
+package mockoidc_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+type unpersistableUser struct {
+	*mockoidc.MockUser
+}
+
+func TestNewFileSessionStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+
+	ss, err := mockoidc.NewFileSessionStore(path)
+	assert.NoError(t, err)
+	assert.Empty(t, ss.Store)
+
+	session, err := ss.NewSession("openid email", "nonce", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+	session.Granted = true
+	assert.NoError(t, ss.Save(session))
+
+	restarted, err := mockoidc.NewFileSessionStore(path)
+	assert.NoError(t, err)
+	loaded, err := restarted.GetSessionByID(session.SessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"openid", "email"}, loaded.Scopes)
+	assert.Equal(t, "nonce", loaded.OIDCNonce)
+	assert.True(t, loaded.Granted)
+	assert.Equal(t, mockoidc.DefaultUser(), loaded.User)
+}
+
+func TestNewFileSessionStore_UnsupportedUser(t *testing.T) {
+	ss, err := mockoidc.NewFileSessionStore(filepath.Join(t.TempDir(), "sessions.json"))
+	assert.NoError(t, err)
+
+	_, err = ss.NewSession("openid", "", &unpersistableUser{mockoidc.DefaultUser()})
+	assert.Error(t, err)
+	assert.Empty(t, ss.Store)
+}
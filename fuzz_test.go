@@ -0,0 +1,66 @@
+//go:build go1.18
+// +build go1.18
+
+package mockoidc_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+)
+
+func fuzzServer(f *testing.F) *mockoidc.MockOIDC {
+	m, err := mockoidc.NewServer(nil)
+	if err != nil {
+		f.Fatal(err)
+	}
+	m.ClientID, m.ClientSecret = "fuzz-client", "fuzz-secret"
+	m.QueueCode("fuzz-code")
+	return m
+}
+
+func fuzzRequest(t *testing.T, m *mockoidc.MockOIDC, endpoint, method, query string, body []byte, header http.Header) {
+	status, err := m.FuzzRequest(endpoint, method, query, body, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status < 200 || status > 599 {
+		t.Fatalf("invalid status code %d", status)
+	}
+}
+
+func FuzzAuthorize(f *testing.F) {
+	m := fuzzServer(f)
+	f.Add("client_id=fuzz-client&response_type=code&scope=openid&state=s&redirect_uri=https://app.example.com/cb", []byte{})
+	f.Add("client_id=fuzz-client&response_type=code&scope=openid%20email&state=s&redirect_uri=%zz", []byte{})
+	f.Add("scope=+openid++email+&state=&redirect_uri=:/%2F?x=1", []byte("\x00\xff"))
+	f.Fuzz(func(t *testing.T, query string, body []byte) {
+		fuzzRequest(t, m, mockoidc.AuthorizationEndpoint, http.MethodGet, query, body, nil)
+	})
+}
+
+func FuzzToken(f *testing.F) {
+	m := fuzzServer(f)
+	f.Add("client_id=fuzz-client&client_secret=fuzz-secret&grant_type=authorization_code&code=fuzz-code", "")
+	f.Add("client_id=fuzz-client&client_secret=fuzz-secret&grant_type=refresh_token&refresh_token=a.b.c", "")
+	f.Add("grant_type=%ff%00&code=", "Basic !!!")
+	f.Fuzz(func(t *testing.T, body string, authorization string) {
+		header := http.Header{
+			"Content-Type":  {"application/x-www-form-urlencoded"},
+			"Authorization": {authorization},
+		}
+		fuzzRequest(t, m, mockoidc.TokenEndpoint, http.MethodPost, "", []byte(body), header)
+	})
+}
+
+func FuzzUserinfo(f *testing.F) {
+	m := fuzzServer(f)
+	f.Add("Bearer eyJhbGciOiJSUzI1NiJ9.e30.c2ln")
+	f.Add("Bearer ")
+	f.Add("bearer\x00a.b")
+	f.Fuzz(func(t *testing.T, authorization string) {
+		header := http.Header{"Authorization": {authorization}}
+		fuzzRequest(t, m, mockoidc.UserinfoEndpoint, http.MethodGet, "", nil, header)
+	})
+}
@@ -0,0 +1,91 @@
+package mockoidc
+
+import "net/http"
+
+// endpointGate blocks the requests to a held endpoint until it's released
+type endpointGate struct {
+	released chan struct{}
+	waiting  int
+}
+
+// HoldEndpoint blocks requests to the endpoint (one of the `*Endpoint`
+// constants) before they are handled, until `ReleaseEndpoint` is called.
+// Use it with `HeldRequests` to deterministically put several requests in
+// flight at once, e.g. to verify a relying party deduplicates concurrent
+// refreshes. Shutdown & Reset release all endpoints.
+func (m *MockOIDC) HoldEndpoint(endpoint string) {
+	m.gatesMu.Lock()
+	defer m.gatesMu.Unlock()
+	if m.gates == nil {
+		m.gates = make(map[string]*endpointGate)
+	}
+	if _, ok := m.gates[endpoint]; !ok {
+		m.gates[endpoint] = &endpointGate{released: make(chan struct{})}
+	}
+}
+
+// ReleaseEndpoint lets the requests blocked by `HoldEndpoint` proceed, and
+// stops holding new ones.
+func (m *MockOIDC) ReleaseEndpoint(endpoint string) {
+	m.gatesMu.Lock()
+	defer m.gatesMu.Unlock()
+	if gate, ok := m.gates[endpoint]; ok {
+		close(gate.released)
+		delete(m.gates, endpoint)
+	}
+}
+
+// HeldRequests returns the number of requests currently blocked on the
+// held endpoint.
+func (m *MockOIDC) HeldRequests(endpoint string) int {
+	m.gatesMu.Lock()
+	defer m.gatesMu.Unlock()
+	if gate, ok := m.gates[endpoint]; ok {
+		return gate.waiting
+	}
+	return 0
+}
+
+// holdingEndpoints reports whether any endpoint is held
+func (m *MockOIDC) holdingEndpoints() bool {
+	m.gatesMu.Lock()
+	defer m.gatesMu.Unlock()
+	return len(m.gates) > 0
+}
+
+// releaseEndpoints releases all held endpoints
+func (m *MockOIDC) releaseEndpoints() {
+	m.gatesMu.Lock()
+	defer m.gatesMu.Unlock()
+	for endpoint, gate := range m.gates {
+		close(gate.released)
+		delete(m.gates, endpoint)
+	}
+}
+
+// holdable blocks requests while their endpoint is held. Requests whose
+// client gives up are dropped.
+func (m *MockOIDC) holdable(endpoint string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		m.gatesMu.Lock()
+		gate, held := m.gates[endpoint]
+		if held {
+			gate.waiting++
+		}
+		m.gatesMu.Unlock()
+
+		if held {
+			select {
+			case <-gate.released:
+			case <-req.Context().Done():
+			}
+			m.gatesMu.Lock()
+			gate.waiting--
+			m.gatesMu.Unlock()
+			if req.Context().Err() != nil {
+				return
+			}
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
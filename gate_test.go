@@ -0,0 +1,93 @@
+package mockoidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func waitHeld(t *testing.T, m *mockoidc.MockOIDC, endpoint string, count int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for m.HeldRequests(endpoint) != count {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d requests not held on %s", count, endpoint)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMockOIDC_HoldEndpoint(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+
+	m.HoldEndpoint(mockoidc.TokenEndpoint)
+	refresh := url.Values{
+		"client_id":     {m.ClientID},
+		"client_secret": {m.ClientSecret},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens.RefreshToken},
+	}.Encode()
+
+	var wg sync.WaitGroup
+	codes := make([]int, 2)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := httpClient.Post(m.TokenEndpoint(), "application/x-www-form-urlencoded",
+				strings.NewReader(refresh))
+			if assert.NoError(t, err) {
+				resp.Body.Close()
+				codes[i] = resp.StatusCode
+			}
+		}(i)
+	}
+	waitHeld(t, m, mockoidc.TokenEndpoint, 2)
+	// Requests to other endpoints aren't held
+	resp, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, uint64(1), m.RequestCount(mockoidc.TokenEndpoint))
+
+	m.ReleaseEndpoint(mockoidc.TokenEndpoint)
+	wg.Wait()
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK}, codes)
+	assert.Equal(t, 0, m.HeldRequests(mockoidc.TokenEndpoint))
+	assert.Equal(t, uint64(3), m.RequestCount(mockoidc.TokenEndpoint))
+}
+
+func TestMockOIDC_HoldEndpoint_Canceled(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	m.HoldEndpoint(mockoidc.DiscoveryEndpoint)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequest(http.MethodGet, m.DiscoveryEndpoint(), nil)
+	assert.NoError(t, err)
+	done := make(chan error)
+	go func() {
+		_, err := httpClient.Do(req.WithContext(ctx))
+		done <- err
+	}()
+	waitHeld(t, m, mockoidc.DiscoveryEndpoint, 1)
+	cancel()
+	assert.Error(t, <-done)
+	waitHeld(t, m, mockoidc.DiscoveryEndpoint, 0)
+
+	// Shutdown doesn't wait for held requests
+	go func() {
+		_, err := httpClient.Get(m.DiscoveryEndpoint())
+		done <- err
+	}()
+	waitHeld(t, m, mockoidc.DiscoveryEndpoint, 1)
+	assert.NoError(t, m.Shutdown())
+	<-done
+}
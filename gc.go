@@ -0,0 +1,34 @@
+package mockoidc
+
+import "time"
+
+// PruneExpired deletes the Sessions whose refresh tokens (or unexchanged
+// codes) are older than the RefreshTTL and returns how many were deleted.
+// Long-lived servers can run it periodically with `GCInterval`.
+func (m *MockOIDC) PruneExpired() (int, error) {
+	now := m.Now()
+	refreshTTL := m.Config().RefreshTTL
+	return m.SessionStore.GC(func(s *Session) bool {
+		return !s.IssuedAt.IsZero() && s.IssuedAt.Add(refreshTTL).Before(now)
+	})
+}
+
+// collectGarbage prunes expired Sessions every interval until done
+func (m *MockOIDC) collectGarbage(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			count, err := m.PruneExpired()
+			if err != nil {
+				m.logger().Error("unable to prune expired sessions", "error", err)
+			} else if count > 0 {
+				m.logger().Info("pruned expired sessions", "count", count)
+			}
+		}
+	}
+}
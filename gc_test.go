@@ -0,0 +1,58 @@
+package mockoidc_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_PruneExpired(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	expiring, err := m.SessionStore.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+	expiring.IssuedAt = m.Now()
+	untimed, err := m.SessionStore.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+
+	count, err := m.PruneExpired()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	m.FastForward(m.RefreshTTL + time.Minute)
+	count, err = m.PruneExpired()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	_, err = m.SessionStore.GetSessionByID(expiring.SessionID)
+	assert.Error(t, err)
+	_, err = m.SessionStore.GetSessionByID(untimed.SessionID)
+	assert.NoError(t, err)
+}
+
+func TestMockOIDC_GCInterval(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	logger := &recordingLogger{}
+	m.Logger = logger
+	m.GCInterval = 10 * time.Millisecond
+
+	session, err := m.SessionStore.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+	session.IssuedAt = m.Now().Add(-2 * m.RefreshTTL)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start(ln, nil))
+	defer m.Shutdown()
+
+	assert.Eventually(t, func() bool {
+		return len(logger.find("pruned expired sessions")) == 1
+	}, time.Second, 10*time.Millisecond)
+	_, err = m.SessionStore.GetSessionByID(session.SessionID)
+	assert.Error(t, err)
+}
@@ -3,9 +3,11 @@ module github.com/oauth2-proxy/mockoidc
 go 1.16
 
 require (
+	github.com/coreos/go-oidc/v3 v3.1.0
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
 	github.com/google/go-cmp v0.5.4 // indirect
 	github.com/stretchr/testify v1.7.0
 	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad // indirect
+	golang.org/x/oauth2 v0.0.0-20210218202405-ba52d332ba99
 	gopkg.in/square/go-jose.v2 v2.5.1
 )
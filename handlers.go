@@ -1,9 +1,13 @@
 package mockoidc
 
 import (
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"mime"
 	"net/http"
 	"net/url"
 	"strings"
@@ -20,25 +24,40 @@ const (
 	JWKSEndpoint          = "/oidc/.well-known/jwks.json"
 	DiscoveryEndpoint     = "/oidc/.well-known/openid-configuration"
 
-	InvalidRequest       = "invalid_request"
-	InvalidClient        = "invalid_client"
-	InvalidGrant         = "invalid_grant"
-	UnsupportedGrantType = "unsupported_grant_type"
-	InvalidScope         = "invalid_scope"
-	//UnauthorizedClient = "unauthorized_client"
-	InternalServerError = "internal_server_error"
+	InvalidRequest          = "invalid_request"
+	InvalidClient           = "invalid_client"
+	InvalidGrant            = "invalid_grant"
+	UnsupportedGrantType    = "unsupported_grant_type"
+	UnsupportedResponseType = "unsupported_response_type"
+	InvalidScope            = "invalid_scope"
+	AccessDenied            = "access_denied"
+	InvalidToken            = "invalid_token"
+	InvalidRequestObject    = "invalid_request_object"
+	InvalidRequestURI       = "invalid_request_uri"
+	UnauthorizedClient      = "unauthorized_client"
+	InternalServerError     = "internal_server_error"
 
 	applicationJSON = "application/json"
 	openidScope     = "openid"
 )
 
+// The discovery metadata every new MockOIDC starts from. Each instance keeps
+// its own copy, changed with its `Set...Supported` setters.
 var (
 	GrantTypesSupported = []string{
 		"authorization_code",
 		"refresh_token",
+		"client_credentials",
+		"urn:ietf:params:oauth:grant-type:device_code",
 	}
 	ResponseTypesSupported = []string{
 		"code",
+		"id_token",
+		"token",
+		"id_token token",
+		"code id_token",
+		"code token",
+		"code id_token token",
 	}
 	SubjectTypesSupported = []string{
 		"public",
@@ -55,6 +74,13 @@ var (
 	TokenEndpointAuthMethodsSupported = []string{
 		"client_secret_basic",
 		"client_secret_post",
+		"none",
+		"private_key_jwt",
+		"tls_client_auth",
+	}
+	CodeChallengeMethodsSupported = []string{
+		"plain",
+		"S256",
 	}
 	ClaimsSupported = []string{
 		"sub",
@@ -73,47 +99,128 @@ var (
 // It is the initial request that "authenticates" a user in the OAuth2
 // flow and redirects the client to the application `redirect_uri`.
 func (m *MockOIDC) Authorize(rw http.ResponseWriter, req *http.Request) {
+	if !formEncoded(req) {
+		errorResponse(rw, InvalidRequest,
+			"Authorization requests sent with POST must be form-encoded", http.StatusBadRequest)
+		return
+	}
 	err := req.ParseForm()
 	if err != nil {
 		internalServerError(rw, err.Error())
 		return
 	}
+	if !m.resolveAuthorizationRequest(rw, req) {
+		return
+	}
+	normalizeScope(m.supported().scopes, req)
+	normalizeResponseType(req)
+	config := m.requestConfig(req)
 
-	valid := assertPresence(
-		[]string{"scope", "state", "client_id", "response_type", "redirect_uri"}, rw, req)
-	if !valid {
+	// Errors are only redirected to a redirect_uri of a known client
+	if !assertPresence([]string{"client_id", "redirect_uri"}, rw, req) {
+		return
+	}
+	if !m.validateClient(config, false, rw, req) {
+		return
+	}
+	redirectURI, err := url.Parse(req.Form.Get("redirect_uri"))
+	if err != nil {
+		errorResponse(rw, InvalidRequest, fmt.Sprintf("Invalid redirect_uri: %s", err),
+			http.StatusBadRequest)
+		return
+	}
+	if !m.validateRedirectURI(rw, req) {
 		return
 	}
 
-	if !validateScope(rw, req) {
+	for _, param := range m.authorizeParams() {
+		if req.Form.Get(param) == "" {
+			m.authorizeError(rw, req, InvalidRequest,
+				fmt.Sprintf("The request is missing the required parameter: %s", param),
+				http.StatusBadRequest)
+			return
+		}
+	}
+	if m.ConformanceMode {
+		ignoreUnsupportedScopes(m.supported().scopes, req)
+	}
+	if scope, ok := unsupportedScope(m.supported().scopes, req); !ok {
+		m.authorizeError(rw, req, InvalidScope, fmt.Sprintf("Unsupported scope: %s", scope),
+			http.StatusBadRequest)
 		return
 	}
-	validClient := assertEqual("client_id", m.ClientID,
-		InvalidClient, "Invalid client id", rw, req)
-	if !validClient {
+	responseType := req.Form.Get("response_type")
+	if !containsString(m.responseTypes(m.supported()), responseType) {
+		description := fmt.Sprintf("Invalid response type: %s", responseType)
+		if m.LegacyResponseTypeError {
+			m.authorizeError(rw, req, UnsupportedGrantType, description, http.StatusUnauthorized)
+		} else {
+			m.authorizeError(rw, req, UnsupportedResponseType, description, http.StatusBadRequest)
+		}
 		return
 	}
-	validType := assertEqual("response_type", "code",
-		UnsupportedGrantType, "Invalid response type", rw, req)
-	if !validType {
+	if containsString(jarmResponseModes, req.Form.Get("response_mode")) && !jarmResponse(req) {
+		m.authorizeError(rw, req, InvalidRequest,
+			"JARM responses are only supported for the code response_type", http.StatusBadRequest)
+		return
+	}
+	if m.requireNonce() && req.Form.Get("nonce") == "" &&
+		containsString(strings.Fields(req.Form.Get("scope")), openidScope) {
+		m.authorizeError(rw, req, InvalidRequest,
+			"The request is missing the required parameter: nonce", http.StatusBadRequest)
+		return
+	}
+	if !m.validateIDTokenResponse(rw, req) || !m.validateCodeChallenge(rw, req) ||
+		!m.requirePKCE(rw, req) || !m.fapiAuthorize(rw, req) {
+		return
+	}
+	claimsRequest, ok := m.parseClaimsRequest(rw, req)
+	if !ok {
+		return
+	}
+	if m.interactiveLogin(rw, req) {
 		return
 	}
 
-	session, err := m.SessionStore.NewSession(
-		req.Form.Get("scope"),
-		req.Form.Get("nonce"),
-		m.UserQueue.Pop(),
-	)
+	session, err := m.newLoginSession(req.Form.Get("scope"), req.Form.Get("nonce"))
 	if err != nil {
 		internalServerError(rw, err.Error())
 		return
 	}
-
-	redirectURI, err := url.Parse(req.Form.Get("redirect_uri"))
-	if err != nil {
+	session.IssuedAt = m.Now()
+	session.AuthTime = session.IssuedAt
+	session.CodeChallenge = req.Form.Get("code_challenge")
+	session.CodeChallengeMethod = req.Form.Get("code_challenge_method")
+	session.RedirectURI = req.Form.Get("redirect_uri")
+	session.State = req.Form.Get("state")
+	session.UILocales = strings.Fields(req.Form.Get("ui_locales"))
+	session.Display = req.Form.Get("display")
+	session.Hints = m.authorizeHints(req)
+	session.ClientID = req.Form.Get("client_id")
+	session.ClaimsRequest = claimsRequest
+	// Implicit flows have no code to exchange
+	session.Granted = implicitFlow(responseType)
+	if !runHook(m.OnAuthorize, session, rw, req) {
+		return
+	}
+	if err = m.SessionStore.Save(session); err != nil {
 		internalServerError(rw, err.Error())
 		return
 	}
+	captureSession(req, session)
+	m.emit(EventSessionCreated, session, req)
+
+	if fragmentResponse(responseType) {
+		m.fragmentRedirect(rw, req, session, redirectURI, config)
+		return
+	}
+	if jarmResponse(req) {
+		m.jarmRedirect(rw, req, url.Values{
+			"code":  {session.SessionID},
+			"state": {req.Form.Get("state")},
+		})
+		return
+	}
 	params, _ := url.ParseQuery(redirectURI.RawQuery)
 	params.Set("code", session.SessionID)
 	params.Set("state", req.Form.Get("state"))
@@ -122,12 +229,22 @@ func (m *MockOIDC) Authorize(rw http.ResponseWriter, req *http.Request) {
 	http.Redirect(rw, req, redirectURI.String(), http.StatusFound)
 }
 
+// formEncoded reports whether the request has no body or a form-encoded one
+func formEncoded(req *http.Request) bool {
+	if req.Method != http.MethodPost || req.ContentLength == 0 {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	return mediaType == "application/x-www-form-urlencoded"
+}
+
 type tokenResponse struct {
 	AccessToken  string        `json:"access_token,omitempty"`
 	RefreshToken string        `json:"refresh_token,omitempty"`
 	IDToken      string        `json:"id_token,omitempty"`
 	TokenType    string        `json:"token_type"`
 	ExpiresIn    time.Duration `json:"expires_in"`
+	Scope        string        `json:"scope,omitempty"`
 }
 
 // Token implements the `token_endpoint` in OIDC and responds to requests
@@ -138,13 +255,34 @@ type tokenResponse struct {
 // the `code`).
 // Reference: https://www.oauth.com/oauth2-servers/access-tokens/access-token-response/
 func (m *MockOIDC) Token(rw http.ResponseWriter, req *http.Request) {
-	err := req.ParseForm()
-	if err != nil {
-		internalServerError(rw, err.Error())
+	if !m.parseTokenRequest(rw, req) {
 		return
 	}
 
-	if !m.validateTokenParams(rw, req) {
+	config := m.requestConfig(req)
+	if !m.clientAuthMethod(rw, req) {
+		return
+	}
+	required := []string{"client_id", "client_secret", "grant_type"}
+	switch grantType := req.Form.Get("grant_type"); {
+	case grantType == deviceCodeGrant:
+		// Public device clients poll without a secret, which validateClient
+		// then checks is their registered (empty) one
+		required = []string{"client_id", "grant_type"}
+	case m.keyAuthenticated(req):
+		required = []string{"client_id", "grant_type"}
+	case grantType != clientCredentialsGrant && m.publicClient(config, req.Form.Get("client_id")):
+		// Public clients have no secret to authenticate with (RFC 6749
+		// §2.1), their codes are bound to them with PKCE instead
+		required = []string{"client_id", "grant_type"}
+		if grantType == "authorization_code" {
+			required = append(required, "code_verifier")
+		}
+	}
+	if !assertPresence(required, rw, req) {
+		return
+	}
+	if !m.validateClient(config, true, rw, req) {
 		return
 	}
 
@@ -153,33 +291,46 @@ func (m *MockOIDC) Token(rw http.ResponseWriter, req *http.Request) {
 		valid   bool
 	)
 	grantType := req.Form.Get("grant_type")
-	switch grantType {
-	case "authorization_code":
-		if session, valid = m.validateCodeGrant(rw, req); !valid {
-			return
-		}
-	case "refresh_token":
-		if session, valid = m.validateRefreshGrant(rw, req); !valid {
+	g := m.grant(m.supported(), grantType)
+	if g == nil {
+		errorResponse(rw, UnsupportedGrantType,
+			fmt.Sprintf("Unsupported grant type: %s", grantType), http.StatusBadRequest)
+		return
+	}
+	if session, valid = g.validate(m, rw, req); !valid {
+		return
+	}
+
+	captureSession(req, session)
+	// Tokens are bound to the client certificate the session was last
+	// redeemed with (RFC 8705 §3)
+	if thumbprint := certificateThumbprint(req); thumbprint != "" && thumbprint != session.CertificateThumbprint {
+		session.CertificateThumbprint = thumbprint
+		if err := m.SessionStore.Save(session); err != nil {
+			internalServerError(rw, err.Error())
 			return
 		}
-	default:
-		errorResponse(rw, InvalidRequest,
-			fmt.Sprintf("Invalid grant type: %s", grantType), http.StatusBadRequest)
-		return
 	}
 
 	tr := &tokenResponse{
 		RefreshToken: req.Form.Get("refresh_token"),
-		TokenType:    "bearer",
-		ExpiresIn:    m.AccessTTL,
+		TokenType:    m.tokenType(),
+		ExpiresIn:    config.AccessTTL,
 	}
-	err = m.setTokens(tr, session, grantType)
+	err := m.setTokens(tr, session, grantType, config)
 	if err != nil {
 		internalServerError(rw, err.Error())
 		return
 	}
+	if !runHook(m.OnTokenIssued, session, rw, req) {
+		return
+	}
+	if grantType == "refresh_token" {
+		m.emit(EventRefreshUsed, session, req)
+	}
+	m.emit(EventTokenIssued, session, req)
 
-	resp, err := json.Marshal(tr)
+	resp, err := m.marshalTokenResponse(tr)
 	if err != nil {
 		internalServerError(rw, err.Error())
 		return
@@ -188,25 +339,92 @@ func (m *MockOIDC) Token(rw http.ResponseWriter, req *http.Request) {
 	jsonResponse(rw, resp)
 }
 
-func (m *MockOIDC) validateTokenParams(rw http.ResponseWriter, req *http.Request) bool {
-	if !assertPresence([]string{"client_id", "client_secret", "grant_type"}, rw, req) {
+// validateClient checks the client_id (and the client's credentials) is the
+// configured client's or a registered one, and sets it in the request's
+// config so tokens are issued to it.
+func (m *MockOIDC) validateClient(config *Config, checkSecret bool, rw http.ResponseWriter, req *http.Request) bool {
+	clientID := req.Form.Get("client_id")
+	client, err := m.lookupClient(config, clientID)
+	if errors.Is(err, ErrUnknownClient) {
+		errorResponse(rw, InvalidClient, fmt.Sprintf("Invalid client id: %s", clientID),
+			http.StatusUnauthorized)
+		return false
+	} else if err != nil {
+		internalServerError(rw, err.Error())
 		return false
 	}
-
-	equal := assertEqual("client_id", m.ClientID,
-		InvalidClient, "Invalid client id", rw, req)
-	if !equal {
+	if checkSecret && !m.authenticateClient(config, client, rw, req) {
 		return false
 	}
-	equal = assertEqual("client_secret", m.ClientSecret,
-		InvalidClient, "Invalid client secret", rw, req)
-	if !equal {
+	if method := m.usedAuthMethod(req); checkSecret && client.TokenEndpointAuthMethod != "" &&
+		method != client.TokenEndpointAuthMethod {
+		errorResponse(rw, InvalidClient,
+			fmt.Sprintf("The client registered the %s token_endpoint_auth_method, not %s",
+				client.TokenEndpointAuthMethod, method), http.StatusUnauthorized)
 		return false
 	}
 
+	config.ClientID, config.ClientSecret = client.ID, client.Secret
 	return true
 }
 
+// authorizeHints collects the hint parameters of an authorization request
+func (m *MockOIDC) authorizeHints(req *http.Request) map[string]string {
+	var hints map[string]string
+	for name := range req.Form {
+		if !strings.HasSuffix(name, "_hint") && !containsString(m.HintParams, name) {
+			continue
+		}
+		if hints == nil {
+			hints = make(map[string]string)
+		}
+		hints[name] = req.Form.Get(name)
+	}
+	return hints
+}
+
+// validateRedirectURI checks the redirect_uri is one the client registered,
+// if it registered any
+func (m *MockOIDC) validateRedirectURI(rw http.ResponseWriter, req *http.Request) bool {
+	client, err := m.lookupClient(m.Config(), req.Form.Get("client_id"))
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return false
+	}
+	redirectURI := req.Form.Get("redirect_uri")
+	if m.redirectURIRegistered(client, redirectURI) {
+		return true
+	}
+	errorResponse(rw, InvalidRequest,
+		fmt.Sprintf("Unregistered redirect_uri: %s", redirectURI), http.StatusBadRequest)
+	return false
+}
+
+// validateGrantRedirectURI checks the redirect_uri of a code exchange is the
+// authorization request's (RFC 6749 §4.1.3). Exchanges without one are only
+// rejected for clients with registered RedirectURIs, older relying parties
+// & tests don't send it. The ComplianceMode makes it required or unchecked.
+func (m *MockOIDC) validateGrantRedirectURI(session *Session, rw http.ResponseWriter, req *http.Request) bool {
+	redirectURI, ok := req.Form["redirect_uri"]
+	if session.RedirectURI == "" || (ok && redirectURI[0] == session.RedirectURI) ||
+		m.lenientRedirectURIs() {
+		return true
+	}
+	if !ok && m.Compliance != ComplianceStrict {
+		client, err := m.lookupClient(m.Config(), req.Form.Get("client_id"))
+		if err != nil {
+			internalServerError(rw, err.Error())
+			return false
+		}
+		if len(client.RedirectURIs) == 0 {
+			return true
+		}
+	}
+	errorResponse(rw, InvalidGrant, fmt.Sprintf("Invalid redirect_uri: %s",
+		req.Form.Get("redirect_uri")), http.StatusBadRequest)
+	return false
+}
+
 func (m *MockOIDC) validateCodeGrant(rw http.ResponseWriter, req *http.Request) (*Session, bool) {
 	if !assertPresence([]string{"code"}, rw, req) {
 		return nil, false
@@ -219,12 +437,29 @@ func (m *MockOIDC) validateCodeGrant(rw http.ResponseWriter, req *http.Request)
 
 	code := req.Form.Get("code")
 	session, err := m.SessionStore.GetSessionByID(code)
+	if err == nil && session.Granted && !m.codeReused(session, rw, req) {
+		return nil, false
+	}
 	if err != nil || session.Granted {
 		errorResponse(rw, InvalidGrant, fmt.Sprintf("Invalid code: %s", code),
 			http.StatusUnauthorized)
 		return nil, false
 	}
+	// Codes are bound to the client they were issued to (RFC 6749 §4.1.3)
+	if session.ClientID != "" && session.ClientID != req.Form.Get("client_id") {
+		errorResponse(rw, InvalidGrant, "The code was issued to another client",
+			http.StatusBadRequest)
+		return nil, false
+	}
+	if !m.validateGrantRedirectURI(session, rw, req) || !validateCodeVerifier(session, rw, req) {
+		return nil, false
+	}
 	session.Granted = true
+	session.IssuedAt = m.Now()
+	if err = m.SessionStore.Save(session); err != nil {
+		internalServerError(rw, err.Error())
+		return nil, false
+	}
 
 	return session, true
 }
@@ -240,14 +475,24 @@ func (m *MockOIDC) validateRefreshGrant(rw http.ResponseWriter, req *http.Reques
 		return nil, false
 	}
 
-	refreshToken := req.Form.Get("refresh_token")
-	token, authorized := m.authorizeToken(refreshToken, rw)
-	if !authorized {
+	// Unlike bearer tokens, invalid grants aren't challenged (RFC 6749 §5.2)
+	token, invalid, err := m.verifyToken(req.Form.Get("refresh_token"))
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return nil, false
+	} else if invalid != "" {
+		errorResponse(rw, InvalidGrant, invalid, http.StatusUnauthorized)
 		return nil, false
 	}
 
 	session, err := m.SessionStore.GetSessionByToken(token)
-	if err != nil {
+	if err == nil && session.Revoked {
+		m.emit(EventRefreshRejected, session, req)
+		if !runHook(m.OnRefreshRejected, session, rw, req) {
+			return nil, false
+		}
+	}
+	if err != nil || session.Revoked {
 		errorResponse(rw, InvalidGrant, "Invalid refresh token",
 			http.StatusUnauthorized)
 		return nil, false
@@ -255,20 +500,42 @@ func (m *MockOIDC) validateRefreshGrant(rw http.ResponseWriter, req *http.Reques
 	return session, true
 }
 
-func (m *MockOIDC) setTokens(tr *tokenResponse, s *Session, grantType string) error {
+// newLoginSession creates the Session of the next queued User logging in,
+// with the code it was queued with if any
+func (m *MockOIDC) newLoginSession(scope, nonce string) (*Session, error) {
+	switch user := m.users().Pop().(type) {
+	case *boundUser:
+		store, ok := m.SessionStore.(sessionIDStore)
+		if !ok {
+			return nil, errors.New("the session store can't issue queued codes")
+		}
+		return store.NewSessionWithID(user.code, scope, nonce, user.User)
+	default:
+		return m.SessionStore.NewSession(scope, nonce, user)
+	}
+}
+
+func (m *MockOIDC) setTokens(tr *tokenResponse, s *Session, grantType string, config *Config) error {
 	var err error
-	tr.AccessToken, err = s.AccessToken(m.Config(), m.Keypair, m.Now())
+	keypair := m.signingKey()
+	if grantType == clientCredentialsGrant {
+		// Machine-to-machine tokens have neither an ID nor a refresh token
+		tr.AccessToken, err = s.clientCredentialsToken(config, keypair, m.Now())
+		tr.Scope = strings.Join(s.Scopes, " ")
+		return err
+	}
+	tr.AccessToken, err = s.AccessToken(config, keypair, m.Now())
 	if err != nil {
 		return err
 	}
-	if len(s.Scopes) > 0 && s.Scopes[0] == openidScope {
-		tr.IDToken, err = s.IDToken(m.Config(), m.Keypair, m.Now())
+	if containsString(s.Scopes, openidScope) && (grantType != "refresh_token" || !m.OmitRefreshIDToken) {
+		tr.IDToken, err = m.idToken(s, config, nil)
 		if err != nil {
 			return err
 		}
 	}
 	if grantType != "refresh_token" {
-		tr.RefreshToken, err = s.RefreshToken(m.Config(), m.Keypair, m.Now())
+		tr.RefreshToken, err = s.RefreshToken(config, keypair, m.Now())
 		if err != nil {
 			return err
 		}
@@ -281,17 +548,36 @@ func (m *MockOIDC) setTokens(tr *tokenResponse, s *Session, grantType string) er
 // initial `authorization_endpoint` call.
 func (m *MockOIDC) Userinfo(rw http.ResponseWriter, req *http.Request) {
 	token, authorized := m.authorizeBearer(rw, req)
-	if !authorized {
+	if !authorized || !m.checkUserinfoAudience(token, rw) || !certificateBound(token, rw, req) {
 		return
 	}
 
+	// Sessions may have been evicted or collected while their tokens are live
 	session, err := m.SessionStore.GetSessionByToken(token)
 	if err != nil {
-		internalServerError(rw, err.Error())
+		description := fmt.Sprintf("Invalid token: %v", err)
+		bearerChallenge(rw, InvalidToken, description)
+		errorResponse(rw, InvalidToken, description, http.StatusUnauthorized)
+		return
+	}
+	if session.Revoked {
+		bearerChallenge(rw, InvalidToken, "The token was revoked")
+		errorResponse(rw, InvalidToken, "The token was revoked", http.StatusUnauthorized)
+		return
+	}
+	captureSession(req, session)
+	if !runHook(m.OnUserinfo, session, rw, req) {
 		return
 	}
 
-	resp, err := session.User.Userinfo(session.Scopes)
+	claims, _, err := m.releaseClaims(session, ClaimsUserinfo, nil, m.requestConfig(req))
+	var resp []byte
+	if err == nil {
+		resp, err = json.Marshal(claims)
+	}
+	if err == nil && m.ConformanceMode {
+		resp, err = userinfoWithSubject(session.User, resp)
+	}
 	if err != nil {
 		internalServerError(rw, err.Error())
 		return
@@ -300,11 +586,16 @@ func (m *MockOIDC) Userinfo(rw http.ResponseWriter, req *http.Request) {
 }
 
 type discoveryResponse struct {
-	Issuer                string `json:"issuer"`
-	AuthorizationEndpoint string `json:"authorization_endpoint"`
-	TokenEndpoint         string `json:"token_endpoint"`
-	JWKSUri               string `json:"jwks_uri"`
-	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	Issuer                      string `json:"issuer"`
+	AuthorizationEndpoint       string `json:"authorization_endpoint"`
+	TokenEndpoint               string `json:"token_endpoint"`
+	JWKSUri                     string `json:"jwks_uri"`
+	UserinfoEndpoint            string `json:"userinfo_endpoint"`
+	EndSessionEndpoint          string `json:"end_session_endpoint"`
+	RevocationEndpoint          string `json:"revocation_endpoint"`
+	IntrospectionEndpoint       string `json:"introspection_endpoint"`
+	DeviceAuthorizationEndpoint string `json:"device_authorization_endpoint,omitempty"`
+	PushedAuthorizationEndpoint string `json:"pushed_authorization_request_endpoint"`
 
 	GrantTypesSupported               []string `json:"grant_types_supported"`
 	ResponseTypesSupported            []string `json:"response_types_supported"`
@@ -313,81 +604,248 @@ type discoveryResponse struct {
 	ScopesSupported                   []string `json:"scopes_supported"`
 	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
 	ClaimsSupported                   []string `json:"claims_supported"`
+	ClaimsParameterSupported          bool     `json:"claims_parameter_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+
+	RequestParameterSupported              bool     `json:"request_parameter_supported"`
+	RequestURIParameterSupported           bool     `json:"request_uri_parameter_supported"`
+	RequestObjectSigningAlgValuesSupported []string `json:"request_object_signing_alg_values_supported"`
+	ResponseModesSupported                 []string `json:"response_modes_supported"`
+	AuthorizationSigningAlgValuesSupported []string `json:"authorization_signing_alg_values_supported"`
+	TokenEndpointAuthSigningAlgsSupported  []string `json:"token_endpoint_auth_signing_alg_values_supported,omitempty"`
+	TLSClientCertificateBoundAccessTokens  bool     `json:"tls_client_certificate_bound_access_tokens"`
 }
 
 // Discovery renders the OIDC discovery document hosted at
 // `/.well-known/openid-configuration`.
-func (m *MockOIDC) Discovery(rw http.ResponseWriter, _ *http.Request) {
-	discovery := &discoveryResponse{
-		Issuer:                m.Issuer(),
-		AuthorizationEndpoint: m.AuthorizationEndpoint(),
-		TokenEndpoint:         m.TokenEndpoint(),
-		JWKSUri:               m.JWKSEndpoint(),
-		UserinfoEndpoint:      m.UserinfoEndpoint(),
-
-		GrantTypesSupported:               GrantTypesSupported,
-		ResponseTypesSupported:            ResponseTypesSupported,
-		SubjectTypesSupported:             SubjectTypesSupported,
-		IDTokenSigningAlgValuesSupported:  IDTokenSigningAlgValuesSupported,
-		ScopesSupported:                   ScopesSupported,
-		TokenEndpointAuthMethodsSupported: TokenEndpointAuthMethodsSupported,
-		ClaimsSupported:                   ClaimsSupported,
-	}
-
-	resp, err := json.Marshal(discovery)
+func (m *MockOIDC) Discovery(rw http.ResponseWriter, req *http.Request) {
+	addr := m.requestAddr(req)
+	issuer := m.formatIssuer(addr)
+	md := m.supported()
+	render := func() ([]byte, error) {
+		return m.renderDiscovery(addr, issuer, md)
+	}
+
+	var (
+		resp []byte
+		err  error
+	)
+	if m.PerformanceMode {
+		resp, err = m.cachedDiscovery(discoveryKey{addr, issuer, m.BasePath, md,
+			m.capabilitiesKey(md), m.ConformanceMode, m.FAPIMode}, render)
+	} else {
+		resp, err = render()
+	}
 	if err != nil {
 		internalServerError(rw, err.Error())
 		return
 	}
-	jsonResponse(rw, resp)
+	m.metadataResponse(rw, req, resp)
+}
+
+func (m *MockOIDC) renderDiscovery(addr, issuer string, md *metadata) ([]byte, error) {
+	discovery := &discoveryResponse{
+		Issuer:                      issuer,
+		AuthorizationEndpoint:       addr + m.endpointPath(AuthorizationEndpoint),
+		TokenEndpoint:               addr + m.endpointPath(TokenEndpoint),
+		JWKSUri:                     addr + m.endpointPath(JWKSEndpoint),
+		UserinfoEndpoint:            addr + m.endpointPath(UserinfoEndpoint),
+		EndSessionEndpoint:          addr + m.endpointPath(EndSessionEndpoint),
+		RevocationEndpoint:          addr + m.endpointPath(RevocationEndpoint),
+		IntrospectionEndpoint:       addr + m.endpointPath(IntrospectionEndpoint),
+		PushedAuthorizationEndpoint: addr + m.endpointPath(PushedAuthorizationEndpoint),
+
+		GrantTypesSupported:               m.grantTypes(md),
+		ResponseTypesSupported:            m.responseTypes(md),
+		SubjectTypesSupported:             md.subjectTypes,
+		IDTokenSigningAlgValuesSupported:  md.idTokenSigningAlgs,
+		ScopesSupported:                   md.scopes,
+		TokenEndpointAuthMethodsSupported: m.tokenEndpointAuthMethods(md),
+		ClaimsSupported:                   md.claimsSupported(),
+		ClaimsParameterSupported:          true,
+		CodeChallengeMethodsSupported:     md.codeChallengeMethods,
+
+		// Request objects are only accepted by value, pushed requests'
+		// `request_uri`s are always supported
+		RequestParameterSupported:              true,
+		RequestObjectSigningAlgValuesSupported: m.clientSigningAlgs(),
+		ResponseModesSupported:                 append([]string{"query", "fragment"}, jarmResponseModes...),
+		AuthorizationSigningAlgValuesSupported: md.idTokenSigningAlgs,
+		TLSClientCertificateBoundAccessTokens:  true,
+	}
+	if m.grant(md, deviceCodeGrant) != nil {
+		discovery.DeviceAuthorizationEndpoint = addr + m.endpointPath(DeviceAuthorizationEndpoint)
+	}
+	if containsString(discovery.TokenEndpointAuthMethodsSupported, "private_key_jwt") {
+		discovery.TokenEndpointAuthSigningAlgsSupported = m.clientSigningAlgs()
+	}
+	data, err := json.Marshal(discovery)
+	if err != nil || len(md.extras) == 0 {
+		return data, err
+	}
+
+	merged := make(map[string]interface{})
+	if err = json.Unmarshal(data, &merged); err != nil {
+		return nil, err
+	}
+	for key, value := range md.extras {
+		merged[key] = value
+	}
+	return json.Marshal(merged)
 }
 
 // JWKS returns the public key in JWKS format to verify in tokens
 // signed with our Keypair.PrivateKey.
-func (m *MockOIDC) JWKS(rw http.ResponseWriter, _ *http.Request) {
-	jwks, err := m.Keypair.JWKS()
+func (m *MockOIDC) JWKS(rw http.ResponseWriter, req *http.Request) {
+	var (
+		jwks []byte
+		err  error
+	)
+	if m.PerformanceMode {
+		jwks, err = m.cachedJWKS()
+	} else {
+		jwks, err = m.jwks()
+	}
 	if err != nil {
 		internalServerError(rw, err.Error())
 		return
 	}
 
-	jsonResponse(rw, jwks)
+	m.metadataResponse(rw, req, jwks)
 }
 
+// metadataResponse renders the discovery document or JWKS with the
+// configured `MetadataCacheControl` & `MetadataETags`
+func (m *MockOIDC) metadataResponse(rw http.ResponseWriter, req *http.Request, data []byte) {
+	if m.MetadataCacheControl == "" && !m.MetadataETags {
+		jsonResponse(rw, data)
+		return
+	}
+
+	if m.MetadataCacheControl != "" {
+		rw.Header().Set("Cache-Control", m.MetadataCacheControl)
+	} else {
+		noCache(rw)
+	}
+	if m.MetadataETags {
+		sum := sha256.Sum256(data)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		rw.Header().Set("ETag", etag)
+		if etagMatches(req.Header.Get("If-None-Match"), etag) {
+			rw.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+	rw.Header().Set("Content-Type", applicationJSON)
+	rw.WriteHeader(http.StatusOK)
+
+	// Write errors are logged by the instrumented handler chain
+	_, _ = rw.Write(data)
+}
+
+// etagMatches reports whether an `If-None-Match` header lists the ETag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// authorizeBearer verifies the access token of a request. It is read from
+// the `Authorization` header, or the `access_token` of a form-encoded body
+// and, with `AllowQueryAccessToken`, the query as RFC 6750 §2.2 & §2.3 allow.
 func (m *MockOIDC) authorizeBearer(rw http.ResponseWriter, req *http.Request) (*jwt.Token, bool) {
-	header := req.Header.Get("Authorization")
-	parts := strings.SplitN(header, " ", 2)
-	if len(parts) < 2 || parts[0] != "Bearer" {
+	var tokens []string
+	if header := req.Header.Get("Authorization"); header != "" {
+		parts := strings.SplitN(header, " ", 2)
+		if len(parts) < 2 || parts[0] != "Bearer" {
+			bearerChallenge(rw, "", "")
+			errorResponse(rw, InvalidRequest, "Invalid authorization header",
+				http.StatusUnauthorized)
+			return nil, false
+		}
+		tokens = append(tokens, parts[1])
+	}
+	if err := req.ParseForm(); err == nil {
+		if t := req.PostForm.Get("access_token"); t != "" {
+			tokens = append(tokens, t)
+		}
+		if t := req.URL.Query().Get("access_token"); t != "" && m.AllowQueryAccessToken {
+			tokens = append(tokens, t)
+		}
+	}
+
+	switch len(tokens) {
+	case 0:
+		bearerChallenge(rw, "", "")
 		errorResponse(rw, InvalidRequest, "Invalid authorization header",
 			http.StatusUnauthorized)
 		return nil, false
+	case 1:
+		return m.authorizeToken(tokens[0], rw)
+	default:
+		bearerChallenge(rw, InvalidRequest, "The access token was sent more than once")
+		errorResponse(rw, InvalidRequest, "The access token was sent more than once",
+			http.StatusBadRequest)
+		return nil, false
 	}
-
-	return m.authorizeToken(parts[1], rw)
 }
 
+// authorizeToken verifies a bearer token, challenging the client to send a
+// valid one otherwise
 func (m *MockOIDC) authorizeToken(t string, rw http.ResponseWriter) (*jwt.Token, bool) {
-	token, err := m.Keypair.VerifyJWT(t)
+	token, invalid, err := m.verifyToken(t)
 	if err != nil {
-		errorResponse(rw, InvalidRequest, fmt.Sprintf("Invalid token: %v", err), http.StatusUnauthorized)
+		internalServerError(rw, err.Error())
+		return nil, false
+	} else if invalid != "" {
+		bearerChallenge(rw, InvalidToken, invalid)
+		errorResponse(rw, InvalidToken, invalid, http.StatusUnauthorized)
 		return nil, false
 	}
+	return token, true
+}
+
+// verifyToken checks the signature & validity period of a token, returning
+// why it is invalid if it is. Errors are internal ones.
+func (m *MockOIDC) verifyToken(t string) (*jwt.Token, string, error) {
+	token, err := m.verifySignature(t)
+	if err != nil {
+		return nil, fmt.Sprintf("Invalid token: %v", err), nil
+	}
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		internalServerError(rw, "Unable to extract token claims")
-		return nil, false
+		return nil, "", errors.New("Unable to extract token claims")
 	}
 	exp, ok := claims["exp"].(float64)
 	if !ok {
-		internalServerError(rw, "Unable to extract token expiration")
-		return nil, false
+		return nil, "", errors.New("Unable to extract token expiration")
 	}
-	if m.Now().Unix() > int64(exp) {
-		errorResponse(rw, InvalidRequest, "The token is expired", http.StatusUnauthorized)
-		return nil, false
+	now := m.Now().Unix()
+	if now > int64(exp) {
+		return nil, "The token is expired", nil
 	}
-	return token, true
+	if !claims.VerifyNotBefore(now, false) || !claims.VerifyIssuedAt(now, false) {
+		return nil, "The token is not valid yet", nil
+	}
+	return token, "", nil
+}
+
+// bearerChallenge sets the RFC 6750 §3 `WWW-Authenticate` header of a 401
+// from a bearer-protected endpoint. Requests without a token get a challenge
+// without an error code.
+func bearerChallenge(rw http.ResponseWriter, error, description string) {
+	challenge := "Bearer"
+	if error != "" {
+		quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+		challenge += fmt.Sprintf(` error="%s", error_description="%s"`,
+			quote.Replace(error), quote.Replace(description))
+	}
+	rw.Header().Set("WWW-Authenticate", challenge)
 }
 
 func assertPresence(params []string, rw http.ResponseWriter, req *http.Request) bool {
@@ -416,28 +874,110 @@ func assertEqual(param, value, errorType, errorMsg string, rw http.ResponseWrite
 	return true
 }
 
-func validateScope(rw http.ResponseWriter, req *http.Request) bool {
+func validateScope(supported []string, rw http.ResponseWriter, req *http.Request) bool {
+	if scope, ok := unsupportedScope(supported, req); !ok {
+		errorResponse(rw, InvalidScope, fmt.Sprintf("Unsupported scope: %s", scope),
+			http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// normalizeScope joins repeated `scope` parameters and splits them on any
+// whitespace, and on `+`s that aren't part of a supported scope, dropping
+// duplicates. Quirky client encodings are then read like a single
+// space-delimited `scope`.
+func normalizeScope(supported []string, req *http.Request) {
+	values, ok := req.Form["scope"]
+	if !ok {
+		return
+	}
+	var scopes []string
+	for _, value := range values {
+		for _, field := range strings.Fields(value) {
+			parts := []string{field}
+			if !containsString(supported, field) {
+				parts = strings.Split(field, "+")
+			}
+			for _, scope := range parts {
+				if scope != "" && !containsString(scopes, scope) {
+					scopes = append(scopes, scope)
+				}
+			}
+		}
+	}
+	req.Form["scope"] = []string{strings.Join(scopes, " ")}
+}
+
+// unsupportedScope returns the first requested scope that isn't supported
+func unsupportedScope(supported []string, req *http.Request) (string, bool) {
 	allowed := make(map[string]struct{})
-	for _, scope := range ScopesSupported {
+	for _, scope := range supported {
 		allowed[scope] = struct{}{}
 	}
 
-	scopes := strings.Split(req.Form.Get("scope"), " ")
-	for _, scope := range scopes {
+	for _, scope := range strings.Fields(req.Form.Get("scope")) {
 		if _, ok := allowed[scope]; !ok {
-			errorResponse(rw, InvalidScope, fmt.Sprintf("Unsupported scope: %s", scope),
-				http.StatusBadRequest)
-			return false
+			return scope, false
 		}
 	}
-	return true
+	return "", true
+}
+
+// authorizeError redirects an error back to the client per RFC 6749
+// §4.1.2.1, in a JWT if it asked for a JARM response, or renders it as JSON
+// with the status code when AuthorizeErrorsAsJSON is set
+func (m *MockOIDC) authorizeError(rw http.ResponseWriter, req *http.Request, error, description string, statusCode int) {
+	if m.authorizeErrorsAsJSON() {
+		errorResponse(rw, error, description, statusCode)
+		return
+	}
+	if jarmResponse(req) {
+		params := url.Values{
+			"error":             {error},
+			"error_description": {templateDescription(rw, error, description)},
+		}
+		if state := req.Form.Get("state"); state != "" {
+			params.Set("state", state)
+		}
+		m.jarmRedirect(rw, req, params)
+		return
+	}
+	redirectError(rw, req, error, description)
+}
+
+// redirectError sends an OAuth2 error back to the redirect_uri of an
+// authorization request, with its state
+func redirectError(rw http.ResponseWriter, req *http.Request, error, description string) {
+	redirectURI, err := url.Parse(req.Form.Get("redirect_uri"))
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	params, _ := url.ParseQuery(redirectURI.RawQuery)
+	params.Set("error", error)
+	params.Set("error_description", templateDescription(rw, error, description))
+	if state := req.Form.Get("state"); state != "" {
+		params.Set("state", state)
+	}
+	// The implicit & hybrid flows return errors in the fragment, like their
+	// tokens
+	if fragmentResponse(req.Form.Get("response_type")) {
+		redirectURI.Fragment = ""
+		http.Redirect(rw, req, redirectURI.String()+"#"+params.Encode(), http.StatusFound)
+		return
+	}
+	redirectURI.RawQuery = params.Encode()
+
+	http.Redirect(rw, req, redirectURI.String(), http.StatusFound)
 }
 
 func errorResponse(rw http.ResponseWriter, error, description string, statusCode int) {
-	errJSON := map[string]string{
+	errJSON := map[string]interface{}{
 		"error":             error,
 		"error_description": description,
 	}
+	templateError(rw, errJSON, statusCode)
 	resp, err := json.Marshal(errJSON)
 	if err != nil {
 		http.Error(rw, error, http.StatusInternalServerError)
@@ -447,10 +987,8 @@ func errorResponse(rw http.ResponseWriter, error, description string, statusCode
 	rw.Header().Set("Content-Type", applicationJSON)
 	rw.WriteHeader(statusCode)
 
-	_, err = rw.Write(resp)
-	if err != nil {
-		panic(err)
-	}
+	// Write errors are logged by the instrumented handler chain
+	_, _ = rw.Write(resp)
 }
 
 func internalServerError(rw http.ResponseWriter, errorMsg string) {
@@ -462,10 +1000,8 @@ func jsonResponse(rw http.ResponseWriter, data []byte) {
 	rw.Header().Set("Content-Type", applicationJSON)
 	rw.WriteHeader(http.StatusOK)
 
-	_, err := rw.Write(data)
-	if err != nil {
-		panic(err)
-	}
+	// Write errors are logged by the instrumented handler chain
+	_, _ = rw.Write(data)
 }
 
 func noCache(rw http.ResponseWriter) {
@@ -2,15 +2,19 @@ package mockoidc_test
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/dgrijalva/jwt-go"
 	"github.com/oauth2-proxy/mockoidc"
 	"github.com/stretchr/testify/assert"
 )
@@ -38,20 +42,258 @@ func TestMockOIDC_Authorize(t *testing.T) {
 	assert.HTTPBodyContains(t, m.Authorize, http.MethodGet,
 		mockoidc.AuthorizationEndpoint, data, mockoidc.InvalidClient)
 
-	// Missing required form values
+	// Missing required form values are redirected once the client &
+	// redirect_uri are known
+	data.Set("client_id", m.ClientID)
 	for key := range data {
+		key := key
 		t.Run(key, func(t *testing.T) {
 			badData, _ := url.ParseQuery(data.Encode())
 			badData.Del(key)
 
-			assert.HTTPStatusCode(t, m.Authorize, http.MethodGet,
-				mockoidc.AuthorizationEndpoint, badData, http.StatusBadRequest)
-			assert.HTTPBodyContains(t, m.Authorize, http.MethodGet,
-				mockoidc.AuthorizationEndpoint, badData, mockoidc.InvalidRequest)
+			if key == "client_id" || key == "redirect_uri" {
+				assert.HTTPStatusCode(t, m.Authorize, http.MethodGet,
+					mockoidc.AuthorizationEndpoint, badData, http.StatusBadRequest)
+				assert.HTTPBodyContains(t, m.Authorize, http.MethodGet,
+					mockoidc.AuthorizationEndpoint, badData, mockoidc.InvalidRequest)
+				return
+			}
+			rr := testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize,
+				http.MethodPost, badData)
+			assert.Equal(t, http.StatusFound, rr.Code)
+			location, err := url.Parse(rr.Header().Get("Location"))
+			assert.NoError(t, err)
+			assert.Equal(t, mockoidc.InvalidRequest, location.Query().Get("error"))
+			assert.Equal(t, badData.Get("state"), location.Query().Get("state"))
+		})
+	}
+}
+
+func TestMockOIDC_Authorize_ErrorRedirects(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	data := url.Values{}
+	data.Set("scope", "openid admin")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "https://app.example.com/callback?tenant=a")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+
+	rr := testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, data)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	location, err := url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, "app.example.com", location.Host)
+	assert.Equal(t, url.Values{
+		"tenant":            {"a"},
+		"error":             {mockoidc.InvalidScope},
+		"error_description": {"Unsupported scope: admin"},
+		"state":             {"testState"},
+	}, location.Query())
+
+	data.Set("scope", "openid")
+	data.Set("response_type", "none")
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, data)
+	location, err = url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.UnsupportedResponseType, location.Query().Get("error"))
+	m.LegacyResponseTypeError = true
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, data)
+	location, err = url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.UnsupportedGrantType, location.Query().Get("error"))
+	m.LegacyResponseTypeError = false
+	data.Set("response_type", "code")
+	data.Set("scope", "openid admin")
+
+	// Unknown clients must not be redirected to
+	data.Set("client_id", "wrong_id")
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, data)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	data.Set("client_id", m.ClientID)
+	m.AuthorizeErrorsAsJSON = true
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, data)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), mockoidc.InvalidScope)
+}
+
+func TestMockOIDC_Authorize_Post(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	form := url.Values{
+		"client_id":     {m.ClientID},
+		"scope":         {"openid"},
+		"response_type": {"code"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"state":         {"body-state"},
+	}
+
+	// Body parameters take precedence over the query
+	resp, err := httpClient.Post(m.AuthorizationEndpoint()+"?state=query-state",
+		"application/x-www-form-urlencoded; charset=utf-8", strings.NewReader(form.Encode()))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := resp.Location()
+	assert.NoError(t, err)
+	assert.Equal(t, "body-state", location.Query().Get("state"))
+	_, err = m.SessionStore.GetSessionByID(location.Query().Get("code"))
+	assert.NoError(t, err)
+
+	resp, err = httpClient.Post(m.AuthorizationEndpoint(), "application/json",
+		strings.NewReader(`{"client_id": "`+m.ClientID+`"}`))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body := make(map[string]interface{})
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, mockoidc.InvalidRequest, body["error"])
+}
+
+func TestMockOIDC_Authorize_ScopeEncodings(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	base := url.Values{
+		"client_id":     {m.ClientID},
+		"response_type": {"code"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"state":         {"testState"},
+	}.Encode()
+
+	for name, query := range map[string]string{
+		"repeated":         "scope=openid&scope=email+profile",
+		"plus encoded":     "scope=openid%2Bemail%2Bprofile",
+		"extra whitespace": "scope=%20openid%09%20email%0Aprofile%20",
+		"duplicates":       "scope=openid+email+openid&scope=profile+email",
+		"percent and plus": "scope=openid%20email+profile",
+		"leading plus":     "scope=openid&scope=+email++profile",
+	} {
+		t.Run(name, func(t *testing.T) {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet,
+				mockoidc.AuthorizationEndpoint+"?"+base+"&"+query, nil)
+			m.Authorize(rr, req)
+			assert.Equal(t, http.StatusFound, rr.Code)
+			location, err := url.Parse(rr.Header().Get("Location"))
+			assert.NoError(t, err)
+			assert.Empty(t, location.Query().Get("error"), location.Query().Get("error_description"))
+			session, err := m.SessionStore.GetSessionByID(location.Query().Get("code"))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"openid", "email", "profile"}, session.Scopes)
 		})
 	}
 }
 
+func TestMockOIDC_Authorize_RequireNonce(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.RequireNonce = true
+
+	data := url.Values{}
+	data.Set("scope", "email openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "https://app.example.com/callback")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+
+	rr := testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, data)
+	assert.Equal(t, http.StatusFound, rr.Code)
+	location, err := url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.InvalidRequest, location.Query().Get("error"))
+	assert.Equal(t, "The request is missing the required parameter: nonce",
+		location.Query().Get("error_description"))
+
+	data.Set("nonce", "strict-nonce")
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, data)
+	location, err = url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	session, err := m.SessionStore.GetSessionByID(location.Query().Get("code"))
+	assert.NoError(t, err)
+	assert.Equal(t, "strict-nonce", session.OIDCNonce)
+
+	// OAuth2 requests without openid don't need one
+	data.Del("nonce")
+	data.Set("scope", "email")
+	rr = testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, data)
+	location, err = url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, location.Query().Get("code"))
+}
+
+func TestMockOIDC_Authorize_BoundCodes(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	expected := make(map[string]string)
+	for i := 0; i < 5; i++ {
+		subject := fmt.Sprintf("user-%d", i)
+		code := ""
+		if i%2 == 0 {
+			code = "code-" + subject
+		}
+		code, err = m.QueueUserWithCode(&mockoidc.MockUser{Subject: subject}, code)
+		assert.NoError(t, err)
+		expected[code] = subject
+	}
+	assert.Equal(t, "user-0", expected["code-user-0"])
+
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "example.com")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+
+	var wg sync.WaitGroup
+	codes := make(chan string, len(expected))
+	for range expected {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rr := testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize,
+				http.MethodPost, data)
+			location, err := url.Parse(rr.Header().Get("Location"))
+			if assert.NoError(t, err) {
+				codes <- location.Query().Get("code")
+			}
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	for code := range codes {
+		session, err := m.SessionStore.GetSessionByID(code)
+		assert.NoError(t, err)
+		assert.Equal(t, expected[code], session.User.ID())
+		delete(expected, code)
+	}
+	assert.Empty(t, expected)
+}
+
+// minimalSessionStore only implements the SessionStore interface
+type minimalSessionStore struct {
+	mockoidc.SessionStore
+}
+
+func TestMockOIDC_Authorize_BoundCodesUnsupported(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.SessionStore = &minimalSessionStore{SessionStore: mockoidc.NewSessionStore()}
+	_, err = m.QueueUserWithCode(mockoidc.DefaultUser(), "")
+	assert.NoError(t, err)
+
+	data := url.Values{}
+	data.Set("scope", "openid")
+	data.Set("response_type", "code")
+	data.Set("redirect_uri", "example.com")
+	data.Set("state", "testState")
+	data.Set("client_id", m.ClientID)
+	rr := testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, data)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code)
+}
+
 func TestMockOIDC_Token_CodeGrant(t *testing.T) {
 	m, err := mockoidc.NewServer(nil)
 	assert.NoError(t, err)
@@ -128,12 +370,68 @@ func TestMockOIDC_Token_CodeGrant(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, rrDup.Code)
 }
 
+// forgetfulSessionStore loses every Session between authorize & token
+type forgetfulSessionStore struct {
+	*mockoidc.MemorySessionStore
+}
+
+func (ss *forgetfulSessionStore) GetSessionByID(string) (*mockoidc.Session, error) {
+	return nil, errors.New("session lost")
+}
+
+func TestMockOIDC_Token_IDTokenScope(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	for scope, issued := range map[string]bool{
+		"openid email profile": true,
+		"email openid profile": true,
+		"email profile":        false,
+	} {
+		session, err := m.SessionStore.NewSession(scope, "", mockoidc.DefaultUser())
+		assert.NoError(t, err)
+		data := url.Values{}
+		data.Set("client_id", m.ClientID)
+		data.Set("client_secret", m.ClientSecret)
+		data.Set("grant_type", "authorization_code")
+		data.Set("code", session.SessionID)
+
+		rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+		assert.Equal(t, http.StatusOK, rr.Code, scope)
+		tokens := map[string]interface{}{}
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tokens))
+		_, ok := tokens["id_token"]
+		assert.Equal(t, issued, ok, scope)
+	}
+}
+
+func TestMockOIDC_Token_LostSession(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.SessionStore = &forgetfulSessionStore{mockoidc.NewSessionStore()}
+
+	session, err := m.SessionStore.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("code", session.SessionID)
+	data.Set("grant_type", "authorization_code")
+
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+}
+
 func TestMockOIDC_Token_RefreshGrant(t *testing.T) {
 	m, err := mockoidc.NewServer(nil)
 	assert.NoError(t, err)
 
 	session, _ := m.SessionStore.NewSession(
 		"openid email profile", "sessionNonce", mockoidc.DefaultUser())
+	loggedIn := m.Now().Add(-time.Hour)
+	session.AuthTime = loggedIn
+	assert.NoError(t, m.SessionStore.Save(session))
 	refreshToken, _ := session.RefreshToken(m.Config(), m.Keypair, m.Now())
 
 	assert.HTTPError(t, m.Token, http.MethodPost, mockoidc.TokenEndpoint, nil)
@@ -169,6 +467,13 @@ func TestMockOIDC_Token_RefreshGrant(t *testing.T) {
 		})
 	}
 
+	// The refreshed ID token is issued now for the original login
+	claims := jwt.MapClaims{}
+	_, _, err = new(jwt.Parser).ParseUnverified(tokenResp["id_token"].(string), claims)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(loggedIn.Unix()), claims["auth_time"])
+	assert.InDelta(t, float64(m.Now().Unix()), claims["iat"], 1)
+
 	// expired refresh token
 	expiredToken, err := session.RefreshToken(
 		m.Config(), m.Keypair, m.Now().Add(time.Hour*time.Duration(-24)))
@@ -178,10 +483,136 @@ func TestMockOIDC_Token_RefreshGrant(t *testing.T) {
 
 	rr = testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
 	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	// The token endpoint isn't a bearer-protected resource
+	assert.Empty(t, rr.Header().Get("WWW-Authenticate"))
 
 	body, err := ioutil.ReadAll(rr.Body)
 	assert.NoError(t, err)
-	assert.Contains(t, string(body), mockoidc.InvalidRequest)
+	assert.Contains(t, string(body), mockoidc.InvalidGrant)
+}
+
+func TestMockOIDC_Token_RefreshGrant_OmitIDToken(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.OmitRefreshIDToken = true
+
+	session, _ := m.SessionStore.NewSession("openid email", "", mockoidc.DefaultUser())
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("code", session.SessionID)
+	data.Set("grant_type", "authorization_code")
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	tokenResp := make(map[string]interface{})
+	assert.NoError(t, getJSON(rr, &tokenResp))
+	assert.Contains(t, tokenResp, "id_token")
+
+	refresh := url.Values{}
+	refresh.Set("client_id", m.ClientID)
+	refresh.Set("client_secret", m.ClientSecret)
+	refresh.Set("refresh_token", tokenResp["refresh_token"].(string))
+	refresh.Set("grant_type", "refresh_token")
+	rr = testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, refresh)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	tokenResp = make(map[string]interface{})
+	assert.NoError(t, getJSON(rr, &tokenResp))
+	assert.Contains(t, tokenResp, "access_token")
+	assert.NotContains(t, tokenResp, "id_token")
+}
+
+func TestMockOIDC_Userinfo_Challenge(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	tokens, err := m.SeedSession(nil, nil, nil)
+	assert.NoError(t, err)
+
+	challenge := func(authorization string) string {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		m.Userinfo(rr, req)
+		if rr.Code == http.StatusOK {
+			return ""
+		}
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		return rr.Header().Get("WWW-Authenticate")
+	}
+
+	assert.Equal(t, "", challenge("Bearer "+tokens.AccessToken))
+	assert.Equal(t, "Bearer", challenge(""))
+	assert.Equal(t, "Bearer", challenge("Basic dXNlcjpwYXNz"))
+	assert.Contains(t, challenge("Bearer not-a-jwt"), `Bearer error="invalid_token", error_description="Invalid token: `)
+
+	// The body agrees with the challenge
+	revoked, err := m.SeedSession(nil, nil, &mockoidc.SeedOptions{Code: "revoked"})
+	assert.NoError(t, err)
+	assert.NoError(t, m.RevokeSession("revoked"))
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+	req.Header.Set("Authorization", "Bearer "+revoked.AccessToken)
+	m.Userinfo(rr, req)
+	assert.Equal(t, `Bearer error="invalid_token", error_description="The token was revoked"`,
+		rr.Header().Get("WWW-Authenticate"))
+	assert.Contains(t, rr.Body.String(), `"error":"invalid_token"`)
+
+	m.FastForward(m.AccessTTL + time.Second)
+	assert.Equal(t, `Bearer error="invalid_token", error_description="The token is expired"`,
+		challenge("Bearer "+tokens.AccessToken))
+}
+
+func TestMockOIDC_Userinfo_EvictedSession(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.SessionStore.(*mockoidc.MemorySessionStore).MaxSessions = 1
+	evicted, err := m.SeedSession(nil, nil, nil)
+	assert.NoError(t, err)
+	_, err = m.SeedSession(nil, nil, nil)
+	assert.NoError(t, err)
+
+	// The evicted Session's access token is still valid, but sends the
+	// client through a new login
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+	req.Header.Set("Authorization", "Bearer "+evicted.AccessToken)
+	m.Userinfo(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Equal(t, `Bearer error="invalid_token", error_description="Invalid token: session not found"`,
+		rr.Header().Get("WWW-Authenticate"))
+	assert.Contains(t, rr.Body.String(), `"error":"invalid_token"`)
+}
+
+func TestMockOIDC_Userinfo_TokenLocations(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	tokens, err := m.SeedSession(nil, nil, nil)
+	assert.NoError(t, err)
+	form := url.Values{"access_token": {tokens.AccessToken}}
+
+	userinfo := func(method, query, body, authorization string) int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(method, mockoidc.UserinfoEndpoint+query, strings.NewReader(body))
+		if body != "" {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		m.Userinfo(rr, req)
+		return rr.Code
+	}
+
+	assert.Equal(t, http.StatusOK, userinfo(http.MethodPost, "", form.Encode(), ""))
+	assert.Equal(t, http.StatusUnauthorized, userinfo(http.MethodGet, "?"+form.Encode(), "", ""))
+	assert.Equal(t, http.StatusBadRequest,
+		userinfo(http.MethodPost, "", form.Encode(), "Bearer "+tokens.AccessToken))
+
+	m.AllowQueryAccessToken = true
+	assert.Equal(t, http.StatusOK, userinfo(http.MethodGet, "?"+form.Encode(), "", ""))
+	assert.Equal(t, http.StatusBadRequest,
+		userinfo(http.MethodGet, "?"+form.Encode(), "", "Bearer "+tokens.AccessToken))
 }
 
 func TestMockOIDC_Discovery(t *testing.T) {
@@ -202,6 +633,226 @@ func TestMockOIDC_Discovery(t *testing.T) {
 	assert.Equal(t, oidcCfg["token_endpoint"], m.TokenEndpoint())
 	assert.Equal(t, oidcCfg["userinfo_endpoint"], m.UserinfoEndpoint())
 	assert.Equal(t, oidcCfg["jwks_uri"], m.JWKSEndpoint())
+	assert.Equal(t, oidcCfg["end_session_endpoint"], m.EndSessionEndpoint())
+	assert.Equal(t, oidcCfg["pushed_authorization_request_endpoint"], m.PushedAuthorizationEndpoint())
+	assert.Equal(t, true, oidcCfg["request_parameter_supported"])
+	assert.Equal(t, false, oidcCfg["request_uri_parameter_supported"])
+	assert.Equal(t, true, oidcCfg["tls_client_certificate_bound_access_tokens"])
+	assert.Equal(t, []interface{}{"query", "fragment", "jwt", "query.jwt", "fragment.jwt"},
+		oidcCfg["response_modes_supported"])
+	assert.Equal(t, []interface{}{"RS256", "PS256", "ES256"},
+		oidcCfg["token_endpoint_auth_signing_alg_values_supported"])
+}
+
+func TestMockOIDC_MetadataCaching(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	resp, err := httpClient.Get(m.JWKSEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Contains(t, resp.Header.Get("Cache-Control"), "no-cache")
+	assert.Empty(t, resp.Header.Get("ETag"))
+
+	m.MetadataCacheControl = "public, max-age=300"
+	m.MetadataETags = true
+	for _, endpoint := range []string{m.DiscoveryEndpoint(), m.JWKSEndpoint()} {
+		resp, err := httpClient.Get(endpoint)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "public, max-age=300", resp.Header.Get("Cache-Control"))
+		etag := resp.Header.Get("ETag")
+		assert.NotEmpty(t, etag)
+
+		for ifNoneMatch, status := range map[string]int{
+			etag:                 http.StatusNotModified,
+			`"stale", W/` + etag: http.StatusNotModified,
+			`"stale"`:            http.StatusOK,
+		} {
+			req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+			assert.NoError(t, err)
+			req.Header.Set("If-None-Match", ifNoneMatch)
+			resp, err := httpClient.Do(req)
+			assert.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, status, resp.StatusCode, ifNoneMatch)
+			assert.Equal(t, etag, resp.Header.Get("ETag"))
+		}
+	}
+}
+
+func TestMockOIDC_Discovery_ForwardedHeaders(t *testing.T) {
+	m := &mockoidc.MockOIDC{
+		Server: &http.Server{
+			Addr: "127.0.0.1:8080",
+		},
+		BasePath: mockoidc.IssuerBase,
+	}
+	req := httptest.NewRequest(http.MethodGet, mockoidc.DiscoveryEndpoint, nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "idp.example.com, internal.proxy")
+	req.Header.Set("X-Forwarded-Prefix", "/auth/")
+
+	// Ignored unless trusted
+	recorder := httptest.NewRecorder()
+	m.Discovery(recorder, req)
+	oidcCfg := make(map[string]interface{})
+	err := getJSON(recorder, &oidcCfg)
+	assert.NoError(t, err)
+	assert.Equal(t, m.Issuer(), oidcCfg["issuer"])
+
+	m.TrustForwardedHeaders = true
+	recorder = httptest.NewRecorder()
+	m.Discovery(recorder, req)
+	oidcCfg = make(map[string]interface{})
+	err = getJSON(recorder, &oidcCfg)
+	assert.NoError(t, err)
+
+	const base = "https://idp.example.com/auth"
+	assert.Equal(t, base+mockoidc.IssuerBase, oidcCfg["issuer"])
+	assert.Equal(t, base+mockoidc.AuthorizationEndpoint, oidcCfg["authorization_endpoint"])
+	assert.Equal(t, base+mockoidc.TokenEndpoint, oidcCfg["token_endpoint"])
+	assert.Equal(t, base+mockoidc.UserinfoEndpoint, oidcCfg["userinfo_endpoint"])
+	assert.Equal(t, base+mockoidc.JWKSEndpoint, oidcCfg["jwks_uri"])
+}
+
+func TestMockOIDC_Token_ForwardedHeaders(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.Server = &http.Server{Addr: "127.0.0.1:8080"}
+	m.TrustForwardedHeaders = true
+
+	session, _ := m.SessionStore.NewSession(
+		"openid email profile", "nonce", mockoidc.DefaultUser())
+
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("code", session.SessionID)
+	data.Set("grant_type", "authorization_code")
+
+	rr := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, mockoidc.TokenEndpoint,
+		strings.NewReader(data.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Header.Set("X-Forwarded-Host", "idp.example.com")
+	m.Token(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	tokenResp := make(map[string]interface{})
+	err = getJSON(rr, &tokenResp)
+	assert.NoError(t, err)
+
+	idToken, err := m.Keypair.VerifyJWT(tokenResp["id_token"].(string))
+	assert.NoError(t, err)
+	claims := idToken.Claims.(jwt.MapClaims)
+	assert.Equal(t, "https://idp.example.com"+mockoidc.IssuerBase, claims["iss"])
+}
+
+func TestMockOIDC_Token_JSONBody(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	token := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, mockoidc.TokenEndpoint, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		m.Token(rr, req)
+		return rr
+	}
+	codeBody := func() string {
+		session, err := m.SessionStore.NewSession("openid", "", mockoidc.DefaultUser())
+		assert.NoError(t, err)
+		body, err := json.Marshal(map[string]string{
+			"client_id":     m.ClientID,
+			"client_secret": m.ClientSecret,
+			"grant_type":    "authorization_code",
+			"code":          session.SessionID,
+		})
+		assert.NoError(t, err)
+		return string(body)
+	}
+
+	// Ignored unless enabled
+	rr := token(codeBody())
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), mockoidc.InvalidRequest)
+
+	m.AcceptJSONTokenRequests = true
+	rr = token(codeBody())
+	assert.Equal(t, http.StatusOK, rr.Code)
+	tokens := make(map[string]interface{})
+	assert.NoError(t, getJSON(rr, &tokens))
+	assert.NotEmpty(t, tokens["id_token"])
+
+	for _, body := range []string{`{"grant_type":`, `{"grant_type": ["authorization_code"]}`} {
+		rr = token(body)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+		assert.Contains(t, rr.Body.String(), "Invalid JSON body", body)
+	}
+}
+
+func TestMockOIDC_IssuerFormatting(t *testing.T) {
+	for name, tc := range map[string]struct {
+		addr, host    string
+		trailingSlash bool
+		port          mockoidc.IssuerPort
+		issuer        string
+	}{
+		"as served":      {"127.0.0.1:80", "", false, "", "http://127.0.0.1:80/oidc"},
+		"trailing slash": {"127.0.0.1:8080", "", true, "", "http://127.0.0.1:8080/oidc/"},
+		"omit default":   {"127.0.0.1:80", "", false, mockoidc.IssuerPortOmitDefault, "http://127.0.0.1/oidc"},
+		"omit other":     {"127.0.0.1:8080", "", false, mockoidc.IssuerPortOmitDefault, "http://127.0.0.1:8080/oidc"},
+		"include default": {"127.0.0.1:8080", "idp.example.com", true, mockoidc.IssuerPortIncludeDefault,
+			"https://idp.example.com:443/oidc/"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m, err := mockoidc.NewServer(nil)
+			assert.NoError(t, err)
+			m.Server = &http.Server{Addr: tc.addr}
+			m.TrustForwardedHeaders = tc.host != ""
+			m.IssuerTrailingSlash = tc.trailingSlash
+			m.IssuerPort = tc.port
+
+			req := httptest.NewRequest(http.MethodGet, mockoidc.DiscoveryEndpoint, nil)
+			req.Header.Set("X-Forwarded-Proto", "https")
+			req.Header.Set("X-Forwarded-Host", tc.host)
+			rr := httptest.NewRecorder()
+			m.Discovery(rr, req)
+			oidcCfg := make(map[string]interface{})
+			err = getJSON(rr, &oidcCfg)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.issuer, oidcCfg["issuer"])
+			// Endpoints keep the served address
+			assert.False(t, strings.Contains(oidcCfg["token_endpoint"].(string), "//oidc"))
+			assert.False(t, strings.Contains(oidcCfg["token_endpoint"].(string), ":443"))
+
+			session, _ := m.SessionStore.NewSession(
+				"openid email profile", "nonce", mockoidc.DefaultUser())
+			data := url.Values{}
+			data.Set("client_id", m.ClientID)
+			data.Set("client_secret", m.ClientSecret)
+			data.Set("code", session.SessionID)
+			data.Set("grant_type", "authorization_code")
+			req = httptest.NewRequest(http.MethodPost, mockoidc.TokenEndpoint,
+				strings.NewReader(data.Encode()))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("X-Forwarded-Proto", "https")
+			req.Header.Set("X-Forwarded-Host", tc.host)
+			rr = httptest.NewRecorder()
+			m.Token(rr, req)
+			assert.Equal(t, http.StatusOK, rr.Code)
+
+			tokenResp := make(map[string]interface{})
+			err = getJSON(rr, &tokenResp)
+			assert.NoError(t, err)
+			idToken, err := m.Keypair.VerifyJWT(tokenResp["id_token"].(string))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.issuer, idToken.Claims.(jwt.MapClaims)["iss"])
+		})
+	}
 }
 
 func getJSON(res *httptest.ResponseRecorder, target interface{}) error {
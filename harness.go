@@ -0,0 +1,125 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+)
+
+// Harness pages let browser-automation tests assert on the result of a
+// redirect without a separate app: register `HarnessCallbackEndpoint` as the
+// redirect URI and the page displays the code, state, error & fragment it
+// received. `HarnessTokensEndpoint` exchanges a code for the MockOIDC's own
+// client and displays the tokens & ID token claims.
+const (
+	HarnessCallbackEndpoint = "/oidc/harness/callback"
+	HarnessTokensEndpoint   = "/oidc/harness/tokens"
+)
+
+const harnessStyle = `<style>
+body { font-family: sans-serif; margin: 2em; }
+dd { font-family: monospace; word-break: break-all; margin-bottom: 0.5em; }
+pre { background: #f4f4f4; padding: 1em; }
+</style>`
+
+var harnessCallbackTemplate = template.Must(template.New(HarnessCallbackPage).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>mockoidc callback</title>
+` + harnessStyle + `
+</head>
+<body>
+<h1>Callback</h1>
+<dl>
+<dt>Code</dt><dd data-testid="code">{{.Code}}</dd>
+<dt>State</dt><dd data-testid="state">{{.State}}</dd>
+{{if .Error}}<dt>Error</dt><dd data-testid="error">{{.Error}}</dd>
+<dt>Error Description</dt><dd data-testid="error-description">{{.ErrorDescription}}</dd>
+{{end}}<dt>Fragment</dt><dd data-testid="fragment"><noscript>Reading the fragment needs JavaScript</noscript></dd>
+</dl>
+{{if .Code}}<p><a data-testid="exchange" href="{{.TokensURL}}">Exchange the code</a></p>{{end}}
+<script>
+document.querySelector('[data-testid="fragment"]').textContent = window.location.hash.slice(1);
+</script>
+</body>
+</html>
+`))
+
+var harnessTokensTemplate = template.Must(template.New(HarnessTokensPage).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>mockoidc tokens</title>
+` + harnessStyle + `
+</head>
+<body>
+<h1>Tokens</h1>
+{{if .Error}}<p data-testid="error">{{.Error}}</p>
+{{else}}<dl>
+<dt>Access Token</dt><dd data-testid="access-token">{{.Tokens.AccessToken}}</dd>
+<dt>Refresh Token</dt><dd data-testid="refresh-token">{{.Tokens.RefreshToken}}</dd>
+<dt>ID Token</dt><dd data-testid="id-token">{{.Tokens.IDToken}}</dd>
+<dt>Expires In</dt><dd data-testid="expires-in">{{.Tokens.ExpiresIn}}</dd>
+</dl>
+<h2>ID Token Claims</h2>
+<pre data-testid="id-token-claims">{{.Claims}}</pre>
+{{end}}
+</body>
+</html>
+`))
+
+// HarnessCallbackData is rendered by the `HarnessCallbackPage` template
+type HarnessCallbackData struct {
+	Code             string
+	State            string
+	Error            string
+	ErrorDescription string
+	TokensURL        string
+}
+
+// HarnessTokensData is rendered by the `HarnessTokensPage` template. Error
+// is set instead of the tokens when the code exchange failed.
+type HarnessTokensData struct {
+	Tokens *TokenSet
+	Claims string
+	Error  string
+}
+
+// HarnessCallback implements the `HarnessCallbackEndpoint`
+func (m *MockOIDC) HarnessCallback(rw http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	page := &HarnessCallbackData{
+		Code:             query.Get("code"),
+		State:            query.Get("state"),
+		Error:            query.Get("error"),
+		ErrorDescription: query.Get("error_description"),
+	}
+	if page.Code != "" {
+		page.TokensURL = m.endpointPath(HarnessTokensEndpoint) + "?" +
+			url.Values{"code": {page.Code}}.Encode()
+	}
+	m.renderPage(rw, http.StatusOK, HarnessCallbackPage, page)
+}
+
+// HarnessTokens implements the `HarnessTokensEndpoint`. The `code` query
+// parameter is exchanged in-process with the MockOIDC's client credentials.
+func (m *MockOIDC) HarnessTokens(rw http.ResponseWriter, req *http.Request) {
+	page := &HarnessTokensData{}
+	client, base := m.flowClient()
+	redirectURI := m.requestAddr(req) + m.endpointPath(HarnessCallbackEndpoint)
+	tokens, err := m.exchangeCode(client, base, req.URL.Query().Get("code"), redirectURI, "")
+	if err != nil {
+		page.Error = err.Error()
+		m.renderPage(rw, http.StatusBadRequest, HarnessTokensPage, page)
+		return
+	}
+	claims, err := json.MarshalIndent(tokens.IDTokenClaims, "", "  ")
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	page.Tokens, page.Claims = tokens, string(claims)
+	m.renderPage(rw, http.StatusOK, HarnessTokensPage, page)
+}
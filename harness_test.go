@@ -0,0 +1,126 @@
+package mockoidc_test
+
+import (
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_HarnessPages(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ServeHarnessPages = true
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start(ln, nil))
+	defer m.Shutdown()
+	m.QueueUser(&mockoidc.MockUser{Subject: "harness-user", Email: "harness@example.com"})
+
+	page := func(target string, status int) string {
+		resp, err := httpClient.Get(target)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, status, resp.StatusCode)
+		assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return string(body)
+	}
+
+	authorize := url.Values{
+		"client_id":     {m.ClientID},
+		"response_type": {"code"},
+		"scope":         {"openid email"},
+		"state":         {"harness-state"},
+		"redirect_uri":  {m.Addr() + mockoidc.HarnessCallbackEndpoint},
+	}
+	resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + authorize.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := resp.Location()
+	assert.NoError(t, err)
+	code := location.Query().Get("code")
+
+	body := page(location.String(), http.StatusOK)
+	assert.Contains(t, body, `<dd data-testid="code">`+code+`</dd>`)
+	assert.Contains(t, body, `<dd data-testid="state">harness-state</dd>`)
+	assert.Contains(t, body, `data-testid="fragment"`)
+	assert.NotContains(t, body, `data-testid="error"`)
+	tokensURL := mockoidc.HarnessTokensEndpoint + "?code=" + code
+	assert.Contains(t, body, `href="`+tokensURL+`"`)
+
+	body = page(m.Addr()+tokensURL, http.StatusOK)
+	assert.Contains(t, body, `data-testid="access-token"`)
+	assert.Contains(t, body, `data-testid="id-token"`)
+	assert.Contains(t, body, "harness@example.com")
+	assert.Contains(t, body, "harness-user")
+
+	// Codes can only be exchanged once
+	body = page(m.Addr()+tokensURL, http.StatusBadRequest)
+	assert.Contains(t, body, `data-testid="error"`)
+
+	body = page(m.Addr()+mockoidc.HarnessCallbackEndpoint+
+		"?error=access_denied&error_description=User+%3Cscript%3E", http.StatusOK)
+	assert.Contains(t, body, `<dd data-testid="error">access_denied</dd>`)
+	assert.Contains(t, body, "User &lt;script&gt;")
+	assert.NotContains(t, body, `data-testid="exchange"`)
+}
+
+func TestMockOIDC_HarnessPages_Disabled(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	resp, err := httpClient.Get(m.Addr() + mockoidc.HarnessCallbackEndpoint)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestMockOIDC_PageTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mockoidc-templates")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "harness_callback.html"),
+		[]byte(`<p data-testid="custom-code">{{.Code}}</p>`), 0600))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0600))
+
+	templates, err := mockoidc.LoadPageTemplates(dir)
+	assert.NoError(t, err)
+	assert.Len(t, templates, 1)
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ServeHarnessPages = true
+	m.PageTemplates = templates
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.NoError(t, m.Start(ln, nil))
+	defer m.Shutdown()
+
+	resp, err := httpClient.Get(m.Addr() + mockoidc.HarnessCallbackEndpoint + "?code=abc")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, `<p data-testid="custom-code">abc</p>`, string(body))
+
+	// Other pages keep their built-in template
+	resp, err = httpClient.Get(m.Addr() + mockoidc.HarnessTokensEndpoint + "?code=abc")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err = ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `data-testid="error"`)
+
+	_, err = mockoidc.LoadPageTemplates(t.Name())
+	assert.Error(t, err)
+}
@@ -0,0 +1,116 @@
+package mockoidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CapturedRequest is a request an endpoint (one of the `*Endpoint`
+// constants) received, to assert exactly what a relying party sent.
+type CapturedRequest struct {
+	Endpoint string
+	Method   string
+	// Params are the query & form parameters
+	Params url.Values
+	Header http.Header
+	// Time is when the request was received by MockOIDC's clock
+	Time       time.Time
+	StatusCode int
+	// SessionID of the Session the request started or used, if any
+	SessionID string
+}
+
+// UILocales returns the `ui_locales` of the request in order of preference
+func (cr CapturedRequest) UILocales() []string {
+	return strings.Fields(cr.Params.Get("ui_locales"))
+}
+
+// Display returns the `display` of the request, e.g. `popup`
+func (cr CapturedRequest) Display() string {
+	return cr.Params.Get("display")
+}
+
+// RequestHistory records the requests received since it was created or
+// last reset.
+type RequestHistory struct {
+	sync.Mutex
+	requests []CapturedRequest
+}
+
+// NewRequestHistory initializes an empty RequestHistory
+func NewRequestHistory() *RequestHistory {
+	return &RequestHistory{}
+}
+
+// Record adds a request to the history
+func (rh *RequestHistory) Record(request CapturedRequest) {
+	rh.Lock()
+	defer rh.Unlock()
+	rh.requests = append(rh.requests, request)
+}
+
+// Requests returns the recorded requests in the order they were received.
+// If any endpoints are passed, only requests to them are returned.
+func (rh *RequestHistory) Requests(endpoints ...string) []CapturedRequest {
+	rh.Lock()
+	defer rh.Unlock()
+
+	requests := make([]CapturedRequest, 0, len(rh.requests))
+	for _, request := range rh.requests {
+		if len(endpoints) == 0 || containsString(endpoints, request.Endpoint) {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// Reset clears the history
+func (rh *RequestHistory) Reset() {
+	rh.Lock()
+	defer rh.Unlock()
+	rh.requests = nil
+}
+
+// Requests returns the requests received by the endpoints (all of them if
+// none are passed), e.g. to assert the scopes or prompt a relying party
+// sent to the `authorization_endpoint`.
+func (m *MockOIDC) Requests(endpoints ...string) []CapturedRequest {
+	return m.RequestHistory.Requests(endpoints...)
+}
+
+type requestSessionKey struct{}
+
+// withRequestSession lets handlers report the Session of a request through
+// captureSession.
+func withRequestSession(req *http.Request) (*http.Request, *string) {
+	sessionID := new(string)
+	ctx := context.WithValue(req.Context(), requestSessionKey{}, sessionID)
+	return req.WithContext(ctx), sessionID
+}
+
+func captureSession(req *http.Request, session *Session) {
+	if sessionID, ok := req.Context().Value(requestSessionKey{}).(*string); ok {
+		*sessionID = session.SessionID
+	}
+}
+
+func cloneValues(values url.Values) url.Values {
+	clone := make(url.Values, len(values))
+	for key, v := range values {
+		clone[key] = copyStrings(v)
+	}
+	return clone
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
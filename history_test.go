@@ -0,0 +1,63 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestHistory(t *testing.T) {
+	rh := mockoidc.NewRequestHistory()
+	rh.Record(mockoidc.CapturedRequest{Endpoint: mockoidc.AuthorizationEndpoint})
+	rh.Record(mockoidc.CapturedRequest{Endpoint: mockoidc.TokenEndpoint, StatusCode: 400})
+	rh.Record(mockoidc.CapturedRequest{Endpoint: mockoidc.TokenEndpoint, StatusCode: 200})
+
+	assert.Len(t, rh.Requests(), 3)
+	tokenRequests := rh.Requests(mockoidc.TokenEndpoint)
+	assert.Len(t, tokenRequests, 2)
+	assert.Equal(t, 400, tokenRequests[0].StatusCode)
+	assert.Empty(t, rh.Requests(mockoidc.UserinfoEndpoint))
+	assert.Len(t, rh.Requests(mockoidc.AuthorizationEndpoint, mockoidc.UserinfoEndpoint), 1)
+
+	rh.Reset()
+	assert.Empty(t, rh.Requests())
+}
+
+func TestMockOIDC_Requests(t *testing.T) {
+	m := mockoidc.RunTB(t)
+
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback",
+		[]string{"openid", "email"})
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, m.UserinfoEndpoint(), nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	resp, err := httpClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	authorize := m.Requests(mockoidc.AuthorizationEndpoint)
+	assert.Len(t, authorize, 1)
+	assert.Equal(t, http.MethodGet, authorize[0].Method)
+	assert.Equal(t, "openid email", authorize[0].Params.Get("scope"))
+	assert.Equal(t, http.StatusFound, authorize[0].StatusCode)
+	assert.NotEmpty(t, authorize[0].SessionID)
+	assert.False(t, authorize[0].Time.IsZero())
+
+	token := m.Requests(mockoidc.TokenEndpoint)
+	assert.Len(t, token, 1)
+	assert.Equal(t, "authorization_code", token[0].Params.Get("grant_type"))
+	assert.Equal(t, authorize[0].SessionID, token[0].SessionID)
+
+	userinfo := m.Requests(mockoidc.UserinfoEndpoint)
+	assert.Len(t, userinfo, 1)
+	assert.Equal(t, "Bearer "+tokens.AccessToken, userinfo[0].Header.Get("Authorization"))
+	assert.Equal(t, authorize[0].SessionID, userinfo[0].SessionID)
+
+	assert.Len(t, m.Requests(), 3)
+	assert.NoError(t, m.Reset())
+	assert.Empty(t, m.Requests())
+}
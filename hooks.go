@@ -0,0 +1,19 @@
+package mockoidc
+
+import "net/http"
+
+// Hook is called by an endpoint with the Session a request started or used
+type Hook func(session *Session, req *http.Request) error
+
+// runHook calls the hook if set and responds with an `internal_server_error` if
+// it fails. It returns whether the request should continue.
+func runHook(hook Hook, session *Session, rw http.ResponseWriter, req *http.Request) bool {
+	if hook == nil {
+		return true
+	}
+	if err := hook(session, req); err != nil {
+		internalServerError(rw, err.Error())
+		return false
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package mockoidc_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Hooks(t *testing.T) {
+	var calls []string
+	m := mockoidc.RunTB(t, func(m *mockoidc.MockOIDC) error {
+		m.OnAuthorize = func(session *mockoidc.Session, req *http.Request) error {
+			calls = append(calls, "authorize "+req.Form.Get("state"))
+			// Changes before the Session is saved apply to its tokens
+			session.User = &mockoidc.MockUser{Subject: "hooked"}
+			return nil
+		}
+		m.OnTokenIssued = func(session *mockoidc.Session, req *http.Request) error {
+			calls = append(calls, "token "+req.Form.Get("grant_type"))
+			return nil
+		}
+		m.OnUserinfo = func(session *mockoidc.Session, _ *http.Request) error {
+			calls = append(calls, "userinfo "+session.User.ID())
+			return errors.New("userinfo disabled")
+		}
+		return nil
+	})
+
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "hooked", tokens.IDTokenClaims["sub"])
+
+	req, err := http.NewRequest(http.MethodGet, m.UserinfoEndpoint(), nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	resp, err := httpClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	assert.Len(t, calls, 3)
+	assert.Regexp(t, "^authorize .+", calls[0])
+	assert.Equal(t, []string{"token authorization_code", "userinfo hooked"}, calls[1:])
+}
+
+func TestMockOIDC_Hooks_Hints(t *testing.T) {
+	var hints map[string]string
+	m := mockoidc.RunTB(t, func(m *mockoidc.MockOIDC) error {
+		m.HintParams = []string{"idp"}
+		m.OnAuthorize = func(session *mockoidc.Session, _ *http.Request) error {
+			hints = session.Hints
+			return nil
+		}
+		return nil
+	})
+
+	resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+		"client_id":     {m.ClientID},
+		"response_type": {"code"},
+		"scope":         {"openid"},
+		"state":         {"state"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"kc_idp_hint":   {"github"},
+		"domain_hint":   {"example.com"},
+		"idp":           {"okta-idp"},
+		"prompt":        {"login"},
+	}.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	expected := map[string]string{
+		"kc_idp_hint": "github",
+		"domain_hint": "example.com",
+		"idp":         "okta-idp",
+	}
+	assert.Equal(t, expected, hints)
+	location, err := resp.Location()
+	assert.NoError(t, err)
+	session, err := m.SessionStore.GetSessionByID(location.Query().Get("code"))
+	assert.NoError(t, err)
+	assert.Equal(t, expected, session.Hints)
+}
+
+func TestMockOIDC_Hooks_Error(t *testing.T) {
+	m := mockoidc.RunTB(t, func(m *mockoidc.MockOIDC) error {
+		m.OnTokenIssued = func(*mockoidc.Session, *http.Request) error {
+			return errors.New("token exchange disabled")
+		}
+		return nil
+	})
+
+	_, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.EqualError(t, err,
+		"token: unexpected status code 500: internal_server_error: token exchange disabled")
+}
+
+func TestMockOIDC_Hooks_Logout(t *testing.T) {
+	var logoutErr error
+	var revoked []bool
+	m := mockoidc.RunTB(t, func(m *mockoidc.MockOIDC) error {
+		m.OnLogout = func(session *mockoidc.Session, req *http.Request) error {
+			// The hook sees the Session before it is revoked
+			revoked = append(revoked, session.Revoked)
+			return logoutErr
+		}
+		return nil
+	})
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	endSession := func() (int, string) {
+		resp, err := httpClient.PostForm(m.EndSessionEndpoint(),
+			url.Values{"id_token_hint": {tokens.IDToken}})
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return resp.StatusCode, string(body)
+	}
+
+	// A failing hook answers the logout with its error and keeps the Session
+	logoutErr = errors.New("logout disabled")
+	status, body := endSession()
+	assert.Equal(t, http.StatusInternalServerError, status)
+	assert.Contains(t, body, "logout disabled")
+	session, err := m.SessionStore.GetSessionByID(tokens.IDTokenClaims["jti"].(string))
+	assert.NoError(t, err)
+	assert.False(t, session.Revoked)
+
+	logoutErr = nil
+	status, _ = endSession()
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []bool{false, false}, revoked)
+	session, err = m.SessionStore.GetSessionByID(tokens.IDTokenClaims["jti"].(string))
+	assert.NoError(t, err)
+	assert.True(t, session.Revoked)
+}
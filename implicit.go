@@ -0,0 +1,121 @@
+package mockoidc
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// implicitResponseTypes are the `response_type`s of the implicit flow,
+	// that return the tokens in the fragment of the redirect instead of a
+	// code
+	implicitResponseTypes = []string{"id_token", "id_token token", "token"}
+	// hybridResponseTypes are the `response_type`s of the hybrid flow,
+	// that return a code alongside tokens in the fragment
+	hybridResponseTypes = []string{"code id_token", "code id_token token", "code token"}
+)
+
+func implicitFlow(responseType string) bool {
+	return containsString(implicitResponseTypes, responseType)
+}
+
+// fragmentResponse reports whether the `response_type` is answered in the
+// fragment of the redirect, as the implicit & hybrid flows are
+func fragmentResponse(responseType string) bool {
+	return implicitFlow(responseType) || containsString(hybridResponseTypes, responseType)
+}
+
+// normalizeResponseType sorts the space-delimited values of the
+// `response_type`, since their order doesn't matter (e.g. `token id_token`)
+func normalizeResponseType(req *http.Request) {
+	values := strings.Fields(req.Form.Get("response_type"))
+	if len(values) < 2 {
+		return
+	}
+	sort.Strings(values)
+	req.Form.Set("response_type", strings.Join(values, " "))
+}
+
+// validateIDTokenResponse checks the requirements of the implicit & hybrid
+// `response_type`s returning an ID token: the `openid` scope and a `nonce`
+// (OIDC Core §3.2.2.1 & §3.3.2.11). It returns false if it already
+// responded.
+func (m *MockOIDC) validateIDTokenResponse(rw http.ResponseWriter, req *http.Request) bool {
+	responseType := req.Form.Get("response_type")
+	if !fragmentResponse(responseType) || !containsString(strings.Fields(responseType), "id_token") {
+		return true
+	}
+	if !containsString(strings.Fields(req.Form.Get("scope")), openidScope) {
+		m.authorizeError(rw, req, InvalidRequest,
+			"The id_token response type requires the openid scope", http.StatusBadRequest)
+		return false
+	}
+	if req.Form.Get("nonce") == "" {
+		m.authorizeError(rw, req, InvalidRequest,
+			"The request is missing the required parameter: nonce", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// fragmentRedirect redirects an implicit or hybrid flow with the code &
+// tokens of its `response_type` in the fragment. The ID token has the
+// `c_hash` of the code and the `at_hash` of an access token issued
+// alongside it.
+func (m *MockOIDC) fragmentRedirect(rw http.ResponseWriter, req *http.Request, session *Session,
+	redirectURI *url.URL, config *Config) {
+
+	responseTypes := strings.Fields(req.Form.Get("response_type"))
+	fragment := url.Values{}
+	hashes := map[string]interface{}{}
+	if containsString(responseTypes, "code") {
+		fragment.Set("code", session.SessionID)
+		hashes["c_hash"] = tokenHash(session.SessionID)
+	}
+	issued := false
+	if containsString(responseTypes, "token") {
+		accessToken, err := session.AccessToken(config, m.signingKey(), m.Now())
+		if err != nil {
+			internalServerError(rw, err.Error())
+			return
+		}
+		fragment.Set("access_token", accessToken)
+		fragment.Set("token_type", m.tokenType())
+		fragment.Set("expires_in", strconv.FormatInt(int64(config.AccessTTL/time.Second), 10))
+		hashes["at_hash"] = tokenHash(accessToken)
+		issued = true
+	}
+	if containsString(responseTypes, "id_token") {
+		idToken, err := m.idToken(session, config, hashes)
+		if err != nil {
+			internalServerError(rw, err.Error())
+			return
+		}
+		fragment.Set("id_token", idToken)
+		issued = true
+	}
+	fragment.Set("state", req.Form.Get("state"))
+	if issued {
+		if !runHook(m.OnTokenIssued, session, rw, req) {
+			return
+		}
+		m.emit(EventTokenIssued, session, req)
+	}
+
+	redirectURI.Fragment = ""
+	http.Redirect(rw, req, redirectURI.String()+"#"+fragment.Encode(), http.StatusFound)
+}
+
+// tokenHash is the `at_hash`, `c_hash` or `s_hash` of a token, code or
+// state: the left half of its SHA-256 hash, as both the RS256 & PS256
+// signing algorithms use SHA-256
+func tokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return base64.RawURLEncoding.EncodeToString(sum[:len(sum)/2])
+}
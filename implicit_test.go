@@ -0,0 +1,162 @@
+package mockoidc_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Authorize_ImplicitFlow(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	authorize := func(responseType, scope, nonce string) (*url.URL, url.Values) {
+		data := url.Values{}
+		data.Set("scope", scope)
+		data.Set("response_type", responseType)
+		data.Set("redirect_uri", "https://app.example.com/callback?tenant=a")
+		data.Set("state", "testState")
+		data.Set("client_id", m.ClientID)
+		if nonce != "" {
+			data.Set("nonce", nonce)
+		}
+		rr := testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, data)
+		assert.Equal(t, http.StatusFound, rr.Code)
+		location, err := url.Parse(rr.Header().Get("Location"))
+		assert.NoError(t, err)
+		fragment, err := url.ParseQuery(location.Fragment)
+		assert.NoError(t, err)
+		return location, fragment
+	}
+	claims := func(raw string) jwt.MapClaims {
+		token, err := m.Keypair.VerifyJWT(raw)
+		assert.NoError(t, err)
+		return token.Claims.(jwt.MapClaims)
+	}
+
+	// The order of the response types doesn't matter
+	for _, responseType := range []string{"id_token token", "token id_token"} {
+		location, fragment := authorize(responseType, "openid email", "nonce")
+		assert.Equal(t, url.Values{"tenant": {"a"}}, location.Query())
+		assert.Equal(t, "testState", fragment.Get("state"))
+		assert.Equal(t, "bearer", fragment.Get("token_type"))
+		assert.Equal(t, "600", fragment.Get("expires_in"))
+		assert.Empty(t, fragment.Get("code"))
+		assert.Empty(t, fragment.Get("refresh_token"))
+
+		accessToken := fragment.Get("access_token")
+		assert.Equal(t, mockoidc.DefaultUser().Subject, claims(accessToken)["sub"])
+		idToken := claims(fragment.Get("id_token"))
+		assert.Equal(t, "nonce", idToken["nonce"])
+		assert.Equal(t, mockoidc.DefaultUser().Email, idToken["email"])
+		sum := sha256.Sum256([]byte(accessToken))
+		assert.Equal(t, base64.RawURLEncoding.EncodeToString(sum[:16]), idToken["at_hash"])
+
+		// There is no code to exchange
+		token, err := m.Keypair.VerifyJWT(accessToken)
+		assert.NoError(t, err)
+		session, err := m.SessionStore.GetSessionByToken(token)
+		assert.NoError(t, err)
+		assert.True(t, session.Granted)
+	}
+
+	_, fragment := authorize("id_token", "openid", "nonce")
+	assert.Empty(t, fragment.Get("access_token"))
+	idToken := claims(fragment.Get("id_token"))
+	assert.Equal(t, "nonce", idToken["nonce"])
+	assert.NotContains(t, idToken, "at_hash")
+
+	// Plain OAuth2 implicit grants don't need openid nor a nonce
+	_, fragment = authorize("token", "email", "")
+	assert.NotEmpty(t, fragment.Get("access_token"))
+	assert.Empty(t, fragment.Get("id_token"))
+
+	// Errors are returned in the fragment too
+	location, fragment := authorize("id_token token", "openid", "")
+	assert.Equal(t, url.Values{"tenant": {"a"}}, location.Query())
+	assert.Equal(t, mockoidc.InvalidRequest, fragment.Get("error"))
+	assert.Equal(t, "The request is missing the required parameter: nonce",
+		fragment.Get("error_description"))
+	assert.Equal(t, "testState", fragment.Get("state"))
+	_, fragment = authorize("id_token", "email", "nonce")
+	assert.Equal(t, "The id_token response type requires the openid scope",
+		fragment.Get("error_description"))
+
+	m.SetResponseTypesSupported([]string{"code"})
+	_, fragment = authorize("token", "email", "")
+	assert.Equal(t, mockoidc.UnsupportedResponseType, fragment.Get("error"))
+}
+
+func TestMockOIDC_Authorize_HybridFlow(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	authorize := func(responseType, nonce string) url.Values {
+		data := url.Values{}
+		data.Set("scope", "openid email")
+		data.Set("response_type", responseType)
+		data.Set("redirect_uri", "https://app.example.com/callback")
+		data.Set("state", "testState")
+		data.Set("client_id", m.ClientID)
+		if nonce != "" {
+			data.Set("nonce", nonce)
+		}
+		rr := testResponse(t, mockoidc.AuthorizationEndpoint, m.Authorize, http.MethodPost, data)
+		assert.Equal(t, http.StatusFound, rr.Code)
+		location, err := url.Parse(rr.Header().Get("Location"))
+		assert.NoError(t, err)
+		assert.Empty(t, location.Query())
+		fragment, err := url.ParseQuery(location.Fragment)
+		assert.NoError(t, err)
+		return fragment
+	}
+	hash := func(value string) string {
+		sum := sha256.Sum256([]byte(value))
+		return base64.RawURLEncoding.EncodeToString(sum[:16])
+	}
+	claims := func(raw string) jwt.MapClaims {
+		token, err := m.Keypair.VerifyJWT(raw)
+		assert.NoError(t, err)
+		return token.Claims.(jwt.MapClaims)
+	}
+
+	fragment := authorize("id_token code", "nonce")
+	code := fragment.Get("code")
+	assert.NotEmpty(t, code)
+	assert.Empty(t, fragment.Get("access_token"))
+	assert.Equal(t, "testState", fragment.Get("state"))
+	idToken := claims(fragment.Get("id_token"))
+	assert.Equal(t, hash(code), idToken["c_hash"])
+	assert.Equal(t, "nonce", idToken["nonce"])
+	assert.NotContains(t, idToken, "at_hash")
+
+	// The code is exchanged like the code flow's
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, url.Values{
+		"client_id":     {m.ClientID},
+		"client_secret": {m.ClientSecret},
+		"code":          {code},
+		"grant_type":    {"authorization_code"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+	})
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	fragment = authorize("code id_token token", "nonce")
+	idToken = claims(fragment.Get("id_token"))
+	assert.Equal(t, hash(fragment.Get("code")), idToken["c_hash"])
+	assert.Equal(t, hash(fragment.Get("access_token")), idToken["at_hash"])
+
+	fragment = authorize("code token", "")
+	assert.NotEmpty(t, fragment.Get("code"))
+	assert.NotEmpty(t, fragment.Get("access_token"))
+	assert.Empty(t, fragment.Get("id_token"))
+
+	fragment = authorize("code id_token", "")
+	assert.Equal(t, mockoidc.InvalidRequest, fragment.Get("error"))
+	assert.Empty(t, fragment.Get("code"))
+}
@@ -0,0 +1,104 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// IntrospectionEndpoint implements RFC 7662 token introspection for
+// resource servers. It is advertised as the `introspection_endpoint` in the
+// discovery document.
+const IntrospectionEndpoint = "/oidc/introspect"
+
+// IntrospectionEndpoint returns the OAuth2 `introspection_endpoint`
+func (m *MockOIDC) IntrospectionEndpoint() string {
+	if m.Server == nil {
+		return ""
+	}
+	return m.Addr() + m.endpointPath(IntrospectionEndpoint)
+}
+
+// Introspect implements the `introspection_endpoint`. Any registered client
+// may introspect a token. Invalid, expired & unknown tokens and the ones of
+// revoked Sessions are inactive; active ones are described with their claims,
+// `scope` & `client_id`, plus the Session's IntrospectionExtras.
+func (m *MockOIDC) Introspect(rw http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+
+	config := m.requestConfig(req)
+	if !m.clientAuthMethod(rw, req) {
+		return
+	}
+	required := []string{"client_id", "client_secret", "token"}
+	if m.keyAuthenticated(req) {
+		required = []string{"client_id", "token"}
+	}
+	if !assertPresence(required, rw, req) {
+		return
+	}
+	if !m.validateClient(config, true, rw, req) {
+		return
+	}
+
+	introspection := m.introspect(req.Form.Get("token"))
+	resp, err := json.Marshal(introspection)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	noCache(rw)
+	jsonResponse(rw, resp)
+}
+
+// introspect describes a token, or returns an inactive introspection
+func (m *MockOIDC) introspect(raw string) map[string]interface{} {
+	inactive := map[string]interface{}{"active": false}
+	token, err := m.verifySignature(raw)
+	if err != nil {
+		return inactive
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return inactive
+	}
+	now := m.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) || !claims.VerifyNotBefore(now, false) {
+		return inactive
+	}
+	session, err := m.SessionStore.GetSessionByToken(token)
+	if err != nil || session.Revoked {
+		return inactive
+	}
+
+	introspection := make(map[string]interface{}, len(claims)+len(session.IntrospectionExtras)+3)
+	for name, value := range claims {
+		introspection[name] = value
+	}
+	introspection["scope"] = strings.Join(session.Scopes, " ")
+	if auds := audiences(claims); len(auds) > 0 {
+		introspection["client_id"] = auds[0]
+	}
+	for name, value := range session.IntrospectionExtras {
+		introspection[name] = value
+	}
+	introspection["active"] = true
+	return introspection
+}
+
+// SetIntrospectionExtras replaces the IntrospectionExtras of a Session, e.g.
+// a `username` or custom entitlements that resource servers read from
+// vendor-specific introspection fields. A nil map removes them.
+func (m *MockOIDC) SetIntrospectionExtras(sessionID string, extras map[string]interface{}) error {
+	session, err := m.SessionStore.GetSessionByID(sessionID)
+	if err != nil {
+		return err
+	}
+	session.IntrospectionExtras = extras
+	return m.SessionStore.Save(session)
+}
@@ -0,0 +1,93 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Introspect(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	user := &mockoidc.MockUser{Subject: "introspected"}
+	session, err := m.SessionStore.NewSession("openid email", "", user)
+	assert.NoError(t, err)
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", session.SessionID)
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	tokens := map[string]interface{}{}
+	assert.NoError(t, getJSON(rr, &tokens))
+
+	introspect := func(token string) map[string]interface{} {
+		data := url.Values{}
+		data.Set("client_id", m.ClientID)
+		data.Set("client_secret", m.ClientSecret)
+		data.Set("token", token)
+		rr := testResponse(t, mockoidc.IntrospectionEndpoint, m.Introspect, http.MethodPost, data)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		introspection := map[string]interface{}{}
+		assert.NoError(t, getJSON(rr, &introspection))
+		return introspection
+	}
+
+	introspection := introspect(tokens["access_token"].(string))
+	assert.Equal(t, true, introspection["active"])
+	assert.Equal(t, "openid email", introspection["scope"])
+	assert.Equal(t, m.ClientID, introspection["client_id"])
+	assert.Equal(t, "introspected", introspection["sub"])
+	assert.NotContains(t, introspection, "username")
+
+	assert.NoError(t, m.SetIntrospectionExtras(session.SessionID, map[string]interface{}{
+		"username":     "jane",
+		"client_id":    "resource-client",
+		"entitlements": []string{"reports:read"},
+	}))
+	introspection = introspect(tokens["refresh_token"].(string))
+	assert.Equal(t, true, introspection["active"])
+	assert.Equal(t, "jane", introspection["username"])
+	assert.Equal(t, "resource-client", introspection["client_id"])
+	assert.Equal(t, []interface{}{"reports:read"}, introspection["entitlements"])
+
+	assert.Equal(t, map[string]interface{}{"active": false}, introspect("not-a-token"))
+	m.FastForward(m.RefreshTTL + 1)
+	assert.Equal(t, map[string]interface{}{"active": false},
+		introspect(tokens["access_token"].(string)))
+
+	assert.Error(t, m.SetIntrospectionExtras("unknown", nil))
+}
+
+func TestMockOIDC_Introspect_RevokedSession(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+
+	introspect := func(secret string) *http.Response {
+		resp, err := httpClient.PostForm(m.IntrospectionEndpoint(), url.Values{
+			"client_id":     {m.ClientID},
+			"client_secret": {secret},
+			"token":         {tokens.AccessToken},
+		})
+		assert.NoError(t, err)
+		return resp
+	}
+	resp := introspect("wrong")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	assert.NoError(t, m.RevokeSession(tokens.IDTokenClaims["jti"].(string)))
+	resp = introspect(m.ClientSecret)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	body := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, false, body["active"])
+}
@@ -0,0 +1,61 @@
+package mockoidc
+
+import (
+	"net"
+	"net/url"
+	"strings"
+)
+
+// IssuerPort controls whether the issuer carries the default port of its
+// scheme (`80` for http, `443` for https). Relying parties comparing issuers
+// as strings break when a provider's formatting differs from what they were
+// configured with. The zero value keeps the port as served.
+type IssuerPort string
+
+const (
+	// IssuerPortOmitDefault drops a default port, e.g. `https://host:443`
+	// becomes `https://host`
+	IssuerPortOmitDefault IssuerPort = "omit"
+	// IssuerPortIncludeDefault adds the default port if there is none, e.g.
+	// `https://host` from a `X-Forwarded-Host` becomes `https://host:443`
+	IssuerPortIncludeDefault IssuerPort = "include"
+)
+
+// ParseIssuerPort validates the name of an IssuerPort. An empty name is the
+// zero value.
+func ParseIssuerPort(name string) (IssuerPort, bool) {
+	switch port := IssuerPort(name); port {
+	case "", IssuerPortOmitDefault, IssuerPortIncludeDefault:
+		return port, true
+	}
+	return "", false
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// formatIssuer renders the issuer served at the address with the
+// IssuerPort & IssuerTrailingSlash formatting. The endpoints are unaffected.
+func (m *MockOIDC) formatIssuer(addr string) string {
+	if m.IssuerPort != "" {
+		if u, err := url.Parse(addr); err == nil {
+			defaultPort := defaultPorts[u.Scheme]
+			switch port := u.Port(); {
+			case defaultPort == "":
+			case m.IssuerPort == IssuerPortOmitDefault && port == defaultPort:
+				u.Host = strings.TrimSuffix(u.Host, ":"+port)
+			case m.IssuerPort == IssuerPortIncludeDefault && port == "":
+				u.Host = net.JoinHostPort(u.Hostname(), defaultPort)
+			}
+			addr = u.String()
+		}
+	}
+
+	issuer := addr + m.BasePath
+	if m.IssuerTrailingSlash && !strings.HasSuffix(issuer, "/") {
+		issuer += "/"
+	}
+	return issuer
+}
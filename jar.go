@@ -0,0 +1,78 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// requestObjectClaims are the claims of request objects that secure them
+// rather than being authorization request parameters
+var requestObjectClaims = []string{"iss", "aud", "exp", "nbf", "iat", "jti"}
+
+// requestObjectParams verifies a request object (RFC 9101) signed by the
+// client with one of its JWKS for the issuer, and returns its claims as the
+// parameters of the authorization request. The `client_id` defaults to the
+// object's issuer, FAPIMode requires an `exp`. It returns false if it
+// already responded.
+func (m *MockOIDC) requestObjectParams(rw http.ResponseWriter, req *http.Request, clientID, request string) (url.Values, bool) {
+	if clientID == "" {
+		unverified := jwt.MapClaims{}
+		if _, _, err := new(jwt.Parser).ParseUnverified(request, unverified); err == nil {
+			clientID, _ = unverified["iss"].(string)
+		}
+	}
+	config := m.requestConfig(req)
+	client, err := m.lookupClient(config, clientID)
+	if errors.Is(err, ErrUnknownClient) {
+		errorResponse(rw, InvalidClient, fmt.Sprintf("Invalid client id: %s", clientID),
+			http.StatusUnauthorized)
+		return nil, false
+	} else if err != nil {
+		internalServerError(rw, err.Error())
+		return nil, false
+	}
+
+	claims, err := m.verifyClientJWT(client, request, []string{config.Issuer}, m.FAPIMode)
+	if err != nil {
+		errorResponse(rw, InvalidRequestObject, fmt.Sprintf("Invalid request object: %v", err),
+			http.StatusBadRequest)
+		return nil, false
+	}
+	if id, ok := claims["client_id"].(string); ok && id != clientID {
+		errorResponse(rw, InvalidRequestObject,
+			fmt.Sprintf("The request object's client_id %s isn't %s", id, clientID),
+			http.StatusBadRequest)
+		return nil, false
+	}
+
+	params := url.Values{}
+	for name, value := range claims {
+		if containsString(requestObjectClaims, name) {
+			continue
+		}
+		switch value := value.(type) {
+		case string:
+			params.Set(name, value)
+		case float64:
+			params.Set(name, strconv.FormatFloat(value, 'f', -1, 64))
+		case bool:
+			params.Set(name, strconv.FormatBool(value))
+		default:
+			// e.g. the `claims` request
+			data, err := json.Marshal(value)
+			if err != nil {
+				internalServerError(rw, err.Error())
+				return nil, false
+			}
+			params.Set(name, string(data))
+		}
+	}
+	params.Set("client_id", clientID)
+	return params, true
+}
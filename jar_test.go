@@ -0,0 +1,135 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_RequestObject(t *testing.T) {
+	m := mockoidc.RunTB(t, mockoidc.WithClientKeypair(clientKeypair(t)))
+
+	var session *mockoidc.Session
+	m.OnAuthorize = func(s *mockoidc.Session, _ *http.Request) error {
+		session = s
+		return nil
+	}
+	claims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"iss":           m.ClientID,
+			"aud":           m.Issuer(),
+			"client_id":     m.ClientID,
+			"response_type": "code",
+			"redirect_uri":  "https://app.example.com/callback",
+			"scope":         "openid email",
+			"state":         "signed-state",
+			"nonce":         "signed-nonce",
+		}
+	}
+	authorize := func(signer *mockoidc.Keypair, claims jwt.MapClaims, params url.Values) *http.Response {
+		request, err := signer.SignJWT(claims)
+		assert.NoError(t, err)
+		query := url.Values{"request": {request}}
+		for k, v := range params {
+			query[k] = v
+		}
+		resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + query.Encode())
+		assert.NoError(t, err)
+		return resp
+	}
+	requestError := func(resp *http.Response) string {
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		body := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return body["error"].(string)
+	}
+
+	// The request object's parameters replace the unsigned ones
+	resp := authorize(m.ClientKeypair, claims(), url.Values{
+		"client_id": {m.ClientID},
+		"state":     {"unsigned-state"},
+	})
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := resp.Location()
+	assert.NoError(t, err)
+	assert.Equal(t, "signed-state", location.Query().Get("state"))
+	assert.Equal(t, "signed-nonce", session.OIDCNonce)
+	assert.Equal(t, []string{"openid", "email"}, session.Scopes)
+
+	// The client_id defaults to the issuer
+	resp = authorize(m.ClientKeypair, claims(), nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	other := clientKeypair(t)
+	other.Kid = "other"
+	assert.Equal(t, mockoidc.InvalidRequestObject, requestError(authorize(other, claims(), nil)))
+
+	wrongAudience := claims()
+	wrongAudience["aud"] = "https://other.example.com"
+	assert.Equal(t, mockoidc.InvalidRequestObject, requestError(authorize(m.ClientKeypair, wrongAudience, nil)))
+
+	otherClient := claims()
+	otherClient["client_id"] = "other-client"
+	assert.Equal(t, mockoidc.InvalidRequestObject, requestError(authorize(m.ClientKeypair, otherClient, nil)))
+
+	expired := claims()
+	expired["exp"] = m.Now().Add(-time.Minute).Unix()
+	assert.Equal(t, mockoidc.InvalidRequestObject, requestError(authorize(m.ClientKeypair, expired, nil)))
+
+	// FAPI requires an exp
+	m.FAPIMode = true
+	fapi := claims()
+	fapi["code_challenge"] = "challenge"
+	fapi["code_challenge_method"] = "S256"
+	assert.Equal(t, mockoidc.InvalidRequestObject, requestError(authorize(m.ClientKeypair, fapi, nil)))
+	fapi["exp"] = m.Now().Add(time.Minute).Unix()
+	resp = authorize(m.ClientKeypair, fapi, nil)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+}
+
+func TestMockOIDC_RequestObject_Claims(t *testing.T) {
+	m := mockoidc.RunTB(t, mockoidc.WithClientKeypair(clientKeypair(t)))
+
+	request, err := m.ClientKeypair.SignJWT(jwt.MapClaims{
+		"iss":           m.ClientID,
+		"aud":           m.Issuer(),
+		"response_type": "code",
+		"redirect_uri":  "https://app.example.com/callback",
+		"scope":         "openid",
+		"state":         "state",
+		"max_age":       300,
+		"claims": map[string]interface{}{
+			"id_token": map[string]interface{}{"acr": map[string]interface{}{"essential": true}},
+		},
+	})
+	assert.NoError(t, err)
+
+	var form url.Values
+	m.OnAuthorize = func(_ *mockoidc.Session, req *http.Request) error {
+		form = req.Form
+		return nil
+	}
+	// Pushed request objects are verified when they are pushed
+	requestURI := pushAuthorization(t, m, url.Values{"request": {request}})
+	resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+		"client_id":   {m.ClientID},
+		"request_uri": {requestURI},
+	}.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "300", form.Get("max_age"))
+	assert.JSONEq(t, `{"id_token":{"acr":{"essential":true}}}`, form.Get("claims"))
+	assert.Empty(t, form.Get("iss"))
+	assert.Empty(t, form.Get("aud"))
+}
@@ -0,0 +1,60 @@
+package mockoidc
+
+import (
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// jarmResponseModes are the `response_mode`s of JWT Secured Authorization
+// Responses (JARM), returning the parameters of code responses in a
+// `response` JWT signed by the MockOIDC
+var jarmResponseModes = []string{"jwt", "query.jwt", "fragment.jwt"}
+
+// jarmResponseTTL is how long JARM responses are valid
+const jarmResponseTTL = 10 * time.Minute
+
+// jarmResponse reports whether an authorization request asked for a JARM
+// response
+func jarmResponse(req *http.Request) bool {
+	return req.Form.Get("response_type") == "code" &&
+		containsString(jarmResponseModes, req.Form.Get("response_mode"))
+}
+
+// jarmRedirect sends the parameters of an authorization response to the
+// `redirect_uri` as a `response` JWT issued to the client, in the query or,
+// with `fragment.jwt`, in the fragment
+func (m *MockOIDC) jarmRedirect(rw http.ResponseWriter, req *http.Request, params url.Values) {
+	redirectURI, err := url.Parse(req.Form.Get("redirect_uri"))
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	claims := jwt.MapClaims{
+		"iss": m.requestConfig(req).Issuer,
+		"aud": req.Form.Get("client_id"),
+		"exp": m.Now().Add(jarmResponseTTL).Unix(),
+	}
+	for name := range params {
+		claims[name] = params.Get(name)
+	}
+	response, err := m.signingKey().SignJWT(claims)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+
+	if req.Form.Get("response_mode") == "fragment.jwt" {
+		redirectURI.Fragment = ""
+		http.Redirect(rw, req, redirectURI.String()+"#"+url.Values{"response": {response}}.Encode(),
+			http.StatusFound)
+		return
+	}
+	query, _ := url.ParseQuery(redirectURI.RawQuery)
+	query.Set("response", response)
+	redirectURI.RawQuery = query.Encode()
+
+	http.Redirect(rw, req, redirectURI.String(), http.StatusFound)
+}
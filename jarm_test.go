@@ -0,0 +1,72 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_JARM(t *testing.T) {
+	m := mockoidc.RunTB(t)
+
+	authorize := func(params url.Values) *url.URL {
+		query := url.Values{
+			"client_id":     {m.ClientID},
+			"response_type": {"code"},
+			"redirect_uri":  {"https://app.example.com/callback?app=1"},
+			"scope":         {"openid"},
+			"state":         {"state"},
+		}
+		for k, v := range params {
+			query[k] = v
+		}
+		resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + query.Encode())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+		location, err := resp.Location()
+		assert.NoError(t, err)
+		return location
+	}
+	response := func(raw string) jwt.MapClaims {
+		token, err := m.Keypair.VerifyJWT(raw)
+		assert.NoError(t, err)
+		return token.Claims.(jwt.MapClaims)
+	}
+
+	for _, mode := range []string{"jwt", "query.jwt"} {
+		location := authorize(url.Values{"response_mode": {mode}})
+		assert.Equal(t, "1", location.Query().Get("app"))
+		assert.Empty(t, location.Query().Get("code"))
+		claims := response(location.Query().Get("response"))
+		assert.Equal(t, m.Issuer(), claims["iss"])
+		assert.Equal(t, m.ClientID, claims["aud"])
+		assert.Equal(t, "state", claims["state"])
+		assert.NotEmpty(t, claims["code"])
+		assert.Contains(t, claims, "exp")
+	}
+
+	location := authorize(url.Values{"response_mode": {"fragment.jwt"}})
+	assert.Empty(t, location.Query().Get("response"))
+	fragment, err := url.ParseQuery(location.Fragment)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, response(fragment.Get("response"))["code"])
+
+	// Errors are signed too
+	location = authorize(url.Values{"response_mode": {"jwt"}, "scope": {"openid unsupported"}})
+	assert.Empty(t, location.Query().Get("error"))
+	claims := response(location.Query().Get("response"))
+	assert.Equal(t, mockoidc.InvalidScope, claims["error"])
+	assert.Equal(t, "state", claims["state"])
+	assert.Contains(t, claims, "error_description")
+
+	// Only code responses are supported
+	location = authorize(url.Values{"response_mode": {"jwt"}, "response_type": {"id_token"}, "nonce": {"nonce"}})
+	fragment, err = url.ParseQuery(location.Fragment)
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.InvalidRequest, fragment.Get("error"))
+}
@@ -0,0 +1,54 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+)
+
+// parseTokenRequest parses the form of a `token_endpoint` request, or its
+// `application/json` body with AcceptJSONTokenRequests. It returns false if
+// it already responded.
+func (m *MockOIDC) parseTokenRequest(rw http.ResponseWriter, req *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if !m.AcceptJSONTokenRequests || mediaType != applicationJSON {
+		if err := req.ParseForm(); err != nil {
+			internalServerError(rw, err.Error())
+			return false
+		}
+		return true
+	}
+
+	var body map[string]interface{}
+	decoder := json.NewDecoder(req.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		errorResponse(rw, InvalidRequest, fmt.Sprintf("Invalid JSON body: %v", err),
+			http.StatusBadRequest)
+		return false
+	}
+	post := url.Values{}
+	for name, value := range body {
+		switch value := value.(type) {
+		case string:
+			post.Set(name, value)
+		case json.Number, bool:
+			post.Set(name, fmt.Sprint(value))
+		default:
+			errorResponse(rw, InvalidRequest,
+				fmt.Sprintf("Invalid JSON body: %s must be a string", name),
+				http.StatusBadRequest)
+			return false
+		}
+	}
+
+	// Body parameters take precedence over the query, as with ParseForm
+	form := req.URL.Query()
+	for name, values := range post {
+		form[name] = append(values, form[name]...)
+	}
+	req.PostForm, req.Form = post, form
+	return true
+}
@@ -0,0 +1,154 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// retiredKey is a signing Keypair replaced by `RotateKey`, still served in
+// the JWKS & verifying its tokens until the end of its overlap
+type retiredKey struct {
+	keypair *Keypair
+	until   time.Time
+}
+
+// RotateKey replaces the signing Keypair with a random one of the same type,
+// size & Alg, like a provider's scheduled key rotation. The replaced Keypair
+// keeps being served in the JWKS, and its tokens accepted, for the overlap
+// by MockOIDC's clock, then it is dropped. It is safe to call while serving
+// requests.
+func (m *MockOIDC) RotateKey(overlap time.Duration) (*Keypair, error) {
+	current := m.signingKey()
+	var (
+		keypair *Keypair
+		err     error
+	)
+	if current.ECPrivateKey != nil {
+		keypair, err = NewECKeypair(nil)
+	} else {
+		keypair, err = RandomKeypair(current.PrivateKey.Size() * 8)
+	}
+	if err != nil {
+		return nil, err
+	}
+	keypair.Alg = current.Alg
+	// The kid is computed lazily, so compute it before it is shared
+	kid, err := keypair.KeyID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := m.Now()
+	m.keysMu.Lock()
+	retired := make([]retiredKey, 0, len(m.retiredKeys)+1)
+	for _, key := range m.retiredKeys {
+		if key.until.After(now) {
+			retired = append(retired, key)
+		}
+	}
+	if overlap > 0 {
+		retired = append(retired, retiredKey{keypair: m.Keypair, until: now.Add(overlap)})
+	}
+	m.Keypair, m.retiredKeys = keypair, retired
+	m.keysMu.Unlock()
+
+	m.logger().Info("signing key rotated", "kid", kid, "overlap", overlap.String())
+	return keypair, nil
+}
+
+// rotateKeys rotates the signing Keypair every interval until done
+func (m *MockOIDC) rotateKeys(interval, overlap time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if _, err := m.RotateKey(overlap); err != nil {
+				m.logger().Error("unable to rotate signing key", "error", err)
+			}
+		}
+	}
+}
+
+// signingKey is the Keypair tokens are signed with
+func (m *MockOIDC) signingKey() *Keypair {
+	m.keysMu.RLock()
+	defer m.keysMu.RUnlock()
+	return m.Keypair
+}
+
+// verificationKeys are the signing Keypair followed by the retired ones
+// still in their overlap
+func (m *MockOIDC) verificationKeys() []*Keypair {
+	now := m.Now()
+	m.keysMu.RLock()
+	defer m.keysMu.RUnlock()
+	keys := []*Keypair{m.Keypair}
+	for _, key := range m.retiredKeys {
+		if key.until.After(now) {
+			keys = append(keys, key.keypair)
+		}
+	}
+	return keys
+}
+
+// jwks renders the JWKS of the verificationKeys
+func (m *MockOIDC) jwks() ([]byte, error) {
+	return keysJWKS(m.verificationKeys())
+}
+
+func keysJWKS(keys []*Keypair) ([]byte, error) {
+	if len(keys) == 1 {
+		return keys[0].JWKS()
+	}
+	jwks := &jose.JSONWebKeySet{}
+	for _, key := range keys {
+		jwk, err := key.jwk()
+		if err != nil {
+			return nil, err
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return json.Marshal(jwks)
+}
+
+// verifyKeysSignature verifies only the signature of a token, with the key
+// of its `kid` among the keys
+func verifyKeysSignature(raw string, keys []*Keypair) (*jwt.Token, error) {
+	if len(keys) == 1 {
+		return keys[0].verifyJWTSignature(raw)
+	}
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	return parser.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		var firstErr error
+		for _, key := range keys {
+			publicKey, err := key.keyFunc(token)
+			if err == nil {
+				return publicKey, nil
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		return nil, firstErr
+	})
+}
+
+// sameKeys tells if two verificationKeys are the same Keypairs
+func sameKeys(a, b []*Keypair) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,74 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/square/go-jose.v2"
+)
+
+func TestMockOIDC_RotateKey(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	oldKid, err := m.Keypair.KeyID()
+	assert.NoError(t, err)
+	before, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+
+	jwks := func() *jose.JSONWebKeySet {
+		resp, err := httpClient.Get(m.JWKSEndpoint())
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		set := &jose.JSONWebKeySet{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(set))
+		return set
+	}
+
+	keypair, err := m.RotateKey(time.Minute)
+	assert.NoError(t, err)
+	newKid, err := keypair.KeyID()
+	assert.NoError(t, err)
+	assert.NotEqual(t, oldKid, newKid)
+
+	// New tokens are signed with the new key, while the old one overlaps
+	after, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	token, _, err := new(jwt.Parser).ParseUnverified(after.IDToken, jwt.MapClaims{})
+	assert.NoError(t, err)
+	assert.Equal(t, newKid, token.Header["kid"])
+	set := jwks()
+	assert.Len(t, set.Keys, 2)
+	assert.Equal(t, newKid, set.Keys[0].KeyID)
+	assert.Equal(t, oldKid, set.Keys[1].KeyID)
+	assert.NoError(t, m.ValidateAgainstJWKS(before.IDToken))
+	assert.NoError(t, m.ValidateAgainstJWKS(after.IDToken))
+
+	// The old key is dropped after the overlap
+	m.FastForward(time.Minute)
+	set = jwks()
+	assert.Len(t, set.Keys, 1)
+	assert.Equal(t, newKid, set.Keys[0].KeyID)
+	assert.Error(t, m.ValidateAgainstJWKS(before.IDToken))
+	assert.NoError(t, m.ValidateAgainstJWKS(after.IDToken))
+}
+
+func TestMockOIDC_KeyRotationInterval(t *testing.T) {
+	m := mockoidc.RunTB(t, func(m *mockoidc.MockOIDC) error {
+		m.KeyRotationInterval = 10 * time.Millisecond
+		m.KeyRotationOverlap = time.Hour
+		return nil
+	})
+
+	assert.Eventually(t, func() bool {
+		resp, err := httpClient.Get(m.JWKSEndpoint())
+		if err != nil {
+			return false
+		}
+		defer resp.Body.Close()
+		set := &jose.JSONWebKeySet{}
+		return json.NewDecoder(resp.Body).Decode(set) == nil && len(set.Keys) > 1
+	}, 5*time.Second, 10*time.Millisecond)
+}
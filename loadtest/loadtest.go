@@ -0,0 +1,178 @@
+// Package loadtest drives concurrent login flows through a relying party
+// using a MockOIDC as its IdP, to benchmark authentication middle layers
+// such as oauth2-proxy.
+package loadtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config describes a load test
+type Config struct {
+	// LoginURL starts a login at the relying party, which redirects to the
+	// IdP and back to its callback
+	LoginURL string
+	// Flows is the total number of logins to run, Concurrency how many run
+	// at once
+	Flows       int
+	Concurrency int
+	// Timeout of a single flow, unlimited if zero
+	Timeout time.Duration
+	// Transport sends the requests, `http.DefaultTransport` if nil
+	Transport http.RoundTripper
+}
+
+// Result summarizes a load test
+type Result struct {
+	Flows    int
+	Failures int
+	// Errors are the distinct failure reasons with their counts
+	Errors   map[string]int
+	Duration time.Duration
+	// Latencies of the successful flows, sorted
+	Latencies []time.Duration
+}
+
+// Run executes the flows of the Config and returns their Result. Each flow
+// has its own cookie jar and follows all redirects; it succeeds if the
+// final response isn't an error. Flows not started when ctx is done are
+// skipped.
+func Run(ctx context.Context, cfg Config) (*Result, error) {
+	if cfg.LoginURL == "" {
+		return nil, errors.New("login url is empty")
+	}
+	if cfg.Flows <= 0 {
+		return nil, fmt.Errorf("flows %d is not positive", cfg.Flows)
+	}
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = 1
+	}
+
+	result := &Result{Errors: make(map[string]int)}
+	var mu sync.Mutex
+	flows := make(chan struct{})
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range flows {
+				latency, err := runFlow(ctx, cfg)
+
+				mu.Lock()
+				result.Flows++
+				if err != nil {
+					result.Failures++
+					result.Errors[err.Error()]++
+				} else {
+					result.Latencies = append(result.Latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+schedule:
+	for i := 0; i < cfg.Flows && ctx.Err() == nil; i++ {
+		select {
+		case flows <- struct{}{}:
+		case <-ctx.Done():
+			break schedule
+		}
+	}
+	close(flows)
+	wg.Wait()
+
+	result.Duration = time.Since(start)
+	sort.Slice(result.Latencies, func(i, j int) bool {
+		return result.Latencies[i] < result.Latencies[j]
+	})
+	return result, ctx.Err()
+}
+
+// runFlow logs in once with a fresh session
+func runFlow(ctx context.Context, cfg Config) (time.Duration, error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return 0, err
+	}
+	client := &http.Client{Transport: cfg.Transport, Jar: jar}
+	if cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.LoginURL, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		// Leave out the URLs, which differ for every flow
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return 0, err
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+	latency := time.Since(start)
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return 0, fmt.Errorf("unexpected status code %d from %s",
+			resp.StatusCode, resp.Request.URL.Path)
+	}
+	return latency, nil
+}
+
+// Percentile returns the latency of the successful flows at the percentile
+// (0-100), or zero if none succeeded
+func (r *Result) Percentile(p float64) time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	i := int(float64(len(r.Latencies)-1) * p / 100)
+	if i < 0 {
+		i = 0
+	} else if i >= len(r.Latencies) {
+		i = len(r.Latencies) - 1
+	}
+	return r.Latencies[i]
+}
+
+// String reports the throughput, latency percentiles and failures
+func (r *Result) String() string {
+	var b strings.Builder
+	throughput := 0.0
+	if r.Duration > 0 {
+		throughput = float64(r.Flows) / r.Duration.Seconds()
+	}
+	fmt.Fprintf(&b, "flows: %d (%d failed) in %s, %.1f/s\n",
+		r.Flows, r.Failures, r.Duration.Round(time.Millisecond), throughput)
+	fmt.Fprintf(&b, "latency: p50 %s, p90 %s, p99 %s, max %s\n",
+		r.Percentile(50), r.Percentile(90), r.Percentile(99), r.Percentile(100))
+
+	reasons := make([]string, 0, len(r.Errors))
+	for reason := range r.Errors {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(&b, "error: %s (%d)\n", reason, r.Errors[reason])
+	}
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package loadtest_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/oauth2-proxy/mockoidc/loadtest"
+	"github.com/stretchr/testify/assert"
+)
+
+// newRelyingParty serves a minimal relying party logging in at the mock
+func newRelyingParty(t *testing.T, m *mockoidc.MockOIDC) *httptest.Server {
+	mux := http.NewServeMux()
+	rp := httptest.NewServer(mux)
+	t.Cleanup(rp.Close)
+	config := m.OAuth2Config(rp.URL + "/callback")
+
+	mux.HandleFunc("/login", func(rw http.ResponseWriter, req *http.Request) {
+		http.SetCookie(rw, &http.Cookie{Name: "state", Value: "xyz"})
+		http.Redirect(rw, req, config.AuthCodeURL("xyz"), http.StatusFound)
+	})
+	mux.HandleFunc("/callback", func(rw http.ResponseWriter, req *http.Request) {
+		cookie, err := req.Cookie("state")
+		if err != nil || cookie.Value != req.URL.Query().Get("state") {
+			http.Error(rw, "state mismatch", http.StatusBadRequest)
+			return
+		}
+		if _, err = config.Exchange(req.Context(), req.URL.Query().Get("code")); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadGateway)
+			return
+		}
+		rw.WriteHeader(http.StatusOK)
+	})
+	return rp
+}
+
+func TestRun(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	rp := newRelyingParty(t, m)
+
+	result, err := loadtest.Run(context.Background(), loadtest.Config{
+		LoginURL:    rp.URL + "/login",
+		Flows:       20,
+		Concurrency: 4,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 20, result.Flows)
+	assert.Equal(t, 0, result.Failures)
+	assert.Len(t, result.Latencies, 20)
+	assert.True(t, result.Percentile(50) <= result.Percentile(99))
+	assert.Equal(t, result.Latencies[19], result.Percentile(100))
+	assert.Equal(t, uint64(20), m.RequestCount(mockoidc.TokenEndpoint))
+	assert.True(t, strings.HasPrefix(result.String(), "flows: 20 (0 failed) in "))
+
+	m.QueueError(&mockoidc.ServerError{Code: http.StatusServiceUnavailable, Error: "temporarily_unavailable"})
+	result, err = loadtest.Run(context.Background(), loadtest.Config{
+		LoginURL: rp.URL + "/login",
+		Flows:    3,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, result.Failures)
+	assert.Equal(t, map[string]int{"unexpected status code 503 from /oidc/authorize": 1}, result.Errors)
+	assert.Contains(t, result.String(), "error: unexpected status code 503 from /oidc/authorize (1)\n")
+}
+
+func TestRun_Invalid(t *testing.T) {
+	_, err := loadtest.Run(context.Background(), loadtest.Config{Flows: 1})
+	assert.EqualError(t, err, "login url is empty")
+	_, err = loadtest.Run(context.Background(), loadtest.Config{LoginURL: "http://rp"})
+	assert.EqualError(t, err, "flows 0 is not positive")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := loadtest.Run(ctx, loadtest.Config{LoginURL: "http://rp", Flows: 5})
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, 0, result.Flows)
+}
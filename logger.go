@@ -0,0 +1,81 @@
+package mockoidc
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger receives structured log events from MockOIDC. keysAndValues are
+// alternating key & value pairs, e.g. `"endpoint", "token"`.
+//
+// A `*slog.Logger` satisfies this interface as is. Use `ZapLogger` & `StdLogger`
+// to adapt zap & standard library loggers.
+type Logger interface {
+	Info(msg string, keysAndValues ...interface{})
+	Error(msg string, keysAndValues ...interface{})
+}
+
+type nopLogger struct{}
+
+func (nopLogger) Info(string, ...interface{})  {}
+func (nopLogger) Error(string, ...interface{}) {}
+
+// NopLogger returns a Logger that discards all events. This is the default.
+func NopLogger() Logger {
+	return nopLogger{}
+}
+
+type stdLogger struct {
+	logger *log.Logger
+}
+
+// StdLogger adapts a standard library `*log.Logger`. Events are written as
+// `level msg key=value ...` lines.
+func StdLogger(logger *log.Logger) Logger {
+	return &stdLogger{logger: logger}
+}
+
+func (l *stdLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.print("INFO", msg, keysAndValues)
+}
+
+func (l *stdLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.print("ERROR", msg, keysAndValues)
+}
+
+func (l *stdLogger) print(level, msg string, keysAndValues []interface{}) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", level, msg)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		if i+1 < len(keysAndValues) {
+			fmt.Fprintf(&b, " %v=%v", keysAndValues[i], keysAndValues[i+1])
+		} else {
+			fmt.Fprintf(&b, " %v", keysAndValues[i])
+		}
+	}
+	l.logger.Print(b.String())
+}
+
+// SugaredLogger is the subset of `*zap.SugaredLogger` used by ZapLogger
+type SugaredLogger interface {
+	Infow(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+}
+
+type zapLogger struct {
+	sugared SugaredLogger
+}
+
+// ZapLogger adapts a `*zap.SugaredLogger`, e.g. `ZapLogger(logger.Sugar())`
+func ZapLogger(sugared SugaredLogger) Logger {
+	return &zapLogger{sugared: sugared}
+}
+
+func (l *zapLogger) Info(msg string, keysAndValues ...interface{}) {
+	l.sugared.Infow(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Error(msg string, keysAndValues ...interface{}) {
+	l.sugared.Errorw(msg, keysAndValues...)
+}
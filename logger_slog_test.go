@@ -0,0 +1,29 @@
+//go:build go1.21
+// +build go1.21
+
+package mockoidc_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var b bytes.Buffer
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.Logger = slog.New(slog.NewTextHandler(&b, nil))
+
+	resp, err := m.Client().Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Contains(t, b.String(), "endpoint=discovery")
+	assert.Contains(t, b.String(), "status=200")
+}
@@ -0,0 +1,84 @@
+package mockoidc_test
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeSugaredLogger struct {
+	lines []string
+}
+
+func (l *fakeSugaredLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprint(append([]interface{}{"info", msg}, keysAndValues...)...))
+}
+
+func (l *fakeSugaredLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprint(append([]interface{}{"error", msg}, keysAndValues...)...))
+}
+
+func TestStdLogger(t *testing.T) {
+	var b bytes.Buffer
+	logger := mockoidc.StdLogger(log.New(&b, "", 0))
+
+	logger.Info("request", "endpoint", "token", "status", 200)
+	logger.Error("failed", "dangling")
+
+	assert.Equal(t, "INFO request endpoint=token status=200\nERROR failed dangling\n", b.String())
+}
+
+func TestZapLogger(t *testing.T) {
+	sugared := &fakeSugaredLogger{}
+	logger := mockoidc.ZapLogger(sugared)
+
+	logger.Info("request", "endpoint", "token")
+	logger.Error("failed", "error", "boom")
+
+	assert.Equal(t, []string{
+		fmt.Sprint("info", "request", "endpoint", "token"),
+		fmt.Sprint("error", "failed", "error", "boom"),
+	}, sugared.lines)
+}
+
+func TestMockOIDC_Logger(t *testing.T) {
+	var b bytes.Buffer
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.Logger = mockoidc.StdLogger(log.New(&b, "", 0))
+	client := m.Client()
+
+	resp, err := client.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t,
+		"INFO request endpoint=discovery method=GET client_id= grant_type= status=200",
+		strings.SplitN(b.String(), " latency=", 2)[0])
+	b.Reset()
+
+	tokenForm := url.Values{}
+	tokenForm.Set("client_id", m.ClientID)
+	tokenForm.Set("client_secret", "WRONG")
+	tokenForm.Set("grant_type", "authorization_code")
+	tokenForm.Set("code", "code")
+	resp, err = client.Post(m.TokenEndpoint(), "application/x-www-form-urlencoded",
+		strings.NewReader(tokenForm.Encode()))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	out := b.String()
+	assert.True(t, strings.HasPrefix(out, "INFO request failed endpoint=token method=POST"))
+	assert.Contains(t, out, "client_id="+m.ClientID)
+	assert.Contains(t, out, "grant_type=authorization_code")
+	assert.Contains(t, out, "status=401")
+	assert.Contains(t, out, "error=invalid_client")
+	assert.Contains(t, out, "error_description=Invalid client secret: WRONG")
+}
@@ -0,0 +1,144 @@
+package mockoidc
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// InteractiveParam overrides per request whether the `authorization_endpoint`
+// renders the `LoginPage` (`true`) or redirects right away (`false`).
+const InteractiveParam = "mockoidc_interactive"
+
+// loginActionParam carries the button pressed on the LoginPage
+const loginActionParam = "mockoidc_action"
+
+var loginTemplate = template.Must(template.New(LoginPage).Parse(`<!DOCTYPE html>
+<html{{if .UILocales}} lang="{{index .UILocales 0}}"{{end}}>
+<head>
+<meta charset="utf-8">
+<title>mockoidc login</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+label { display: block; margin-bottom: 0.5em; }
+</style>
+</head>
+<body>
+<h1>Sign in to <code data-testid="client-id">{{.ClientID}}</code></h1>
+<p>Requested scopes: {{range .Scopes}}<code data-testid="scope">{{.}}</code> {{end}}</p>
+{{if .UILocales}}<p>Locales: {{range .UILocales}}<code data-testid="ui-locale">{{.}}</code> {{end}}</p>
+{{end}}{{if .Display}}<p>Display: <code data-testid="display">{{.Display}}</code></p>
+{{end}}<form method="post" action="{{.Action}}" data-testid="login-form">
+{{range .Hidden}}<input type="hidden" name="{{.Name}}" value="{{.Value}}">
+{{end}}<p>Leave the subject empty to log in <span data-testid="next-user">{{if .NextUser}}{{.NextUser}}{{else}}the default user{{end}}</span>.</p>
+<label>Subject <input name="subject" data-testid="subject"></label>
+<label>Email <input name="email" data-testid="email"></label>
+<label>Username <input name="preferred_username" data-testid="preferred-username"></label>
+<button name="` + loginActionParam + `" value="approve" data-testid="approve">Approve</button>
+<button name="` + loginActionParam + `" value="deny" data-testid="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+// LoginHiddenField is an authorization request parameter the LoginPage
+// posts back
+type LoginHiddenField struct {
+	Name  string
+	Value string
+}
+
+// LoginData is rendered by the `LoginPage` template. Its form must post the
+// Hidden fields back to Action, with `mockoidc_action` set to `approve` or
+// `deny`. An approval with a `subject` logs that user in instead of the
+// next queued one. UILocales & Display are the request's `ui_locales` and
+// `display`, for templates to localize & lay out the page.
+type LoginData struct {
+	Action    string
+	ClientID  string
+	Scopes    []string
+	UILocales []string
+	Display   string
+	NextUser  string
+	Hidden    []LoginHiddenField
+}
+
+// SetInteractiveLogin toggles whether the `authorization_endpoint` renders
+// the `LoginPage` by default, safe to call while serving requests
+func (m *MockOIDC) SetInteractiveLogin(interactive bool) {
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+	m.InteractiveLogin = interactive
+}
+
+// interactive decides whether an authorization request gets the LoginPage:
+// the InteractiveParam wins over the client's setting, which wins over the
+// server's
+func (m *MockOIDC) interactive(req *http.Request) bool {
+	if interactive, err := strconv.ParseBool(req.Form.Get(InteractiveParam)); err == nil {
+		return interactive
+	}
+	client, err := m.lookupClient(m.Config(), req.Form.Get("client_id"))
+	if err == nil && client.Interactive {
+		return true
+	}
+	m.configMu.RLock()
+	defer m.configMu.RUnlock()
+	return m.InteractiveLogin
+}
+
+// interactiveLogin renders the LoginPage or applies its answer. It returns
+// false when the authorization request should carry on and log a user in.
+func (m *MockOIDC) interactiveLogin(rw http.ResponseWriter, req *http.Request) bool {
+	switch req.Form.Get(loginActionParam) {
+	case "approve":
+		if subject := req.PostForm.Get("subject"); subject != "" {
+			m.queueUserFirst(&MockUser{
+				Subject:           subject,
+				Email:             req.PostForm.Get("email"),
+				PreferredUsername: req.PostForm.Get("preferred_username"),
+			})
+		}
+		return false
+	case "deny":
+		redirectError(rw, req, AccessDenied, "The user denied the request")
+		return true
+	}
+	if !m.interactive(req) {
+		return false
+	}
+
+	page := &LoginData{
+		Action:   req.URL.Path,
+		ClientID: req.Form.Get("client_id"),
+		Scopes:   strings.Fields(req.Form.Get("scope")),
+
+		UILocales: strings.Fields(req.Form.Get("ui_locales")),
+		Display:   req.Form.Get("display"),
+	}
+	if q, ok := m.users().(*UserQueue); ok {
+		q.Lock()
+		if len(q.Queue) > 0 {
+			user := q.Queue[0]
+			if bu, ok := user.(*boundUser); ok {
+				user = bu.User
+			}
+			page.NextUser = user.ID()
+		}
+		q.Unlock()
+	}
+	names := make([]string, 0, len(req.Form))
+	for name := range req.Form {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range req.Form[name] {
+			page.Hidden = append(page.Hidden, LoginHiddenField{Name: name, Value: value})
+		}
+	}
+	m.renderPage(rw, http.StatusOK, LoginPage, page)
+	return true
+}
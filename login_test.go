@@ -0,0 +1,147 @@
+package mockoidc_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_InteractiveLogin(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+	m.QueueUser(&mockoidc.MockUser{Subject: "queued"})
+
+	authorize := url.Values{
+		"client_id":     {m.ClientID},
+		"response_type": {"code"},
+		"scope":         {"openid email"},
+		"state":         {"login-state"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"nonce":         {"login-nonce"},
+	}
+	get := func(params url.Values) *http.Response {
+		resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + params.Encode())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	page := func(params url.Values) string {
+		resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + params.Encode())
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		body, err := ioutil.ReadAll(resp.Body)
+		assert.NoError(t, err)
+		return string(body)
+	}
+	post := func(form url.Values) *url.URL {
+		resp, err := httpClient.PostForm(m.AuthorizationEndpoint(), form)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+		location, err := resp.Location()
+		assert.NoError(t, err)
+		return location
+	}
+	form := func(action string, extra url.Values) url.Values {
+		form := url.Values{"mockoidc_action": {action}}
+		for k, v := range authorize {
+			form[k] = v
+		}
+		for k, v := range extra {
+			form[k] = v
+		}
+		return form
+	}
+
+	// Headless by default
+	assert.Equal(t, http.StatusFound, get(authorize).StatusCode)
+	m.QueueUser(&mockoidc.MockUser{Subject: "queued"})
+
+	// Per request
+	interactive := form("", url.Values{mockoidc.InteractiveParam: {"true"}})
+	interactive.Del("mockoidc_action")
+	body := page(interactive)
+	assert.Contains(t, body, `<span data-testid="next-user">queued</span>`)
+	assert.Contains(t, body, `<code data-testid="scope">email</code>`)
+	assert.Contains(t, body, `<input type="hidden" name="state" value="login-state">`)
+
+	location := post(form("deny", nil))
+	assert.Equal(t, "access_denied", location.Query().Get("error"))
+	assert.Equal(t, "login-state", location.Query().Get("state"))
+	assert.Len(t, m.UserQueue.Queue, 1)
+
+	// Server wide, toggled at runtime
+	m.SetInteractiveLogin(true)
+	assert.True(t, strings.Contains(page(authorize), `data-testid="login-form"`))
+	location = post(form("approve", url.Values{"subject": {"typed"}, "email": {"typed@example.com"}}))
+	session, err := m.SessionStore.GetSessionByID(location.Query().Get("code"))
+	assert.NoError(t, err)
+	assert.Equal(t, "typed", session.User.ID())
+	assert.Equal(t, "login-nonce", session.OIDCNonce)
+	assert.Len(t, m.UserQueue.Queue, 1)
+
+	noPage := url.Values{mockoidc.InteractiveParam: {"false"}}
+	for k, v := range authorize {
+		noPage[k] = v
+	}
+	assert.Equal(t, http.StatusFound, get(noPage).StatusCode)
+	assert.Empty(t, m.UserQueue.Queue)
+	m.SetInteractiveLogin(false)
+
+	// Per client
+	m.ClientStore.(*mockoidc.MemoryClientStore).Add(&mockoidc.Client{
+		ID: "browser-app", Secret: "secret", Interactive: true})
+	authorize.Set("client_id", "browser-app")
+	assert.Contains(t, page(authorize), `<code data-testid="client-id">browser-app</code>`)
+	location = post(form("approve", nil))
+	session, err = m.SessionStore.GetSessionByID(location.Query().Get("code"))
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.DefaultUser().ID(), session.User.ID())
+}
+
+func TestMockOIDC_UILocalesAndDisplay(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	authorize := url.Values{
+		"client_id":               {m.ClientID},
+		"response_type":           {"code"},
+		"scope":                   {"openid"},
+		"state":                   {"state"},
+		"redirect_uri":            {"https://app.example.com/callback"},
+		"ui_locales":              {"fr-CA fr en"},
+		"display":                 {"popup"},
+		mockoidc.InteractiveParam: {"true"},
+	}
+
+	resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + authorize.Encode())
+	assert.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.NoError(t, err)
+	assert.Contains(t, string(body), `<html lang="fr-CA">`)
+	assert.Contains(t, string(body), `<code data-testid="ui-locale">fr</code>`)
+	assert.Contains(t, string(body), `<code data-testid="display">popup</code>`)
+
+	authorize.Set(mockoidc.InteractiveParam, "false")
+	resp, err = httpClient.Get(m.AuthorizationEndpoint() + "?" + authorize.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	location, err := resp.Location()
+	assert.NoError(t, err)
+
+	session, err := m.SessionStore.GetSessionByID(location.Query().Get("code"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"fr-CA", "fr", "en"}, session.UILocales)
+	assert.Equal(t, "popup", session.Display)
+
+	requests := m.Requests(mockoidc.AuthorizationEndpoint)
+	assert.Len(t, requests, 2)
+	assert.Equal(t, []string{"fr-CA", "fr", "en"}, requests[1].UILocales())
+	assert.Equal(t, "popup", requests[1].Display())
+}
@@ -0,0 +1,135 @@
+package mockoidc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// EndSessionEndpoint implements RP-Initiated Logout. It is advertised as the
+// `end_session_endpoint` in the discovery document.
+const EndSessionEndpoint = "/oidc/end_session"
+
+// EndSessionEndpoint returns the OIDC `end_session_endpoint`
+func (m *MockOIDC) EndSessionEndpoint() string {
+	if m.Server == nil {
+		return ""
+	}
+	return m.Addr() + m.endpointPath(EndSessionEndpoint)
+}
+
+// EndSession implements the `end_session_endpoint`. The `id_token_hint` must
+// be signed by our Keypair for our issuer (and the `client_id`, if passed)
+// and belong to a live Session, whose tokens are then revoked. The user is
+// redirected to the `post_logout_redirect_uri` with the `state`, if passed
+// and registered in the client's `PostLogoutRedirectURIs`.
+func (m *MockOIDC) EndSession(rw http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	if !assertPresence([]string{"id_token_hint"}, rw, req) {
+		return
+	}
+
+	session, clientID, ok := m.idTokenHintSession(rw, req)
+	if !ok {
+		return
+	}
+	redirectURI := req.Form.Get("post_logout_redirect_uri")
+	redirect, err := url.Parse(redirectURI)
+	if err != nil {
+		errorResponse(rw, InvalidRequest, "Invalid post_logout_redirect_uri",
+			http.StatusBadRequest)
+		return
+	}
+	if redirectURI != "" && !m.validatePostLogoutRedirectURI(clientID, redirectURI, rw) {
+		return
+	}
+
+	if !runHook(m.OnLogout, session, rw, req) {
+		return
+	}
+	if err = m.revokeSession(session); err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	m.emit(EventSessionEnded, session, req)
+
+	if redirectURI == "" {
+		rw.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		rw.WriteHeader(http.StatusOK)
+		_, _ = rw.Write([]byte("Logged out\n"))
+		return
+	}
+	if state := req.Form.Get("state"); state != "" {
+		query := redirect.Query()
+		query.Set("state", state)
+		redirect.RawQuery = query.Encode()
+	}
+	http.Redirect(rw, req, redirect.String(), http.StatusFound)
+}
+
+// validatePostLogoutRedirectURI checks the client registered the URI, if it
+// registered any
+func (m *MockOIDC) validatePostLogoutRedirectURI(clientID, redirectURI string, rw http.ResponseWriter) bool {
+	client, err := m.lookupClient(m.Config(), clientID)
+	if errors.Is(err, ErrUnknownClient) {
+		errorResponse(rw, InvalidRequest, fmt.Sprintf("Unknown client: %s", clientID),
+			http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return false
+	}
+	if len(client.PostLogoutRedirectURIs) == 0 ||
+		containsString(client.PostLogoutRedirectURIs, redirectURI) {
+		return true
+	}
+	errorResponse(rw, InvalidRequest,
+		fmt.Sprintf("Unregistered post_logout_redirect_uri: %s", redirectURI),
+		http.StatusBadRequest)
+	return false
+}
+
+// idTokenHintSession verifies the `id_token_hint` of a logout request and
+// looks up its live Session & client. It returns false if it already
+// responded.
+func (m *MockOIDC) idTokenHintSession(rw http.ResponseWriter, req *http.Request) (*Session, string, bool) {
+	invalid := func(description string) (*Session, string, bool) {
+		errorResponse(rw, InvalidRequest, description, http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	token, err := m.verifySignature(req.Form.Get("id_token_hint"))
+	if err != nil {
+		return invalid(fmt.Sprintf("Invalid id_token_hint: %v", err))
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return invalid("Invalid id_token_hint claims")
+	}
+	if issuer := m.requestConfig(req).Issuer; !claims.VerifyIssuer(issuer, true) {
+		return invalid(fmt.Sprintf("The id_token_hint wasn't issued by %s", issuer))
+	}
+	clientID := req.Form.Get("client_id")
+	if clientID == "" {
+		clientID, _ = claims["aud"].(string)
+	}
+	if !claims.VerifyAudience(clientID, true) {
+		return invalid(fmt.Sprintf("The id_token_hint wasn't issued to %s", clientID))
+	}
+	if _, ok := claims["jti"].(string); !ok {
+		return invalid("The id_token_hint has no session")
+	}
+
+	session, err := m.SessionStore.GetSessionByToken(token)
+	if err != nil || session.Revoked {
+		return invalid("The id_token_hint doesn't belong to a live session")
+	}
+	return session, clientID, true
+}
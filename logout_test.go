@@ -0,0 +1,111 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_EndSession(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", []string{"openid"})
+	assert.NoError(t, err)
+
+	other, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	foreign, err := other.SeedSession(nil, nil, nil)
+	assert.NoError(t, err)
+
+	endSession := func(values url.Values) *http.Response {
+		resp, err := httpClient.PostForm(m.EndSessionEndpoint(), values)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	for name, values := range map[string]url.Values{
+		"missing hint": {},
+		"invalid hint": {"id_token_hint": {"not-a-jwt"}},
+		"foreign hint": {"id_token_hint": {foreign.IDToken}},
+		"other client": {"id_token_hint": {tokens.IDToken}, "client_id": {"other"}},
+	} {
+		assert.Equal(t, http.StatusBadRequest, endSession(values).StatusCode, name)
+	}
+
+	resp := endSession(url.Values{
+		"id_token_hint":            {tokens.IDToken},
+		"client_id":                {m.ClientID},
+		"post_logout_redirect_uri": {"https://app.example.com/logged-out"},
+		"state":                    {"xyz"},
+	})
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "https://app.example.com/logged-out?state=xyz", resp.Header.Get("Location"))
+
+	// The session's tokens are revoked and can't log out again
+	req, err := http.NewRequest(http.MethodGet, m.UserinfoEndpoint(), nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Equal(t, http.StatusBadRequest,
+		endSession(url.Values{"id_token_hint": {tokens.IDToken}}).StatusCode)
+}
+
+func TestMockOIDC_EndSession_PostLogoutRedirectURIs(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	m.ClientStore.(*mockoidc.MemoryClientStore).Add(&mockoidc.Client{
+		ID:                     "registered",
+		Secret:                 "secret",
+		PostLogoutRedirectURIs: []string{"https://app.example.com/logged-out"},
+	})
+
+	for redirectURI, status := range map[string]int{
+		"https://evil.example.com/logged-out": http.StatusBadRequest,
+		"https://app.example.com/logged-out/": http.StatusBadRequest,
+		"https://app.example.com/logged-out":  http.StatusFound,
+	} {
+		idToken := clientIDToken(t, m, "registered", "secret")
+		resp, err := httpClient.PostForm(m.EndSessionEndpoint(), url.Values{
+			"id_token_hint":            {idToken},
+			"post_logout_redirect_uri": {redirectURI},
+		})
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, status, resp.StatusCode, redirectURI)
+	}
+}
+
+// clientIDToken logs the default user in with the client & returns its ID token
+func clientIDToken(t *testing.T, m *mockoidc.MockOIDC, clientID, clientSecret string) string {
+	resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+		"client_id":     {clientID},
+		"response_type": {"code"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"scope":         {"openid"},
+		"state":         {"state"},
+	}.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	location, err := resp.Location()
+	assert.NoError(t, err)
+
+	resp, err = httpClient.PostForm(m.TokenEndpoint(), url.Values{
+		"client_id":     {clientID},
+		"client_secret": {clientSecret},
+		"grant_type":    {"authorization_code"},
+		"code":          {location.Query().Get("code")},
+	})
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&tokens))
+	return tokens.IDToken
+}
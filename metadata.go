@@ -0,0 +1,123 @@
+package mockoidc
+
+// metadata is a MockOIDC's own copy of the `*Supported` package defaults,
+// so parallel instances (and tests changing the defaults) don't share
+// mutable state. It is replaced, never modified, once in use.
+type metadata struct {
+	grantTypes               []string
+	responseTypes            []string
+	subjectTypes             []string
+	idTokenSigningAlgs       []string
+	scopes                   []string
+	tokenEndpointAuthMethods []string
+	codeChallengeMethods     []string
+	claims                   []string
+	// extras are merged into the discovery document, overriding the
+	// standard fields of the same name
+	extras map[string]interface{}
+}
+
+// newMetadata copies the current package defaults
+func newMetadata() *metadata {
+	return &metadata{
+		grantTypes:               copyStrings(GrantTypesSupported),
+		responseTypes:            copyStrings(ResponseTypesSupported),
+		subjectTypes:             copyStrings(SubjectTypesSupported),
+		idTokenSigningAlgs:       copyStrings(IDTokenSigningAlgValuesSupported),
+		scopes:                   copyStrings(ScopesSupported),
+		tokenEndpointAuthMethods: copyStrings(TokenEndpointAuthMethodsSupported),
+		codeChallengeMethods:     copyStrings(CodeChallengeMethodsSupported),
+		claims:                   copyStrings(ClaimsSupported),
+	}
+}
+
+// supported returns the metadata of this MockOIDC. Servers not created by
+// `NewServer` see the package defaults.
+func (m *MockOIDC) supported() *metadata {
+	m.configMu.RLock()
+	defer m.configMu.RUnlock()
+	if m.metadata == nil {
+		return newMetadata()
+	}
+	return m.metadata
+}
+
+// updateMetadata replaces the metadata with a copy changed by update
+func (m *MockOIDC) updateMetadata(update func(*metadata)) {
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+
+	var md metadata
+	if m.metadata == nil {
+		md = *newMetadata()
+	} else {
+		md = *m.metadata
+	}
+	update(&md)
+	m.metadata = &md
+}
+
+// claimScopes are the scopes MockUser releases its claims for. Claims missing
+// here are released for every scope.
+var claimScopes = map[string]string{
+	"email":              "email",
+	"email_verified":     "email",
+	"preferred_username": "profile",
+	"phone_number":       "profile",
+	"address":            "profile",
+	"groups":             "groups",
+}
+
+// implementedAuthMethods are the `token_endpoint_auth_methods_supported`
+// the `token_endpoint` implements
+var implementedAuthMethods = []string{"client_secret_basic", "client_secret_post", "none",
+	"private_key_jwt", "tls_client_auth"}
+
+// fapiAuthMethods are the `implementedAuthMethods` the FAPI profiles allow
+var fapiAuthMethods = []string{"private_key_jwt", "tls_client_auth"}
+
+// claimsSupported returns the claims released for one of the supported
+// scopes
+func (md *metadata) claimsSupported() []string {
+	claims := make([]string, 0, len(md.claims))
+	for _, claim := range md.claims {
+		if scope, ok := claimScopes[claim]; !ok || containsString(md.scopes, scope) {
+			claims = append(claims, claim)
+		}
+	}
+	return claims
+}
+
+// tokenEndpointAuthMethods returns the supported methods the `token_endpoint`
+// implements. ConformanceMode always accepts `client_secret_basic`, FAPIMode
+// only the `fapiAuthMethods`.
+func (m *MockOIDC) tokenEndpointAuthMethods(md *metadata) []string {
+	methods := make([]string, 0, len(implementedAuthMethods))
+	for _, method := range implementedAuthMethods {
+		if m.FAPIMode && !containsString(fapiAuthMethods, method) {
+			continue
+		}
+		if containsString(md.tokenEndpointAuthMethods, method) ||
+			(m.ConformanceMode && method == "client_secret_basic") {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// SetDiscoveryExtras merges the fields into the discovery document, e.g. an
+// `end_session_endpoint` or vendor-specific metadata. Fields with the name
+// of a standard field replace it. A nil map removes the extras.
+func (m *MockOIDC) SetDiscoveryExtras(extras map[string]interface{}) {
+	copied := make(map[string]interface{}, len(extras))
+	for key, value := range extras {
+		copied[key] = value
+	}
+	m.updateMetadata(func(md *metadata) {
+		md.extras = copied
+	})
+}
+
+func copyStrings(values []string) []string {
+	return append([]string{}, values...)
+}
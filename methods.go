@@ -0,0 +1,70 @@
+package mockoidc
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// endpointMethods are the methods each OIDC endpoint accepts. `HEAD` is
+// accepted wherever `GET` is, and `OPTIONS` everywhere.
+var endpointMethods = map[string][]string{
+	AuthorizationEndpoint:       {http.MethodGet, http.MethodPost},
+	TokenEndpoint:               {http.MethodPost},
+	UserinfoEndpoint:            {http.MethodGet, http.MethodPost},
+	JWKSEndpoint:                {http.MethodGet},
+	DiscoveryEndpoint:           {http.MethodGet},
+	EndSessionEndpoint:          {http.MethodGet, http.MethodPost},
+	RevocationEndpoint:          {http.MethodPost},
+	IntrospectionEndpoint:       {http.MethodPost},
+	DeviceAuthorizationEndpoint: {http.MethodPost},
+	DeviceVerificationEndpoint:  {http.MethodGet, http.MethodPost},
+	PushedAuthorizationEndpoint: {http.MethodPost},
+}
+
+// allowedMethods renders the `Allow` header of the endpoint
+func allowedMethods(endpoint string) string {
+	methods := append([]string{}, endpointMethods[endpoint]...)
+	if containsString(methods, http.MethodGet) {
+		methods = append(methods, http.MethodHead)
+	}
+	return strings.Join(append(methods, http.MethodOptions), ", ")
+}
+
+// allowMethods answers `OPTIONS` requests with the endpoint's `Allow` header
+// and rejects methods it doesn't accept with a `405`. `HEAD` requests to the
+// `authorization_endpoint` & `end_session_endpoint` are answered without
+// logging a user in or out, as clients only send them to probe them.
+func (m *MockOIDC) allowMethods(endpoint string, next http.Handler) http.Handler {
+	methods, ok := endpointMethods[endpoint]
+	if !ok {
+		return next
+	}
+	allow := allowedMethods(endpoint)
+
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		method := req.Method
+		if method == http.MethodHead && containsString(methods, http.MethodGet) {
+			if endpoint == AuthorizationEndpoint || endpoint == EndSessionEndpoint {
+				rw.Header().Set("Allow", allow)
+				rw.WriteHeader(http.StatusOK)
+				return
+			}
+			method = http.MethodGet
+		}
+
+		switch {
+		case method == http.MethodOptions:
+			rw.Header().Set("Allow", allow)
+			rw.WriteHeader(http.StatusNoContent)
+		case !containsString(methods, method):
+			rw.Header().Set("Allow", allow)
+			errorResponse(rw, InvalidRequest,
+				fmt.Sprintf("Method %s is not allowed, use %s", req.Method,
+					strings.Join(methods, " or ")),
+				http.StatusMethodNotAllowed)
+		default:
+			next.ServeHTTP(rw, req)
+		}
+	})
+}
@@ -0,0 +1,51 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Methods(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	m.QueueUser(&mockoidc.MockUser{Subject: "queued"})
+
+	for _, tc := range []struct {
+		endpoint string
+		method   string
+		status   int
+		allow    string
+	}{
+		{m.DiscoveryEndpoint(), http.MethodHead, http.StatusOK, ""},
+		{m.JWKSEndpoint(), http.MethodHead, http.StatusOK, ""},
+		{m.AuthorizationEndpoint(), http.MethodHead, http.StatusOK, "GET, POST, HEAD, OPTIONS"},
+		{m.TokenEndpoint(), http.MethodOptions, http.StatusNoContent, "POST, OPTIONS"},
+		{m.DiscoveryEndpoint(), http.MethodOptions, http.StatusNoContent, "GET, HEAD, OPTIONS"},
+		{m.TokenEndpoint(), http.MethodGet, http.StatusMethodNotAllowed, "POST, OPTIONS"},
+		{m.TokenEndpoint(), http.MethodHead, http.StatusMethodNotAllowed, "POST, OPTIONS"},
+		{m.UserinfoEndpoint(), http.MethodDelete, http.StatusMethodNotAllowed, "GET, POST, HEAD, OPTIONS"},
+		{m.JWKSEndpoint(), http.MethodPost, http.StatusMethodNotAllowed, "GET, HEAD, OPTIONS"},
+	} {
+		req, err := http.NewRequest(tc.method, tc.endpoint, nil)
+		assert.NoError(t, err)
+		resp, err := httpClient.Do(req)
+		assert.NoError(t, err)
+		assert.Equal(t, tc.status, resp.StatusCode, tc.method+" "+tc.endpoint)
+		assert.Equal(t, tc.allow, resp.Header.Get("Allow"), tc.method+" "+tc.endpoint)
+
+		if tc.status == http.StatusMethodNotAllowed && tc.method != http.MethodHead {
+			body := make(map[string]interface{})
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.Equal(t, mockoidc.InvalidRequest, body["error"])
+		}
+		resp.Body.Close()
+	}
+
+	// Probing the authorization_endpoint doesn't log the queued user in
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", []string{"openid"})
+	assert.NoError(t, err)
+	assert.Equal(t, "queued", tokens.IDTokenClaims["sub"])
+}
@@ -0,0 +1,202 @@
+package mockoidc
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MetricsEndpoint serves the Prometheus metrics of a MockOIDC server
+const MetricsEndpoint = "/metrics"
+
+// MetricsBuckets are the upper bounds (in seconds) of the request latency
+// histogram buckets of Metrics created afterwards
+var MetricsBuckets = []float64{
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10,
+}
+
+var endpointNames = map[string]string{
+	AuthorizationEndpoint:       "authorize",
+	TokenEndpoint:               "token",
+	UserinfoEndpoint:            "userinfo",
+	JWKSEndpoint:                "jwks",
+	DiscoveryEndpoint:           "discovery",
+	EndSessionEndpoint:          "end_session",
+	RevocationEndpoint:          "revocation",
+	IntrospectionEndpoint:       "introspection",
+	DeviceAuthorizationEndpoint: "device_authorization",
+	DeviceVerificationEndpoint:  "device_verification",
+	PushedAuthorizationEndpoint: "pushed_authorization",
+	AdminReloadEndpoint:         "admin_reload",
+	AdminRequestCountsEndpoint:  "admin_request_counts",
+	AdminUIEndpoint:             "admin_ui",
+	HarnessCallbackEndpoint:     "harness_callback",
+	HarnessTokensEndpoint:       "harness_tokens",
+}
+
+// Metrics collects request counts & latency histograms for each endpoint
+// and grant type. It serves them in the Prometheus text format.
+type Metrics struct {
+	sync.Mutex
+	buckets   []float64
+	requests  map[requestLabels]uint64
+	latencies map[latencyLabels]*histogram
+	evictions uint64
+	reuses    uint64
+}
+
+type requestLabels struct {
+	endpoint  string
+	grantType string
+	code      int
+}
+
+type latencyLabels struct {
+	endpoint  string
+	grantType string
+}
+
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+// NewMetrics initializes empty Metrics with the current MetricsBuckets
+func NewMetrics() *Metrics {
+	return &Metrics{
+		buckets:   append([]float64{}, MetricsBuckets...),
+		requests:  make(map[requestLabels]uint64),
+		latencies: make(map[latencyLabels]*histogram),
+	}
+}
+
+// Observe records a request to the endpoint (one of the `*Endpoint`
+// constants). grantType is only set for `token_endpoint` requests.
+func (metrics *Metrics) Observe(endpoint, grantType string, code int, latency time.Duration) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	name := endpointName(endpoint)
+	metrics.requests[requestLabels{endpoint: name, grantType: grantType, code: code}]++
+
+	labels := latencyLabels{endpoint: name, grantType: grantType}
+	h, ok := metrics.latencies[labels]
+	if !ok {
+		h = &histogram{buckets: make([]uint64, len(metrics.buckets))}
+		metrics.latencies[labels] = h
+	}
+	seconds := latency.Seconds()
+	for i, bound := range metrics.buckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// ObserveEviction records a Session evicted from a full SessionStore
+func (metrics *Metrics) ObserveEviction() {
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.evictions++
+}
+
+// ObserveCodeReuse records an exchanged code presented again
+func (metrics *Metrics) ObserveCodeReuse() {
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.reuses++
+}
+
+// Reset zeroes all metrics
+func (metrics *Metrics) Reset() {
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.requests = make(map[requestLabels]uint64)
+	metrics.latencies = make(map[latencyLabels]*histogram)
+	metrics.evictions = 0
+	metrics.reuses = 0
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format
+func (metrics *Metrics) WriteTo(w io.Writer) (int64, error) {
+	metrics.Lock()
+	defer metrics.Unlock()
+
+	var b strings.Builder
+	b.WriteString("# HELP mockoidc_requests_total Requests handled by endpoint, grant type and status code.\n")
+	b.WriteString("# TYPE mockoidc_requests_total counter\n")
+	requests := make([]requestLabels, 0, len(metrics.requests))
+	for labels := range metrics.requests {
+		requests = append(requests, labels)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].endpoint != requests[j].endpoint {
+			return requests[i].endpoint < requests[j].endpoint
+		}
+		if requests[i].grantType != requests[j].grantType {
+			return requests[i].grantType < requests[j].grantType
+		}
+		return requests[i].code < requests[j].code
+	})
+	for _, labels := range requests {
+		fmt.Fprintf(&b, "mockoidc_requests_total{endpoint=%q,grant_type=%q,code=\"%d\"} %d\n",
+			labels.endpoint, labels.grantType, labels.code, metrics.requests[labels])
+	}
+
+	b.WriteString("# HELP mockoidc_request_duration_seconds Request latencies by endpoint and grant type.\n")
+	b.WriteString("# TYPE mockoidc_request_duration_seconds histogram\n")
+	latencies := make([]latencyLabels, 0, len(metrics.latencies))
+	for labels := range metrics.latencies {
+		latencies = append(latencies, labels)
+	}
+	sort.Slice(latencies, func(i, j int) bool {
+		if latencies[i].endpoint != latencies[j].endpoint {
+			return latencies[i].endpoint < latencies[j].endpoint
+		}
+		return latencies[i].grantType < latencies[j].grantType
+	})
+	for _, labels := range latencies {
+		h := metrics.latencies[labels]
+		prefix := fmt.Sprintf("endpoint=%q,grant_type=%q", labels.endpoint, labels.grantType)
+		for i, bound := range metrics.buckets {
+			fmt.Fprintf(&b, "mockoidc_request_duration_seconds_bucket{%s,le=\"%g\"} %d\n",
+				prefix, bound, h.buckets[i])
+		}
+		fmt.Fprintf(&b, "mockoidc_request_duration_seconds_bucket{%s,le=\"+Inf\"} %d\n", prefix, h.count)
+		fmt.Fprintf(&b, "mockoidc_request_duration_seconds_sum{%s} %g\n", prefix, h.sum)
+		fmt.Fprintf(&b, "mockoidc_request_duration_seconds_count{%s} %d\n", prefix, h.count)
+	}
+
+	b.WriteString("# HELP mockoidc_sessions_evicted_total Sessions evicted from full session stores.\n")
+	b.WriteString("# TYPE mockoidc_sessions_evicted_total counter\n")
+	fmt.Fprintf(&b, "mockoidc_sessions_evicted_total %d\n", metrics.evictions)
+
+	b.WriteString("# HELP mockoidc_codes_reused_total Exchanged codes presented again, revoking their tokens.\n")
+	b.WriteString("# TYPE mockoidc_codes_reused_total counter\n")
+	fmt.Fprintf(&b, "mockoidc_codes_reused_total %d\n", metrics.reuses)
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP implements the `MetricsEndpoint`
+func (metrics *Metrics) ServeHTTP(rw http.ResponseWriter, _ *http.Request) {
+	noCache(rw)
+	rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	rw.WriteHeader(http.StatusOK)
+	_, _ = metrics.WriteTo(rw)
+}
+
+func endpointName(endpoint string) string {
+	if name, ok := endpointNames[endpoint]; ok {
+		return name
+	}
+	return strings.TrimPrefix(endpoint, IssuerBase+"/")
+}
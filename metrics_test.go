@@ -0,0 +1,105 @@
+package mockoidc_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics_Observe(t *testing.T) {
+	metrics := mockoidc.NewMetrics()
+	metrics.Observe(mockoidc.TokenEndpoint, "authorization_code", http.StatusOK, 3*time.Millisecond)
+	metrics.Observe(mockoidc.TokenEndpoint, "authorization_code", http.StatusOK, 2*time.Second)
+	metrics.Observe(mockoidc.TokenEndpoint, "refresh_token", http.StatusUnauthorized, time.Millisecond)
+	metrics.Observe(mockoidc.DiscoveryEndpoint, "", http.StatusOK, time.Millisecond)
+
+	var b bytes.Buffer
+	_, err := metrics.WriteTo(&b)
+	assert.NoError(t, err)
+	out := b.String()
+
+	for _, line := range []string{
+		"# TYPE mockoidc_requests_total counter",
+		`mockoidc_requests_total{endpoint="token",grant_type="authorization_code",code="200"} 2`,
+		`mockoidc_requests_total{endpoint="token",grant_type="refresh_token",code="401"} 1`,
+		`mockoidc_requests_total{endpoint="discovery",grant_type="",code="200"} 1`,
+		"# TYPE mockoidc_request_duration_seconds histogram",
+		`mockoidc_request_duration_seconds_bucket{endpoint="token",grant_type="authorization_code",le="0.001"} 0`,
+		`mockoidc_request_duration_seconds_bucket{endpoint="token",grant_type="authorization_code",le="0.005"} 1`,
+		`mockoidc_request_duration_seconds_bucket{endpoint="token",grant_type="authorization_code",le="2.5"} 2`,
+		`mockoidc_request_duration_seconds_bucket{endpoint="token",grant_type="authorization_code",le="+Inf"} 2`,
+		`mockoidc_request_duration_seconds_sum{endpoint="token",grant_type="authorization_code"} 2.003`,
+		`mockoidc_request_duration_seconds_count{endpoint="token",grant_type="refresh_token"} 1`,
+	} {
+		assert.Contains(t, out, line+"\n")
+	}
+}
+
+func TestMockOIDC_Metrics(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	resp, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	tokenForm := url.Values{}
+	tokenForm.Set("client_id", m.ClientID)
+	tokenForm.Set("client_secret", "WRONG")
+	tokenForm.Set("grant_type", "refresh_token")
+	resp, err = httpClient.Post(m.TokenEndpoint(), "application/x-www-form-urlencoded",
+		strings.NewReader(tokenForm.Encode()))
+	assert.NoError(t, err)
+	resp.Body.Close()
+
+	resp, err = httpClient.Get(m.Addr() + mockoidc.MetricsEndpoint)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/plain")
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.Contains(t, string(body),
+		`mockoidc_requests_total{endpoint="discovery",grant_type="",code="200"} 1`)
+	assert.Contains(t, string(body),
+		`mockoidc_requests_total{endpoint="token",grant_type="refresh_token",code="401"} 1`)
+	assert.Contains(t, string(body),
+		`mockoidc_request_duration_seconds_count{endpoint="discovery",grant_type=""} 1`)
+}
+
+func TestMockOIDC_Metrics_SessionEvictions(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	logger := &recordingLogger{}
+	m.Logger = logger
+	m.SessionStore.(*mockoidc.MemorySessionStore).MaxSessions = 1
+	client := m.Client()
+
+	authorizeQuery := url.Values{}
+	authorizeQuery.Set("client_id", m.ClientID)
+	authorizeQuery.Set("scope", "openid")
+	authorizeQuery.Set("response_type", "code")
+	authorizeQuery.Set("redirect_uri", "http://127.0.0.1/oauth2/callback")
+	authorizeQuery.Set("state", "state")
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(m.AuthorizationEndpoint() + "?" + authorizeQuery.Encode())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+	}
+
+	assert.Len(t, logger.find("session evicted"), 2)
+	var b bytes.Buffer
+	_, err = m.Metrics.WriteTo(&b)
+	assert.NoError(t, err)
+	assert.Contains(t, b.String(), "mockoidc_sessions_evicted_total 2\n")
+}
@@ -1,13 +1,23 @@
 package mockoidc
 
 import (
+	"bytes"
 	"context"
 	"crypto/rsa"
 	"crypto/tls"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"html/template"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -20,23 +30,282 @@ var NowFunc = time.Now
 // MockOIDC is a minimal OIDC server for use in OIDC authentication
 // integration testing.
 type MockOIDC struct {
+	// Client credentials & TTLs can be set directly before starting the
+	// server. Use the setters (e.g. `SetClientSecret`) to change them while
+	// it handles requests.
 	ClientID     string
 	ClientSecret string
+	// ClientKeypair lets the client authenticate with `private_key_jwt` and
+	// sign request objects, e.g. in FAPIMode. MockOIDC verifies them with
+	// its public key; relying parties (& CompleteCodeFlow) sign with its
+	// private one.
+	ClientKeypair *Keypair
 
 	AccessTTL  time.Duration
 	RefreshTTL time.Duration
 
+	// BasePath is the path prefix all endpoints are served under. It is
+	// `IssuerBase` (`/oidc`) when created with `NewServer`, but can be set to
+	// e.g. a tenant path or empty to serve at the root (`/authorize`, ...).
+	BasePath string
+
+	// EndpointPaths replaces the paths of endpoints, keyed by their
+	// `*Endpoint` constant, e.g. to serve a provider's path layout. The
+	// BasePath isn't prepended to them.
+	EndpointPaths map[string]string
+
+	// Timeouts of the http.Server created in `Start`. Zero means no timeout,
+	// as with http.Server.
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+
+	// ConfigFile is the FileConfig JSON file `Reload` applies. When set, the
+	// `AdminReloadEndpoint` is served as well.
+	ConfigFile string
+
+	// DumpRequests logs the full wire format of every endpoint request &
+	// response to the Logger, to see exactly what a relying party sent when
+	// a flow fails. RedactDumps replaces tokens, secrets & codes in them.
+	DumpRequests bool
+	RedactDumps  bool
+
+	// TrustForwardedHeaders derives the issuer & endpoint URLs from the
+	// `X-Forwarded-Proto`, `X-Forwarded-Host` and `X-Forwarded-Prefix`
+	// headers set by a reverse proxy in front of MockOIDC.
+	TrustForwardedHeaders bool
+
+	// IssuerTrailingSlash ends the issuer with a `/`, like e.g. Auth0's, and
+	// IssuerPort adds or drops default ports from it, to find relying
+	// parties that compare issuers as strings. The endpoint URLs don't
+	// change.
+	IssuerTrailingSlash bool
+	IssuerPort          IssuerPort
+
+	// GCInterval is how often a started server prunes Sessions whose
+	// refresh tokens expired (see `PruneExpired`). Zero disables it.
+	GCInterval time.Duration
+
+	// KeyRotationInterval is how often a started server rotates its signing
+	// Keypair (see `RotateKey`), serving the replaced one in the JWKS for the
+	// KeyRotationOverlap. Zero disables it.
+	KeyRotationInterval time.Duration
+	KeyRotationOverlap  time.Duration
+
+	// ServeAdminUI enables the web UI at `AdminUIEndpoint`
+	ServeAdminUI bool
+
+	// ServeHarnessPages enables the callback & token display pages at
+	// `HarnessCallbackEndpoint` & `HarnessTokensEndpoint`
+	ServeHarnessPages bool
+
+	// InteractiveLogin makes the `authorization_endpoint` render the
+	// `LoginPage` instead of logging the next user in right away. See
+	// `SetInteractiveLogin` to toggle it while serving requests.
+	InteractiveLogin bool
+
+	// PageTemplates replace the built-in templates of the interactive pages,
+	// keyed by page name, e.g. `AdminUIPage`
+	PageTemplates map[string]*template.Template
+
+	// HintParams are authorization request parameters kept in the
+	// Session's Hints besides the `*_hint` ones, e.g. Okta's `idp` or
+	// Auth0's `connection`
+	HintParams []string
+
+	// AuthorizeErrorsAsJSON keeps the legacy behavior of rendering invalid
+	// authorization requests as JSON errors. By default they are redirected
+	// to the client's `redirect_uri` with `error`, `error_description` and
+	// `state`, as RPs expect. Unknown clients & invalid redirect URIs are
+	// always rendered.
+	AuthorizeErrorsAsJSON bool
+
+	// LegacyResponseTypeError answers unsupported `response_type`s with an
+	// `unsupported_grant_type` error & a `401` like earlier versions did,
+	// instead of RFC 6749's `unsupported_response_type`
+	LegacyResponseTypeError bool
+
+	// RequireNonce rejects `openid` authorization requests without a
+	// `nonce`, like strict providers do. The nonce is echoed in every ID
+	// token of the Session.
+	RequireNonce bool
+
+	// AccessTokenAudience is added to the `aud` of access tokens besides
+	// the client, e.g. the userinfo endpoint's URL or an API identifier.
+	// The `userinfo_endpoint` then rejects tokens without it, like ID
+	// tokens, unless LenientAudience only logs them.
+	AccessTokenAudience string
+	LenientAudience     bool
+
+	// OmitRefreshIDToken leaves the ID token out of `refresh_token` grant
+	// responses, like providers that only issue one at login. By default
+	// refreshes of `openid` Sessions get a new ID token with a fresh `iat`
+	// & `exp`.
+	OmitRefreshIDToken bool
+
+	// ClientCredentialsScopes are granted to `client_credentials` token
+	// requests without a `scope`. Requests may also ask for them when they
+	// aren't in the supported scopes, e.g. API scopes like `orders:read`.
+	ClientCredentialsScopes []string
+
+	// DeviceCodeTTL is how long device codes can be approved & polled for,
+	// 10 minutes when zero. DevicePollInterval is the `interval` clients
+	// must wait between polls of the `token_endpoint`, 5 seconds when zero.
+	// Faster polls get a `slow_down` that adds 5 seconds to the interval,
+	// unless LenientDevicePolling is set.
+	DeviceCodeTTL        time.Duration
+	DevicePollInterval   time.Duration
+	LenientDevicePolling bool
+
+	// DisableClientCredentials, DisableDeviceFlow, DisableImplicitFlow &
+	// DisableHybridFlow turn the `client_credentials` grant, the device
+	// authorization grant and the implicit & hybrid `response_type`s off:
+	// they are neither advertised in the discovery document nor accepted.
+	DisableClientCredentials bool
+	DisableDeviceFlow        bool
+	DisableImplicitFlow      bool
+	DisableHybridFlow        bool
+
+	// AllowQueryAccessToken accepts the access token of userinfo requests in
+	// the `access_token` query parameter (RFC 6750 §2.3). The header & the
+	// form-encoded body are always accepted.
+	AllowQueryAccessToken bool
+
+	// AcceptJSONTokenRequests reads the parameters of `application/json`
+	// `token_endpoint` requests from their JSON object body, as some
+	// non-compliant clients send them. Form-encoded requests keep working.
+	AcceptJSONTokenRequests bool
+
+	// TokenType is the `token_type` of token responses, `bearer` when
+	// empty, and TokenResponseExtras are added to them, e.g. Azure AD's
+	// `ext_expires_in`. ExpiresInSeconds renders `expires_in` in seconds,
+	// as ConformanceMode does, instead of as a time.Duration.
+	TokenType           string
+	TokenResponseExtras map[string]interface{}
+	ExpiresInSeconds    bool
+
+	// ShapeClaims changes the claims released to ID tokens & userinfo
+	// responses last, to imitate a provider's claim shapes. Its changes are
+	// listed by `ExplainClaims`.
+	ShapeClaims func(claims map[string]interface{}, session *Session, target ClaimsTarget)
+
+	// FAPIMode applies the FAPI 1.0 Advanced & 2.0 profiles: authorization
+	// requests must be pushed or signed request objects, with PKCE `S256`
+	// and a `nonce` on `openid` requests, clients authenticate with
+	// `private_key_jwt` or `tls_client_auth`, and ID tokens carry the
+	// `s_hash` of the `state`. Pair it with `WithSigningAlg("PS256")` and a
+	// ClientKeypair.
+	FAPIMode bool
+
+	// Compliance emulates rigorous or sloppy providers, see ComplianceMode
+	Compliance ComplianceMode
+
+	// ConformanceMode fixes the deviations from the OpenID Connect specs
+	// that the OpenID Foundation's Basic OP certification profile checks,
+	// which existing tests may rely on: `state` is optional, unsupported
+	// scopes are ignored instead of rejected, the token endpoint accepts
+	// `client_secret_basic` credentials and renders `expires_in` in seconds,
+	// and userinfo responses include `sub`.
+	ConformanceMode bool
+
+	// MetadataCacheControl replaces the `no-cache` `Cache-Control` header of
+	// the discovery document & JWKS, e.g. `max-age=300`, to test the
+	// caching of clients. MetadataETags adds an `ETag` to them and answers
+	// matching `If-None-Match` requests with `304 Not Modified`.
+	MetadataCacheControl string
+	MetadataETags        bool
+
+	// PerformanceMode trades per-request work for throughput when the mock
+	// is the IdP of load tests: the discovery document & JWKS are marshaled
+	// once, token signatures are verified once, and requests aren't kept in
+	// the RequestHistory. Token minting is cheap in every mode.
+	PerformanceMode bool
+
+	// Hooks called by the endpoints with the Session of a request, to
+	// assert side effects or change the Session. OnAuthorize runs before the
+	// Session is saved, OnTokenIssued after the tokens are signed and
+	// OnUserinfo before the claims are returned. OnCodeReused runs when an
+	// exchanged code is presented again, after its Session's tokens were
+	// revoked, and OnRefreshRejected when a refresh token of a revoked
+	// Session is, before the `invalid_grant`. OnLogout runs before the
+	// Session of an `end_session_endpoint` request is revoked. An error
+	// fails the request.
+	OnAuthorize       Hook
+	OnTokenIssued     Hook
+	OnUserinfo        Hook
+	OnCodeReused      Hook
+	OnRefreshRejected Hook
+	OnLogout          Hook
+
 	// Normally, these would be private. Expose them publicly for
 	// power users.
-	Server       *http.Server
-	Keypair      *Keypair
-	SessionStore *SessionStore
-	UserQueue    *UserQueue
-	ErrorQueue   *ErrorQueue
-
-	tlsConfig   *tls.Config
-	middleware  []func(http.Handler) http.Handler
+	Server         *http.Server
+	Keypair        *Keypair
+	SessionStore   SessionStore
+	UserQueue      *UserQueue
+	ErrorQueue     *ErrorQueue
+	Metrics        *Metrics
+	RequestCounter *RequestCounter
+	RequestHistory *RequestHistory
+	Logger         Logger
+	// ClientStore registers clients besides `ClientID`. UserStore replaces
+	// the UserQueue as the source of logged in Users when set.
+	ClientStore ClientStore
+	UserStore   UserStore
+
+	configMu       sync.RWMutex
+	metadata       *metadata
+	errorTemplates map[string]*errorTemplate
+	preset         Preset
+
+	// keysMu guards the Keypair against rotations while serving requests
+	keysMu      sync.RWMutex
+	retiredKeys []retiredKey
+
+	tlsConfig  *tls.Config
+	middleware []func(http.Handler) http.Handler
+
+	clockMu     sync.RWMutex
 	fastForward time.Duration
+	// The clock is stopped at frozenAt when set. Reset freezes it at epoch
+	// again.
+	frozenAt time.Time
+	epoch    time.Time
+	// flowNonce generates the `state`, `nonce` & PKCE verifier of
+	// CompleteCodeFlow, randomNonce if nil
+	flowNonce func(length int) (string, error)
+
+	serveDone chan struct{}
+	serveErr  error
+	// Guards Start against concurrent `WaitForReady` calls
+	startMu sync.Mutex
+
+	expectMu sync.Mutex
+	expected map[string]int
+
+	gatesMu sync.Mutex
+	gates   map[string]*endpointGate
+
+	eventsMu    sync.Mutex
+	subscribers map[chan Event]struct{}
+
+	scenarioMu sync.Mutex
+	scenario   []scenarioStep
+
+	recordMu sync.Mutex
+	recorder *recorder
+
+	perf perfCache
+
+	replayMu sync.Mutex
+	replayer *replayer
+
+	devicesMu sync.Mutex
+	devices   map[string]*deviceAuthorization
+
+	pushedMu sync.Mutex
+	pushed   map[string]*pushedRequest
 }
 
 // Config gives the various settings MockOIDC starts with that a test
@@ -48,6 +317,9 @@ type Config struct {
 
 	AccessTTL  time.Duration
 	RefreshTTL time.Duration
+
+	// AccessTokenAudience is added to the `aud` of access tokens, if set
+	AccessTokenAudience string
 }
 
 // NewServer configures a new MockOIDC that isn't started. An existing
@@ -68,17 +340,45 @@ func NewServer(key *rsa.PrivateKey) (*MockOIDC, error) {
 	}
 
 	return &MockOIDC{
-		ClientID:     clientID,
-		ClientSecret: clientSecret,
-		AccessTTL:    time.Duration(10) * time.Minute,
-		RefreshTTL:   time.Duration(60) * time.Minute,
-		Keypair:      keypair,
-		SessionStore: NewSessionStore(),
-		UserQueue:    &UserQueue{},
-		ErrorQueue:   &ErrorQueue{},
+		ClientID:       clientID,
+		ClientSecret:   clientSecret,
+		AccessTTL:      time.Duration(10) * time.Minute,
+		RefreshTTL:     time.Duration(60) * time.Minute,
+		Keypair:        keypair,
+		SessionStore:   NewSessionStore(),
+		ClientStore:    NewClientStore(),
+		UserQueue:      &UserQueue{},
+		ErrorQueue:     &ErrorQueue{},
+		Metrics:        NewMetrics(),
+		RequestCounter: NewRequestCounter(),
+		RequestHistory: NewRequestHistory(),
+		Logger:         NopLogger(),
+		BasePath:       IssuerBase,
+		metadata:       newMetadata(),
 	}, nil
 }
 
+// Stores are the stores a MockOIDC looks up Users, Clients & Sessions in.
+// Nil ones are left to their defaults.
+type Stores struct {
+	Users    UserStore
+	Clients  ClientStore
+	Sessions SessionStore
+}
+
+// NewServerWithStores configures a server like `NewServer` with the passed
+// stores, e.g. mocks scripting lookup failures for handler tests.
+func NewServerWithStores(key *rsa.PrivateKey, stores Stores) (*MockOIDC, error) {
+	m, err := NewServer(key)
+	if err != nil {
+		return nil, err
+	}
+	if err = WithStores(stores)(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // Run creates a default MockOIDC server and starts it
 func Run() (*MockOIDC, error) {
 	return RunTLS(nil)
@@ -87,11 +387,29 @@ func Run() (*MockOIDC, error) {
 // RunTLS creates a default MockOIDC server and starts it. It takes a
 // tester configured tls.Config for TLS support.
 func RunTLS(cfg *tls.Config) (*MockOIDC, error) {
+	return runListen("tcp", "127.0.0.1:0", cfg)
+}
+
+// RunAddr creates a default MockOIDC server and starts it on the passed
+// TCP address (e.g. `127.0.0.1:8080`). Use port `0` for an ephemeral port
+// and retrieve the chosen one with `m.Port()`.
+func RunAddr(addr string, cfg *tls.Config) (*MockOIDC, error) {
+	return runListen("tcp", addr, cfg)
+}
+
+// RunUnix creates a default MockOIDC server and starts it on a Unix domain
+// socket at the passed path. Endpoint URLs will use `localhost` as the
+// host, clients need to dial the socket directly.
+func RunUnix(path string, cfg *tls.Config) (*MockOIDC, error) {
+	return runListen("unix", path, cfg)
+}
+
+func runListen(network, address string, cfg *tls.Config) (*MockOIDC, error) {
 	m, err := NewServer(nil)
 	if err != nil {
 		return nil, err
 	}
-	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	ln, err := net.Listen(network, address)
 	if err != nil {
 		return nil, err
 	}
@@ -101,38 +419,171 @@ func RunTLS(cfg *tls.Config) (*MockOIDC, error) {
 // Start starts the MockOIDC server in its own Goroutine on the provided
 // net.Listener. In generic `Run`, this defaults to `127.0.0.1:0`
 func (m *MockOIDC) Start(ln net.Listener, cfg *tls.Config) error {
+	m.startMu.Lock()
+	defer m.startMu.Unlock()
+
 	if m.Server != nil {
 		return errors.New("server already started")
 	}
 
-	handler := http.NewServeMux()
-	handler.Handle(AuthorizationEndpoint, m.chainMiddleware(m.Authorize))
-	handler.Handle(TokenEndpoint, m.chainMiddleware(m.Token))
-	handler.Handle(UserinfoEndpoint, m.chainMiddleware(m.Userinfo))
-	handler.Handle(JWKSEndpoint, m.chainMiddleware(m.JWKS))
-	handler.Handle(DiscoveryEndpoint, m.chainMiddleware(m.Discovery))
-
+	addr := ln.Addr().String()
+	if ln.Addr().Network() == "unix" {
+		addr = "localhost"
+	}
 	m.Server = &http.Server{
-		Addr:      ln.Addr().String(),
-		Handler:   handler,
-		TLSConfig: cfg,
+		Addr:              addr,
+		Handler:           m.Handler(),
+		TLSConfig:         cfg,
+		ReadTimeout:       m.ReadTimeout,
+		ReadHeaderTimeout: m.ReadHeaderTimeout,
+		WriteTimeout:      m.WriteTimeout,
+		IdleTimeout:       m.IdleTimeout,
 	}
 	// Track this to know if we are https
 	m.tlsConfig = cfg
+	if cfg != nil {
+		ln = tls.NewListener(ln, cfg)
+	}
 
+	m.serveDone = make(chan struct{})
 	go func() {
+		defer close(m.serveDone)
 		err := m.Server.Serve(ln)
 		if err != nil && err != http.ErrServerClosed {
-			panic(err)
+			m.logger().Error("server stopped", "error", err)
+			m.serveErr = err
 		}
 	}()
+	if m.GCInterval > 0 {
+		go m.collectGarbage(m.GCInterval, m.serveDone)
+	}
+	if m.KeyRotationInterval > 0 {
+		go m.rotateKeys(m.KeyRotationInterval, m.KeyRotationOverlap, m.serveDone)
+	}
 
 	return nil
 }
 
+// StartContext is the same as Start, but the server is shut down once the
+// passed context is done.
+func (m *MockOIDC) StartContext(ctx context.Context, ln net.Listener, cfg *tls.Config) error {
+	if err := m.Start(ln, cfg); err != nil {
+		return err
+	}
+
+	done := m.serveDone
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = m.ShutdownContext(context.Background())
+		case <-done:
+		}
+	}()
+	return nil
+}
+
+// Run starts the server like Start and blocks until the passed context is
+// done or the process receives SIGINT or SIGTERM, then shuts it down
+// gracefully. It is the building block for main funcs embedding MockOIDC.
+func (m *MockOIDC) Run(ctx context.Context, ln net.Listener, cfg *tls.Config) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := m.Start(ln, cfg); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return m.ShutdownContext(context.Background())
+	case <-m.serveDone:
+		return m.serveErr
+	}
+}
+
+// Handler returns the http.Handler serving all the MockOIDC endpoints
+// wrapped in any added middleware. Use this to mount MockOIDC in your own
+// http.Server or test harness instead of calling `Start`.
+func (m *MockOIDC) Handler() http.Handler {
+	handler := http.NewServeMux()
+	for _, endpoint := range []struct {
+		path    string
+		handler func(http.ResponseWriter, *http.Request)
+	}{
+		{AuthorizationEndpoint, m.Authorize},
+		{TokenEndpoint, m.Token},
+		{UserinfoEndpoint, m.Userinfo},
+		{JWKSEndpoint, m.JWKS},
+		{DiscoveryEndpoint, m.Discovery},
+		{EndSessionEndpoint, m.EndSession},
+		{RevocationEndpoint, m.Revoke},
+		{IntrospectionEndpoint, m.Introspect},
+		{DeviceAuthorizationEndpoint, m.DeviceAuthorization},
+		{DeviceVerificationEndpoint, m.DeviceVerification},
+		{PushedAuthorizationEndpoint, m.PushedAuthorization},
+	} {
+		handler.Handle(m.endpointPath(endpoint.path),
+			m.chainMiddleware(endpoint.path, endpoint.handler))
+	}
+	if m.RequestCounter != nil {
+		handler.Handle(m.endpointPath(AdminRequestCountsEndpoint),
+			m.chainMiddleware(AdminRequestCountsEndpoint, m.AdminRequestCounts))
+	}
+	if m.ConfigFile != "" {
+		handler.Handle(m.endpointPath(AdminReloadEndpoint),
+			m.chainMiddleware(AdminReloadEndpoint, m.AdminReload))
+	}
+	if m.ServeAdminUI {
+		// Queued errors are meant for the relying party, not the UI showing them
+		handler.Handle(m.endpointPath(AdminUIEndpoint),
+			m.instrument(AdminUIEndpoint, http.HandlerFunc(m.AdminUI)))
+	}
+	if m.ServeHarnessPages {
+		handler.Handle(m.endpointPath(HarnessCallbackEndpoint),
+			m.instrument(HarnessCallbackEndpoint, http.HandlerFunc(m.HarnessCallback)))
+		handler.Handle(m.endpointPath(HarnessTokensEndpoint),
+			m.instrument(HarnessTokensEndpoint, http.HandlerFunc(m.HarnessTokens)))
+	}
+	if m.Metrics != nil {
+		handler.Handle(MetricsEndpoint, m.Metrics)
+	}
+	handler.HandleFunc(VersionEndpoint, m.Version)
+	if ss, ok := m.SessionStore.(*MemorySessionStore); ok && ss.OnEvict == nil {
+		ss.OnEvict = m.sessionEvicted
+	}
+	return handler
+}
+
+// sessionEvicted logs & counts Sessions evicted from a full store
+func (m *MockOIDC) sessionEvicted(session *Session) {
+	if m.Metrics != nil {
+		m.Metrics.ObserveEviction()
+	}
+	m.logger().Info("session evicted", "session_id", session.SessionID)
+}
+
 // Shutdown stops the MockOIDC server. Use this to cleanup test runs.
 func (m *MockOIDC) Shutdown() error {
-	return m.Server.Shutdown(context.Background())
+	return m.ShutdownContext(context.Background())
+}
+
+// ShutdownContext gracefully stops the MockOIDC server. It waits for
+// in-flight requests to drain and the listener to be released until the
+// passed context is done.
+func (m *MockOIDC) ShutdownContext(ctx context.Context) error {
+	// Held requests would never drain
+	m.releaseEndpoints()
+	if err := m.Server.Shutdown(ctx); err != nil {
+		return err
+	}
+	if m.serveDone == nil {
+		return nil
+	}
+	select {
+	case <-m.serveDone:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (m *MockOIDC) AddMiddleware(mw func(http.Handler) http.Handler) error {
@@ -147,20 +598,172 @@ func (m *MockOIDC) AddMiddleware(mw func(http.Handler) http.Handler) error {
 // Config returns the Config with options a connection application or unit
 // tests need to be aware of.
 func (m *MockOIDC) Config() *Config {
+	m.configMu.RLock()
+	defer m.configMu.RUnlock()
+
 	return &Config{
 		ClientID:     m.ClientID,
 		ClientSecret: m.ClientSecret,
 		Issuer:       m.Issuer(),
 		AccessTTL:    m.AccessTTL,
 		RefreshTTL:   m.RefreshTTL,
+
+		AccessTokenAudience: m.AccessTokenAudience,
+	}
+}
+
+// SetClientID changes the ClientID, safe to call while serving requests
+func (m *MockOIDC) SetClientID(clientID string) {
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+	m.ClientID = clientID
+}
+
+// SetClientSecret changes the ClientSecret, safe to call while serving
+// requests. Use it to test secret rotation in the middle of a flow.
+func (m *MockOIDC) SetClientSecret(clientSecret string) {
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+	m.ClientSecret = clientSecret
+}
+
+// SetAccessTTL changes the AccessTTL, safe to call while serving requests
+func (m *MockOIDC) SetAccessTTL(ttl time.Duration) {
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+	m.AccessTTL = ttl
+}
+
+// SetRefreshTTL changes the RefreshTTL, safe to call while serving requests
+func (m *MockOIDC) SetRefreshTTL(ttl time.Duration) {
+	m.configMu.Lock()
+	defer m.configMu.Unlock()
+	m.RefreshTTL = ttl
+}
+
+// SetScopesSupported changes the scopes this MockOIDC accepts & advertises
+// in its discovery document from the `ScopesSupported` default. It is safe
+// to call while serving requests.
+func (m *MockOIDC) SetScopesSupported(scopes []string) {
+	m.updateMetadata(func(md *metadata) {
+		md.scopes = copyStrings(scopes)
+	})
+}
+
+// SetGrantTypesSupported changes the grant types this MockOIDC accepts &
+// advertises from the `GrantTypesSupported` default. Grant types that aren't
+// implemented or whose feature isn't enabled are neither.
+func (m *MockOIDC) SetGrantTypesSupported(grantTypes []string) {
+	m.updateMetadata(func(md *metadata) {
+		md.grantTypes = copyStrings(grantTypes)
+	})
+}
+
+// SetResponseTypesSupported changes the `response_type`s this MockOIDC
+// accepts & advertises from the `ResponseTypesSupported` default, like
+// SetGrantTypesSupported
+func (m *MockOIDC) SetResponseTypesSupported(responseTypes []string) {
+	m.updateMetadata(func(md *metadata) {
+		md.responseTypes = copyStrings(responseTypes)
+	})
+}
+
+// SetSubjectTypesSupported changes the `subject_types_supported` this
+// MockOIDC advertises from the `SubjectTypesSupported` default
+func (m *MockOIDC) SetSubjectTypesSupported(subjectTypes []string) {
+	m.updateMetadata(func(md *metadata) {
+		md.subjectTypes = copyStrings(subjectTypes)
+	})
+}
+
+// SetCodeChallengeMethodsSupported changes the PKCE
+// `code_challenge_method`s this MockOIDC accepts & advertises from the
+// `CodeChallengeMethodsSupported` default
+func (m *MockOIDC) SetCodeChallengeMethodsSupported(methods []string) {
+	m.updateMetadata(func(md *metadata) {
+		md.codeChallengeMethods = copyStrings(methods)
+	})
+}
+
+// SetIDTokenSigningAlgValuesSupported changes the
+// `id_token_signing_alg_values_supported` this MockOIDC advertises from the
+// `IDTokenSigningAlgValuesSupported` default
+func (m *MockOIDC) SetIDTokenSigningAlgValuesSupported(algs []string) {
+	m.updateMetadata(func(md *metadata) {
+		md.idTokenSigningAlgs = copyStrings(algs)
+	})
+}
+
+// SetTokenEndpointAuthMethodsSupported changes the
+// `token_endpoint_auth_methods_supported` this MockOIDC advertises from the
+// `TokenEndpointAuthMethodsSupported` default
+func (m *MockOIDC) SetTokenEndpointAuthMethodsSupported(methods []string) {
+	m.updateMetadata(func(md *metadata) {
+		md.tokenEndpointAuthMethods = copyStrings(methods)
+	})
+}
+
+// SetClaimsSupported changes the `claims_supported` this MockOIDC advertises
+// from the `ClaimsSupported` default
+func (m *MockOIDC) SetClaimsSupported(claims []string) {
+	m.updateMetadata(func(md *metadata) {
+		md.claims = copyStrings(claims)
+	})
+}
+
+// requestConfig is the Config as seen by the client making the request.
+func (m *MockOIDC) requestConfig(req *http.Request) *Config {
+	cfg := m.Config()
+	if m.Server != nil {
+		cfg.Issuer = m.formatIssuer(m.requestAddr(req))
 	}
+	return cfg
 }
 
 // QueueUser allows adding mock User objects to the authentication queue.
 // Calls to the `authorization_endpoint` will pop these mock User objects
 // off the queue and create a session with them.
 func (m *MockOIDC) QueueUser(user User) {
-	m.UserQueue.Push(user)
+	m.users().Push(user)
+}
+
+// users is the UserStore, or the UserQueue if none is set
+func (m *MockOIDC) users() UserStore {
+	if m.UserStore != nil {
+		return m.UserStore
+	}
+	return m.UserQueue
+}
+
+// queueUserFirst queues a User ahead of the others. Custom UserStores get it
+// pushed at the back.
+func (m *MockOIDC) queueUserFirst(user User) {
+	if q, ok := m.users().(*UserQueue); ok {
+		q.pushFront(user)
+	} else {
+		m.users().Push(user)
+	}
+}
+
+// QueueUserWithCode queues a User whose login will issue the passed code, or
+// a random one if it's empty, and returns the code. Unlike queueing Users &
+// codes separately, codes map to their Users even if logins run
+// concurrently.
+func (m *MockOIDC) QueueUserWithCode(user User, code string) (string, error) {
+	if code == "" {
+		var err error
+		if code, err = randomNonce(24); err != nil {
+			return "", err
+		}
+	}
+	m.users().Push(&boundUser{User: user, code: code})
+	return code, nil
+}
+
+// sessionIDStore is implemented by SessionStores able to create Sessions
+// with preset IDs
+type sessionIDStore interface {
+	NewSessionWithID(sessionID, scope, nonce string, user User) (*Session, error)
 }
 
 // QueueCode allows adding mock code strings to the authentication queue.
@@ -168,7 +771,7 @@ func (m *MockOIDC) QueueUser(user User) {
 // off the queue and create a session with them and return them as the
 // code parameter in the response.
 func (m *MockOIDC) QueueCode(code string) {
-	m.SessionStore.CodeQueue.Push(code)
+	m.SessionStore.QueueCode(code)
 }
 
 // QueueError allows queueing arbitrary errors for the next handler calls
@@ -177,15 +780,99 @@ func (m *MockOIDC) QueueError(se *ServerError) {
 	m.ErrorQueue.Push(se)
 }
 
+// Reset clears the state tests accumulate: sessions, queued users, codes &
+// errors, device & pushed authorization requests, request counts, history &
+// expectations, the played Scenario, metrics and changes to time, and held
+// endpoints are released. The listener, keys and configuration are kept, so
+// one server can be reused cheaply across many subtests.
+func (m *MockOIDC) Reset() error {
+	if _, err := m.SessionStore.GC(func(*Session) bool { return true }); err != nil {
+		return err
+	}
+	if ss, ok := m.SessionStore.(*MemorySessionStore); ok {
+		ss.CodeQueue.Clear()
+	}
+	m.users().Clear()
+	m.ErrorQueue.Clear()
+	if m.RequestCounter != nil {
+		m.RequestCounter.Reset()
+	}
+	if m.RequestHistory != nil {
+		m.RequestHistory.Reset()
+	}
+	m.clearExpectations()
+	m.clearDevices()
+	m.clearPushedRequests()
+	m.releaseEndpoints()
+	m.Play(NewScenario())
+	if m.Metrics != nil {
+		m.Metrics.Reset()
+	}
+	m.clockMu.Lock()
+	m.fastForward = 0
+	m.frozenAt = m.epoch
+	m.clockMu.Unlock()
+	return nil
+}
+
 // FastForward moves the MockOIDC's internal view of time forward.
 // Use this to test token expirations in your tests.
 func (m *MockOIDC) FastForward(d time.Duration) time.Duration {
+	m.clockMu.Lock()
+	defer m.clockMu.Unlock()
 	m.fastForward = m.fastForward + d
 	return m.fastForward
 }
 
+// Rewind moves the MockOIDC's internal view of time back, e.g. to issue
+// tokens that are already expired.
+func (m *MockOIDC) Rewind(d time.Duration) time.Duration {
+	return m.FastForward(-d)
+}
+
+// SetTime moves the MockOIDC's internal view of time to t. It keeps running
+// from there unless frozen.
+func (m *MockOIDC) SetTime(t time.Time) {
+	m.clockMu.Lock()
+	defer m.clockMu.Unlock()
+	if m.frozenAt.IsZero() {
+		m.fastForward = t.Sub(NowFunc())
+	} else {
+		m.fastForward = t.Sub(m.frozenAt)
+	}
+}
+
+// FreezeTime stops the MockOIDC's internal view of time, so expiry
+// boundaries can be tested to the second. Use FastForward, Rewind & SetTime
+// to move it. It returns the frozen time.
+func (m *MockOIDC) FreezeTime() time.Time {
+	m.clockMu.Lock()
+	defer m.clockMu.Unlock()
+	if m.frozenAt.IsZero() {
+		m.frozenAt = NowFunc().Add(m.fastForward)
+		m.fastForward = 0
+	}
+	return m.frozenAt.Add(m.fastForward)
+}
+
+// UnfreezeTime lets the MockOIDC's internal view of time run again from
+// where it was stopped.
+func (m *MockOIDC) UnfreezeTime() {
+	m.clockMu.Lock()
+	defer m.clockMu.Unlock()
+	if !m.frozenAt.IsZero() {
+		m.fastForward = m.frozenAt.Add(m.fastForward).Sub(NowFunc())
+		m.frozenAt = time.Time{}
+	}
+}
+
 // Now is what MockOIDC thinks time.Now is
 func (m *MockOIDC) Now() time.Time {
+	m.clockMu.RLock()
+	defer m.clockMu.RUnlock()
+	if !m.frozenAt.IsZero() {
+		return m.frozenAt.Add(m.fastForward)
+	}
 	return NowFunc().Add(m.fastForward)
 }
 
@@ -214,12 +901,58 @@ func (m *MockOIDC) Addr() string {
 	return fmt.Sprintf("%s://%s", proto, m.Server.Addr)
 }
 
+// requestAddr returns the server address as seen by the client making the
+// request. This only differs from `Addr` behind a reverse proxy when
+// TrustForwardedHeaders is enabled.
+func (m *MockOIDC) requestAddr(req *http.Request) string {
+	addr := m.Addr()
+	if !m.TrustForwardedHeaders || addr == "" {
+		return addr
+	}
+	u, err := url.Parse(addr)
+	if err != nil {
+		return addr
+	}
+	if proto := forwardedHeader(req, "X-Forwarded-Proto"); proto != "" {
+		u.Scheme = proto
+	}
+	if host := forwardedHeader(req, "X-Forwarded-Host"); host != "" {
+		u.Host = host
+	}
+	prefix := strings.TrimSuffix(forwardedHeader(req, "X-Forwarded-Prefix"), "/")
+	return fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, prefix)
+}
+
+// forwardedHeader returns the value set by the proxy closest to the client
+// if multiple proxies appended to the header.
+func forwardedHeader(req *http.Request, header string) string {
+	value := strings.SplitN(req.Header.Get(header), ",", 2)[0]
+	return strings.TrimSpace(value)
+}
+
+// Port returns the TCP port the server is listening on (if started). This
+// is how the port is reported back when listening on port `0`.
+func (m *MockOIDC) Port() int {
+	if m.Server == nil {
+		return 0
+	}
+	_, port, err := net.SplitHostPort(m.Server.Addr)
+	if err != nil {
+		return 0
+	}
+	p, err := strconv.Atoi(port)
+	if err != nil {
+		return 0
+	}
+	return p
+}
+
 // Issuer returns the OIDC Issuer that will be in `iss` token claims
 func (m *MockOIDC) Issuer() string {
 	if m.Server == nil {
 		return ""
 	}
-	return m.Addr() + IssuerBase
+	return m.formatIssuer(m.Addr())
 }
 
 // DiscoveryEndpoint returns the full `/.well-known/openid-configuration` URL
@@ -227,7 +960,7 @@ func (m *MockOIDC) DiscoveryEndpoint() string {
 	if m.Server == nil {
 		return ""
 	}
-	return m.Addr() + DiscoveryEndpoint
+	return m.Addr() + m.endpointPath(DiscoveryEndpoint)
 }
 
 // AuthorizationEndpoint returns the OIDC `authorization_endpoint`
@@ -235,7 +968,7 @@ func (m *MockOIDC) AuthorizationEndpoint() string {
 	if m.Server == nil {
 		return ""
 	}
-	return m.Addr() + AuthorizationEndpoint
+	return m.Addr() + m.endpointPath(AuthorizationEndpoint)
 }
 
 // TokenEndpoint returns the OIDC `token_endpoint`
@@ -243,7 +976,7 @@ func (m *MockOIDC) TokenEndpoint() string {
 	if m.Server == nil {
 		return ""
 	}
-	return m.Addr() + TokenEndpoint
+	return m.Addr() + m.endpointPath(TokenEndpoint)
 }
 
 // UserinfoEndpoint returns the OIDC `userinfo_endpoint`
@@ -251,7 +984,7 @@ func (m *MockOIDC) UserinfoEndpoint() string {
 	if m.Server == nil {
 		return ""
 	}
-	return m.Addr() + UserinfoEndpoint
+	return m.Addr() + m.endpointPath(UserinfoEndpoint)
 }
 
 // JWKSEndpoint returns the OIDC `jwks_uri`
@@ -259,16 +992,128 @@ func (m *MockOIDC) JWKSEndpoint() string {
 	if m.Server == nil {
 		return ""
 	}
-	return m.Addr() + JWKSEndpoint
+	return m.Addr() + m.endpointPath(JWKSEndpoint)
+}
+
+// endpointPath moves one of the default `/oidc` endpoint paths under the
+// configured BasePath, unless it has one of the EndpointPaths.
+func (m *MockOIDC) endpointPath(endpoint string) string {
+	if path, ok := m.EndpointPaths[endpoint]; ok {
+		return path
+	}
+	return m.BasePath + strings.TrimPrefix(endpoint, IssuerBase)
 }
 
-func (m *MockOIDC) chainMiddleware(endpoint func(http.ResponseWriter, *http.Request)) http.Handler {
-	chain := m.forceError(http.HandlerFunc(endpoint))
+func (m *MockOIDC) chainMiddleware(endpoint string, handler func(http.ResponseWriter, *http.Request)) http.Handler {
+	chain := m.forceError(m.replayed(endpoint, http.HandlerFunc(handler)))
+	chain = m.holdable(endpoint, m.scripted(endpoint, chain))
 	for i := len(m.middleware) - 1; i >= 0; i-- {
 		mw := m.middleware[i]
 		chain = mw(chain)
 	}
-	return chain
+	return m.instrument(endpoint,
+		m.allowMethods(endpoint, m.dump(endpoint, m.record(endpoint, chain))))
+}
+
+// instrument wraps an endpoint handler to log each request and record its
+// Metrics.
+func (m *MockOIDC) instrument(endpoint string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		received := m.Now()
+		req, sessionID := withRequestSession(req)
+		sr := &statusRecorder{ResponseWriter: rw, code: http.StatusOK}
+		next.ServeHTTP(&errorWriter{ResponseWriter: sr, m: m, endpoint: endpoint}, req)
+		latency := time.Since(start)
+
+		// Handlers have parsed the form by now, unless an error was forced
+		_ = req.ParseForm()
+		grantType := ""
+		if endpoint == TokenEndpoint {
+			grantType = req.Form.Get("grant_type")
+		}
+		if m.Metrics != nil {
+			m.Metrics.Observe(endpoint, grantType, sr.code, latency)
+		}
+
+		clientID := req.Form.Get("client_id")
+		if user, _, ok := req.BasicAuth(); ok && clientID == "" {
+			clientID = user
+		}
+		if m.RequestCounter != nil {
+			m.RequestCounter.Increment(endpoint, clientID, grantType)
+		}
+		if m.RequestHistory != nil && !m.PerformanceMode {
+			m.RequestHistory.Record(CapturedRequest{
+				Endpoint:   endpoint,
+				Method:     req.Method,
+				Params:     cloneValues(req.Form),
+				Header:     req.Header.Clone(),
+				Time:       received,
+				StatusCode: sr.code,
+				SessionID:  *sessionID,
+			})
+		}
+		keysAndValues := []interface{}{
+			"endpoint", endpointName(endpoint),
+			"method", req.Method,
+			"client_id", clientID,
+			"grant_type", grantType,
+			"status", sr.code,
+			"latency", latency,
+		}
+		switch {
+		case sr.err != nil:
+			m.logger().Error("unable to write response",
+				append(keysAndValues, "error", sr.err)...)
+		case sr.code >= http.StatusBadRequest:
+			var body struct {
+				Error       string `json:"error"`
+				Description string `json:"error_description"`
+			}
+			_ = json.Unmarshal(sr.body.Bytes(), &body)
+			m.logger().Info("request failed", append(keysAndValues,
+				"error", body.Error, "error_description", body.Description)...)
+		default:
+			m.logger().Info("request", keysAndValues...)
+		}
+	})
+}
+
+func (m *MockOIDC) logger() Logger {
+	if m.Logger == nil {
+		return NopLogger()
+	}
+	return m.Logger
+}
+
+// statusRecorder captures the status code written by a handler, the body
+// of error responses and any error writing the response.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+	body bytes.Buffer
+	err  error
+}
+
+func (sr *statusRecorder) Unwrap() http.ResponseWriter {
+	return sr.ResponseWriter
+}
+
+func (sr *statusRecorder) WriteHeader(code int) {
+	sr.code = code
+	sr.ResponseWriter.WriteHeader(code)
+}
+
+func (sr *statusRecorder) Write(data []byte) (int, error) {
+	if sr.code >= http.StatusBadRequest && sr.body.Len() < 4096 {
+		sr.body.Write(data)
+	}
+	n, err := sr.ResponseWriter.Write(data)
+	if err != nil && sr.err == nil {
+		sr.err = err
+	}
+	return n, err
 }
 
 func (m *MockOIDC) forceError(next http.Handler) http.Handler {
@@ -2,12 +2,17 @@ package mockoidc_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -18,8 +23,10 @@ import (
 
 const TestNow = 1234567890
 
-// A custom client that doesn't automatically follow redirects
+// A custom client that doesn't automatically follow redirects. Pooled
+// connections are disabled as spare ones delay server shutdowns by seconds.
 var httpClient = &http.Client{
+	Transport: &http.Transport{DisableKeepAlives: true},
 	CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
 		return http.ErrUseLastResponse
 	},
@@ -222,6 +229,121 @@ func TestRun(t *testing.T) {
 	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
 }
 
+func TestMockOIDC_StartContext(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	addr := ln.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = m.StartContext(ctx, ln, nil)
+	assert.NoError(t, err)
+
+	resp, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	cancel()
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return true
+		}
+		conn.Close()
+		return false
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMockOIDC_ShutdownContext(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	err = m.AddMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			close(started)
+			<-release
+			next.ServeHTTP(rw, req)
+		})
+	})
+	assert.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	err = m.Start(ln, nil)
+	assert.NoError(t, err)
+
+	inFlight := make(chan int)
+	go func() {
+		resp, err := httpClient.Get(m.DiscoveryEndpoint())
+		if err != nil {
+			inFlight <- 0
+			return
+		}
+		resp.Body.Close()
+		inFlight <- resp.StatusCode
+	}()
+	<-started
+
+	// An expired context doesn't wait for the in-flight request
+	expired, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Error(t, m.ShutdownContext(expired))
+
+	close(release)
+	assert.NoError(t, m.ShutdownContext(context.Background()))
+	assert.Equal(t, http.StatusOK, <-inFlight)
+}
+
+func TestMockOIDC_Timeouts(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.ReadHeaderTimeout = 50 * time.Millisecond
+	m.WriteTimeout = 50 * time.Millisecond
+
+	err = m.AddMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+			if req.URL.Query().Get("slow") != "" {
+				time.Sleep(100 * time.Millisecond)
+			}
+			next.ServeHTTP(rw, req)
+		})
+	})
+	assert.NoError(t, err)
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	err = m.Start(ln, nil)
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	assert.Equal(t, m.ReadHeaderTimeout, m.Server.ReadHeaderTimeout)
+	assert.Equal(t, m.WriteTimeout, m.Server.WriteTimeout)
+
+	resp, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Handlers slower than the WriteTimeout have their connection dropped
+	_, err = httpClient.Get(m.DiscoveryEndpoint() + "?slow=true")
+	assert.Error(t, err)
+
+	// Clients slower than the ReadHeaderTimeout have their connection dropped
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte("GET / HTTP/1.1\r\n"))
+	assert.NoError(t, err)
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = ioutil.ReadAll(conn)
+	assert.NoError(t, err)
+}
+
 func TestMockOIDC_Config(t *testing.T) {
 	m, err := mockoidc.Run()
 	assert.NoError(t, err)
@@ -235,6 +357,88 @@ func TestMockOIDC_Config(t *testing.T) {
 	assert.Equal(t, m.RefreshTTL, cfg.RefreshTTL)
 }
 
+func TestRunAddr(t *testing.T) {
+	m, err := mockoidc.RunAddr("127.0.0.1:0", nil)
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	assert.NotZero(t, m.Port())
+	assert.Equal(t, fmt.Sprintf("http://127.0.0.1:%d", m.Port()), m.Addr())
+
+	resp, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRunUnix(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "mockoidc.sock")
+	m, err := mockoidc.RunUnix(socket, nil)
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	assert.Zero(t, m.Port())
+	assert.Equal(t, "http://localhost/oidc", m.Issuer())
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	resp, err := client.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestMockOIDC_BasePath(t *testing.T) {
+	for name, basePath := range map[string]string{
+		"root":   "",
+		"tenant": "/tenants/acme",
+	} {
+		t.Run(name, func(t *testing.T) {
+			m, err := mockoidc.NewServer(nil)
+			assert.NoError(t, err)
+			m.BasePath = basePath
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+			err = m.Start(ln, nil)
+			assert.NoError(t, err)
+			defer m.Shutdown()
+
+			assert.Equal(t, m.Addr()+basePath, m.Issuer())
+			assert.Equal(t, m.Addr()+basePath+"/authorize", m.AuthorizationEndpoint())
+			assert.Equal(t, m.Addr()+basePath+"/token", m.TokenEndpoint())
+			assert.Equal(t, m.Addr()+basePath+"/userinfo", m.UserinfoEndpoint())
+			assert.Equal(t, m.Addr()+basePath+"/.well-known/jwks.json", m.JWKSEndpoint())
+			assert.Equal(t, m.Addr()+basePath+"/.well-known/openid-configuration",
+				m.DiscoveryEndpoint())
+
+			resp, err := httpClient.Get(m.DiscoveryEndpoint())
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			discovery := make(map[string]interface{})
+			err = json.NewDecoder(resp.Body).Decode(&discovery)
+			assert.NoError(t, err)
+			assert.Equal(t, m.Issuer(), discovery["issuer"])
+			assert.Equal(t, m.TokenEndpoint(), discovery["token_endpoint"])
+
+			// The default `/oidc` paths aren't served
+			if basePath != mockoidc.IssuerBase {
+				resp, err := httpClient.Get(m.Addr() + mockoidc.DiscoveryEndpoint)
+				assert.NoError(t, err)
+				defer resp.Body.Close()
+				assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+			}
+		})
+	}
+}
+
 func TestMockOIDC_QueueError(t *testing.T) {
 	m, err := mockoidc.Run()
 	assert.NoError(t, err)
@@ -354,6 +558,63 @@ func TestMockOIDC_FastForward(t *testing.T) {
 	assert.Equal(t, mockoidc.NowFunc().Add(time.Duration(579)), m.Now())
 }
 
+func TestMockOIDC_ClockControl(t *testing.T) {
+	now := time.Unix(TestNow, 0)
+	mockoidc.NowFunc = func() time.Time { return now }
+	defer resetTime()
+
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	frozen := m.FreezeTime()
+	assert.Equal(t, now, frozen)
+	now = now.Add(time.Hour)
+	assert.Equal(t, frozen, m.Now())
+
+	m.FastForward(time.Minute)
+	assert.Equal(t, frozen.Add(time.Minute), m.Now())
+	m.Rewind(2 * time.Minute)
+	assert.Equal(t, frozen.Add(-time.Minute), m.Now())
+
+	target := time.Date(2030, time.June, 1, 12, 0, 0, 0, time.UTC)
+	m.SetTime(target)
+	assert.True(t, target.Equal(m.Now()))
+	assert.True(t, target.Equal(m.FreezeTime()))
+
+	m.UnfreezeTime()
+	assert.True(t, target.Equal(m.Now()))
+	now = now.Add(time.Second)
+	assert.True(t, target.Add(time.Second).Equal(m.Now()))
+
+	m.SetTime(target)
+	assert.True(t, target.Equal(m.Now()))
+
+	assert.NoError(t, m.Reset())
+	assert.Equal(t, now, m.Now())
+}
+
+func TestMockOIDC_ClockControl_ExpiryBoundary(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	issued := m.FreezeTime()
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+
+	userinfo := func() int {
+		req, err := http.NewRequest(http.MethodGet, m.UserinfoEndpoint(), nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		resp, err := httpClient.Do(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	m.SetTime(issued.Add(m.AccessTTL - time.Second))
+	assert.Equal(t, http.StatusOK, userinfo())
+	m.SetTime(issued.Add(m.AccessTTL + time.Second))
+	assert.Equal(t, http.StatusUnauthorized, userinfo())
+}
+
 func setTime() {
 	mockoidc.NowFunc = func() time.Time {
 		return time.Unix(TestNow, 0)
@@ -367,3 +628,434 @@ func resetTime() {
 	mockoidc.NowFunc = time.Now
 	jwt.TimeFunc = time.Now
 }
+
+func TestMockOIDC_SetClientSecret(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	tokenForm := func(secret string) url.Values {
+		session, err := m.SessionStore.NewSession("openid", "", mockoidc.DefaultUser())
+		assert.NoError(t, err)
+		form := url.Values{}
+		form.Set("client_id", m.Config().ClientID)
+		form.Set("client_secret", secret)
+		form.Set("grant_type", "authorization_code")
+		form.Set("code", session.SessionID)
+		return form
+	}
+	oldSecret := m.Config().ClientSecret
+
+	// Rotate while requests are in flight
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			m.SetClientSecret(fmt.Sprintf("rotating-%d", i))
+			m.SetAccessTTL(time.Duration(i+1) * time.Minute)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		resp, err := httpClient.PostForm(m.TokenEndpoint(), tokenForm(oldSecret))
+		assert.NoError(t, err)
+		resp.Body.Close()
+	}
+	<-done
+
+	m.SetClientSecret("rotated")
+	resp, err := httpClient.PostForm(m.TokenEndpoint(), tokenForm(oldSecret))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	resp, err = httpClient.PostForm(m.TokenEndpoint(), tokenForm("rotated"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "rotated", m.Config().ClientSecret)
+}
+
+func TestMockOIDC_SetScopesSupported(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+	m.SetScopesSupported([]string{"openid", "custom"})
+
+	resp, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	discovery := make(map[string]interface{})
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&discovery))
+	assert.Equal(t, []interface{}{"openid", "custom"}, discovery["scopes_supported"])
+
+	authorizeQuery := url.Values{}
+	authorizeQuery.Set("client_id", m.ClientID)
+	authorizeQuery.Set("response_type", "code")
+	authorizeQuery.Set("redirect_uri", "http://127.0.0.1/oauth2/callback")
+	authorizeQuery.Set("state", "state")
+	for scope, authErr := range map[string]string{
+		"openid custom": "",
+		"openid email":  mockoidc.InvalidScope,
+	} {
+		authorizeQuery.Set("scope", scope)
+		resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + authorizeQuery.Encode())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusFound, resp.StatusCode, scope)
+		location, err := resp.Location()
+		assert.NoError(t, err)
+		assert.Equal(t, authErr, location.Query().Get("error"), scope)
+	}
+}
+
+func TestMockOIDC_MetadataSetters(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+	m.SetGrantTypesSupported([]string{"authorization_code"})
+	m.SetResponseTypesSupported([]string{"code"})
+	m.SetSubjectTypesSupported([]string{"pairwise"})
+	m.SetIDTokenSigningAlgValuesSupported([]string{"RS256"})
+	m.SetTokenEndpointAuthMethodsSupported([]string{"client_secret_basic"})
+	m.SetCodeChallengeMethodsSupported([]string{"S256"})
+	m.SetClaimsSupported([]string{"sub", "email"})
+
+	other, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer other.Shutdown()
+
+	discovery := func(m *mockoidc.MockOIDC) map[string]interface{} {
+		resp, err := httpClient.Get(m.DiscoveryEndpoint())
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		d := make(map[string]interface{})
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&d))
+		return d
+	}
+	d := discovery(m)
+	assert.Equal(t, []interface{}{"authorization_code"}, d["grant_types_supported"])
+	assert.Equal(t, []interface{}{"code"}, d["response_types_supported"])
+	assert.Equal(t, []interface{}{"pairwise"}, d["subject_types_supported"])
+	assert.Equal(t, []interface{}{"RS256"}, d["id_token_signing_alg_values_supported"])
+	assert.Equal(t, []interface{}{"client_secret_basic"}, d["token_endpoint_auth_methods_supported"])
+	assert.Equal(t, []interface{}{"S256"}, d["code_challenge_methods_supported"])
+	assert.Equal(t, []interface{}{"sub", "email"}, d["claims_supported"])
+	assert.Contains(t, discovery(other)["grant_types_supported"], "refresh_token")
+
+	form := url.Values{}
+	form.Set("grant_type", "refresh_token")
+	form.Set("refresh_token", "unused")
+	req, err := http.NewRequest(http.MethodPost, m.TokenEndpoint(), strings.NewReader(form.Encode()))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(m.ClientID, m.ClientSecret)
+	resp, err := httpClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body := make(map[string]interface{})
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, mockoidc.UnsupportedGrantType, body["error"])
+}
+
+func TestMockOIDC_DerivedMetadata(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	m.SetScopesSupported([]string{"openid", "email"})
+	m.SetTokenEndpointAuthMethodsSupported([]string{"client_secret_post", "client_secret_jwt"})
+
+	resp, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	discovery := make(map[string]interface{})
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&discovery))
+	assert.Equal(t, []interface{}{"sub", "email", "email_verified", "iss", "aud"},
+		discovery["claims_supported"])
+	assert.Equal(t, []interface{}{"client_secret_post"},
+		discovery["token_endpoint_auth_methods_supported"])
+
+	// client_secret_basic isn't accepted anymore
+	req, err := http.NewRequest(http.MethodPost, m.TokenEndpoint(),
+		strings.NewReader(url.Values{"grant_type": {"refresh_token"}}.Encode()))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(m.ClientID, m.ClientSecret)
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestMockOIDC_UnimplementedCapabilities(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	m.SetGrantTypesSupported([]string{"password", "refresh_token", "authorization_code"})
+	m.SetResponseTypesSupported([]string{"none"})
+
+	resp, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	discovery := make(map[string]interface{})
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&discovery))
+	assert.Equal(t, []interface{}{"refresh_token", "authorization_code"},
+		discovery["grant_types_supported"])
+	assert.Equal(t, []interface{}{}, discovery["response_types_supported"])
+
+	req, err := http.NewRequest(http.MethodPost, m.TokenEndpoint(),
+		strings.NewReader(url.Values{"grant_type": {"password"}}.Encode()))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(m.ClientID, m.ClientSecret)
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	assert.EqualError(t, responseError("token", resp, http.StatusOK),
+		"token: 400 "+mockoidc.UnsupportedGrantType)
+
+	// The code response type isn't enabled anymore
+	resp, err = httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+		"client_id":     {m.ClientID},
+		"response_type": {"code"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"scope":         {"openid"},
+		"state":         {"state"},
+	}.Encode())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	location, err := resp.Location()
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.UnsupportedResponseType, location.Query().Get("error"))
+}
+
+func TestMockOIDC_DisabledCapabilities(t *testing.T) {
+	for _, performance := range []bool{false, true} {
+		m := mockoidc.RunTB(t, func(m *mockoidc.MockOIDC) error {
+			m.PerformanceMode = performance
+			return nil
+		})
+		discovery := func() map[string]interface{} {
+			resp, err := httpClient.Get(m.DiscoveryEndpoint())
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			doc := make(map[string]interface{})
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+			return doc
+		}
+		post := func(endpoint string, form url.Values) error {
+			req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+			assert.NoError(t, err)
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.SetBasicAuth(m.ClientID, m.ClientSecret)
+			resp, err := httpClient.Do(req)
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			return responseError("post", resp, http.StatusOK)
+		}
+		authorize := func(responseType string) string {
+			resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+				"client_id":     {m.ClientID},
+				"response_type": {responseType},
+				"redirect_uri":  {"https://app.example.com/callback"},
+				"scope":         {"openid"},
+				"state":         {"state"},
+				"nonce":         {"nonce"},
+			}.Encode())
+			assert.NoError(t, err)
+			resp.Body.Close()
+			location, err := resp.Location()
+			assert.NoError(t, err)
+			fragment, err := url.ParseQuery(location.Fragment)
+			assert.NoError(t, err)
+			return fragment.Get("error")
+		}
+
+		assert.Contains(t, discovery()["grant_types_supported"], "client_credentials")
+		assert.NoError(t, post(m.TokenEndpoint(), url.Values{"grant_type": {"client_credentials"}}))
+		assert.Empty(t, authorize("id_token"))
+
+		m.DisableClientCredentials = true
+		m.DisableDeviceFlow = true
+		m.DisableImplicitFlow = true
+		m.DisableHybridFlow = true
+		doc := discovery()
+		assert.Equal(t, []interface{}{"authorization_code", "refresh_token"}, doc["grant_types_supported"])
+		assert.Equal(t, []interface{}{"code"}, doc["response_types_supported"])
+		assert.NotContains(t, doc, "device_authorization_endpoint")
+
+		assert.EqualError(t, post(m.TokenEndpoint(), url.Values{"grant_type": {"client_credentials"}}),
+			"post: 400 "+mockoidc.UnsupportedGrantType)
+		assert.EqualError(t, post(m.DeviceAuthorizationEndpoint(), url.Values{"client_id": {m.ClientID}}),
+			"post: 400 "+mockoidc.UnauthorizedClient)
+		assert.Equal(t, mockoidc.UnsupportedResponseType, authorize("id_token"))
+		assert.Equal(t, mockoidc.UnsupportedResponseType, authorize("code id_token"))
+	}
+}
+
+func TestMockOIDC_SetDiscoveryExtras(t *testing.T) {
+	for _, performance := range []bool{false, true} {
+		m, err := mockoidc.NewServer(nil)
+		assert.NoError(t, err)
+		m.PerformanceMode = performance
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		assert.NoError(t, m.Start(ln, nil))
+
+		discovery := func() map[string]interface{} {
+			resp, err := httpClient.Get(m.DiscoveryEndpoint())
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			d := make(map[string]interface{})
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&d))
+			return d
+		}
+		assert.NotContains(t, discovery(), "tenant_region_scope")
+
+		m.SetDiscoveryExtras(map[string]interface{}{
+			"tenant_region_scope":     "EU",
+			"subject_types_supported": []string{"pairwise"},
+		})
+		d := discovery()
+		assert.Equal(t, "EU", d["tenant_region_scope"])
+		assert.Equal(t, []interface{}{"pairwise"}, d["subject_types_supported"])
+		assert.Equal(t, m.Issuer(), d["issuer"])
+
+		m.SetDiscoveryExtras(nil)
+		assert.NotContains(t, discovery(), "tenant_region_scope")
+		assert.NoError(t, m.Shutdown())
+	}
+}
+
+func TestMockOIDC_ParallelInstances(t *testing.T) {
+	for i, scope := range []string{"first", "second"} {
+		i, scope := i, scope
+		t.Run(scope, func(t *testing.T) {
+			t.Parallel()
+
+			m, err := mockoidc.NewServer(nil)
+			assert.NoError(t, err)
+			client := m.Client()
+			m.SetScopesSupported([]string{"openid", scope})
+			// Each instance has its own view of time without Synchronize
+			m.FastForward(time.Duration(i+1) * 24 * time.Hour)
+
+			session, err := m.SessionStore.NewSession("openid "+scope, "", mockoidc.DefaultUser())
+			assert.NoError(t, err)
+			refreshToken, err := session.RefreshToken(m.Config(), m.Keypair, m.Now())
+			assert.NoError(t, err)
+
+			form := url.Values{}
+			form.Set("client_id", m.ClientID)
+			form.Set("client_secret", m.ClientSecret)
+			form.Set("grant_type", "refresh_token")
+			form.Set("refresh_token", refreshToken)
+			resp, err := client.PostForm(m.TokenEndpoint(), form)
+			assert.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			resp, err = client.Get(m.DiscoveryEndpoint())
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			discovery := make(map[string]interface{})
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&discovery))
+			assert.Equal(t, []interface{}{"openid", scope}, discovery["scopes_supported"])
+		})
+	}
+}
+
+func TestNewServer_CopiesDefaults(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	original := mockoidc.ScopesSupported
+	mockoidc.ScopesSupported = []string{"openid"}
+	defer func() { mockoidc.ScopesSupported = original }()
+
+	rr := httptest.NewRecorder()
+	m.Discovery(rr, httptest.NewRequest(http.MethodGet, mockoidc.DiscoveryEndpoint, nil))
+	discovery := make(map[string]interface{})
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&discovery))
+	assert.Len(t, discovery["scopes_supported"], len(original))
+}
+
+func TestMockOIDC_Reset(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+	issuer, keypair := m.Issuer(), m.Keypair
+
+	session, err := m.SessionStore.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+	m.QueueUser(&mockoidc.MockUser{Subject: "queued"})
+	m.QueueCode("queued-code")
+	m.QueueError(&mockoidc.ServerError{Code: http.StatusInternalServerError})
+	m.FastForward(time.Hour)
+	resp, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	// Drained so the connection is reused instead of delaying Shutdown
+	_, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+
+	assert.NoError(t, m.Reset())
+
+	_, err = m.SessionStore.GetSessionByID(session.SessionID)
+	assert.Error(t, err)
+	assert.Equal(t, mockoidc.DefaultUser().ID(), m.UserQueue.Pop().ID())
+	assert.Nil(t, m.ErrorQueue.Pop())
+	code, err := m.SessionStore.(*mockoidc.MemorySessionStore).CodeQueue.Pop()
+	assert.NoError(t, err)
+	assert.NotEqual(t, "queued-code", code)
+	assert.Empty(t, m.RequestCounter.Counts())
+	assert.WithinDuration(t, time.Now(), m.Now(), time.Minute)
+
+	// The server keeps serving with the same issuer & keys
+	assert.Equal(t, issuer, m.Issuer())
+	assert.Same(t, keypair, m.Keypair)
+	resp, err = httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestMockOIDC_Run(t *testing.T) {
+	for name, stop := range map[string]func(cancel context.CancelFunc){
+		"context": func(cancel context.CancelFunc) { cancel() },
+		"signal": func(_ context.CancelFunc) {
+			p, err := os.FindProcess(os.Getpid())
+			assert.NoError(t, err)
+			if err = p.Signal(os.Interrupt); err != nil {
+				t.Skipf("unable to signal: %v", err)
+			}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m, err := mockoidc.NewServer(nil)
+			assert.NoError(t, err)
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+			discovery := "http://" + ln.Addr().String() + mockoidc.DiscoveryEndpoint
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error)
+			go func() { done <- m.Run(ctx, ln, nil) }()
+
+			assert.Eventually(t, func() bool {
+				resp, err := httpClient.Get(discovery)
+				if err != nil {
+					return false
+				}
+				resp.Body.Close()
+				return resp.StatusCode == http.StatusOK
+			}, time.Second, 10*time.Millisecond)
+
+			stop(cancel)
+			select {
+			case err = <-done:
+				assert.NoError(t, err)
+			case <-time.After(time.Second):
+				t.Fatal("Run didn't return")
+			}
+			_, err = httpClient.Get(discovery)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package mockoidc
+
+import "golang.org/x/oauth2"
+
+// OAuth2Config returns an `oauth2.Config` for this MockOIDC's client, with
+// its endpoints and the `openid` scope, to wire golang.org/x/oauth2 based
+// relying parties to it. The server must be started first.
+func (m *MockOIDC) OAuth2Config(redirectURI string) *oauth2.Config {
+	config := m.Config()
+	return &oauth2.Config{
+		ClientID:     config.ClientID,
+		ClientSecret: config.ClientSecret,
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  m.AuthorizationEndpoint(),
+			TokenURL: m.TokenEndpoint(),
+			// The token_endpoint reads the client credentials from the form
+			AuthStyle: oauth2.AuthStyleInParams,
+		},
+		RedirectURL: redirectURI,
+		Scopes:      []string{"openid"},
+	}
+}
@@ -0,0 +1,32 @@
+package mockoidc_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/oauth2"
+)
+
+func TestMockOIDC_OAuth2Config(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	config := m.OAuth2Config("https://app.example.com/callback")
+	config.Scopes = append(config.Scopes, "email")
+
+	resp, err := httpClient.Get(config.AuthCodeURL("state"))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := resp.Location()
+	assert.NoError(t, err)
+	assert.Equal(t, "app.example.com", location.Host)
+
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, httpClient)
+	token, err := config.Exchange(ctx, location.Query().Get("code"))
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token.AccessToken)
+	assert.NotEmpty(t, token.RefreshToken)
+	assert.NotEmpty(t, token.Extra("id_token"))
+}
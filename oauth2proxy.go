@@ -0,0 +1,96 @@
+package mockoidc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// OAuth2ProxyConfig is an oauth2-proxy configuration pointing at a MockOIDC
+type OAuth2ProxyConfig struct {
+	Provider      string
+	OIDCIssuerURL string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	CookieSecret  string
+	CookieSecure  bool
+	EmailDomains  []string
+}
+
+// OAuth2ProxyConfig returns an oauth2-proxy configuration for this
+// MockOIDC's client and a fresh cookie secret, allowing any email domain.
+// Render it as flags, a config file or environment variables. The server
+// must be started first.
+func (m *MockOIDC) OAuth2ProxyConfig(redirectURL string) (*OAuth2ProxyConfig, error) {
+	cookieSecret, err := randomNonce(24)
+	if err != nil {
+		return nil, err
+	}
+	config := m.Config()
+	return &OAuth2ProxyConfig{
+		Provider:      "oidc",
+		OIDCIssuerURL: config.Issuer,
+		ClientID:      config.ClientID,
+		ClientSecret:  config.ClientSecret,
+		RedirectURL:   redirectURL,
+		CookieSecret:  cookieSecret,
+		CookieSecure:  strings.HasPrefix(redirectURL, "https://"),
+		EmailDomains:  []string{"*"},
+	}, nil
+}
+
+// options are the oauth2-proxy options set by the config, by their config
+// file name
+func (c *OAuth2ProxyConfig) options() [][2]string {
+	return [][2]string{
+		{"provider", c.Provider},
+		{"oidc_issuer_url", c.OIDCIssuerURL},
+		{"client_id", c.ClientID},
+		{"client_secret", c.ClientSecret},
+		{"redirect_url", c.RedirectURL},
+		{"cookie_secret", c.CookieSecret},
+		{"cookie_secure", strconv.FormatBool(c.CookieSecure)},
+		{"email_domains", strings.Join(c.EmailDomains, ",")},
+	}
+}
+
+// Flags renders the config as oauth2-proxy command line flags
+func (c *OAuth2ProxyConfig) Flags() []string {
+	var flags []string
+	for _, option := range c.options() {
+		flags = append(flags, fmt.Sprintf("--%s=%s",
+			strings.ReplaceAll(option[0], "_", "-"), option[1]))
+	}
+	return flags
+}
+
+// Env renders the config as oauth2-proxy environment variables
+func (c *OAuth2ProxyConfig) Env() []string {
+	var env []string
+	for _, option := range c.options() {
+		env = append(env, fmt.Sprintf("OAUTH2_PROXY_%s=%s",
+			strings.ToUpper(option[0]), option[1]))
+	}
+	return env
+}
+
+// ConfigFile renders the config in oauth2-proxy's TOML config file format
+func (c *OAuth2ProxyConfig) ConfigFile() string {
+	var b strings.Builder
+	for _, option := range c.options() {
+		switch option[0] {
+		case "cookie_secure":
+			fmt.Fprintf(&b, "%s = %s\n", option[0], option[1])
+		case "email_domains":
+			quoted := make([]string, len(c.EmailDomains))
+			for i, domain := range c.EmailDomains {
+				quoted[i] = strconv.Quote(domain)
+			}
+			fmt.Fprintf(&b, "%s = [%s]\n", option[0], strings.Join(quoted, ", "))
+		default:
+			fmt.Fprintf(&b, "%s = %s\n", option[0], strconv.Quote(option[1]))
+		}
+	}
+	return b.String()
+}
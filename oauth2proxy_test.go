@@ -0,0 +1,41 @@
+package mockoidc_test
+
+import (
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_OAuth2ProxyConfig(t *testing.T) {
+	m := mockoidc.RunTB(t)
+
+	config, err := m.OAuth2ProxyConfig("http://localhost:4180/oauth2/callback")
+	assert.NoError(t, err)
+	assert.Equal(t, "oidc", config.Provider)
+	assert.Equal(t, m.Issuer(), config.OIDCIssuerURL)
+	assert.Len(t, config.CookieSecret, 32)
+	assert.False(t, config.CookieSecure)
+
+	assert.Equal(t, []string{
+		"--provider=oidc",
+		"--oidc-issuer-url=" + m.Issuer(),
+		"--client-id=" + m.ClientID,
+		"--client-secret=" + m.ClientSecret,
+		"--redirect-url=http://localhost:4180/oauth2/callback",
+		"--cookie-secret=" + config.CookieSecret,
+		"--cookie-secure=false",
+		"--email-domains=*",
+	}, config.Flags())
+	assert.Contains(t, config.Env(), "OAUTH2_PROXY_OIDC_ISSUER_URL="+m.Issuer())
+	assert.Contains(t, config.Env(), "OAUTH2_PROXY_EMAIL_DOMAINS=*")
+
+	file := config.ConfigFile()
+	assert.Contains(t, file, `oidc_issuer_url = "`+m.Issuer()+`"`+"\n")
+	assert.Contains(t, file, "cookie_secure = false\n")
+	assert.Contains(t, file, `email_domains = ["*"]`+"\n")
+
+	config, err = m.OAuth2ProxyConfig("https://app.example.com/oauth2/callback")
+	assert.NoError(t, err)
+	assert.True(t, config.CookieSecure)
+}
@@ -0,0 +1,34 @@
+package mockoidc
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider discovers this started MockOIDC with `coreos/go-oidc` and
+// returns the Provider with an IDTokenVerifier for its client. The verifier
+// checks expiry against the MockOIDC's clock, so fast-forwarded time
+// applies. Unless the context carries its own `oidc.ClientContext`, discovery
+// & key requests reach the server in-process or skip TLS verification.
+func (m *MockOIDC) OIDCProvider(ctx context.Context) (*oidc.Provider, *oidc.IDTokenVerifier, error) {
+	if !m.started() {
+		return nil, nil, errors.New("server not started")
+	}
+	if _, ok := ctx.Value(oauth2.HTTPClient).(*http.Client); !ok {
+		ctx = oidc.ClientContext(ctx, m.selfClient())
+	}
+
+	provider, err := oidc.NewProvider(ctx, m.Issuer())
+	if err != nil {
+		return nil, nil, err
+	}
+	verifier := provider.Verifier(&oidc.Config{
+		ClientID: m.Config().ClientID,
+		Now:      m.Now,
+	})
+	return provider, verifier, nil
+}
@@ -0,0 +1,44 @@
+package mockoidc_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_OIDCProvider(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	ctx := context.Background()
+
+	provider, verifier, err := m.OIDCProvider(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, m.TokenEndpoint(), provider.Endpoint().TokenURL)
+
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	idToken, err := verifier.Verify(ctx, tokens.IDToken)
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.DefaultUser().ID(), idToken.Subject)
+
+	m.FastForward(2 * m.AccessTTL)
+	_, err = verifier.Verify(ctx, tokens.IDToken)
+	assert.Error(t, err)
+}
+
+func TestMockOIDC_OIDCProvider_InProcess(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	_, _, err = m.OIDCProvider(context.Background())
+	assert.EqualError(t, err, "server not started")
+
+	m.Transport()
+	_, verifier, err := m.OIDCProvider(context.Background())
+	assert.NoError(t, err)
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	_, err = verifier.Verify(context.Background(), tokens.IDToken)
+	assert.NoError(t, err)
+}
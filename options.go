@@ -0,0 +1,166 @@
+package mockoidc
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Option configures the MockOIDC created by `New`
+type Option func(m *MockOIDC) error
+
+// New creates a MockOIDC server like `NewServer(nil)` and applies the opts.
+// The first failing Option's error is returned.
+func New(opts ...Option) (*MockOIDC, error) {
+	m, err := NewServer(nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		if err = opt(m); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// WithTLS serves the MockOIDC with the tls.Config, e.g. from
+// `NewCertificate`, when RunTB starts it
+func WithTLS(cfg *tls.Config) Option {
+	return func(m *MockOIDC) error {
+		m.tlsConfig = cfg
+		return nil
+	}
+}
+
+// WithClientCredentials sets the ClientID & ClientSecret
+func WithClientCredentials(clientID, clientSecret string) Option {
+	return func(m *MockOIDC) error {
+		if clientID == "" {
+			return errors.New("client id is empty")
+		}
+		m.SetClientID(clientID)
+		m.SetClientSecret(clientSecret)
+		return nil
+	}
+}
+
+// WithAccessTTL sets the AccessTTL
+func WithAccessTTL(ttl time.Duration) Option {
+	return func(m *MockOIDC) error {
+		if ttl <= 0 {
+			return fmt.Errorf("access ttl %s is not positive", ttl)
+		}
+		m.SetAccessTTL(ttl)
+		return nil
+	}
+}
+
+// WithRefreshTTL sets the RefreshTTL
+func WithRefreshTTL(ttl time.Duration) Option {
+	return func(m *MockOIDC) error {
+		if ttl <= 0 {
+			return fmt.Errorf("refresh ttl %s is not positive", ttl)
+		}
+		m.SetRefreshTTL(ttl)
+		return nil
+	}
+}
+
+// WithKeypair signs tokens with the Keypair instead of the default one
+func WithKeypair(keypair *Keypair) Option {
+	return func(m *MockOIDC) error {
+		if keypair == nil {
+			return errors.New("keypair is nil")
+		}
+		m.Keypair = keypair
+		return nil
+	}
+}
+
+// WithClientKeypair lets the configured client authenticate with
+// `private_key_jwt` assertions & sign request objects with the Keypair
+func WithClientKeypair(keypair *Keypair) Option {
+	return func(m *MockOIDC) error {
+		if keypair == nil {
+			return errors.New("client keypair is nil")
+		}
+		m.ClientKeypair = keypair
+		return nil
+	}
+}
+
+// WithScopes sets the scopes the server accepts & advertises
+func WithScopes(scopes ...string) Option {
+	return func(m *MockOIDC) error {
+		if len(scopes) == 0 {
+			return errors.New("no scopes are supported")
+		}
+		m.SetScopesSupported(scopes)
+		return nil
+	}
+}
+
+// WithSigningAlg sets the algorithm tokens are signed with, RS256, PS256 or
+// ES256. It sets the Alg of the Keypair, so pass it after WithKeypair;
+// ES256 replaces an RSA Keypair with a random `NewECKeypair`.
+func WithSigningAlg(alg string) Option {
+	return func(m *MockOIDC) error {
+		switch alg {
+		case jwt.SigningMethodRS256.Alg(), jwt.SigningMethodPS256.Alg():
+			if m.Keypair.ECPrivateKey != nil {
+				return fmt.Errorf("the Keypair's EC key can't sign %s", alg)
+			}
+			m.Keypair.Alg = alg
+		case jwt.SigningMethodES256.Alg():
+			if m.Keypair.ECPrivateKey == nil {
+				keypair, err := NewECKeypair(nil)
+				if err != nil {
+					return err
+				}
+				m.Keypair = keypair
+			}
+		default:
+			return fmt.Errorf("unsupported signing alg %s", alg)
+		}
+		m.updateMetadata(func(md *metadata) {
+			md.idTokenSigningAlgs = []string{alg}
+		})
+		return nil
+	}
+}
+
+// WithBasePath serves the endpoints under the path instead of `IssuerBase`
+func WithBasePath(path string) Option {
+	return func(m *MockOIDC) error {
+		m.BasePath = path
+		return nil
+	}
+}
+
+// WithStores sets the non-nil stores, as with `NewServerWithStores`
+func WithStores(stores Stores) Option {
+	return func(m *MockOIDC) error {
+		if stores.Users != nil {
+			m.UserStore = stores.Users
+		}
+		if stores.Clients != nil {
+			m.ClientStore = stores.Clients
+		}
+		if stores.Sessions != nil {
+			m.SessionStore = stores.Sessions
+		}
+		return nil
+	}
+}
+
+// WithLogger sets the Logger
+func WithLogger(logger Logger) Option {
+	return func(m *MockOIDC) error {
+		m.Logger = logger
+		return nil
+	}
+}
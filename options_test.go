@@ -0,0 +1,82 @@
+package mockoidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	keypair, err := mockoidc.NewKeypair(key)
+	assert.NoError(t, err)
+
+	m, err := mockoidc.New(
+		mockoidc.WithClientCredentials("my-client", "my-secret"),
+		mockoidc.WithAccessTTL(time.Minute),
+		mockoidc.WithRefreshTTL(time.Hour),
+		mockoidc.WithKeypair(keypair),
+		mockoidc.WithScopes("openid", "email"),
+		mockoidc.WithSigningAlg("RS256"),
+		mockoidc.WithBasePath("/tenants/acme"),
+	)
+	assert.NoError(t, err)
+	assert.Equal(t, "my-client", m.ClientID)
+	assert.Equal(t, "my-secret", m.ClientSecret)
+	assert.Equal(t, time.Minute, m.AccessTTL)
+	assert.Equal(t, time.Hour, m.RefreshTTL)
+	assert.Equal(t, keypair, m.Keypair)
+	assert.Equal(t, "/tenants/acme", m.BasePath)
+
+	_, err = m.CompleteCodeFlow(nil, "https://app.example.com/callback", []string{"profile"})
+	assert.EqualError(t, err,
+		"authorize: redirected with error invalid_scope: Unsupported scope: profile")
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", []string{"openid", "email"})
+	assert.NoError(t, err)
+	assert.Equal(t, "my-client", tokens.IDTokenClaims["aud"])
+}
+
+func TestNew_InvalidOptions(t *testing.T) {
+	for name, opt := range map[string]mockoidc.Option{
+		"client id":      mockoidc.WithClientCredentials("", "secret"),
+		"access ttl":     mockoidc.WithAccessTTL(0),
+		"refresh ttl":    mockoidc.WithRefreshTTL(-time.Second),
+		"keypair":        mockoidc.WithKeypair(nil),
+		"scopes":         mockoidc.WithScopes(),
+		"signing alg":    mockoidc.WithSigningAlg("HS256"),
+		"client keypair": mockoidc.WithClientKeypair(nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			m, err := mockoidc.New(opt)
+			assert.Error(t, err)
+			assert.Nil(t, m)
+		})
+	}
+}
+
+func TestNew_ES256(t *testing.T) {
+	m := mockoidc.RunTB(t, mockoidc.WithSigningAlg("ES256"))
+	assert.NotNil(t, m.Keypair.ECPrivateKey)
+
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	provider, verifier, err := m.OIDCProvider(context.Background())
+	assert.NoError(t, err)
+	_, err = verifier.Verify(context.Background(), tokens.IDToken)
+	assert.NoError(t, err)
+
+	var discovery struct {
+		Algs []string `json:"id_token_signing_alg_values_supported"`
+	}
+	assert.NoError(t, provider.Claims(&discovery))
+	assert.Equal(t, []string{"ES256"}, discovery.Algs)
+
+	// The EC key can't sign with RSA algorithms
+	assert.EqualError(t, mockoidc.WithSigningAlg("PS256")(m), "the Keypair's EC key can't sign PS256")
+}
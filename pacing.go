@@ -0,0 +1,49 @@
+package mockoidc
+
+import "time"
+
+const (
+	// SlowDown is the error of device clients polling the `token_endpoint`
+	// faster than their interval (RFC 8628 section 3.5)
+	SlowDown = "slow_down"
+
+	// defaultDevicePollInterval is the interval when DevicePollInterval is
+	// zero
+	defaultDevicePollInterval = 5 * time.Second
+	// slowDownIncrease is added to the interval of each `slow_down`, as
+	// clients are required to by RFC 8628 section 3.5
+	slowDownIncrease = 5 * time.Second
+)
+
+// pollPacer enforces the interval a device client polls the
+// `token_endpoint` at. Each poll faster than the interval slows the client
+// down by increasing it.
+type pollPacer struct {
+	interval time.Duration
+	lastPoll time.Time
+}
+
+// newPollPacer paces polls at the DevicePollInterval
+func (m *MockOIDC) newPollPacer() pollPacer {
+	return pollPacer{interval: m.devicePollInterval()}
+}
+
+func (m *MockOIDC) devicePollInterval() time.Duration {
+	if m.DevicePollInterval <= 0 {
+		return defaultDevicePollInterval
+	}
+	return m.DevicePollInterval
+}
+
+// poll records a poll at now and reports whether it waited out the
+// interval. Faster polls increase the interval by slowDownIncrease, unless
+// the pacing is lenient.
+func (p *pollPacer) poll(now time.Time, lenient bool) bool {
+	lastPoll := p.lastPoll
+	p.lastPoll = now
+	if lenient || lastPoll.IsZero() || now.Sub(lastPoll) >= p.interval {
+		return true
+	}
+	p.interval += slowDownIncrease
+	return false
+}
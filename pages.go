@@ -0,0 +1,77 @@
+package mockoidc
+
+import (
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// Names of the interactive pages. Their templates can be replaced through
+// `MockOIDC.PageTemplates`, and get the matching `*Data` struct.
+//
+// The built-in templates mark every element browser-automation suites may
+// assert on or click with a `data-testid` attribute that is kept stable
+// across versions, and work without JavaScript.
+const (
+	AdminUIPage            = "admin_ui"
+	DeviceVerificationPage = "device_verification"
+	HarnessCallbackPage    = "harness_callback"
+	HarnessTokensPage      = "harness_tokens"
+	LoginPage              = "login"
+)
+
+// pageTemplates are the built-in templates of the interactive pages
+var pageTemplates = map[string]*template.Template{
+	AdminUIPage:            adminUITemplate,
+	DeviceVerificationPage: deviceVerificationTemplate,
+	HarnessCallbackPage:    harnessCallbackTemplate,
+	HarnessTokensPage:      harnessTokensTemplate,
+	LoginPage:              loginTemplate,
+}
+
+// LoadPageTemplates parses the `<page>.html` files of a directory, e.g.
+// `admin_ui.html`, into templates for `MockOIDC.PageTemplates`. Pages
+// without a file keep their built-in template.
+func LoadPageTemplates(dir string) (map[string]*template.Template, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	templates := map[string]*template.Template{}
+	for _, file := range files {
+		name := strings.TrimSuffix(file.Name(), ".html")
+		if _, ok := pageTemplates[name]; !ok || file.IsDir() || name == file.Name() {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, file.Name()))
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := template.New(name).Parse(string(data))
+		if err != nil {
+			return nil, err
+		}
+		templates[name] = tmpl
+	}
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("no page templates in %s", dir)
+	}
+	return templates, nil
+}
+
+// renderPage renders the PageTemplates override of a page, or its built-in
+// template
+func (m *MockOIDC) renderPage(rw http.ResponseWriter, status int, page string, data interface{}) {
+	tmpl, ok := m.PageTemplates[page]
+	if !ok {
+		tmpl = pageTemplates[page]
+	}
+	noCache(rw)
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	rw.WriteHeader(status)
+	// Write errors are logged by the instrumented handler chain
+	_ = tmpl.Execute(rw, data)
+}
@@ -0,0 +1,196 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// PushedAuthorizationEndpoint implements RFC 9126 pushed authorization
+// requests: clients POST the parameters of an authorization request there,
+// authenticated like at the `token_endpoint`, and send the user to the
+// `authorization_endpoint` with the returned `request_uri` & their
+// `client_id` only. It is advertised as the
+// `pushed_authorization_request_endpoint` in the discovery document.
+const PushedAuthorizationEndpoint = "/oidc/par"
+
+const (
+	requestURIPrefix = "urn:ietf:params:oauth:request_uri:"
+	// pushedRequestTTL is the `expires_in` of the `request_uri`s
+	pushedRequestTTL = time.Minute
+)
+
+// clientAuthParams authenticate the client of a pushed authorization
+// request, they aren't part of the authorization request
+var clientAuthParams = []string{"client_secret", "client_assertion", "client_assertion_type"}
+
+// pushedRequest is an authorization request pushed by a client
+type pushedRequest struct {
+	clientID  string
+	params    url.Values
+	expiresAt time.Time
+}
+
+type pushedAuthorizationResponse struct {
+	RequestURI string `json:"request_uri"`
+	ExpiresIn  int64  `json:"expires_in"`
+}
+
+// PushedAuthorizationEndpoint returns the OAuth2
+// `pushed_authorization_request_endpoint`
+func (m *MockOIDC) PushedAuthorizationEndpoint() string {
+	if m.Server == nil {
+		return ""
+	}
+	return m.Addr() + m.endpointPath(PushedAuthorizationEndpoint)
+}
+
+// PushedAuthorization implements the `PushedAuthorizationEndpoint`. A
+// signed request object in the `request` parameter is verified right away;
+// the other parameters are validated when the `request_uri` is used. The
+// `request_uri` can be used until it expires, so interactive logins can
+// post it back.
+func (m *MockOIDC) PushedAuthorization(rw http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+
+	config := m.requestConfig(req)
+	if !m.clientAuthMethod(rw, req) {
+		return
+	}
+	required := []string{"client_id", "client_secret"}
+	if m.publicClient(config, req.Form.Get("client_id")) || m.keyAuthenticated(req) {
+		required = []string{"client_id"}
+	}
+	if !assertPresence(required, rw, req) {
+		return
+	}
+	if !m.validateClient(config, true, rw, req) {
+		return
+	}
+	if req.PostForm.Get("request_uri") != "" {
+		errorResponse(rw, InvalidRequest, "A request_uri can't be pushed", http.StatusBadRequest)
+		return
+	}
+
+	params := url.Values{}
+	for name, values := range req.PostForm {
+		if !containsString(clientAuthParams, name) {
+			params[name] = values
+		}
+	}
+	if request := params.Get("request"); request != "" {
+		var ok bool
+		if params, ok = m.requestObjectParams(rw, req, config.ClientID, request); !ok {
+			return
+		}
+	}
+	params.Set("client_id", config.ClientID)
+
+	id, err := randomNonce(24)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	m.pushedMu.Lock()
+	if m.pushed == nil {
+		m.pushed = map[string]*pushedRequest{}
+	}
+	m.pushed[id] = &pushedRequest{
+		clientID:  config.ClientID,
+		params:    params,
+		expiresAt: m.Now().Add(pushedRequestTTL),
+	}
+	m.pushedMu.Unlock()
+
+	resp, err := json.Marshal(&pushedAuthorizationResponse{
+		RequestURI: requestURIPrefix + id,
+		ExpiresIn:  int64(pushedRequestTTL / time.Second),
+	})
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	noCache(rw)
+	rw.Header().Set("Content-Type", applicationJSON)
+	rw.WriteHeader(http.StatusCreated)
+
+	// Write errors are logged by the instrumented handler chain
+	_, _ = rw.Write(resp)
+}
+
+// pushedRequestParams returns the parameters pushed for the `request_uri`
+// by the client, if they haven't expired
+func (m *MockOIDC) pushedRequestParams(requestURI, clientID string) (url.Values, bool) {
+	if !strings.HasPrefix(requestURI, requestURIPrefix) {
+		return nil, false
+	}
+	now := m.Now()
+
+	m.pushedMu.Lock()
+	defer m.pushedMu.Unlock()
+	for id, pushed := range m.pushed {
+		if !pushed.expiresAt.After(now) {
+			delete(m.pushed, id)
+		}
+	}
+	pushed, ok := m.pushed[strings.TrimPrefix(requestURI, requestURIPrefix)]
+	if !ok || (clientID != "" && clientID != pushed.clientID) {
+		return nil, false
+	}
+	params := url.Values{}
+	for name, values := range pushed.params {
+		params[name] = append([]string(nil), values...)
+	}
+	return params, true
+}
+
+// clearPushedRequests drops all pushed authorization requests
+func (m *MockOIDC) clearPushedRequests() {
+	m.pushedMu.Lock()
+	defer m.pushedMu.Unlock()
+	m.pushed = nil
+}
+
+// resolveAuthorizationRequest replaces the parameters of an authorization
+// request with the pushed ones of its `request_uri` or the claims of its
+// signed `request` object, and enforces FAPIMode's requirement for either.
+// It returns false if it already responded.
+func (m *MockOIDC) resolveAuthorizationRequest(rw http.ResponseWriter, req *http.Request) bool {
+	var (
+		params url.Values
+		ok     bool
+	)
+	switch requestURI, request := req.Form.Get("request_uri"), req.Form.Get("request"); {
+	case requestURI != "":
+		if params, ok = m.pushedRequestParams(requestURI, req.Form.Get("client_id")); !ok {
+			errorResponse(rw, InvalidRequestURI, "The request_uri is invalid or expired",
+				http.StatusBadRequest)
+			return false
+		}
+		params.Set("request_uri", requestURI)
+	case request != "":
+		if params, ok = m.requestObjectParams(rw, req, req.Form.Get("client_id"), request); !ok {
+			return false
+		}
+		params.Set("request", request)
+	case m.FAPIMode:
+		errorResponse(rw, InvalidRequest,
+			"FAPI requires a pushed authorization request or a signed request object",
+			http.StatusBadRequest)
+		return false
+	default:
+		return true
+	}
+
+	// The login page posts its action back along with the request
+	if action := req.Form.Get(loginActionParam); action != "" {
+		params.Set(loginActionParam, action)
+	}
+	req.Form = params
+	return true
+}
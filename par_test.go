@@ -0,0 +1,143 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_PushedAuthorization(t *testing.T) {
+	m := mockoidc.RunTB(t)
+
+	params := url.Values{
+		"client_id":     {m.ClientID},
+		"client_secret": {m.ClientSecret},
+		"response_type": {"code"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"scope":         {"openid"},
+		"state":         {"pushed-state"},
+	}
+	push := func(form url.Values) (int, map[string]interface{}) {
+		resp, err := httpClient.PostForm(m.PushedAuthorizationEndpoint(), form)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp.StatusCode, body
+	}
+	status, body := push(params)
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, float64(60), body["expires_in"])
+	requestURI := body["request_uri"].(string)
+	assert.Regexp(t, "^urn:ietf:params:oauth:request_uri:", requestURI)
+
+	authorize := func(clientID, requestURI string) *http.Response {
+		resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+			"client_id":   {clientID},
+			"request_uri": {requestURI},
+		}.Encode())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	resp := authorize(m.ClientID, requestURI)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	location, err := resp.Location()
+	assert.NoError(t, err)
+	assert.Equal(t, "pushed-state", location.Query().Get("state"))
+	assert.NotEmpty(t, location.Query().Get("code"))
+
+	// Other clients can't use it, and it expires
+	assert.Equal(t, http.StatusBadRequest, authorize("other-client", requestURI).StatusCode)
+	assert.Equal(t, http.StatusBadRequest, authorize(m.ClientID, "urn:example:unknown").StatusCode)
+	m.FastForward(2 * time.Minute)
+	assert.Equal(t, http.StatusBadRequest, authorize(m.ClientID, requestURI).StatusCode)
+
+	// Clients authenticate like at the token endpoint
+	params.Set("client_secret", "wrong")
+	status, body = push(params)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, mockoidc.InvalidClient, body["error"])
+
+	params.Set("client_secret", m.ClientSecret)
+	params.Set("request_uri", requestURI)
+	status, body = push(params)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, mockoidc.InvalidRequest, body["error"])
+
+	resp, err = httpClient.Get(m.PushedAuthorizationEndpoint())
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestMockOIDC_PushedAuthorization_Reset(t *testing.T) {
+	m := mockoidc.RunTB(t, mockoidc.WithClientKeypair(clientKeypair(t)))
+	requestURI := pushAuthorization(t, m, url.Values{
+		"client_id":     {m.ClientID},
+		"response_type": {"code"},
+		"redirect_uri":  {"https://app.example.com/callback"},
+		"scope":         {"openid"},
+		"state":         {"state"},
+	})
+	assert.NoError(t, m.Reset())
+
+	resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+		"client_id":   {m.ClientID},
+		"request_uri": {requestURI},
+	}.Encode())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body := map[string]interface{}{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, mockoidc.InvalidRequestURI, body["error"])
+}
+
+// clientKeypair is a random ES256 key for the configured client
+func clientKeypair(t *testing.T) *mockoidc.Keypair {
+	keypair, err := mockoidc.NewECKeypair(nil)
+	assert.NoError(t, err)
+	return keypair
+}
+
+// clientAssertion authenticates the configured client with a
+// `private_key_jwt` assertion for the audience
+func clientAssertion(t *testing.T, m *mockoidc.MockOIDC, audience string) url.Values {
+	assertion, err := m.ClientKeypair.SignJWT(jwt.StandardClaims{
+		Issuer:    m.ClientID,
+		Subject:   m.ClientID,
+		Audience:  audience,
+		ExpiresAt: m.Now().Add(time.Minute).Unix(),
+	})
+	assert.NoError(t, err)
+	return url.Values{
+		"client_id":             {m.ClientID},
+		"client_assertion_type": {mockoidc.JWTBearerAssertionType},
+		"client_assertion":      {assertion},
+	}
+}
+
+// pushAuthorization pushes the authorization request with a client
+// assertion and returns its `request_uri`
+func pushAuthorization(t *testing.T, m *mockoidc.MockOIDC, params url.Values) string {
+	form := clientAssertion(t, m, m.Issuer())
+	for k, v := range params {
+		form[k] = v
+	}
+	resp, err := httpClient.PostForm(m.PushedAuthorizationEndpoint(), form)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+	var pushed struct {
+		RequestURI string `json:"request_uri"`
+	}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&pushed))
+	return pushed.RequestURI
+}
@@ -0,0 +1,154 @@
+package mockoidc
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// maxPerfCacheEntries bounds the caches of the PerformanceMode
+const maxPerfCacheEntries = 4096
+
+// perfCache holds the responses & verified tokens the PerformanceMode reuses
+type perfCache struct {
+	sync.Mutex
+	keys      []*Keypair
+	jwks      []byte
+	discovery map[discoveryKey][]byte
+	verified  map[string]*jwt.Token
+}
+
+// discoveryKey identifies a discovery document. Metadata is replaced, never
+// modified, so its pointer changes with it. The enabled capabilities, the
+// ConformanceMode's `client_secret_basic` and the FAPIMode's auth methods
+// follow the MockOIDC's features instead.
+type discoveryKey struct {
+	addr         string
+	issuer       string
+	basePath     string
+	metadata     *metadata
+	capabilities string
+	conformance  bool
+	fapi         bool
+}
+
+// cachedJWKS returns the JWKS of the Keypairs, marshaled once per key set
+func (m *MockOIDC) cachedJWKS() ([]byte, error) {
+	keys := m.verificationKeys()
+	m.perf.Lock()
+	defer m.perf.Unlock()
+	if !sameKeys(m.perf.keys, keys) || m.perf.jwks == nil {
+		jwks, err := keysJWKS(keys)
+		if err != nil {
+			return nil, err
+		}
+		m.perf.keys, m.perf.jwks = keys, jwks
+		m.perf.verified = nil
+	}
+	return m.perf.jwks, nil
+}
+
+// cachedDiscovery returns the document for the key, rendering it on first use
+func (m *MockOIDC) cachedDiscovery(key discoveryKey, render func() ([]byte, error)) ([]byte, error) {
+	m.perf.Lock()
+	defer m.perf.Unlock()
+	if doc, ok := m.perf.discovery[key]; ok {
+		return doc, nil
+	}
+	doc, err := render()
+	if err != nil {
+		return nil, err
+	}
+	if m.perf.discovery == nil || len(m.perf.discovery) >= maxPerfCacheEntries {
+		m.perf.discovery = make(map[discoveryKey][]byte)
+	}
+	m.perf.discovery[key] = doc
+	return doc, nil
+}
+
+// verifySignature checks a token's signature, only once per token in the
+// PerformanceMode. Time based claims are always left to the caller.
+func (m *MockOIDC) verifySignature(raw string) (*jwt.Token, error) {
+	keys := m.verificationKeys()
+	if !m.PerformanceMode {
+		return verifyKeysSignature(raw, keys)
+	}
+
+	m.perf.Lock()
+	if !sameKeys(m.perf.keys, keys) {
+		m.perf.keys, m.perf.jwks, m.perf.verified = keys, nil, nil
+	}
+	token, ok := m.perf.verified[raw]
+	m.perf.Unlock()
+	if ok {
+		return token, nil
+	}
+
+	token, err := verifyKeysSignature(raw, keys)
+	if err != nil {
+		return nil, err
+	}
+	m.perf.Lock()
+	defer m.perf.Unlock()
+	if m.perf.verified == nil || len(m.perf.verified) >= maxPerfCacheEntries {
+		m.perf.verified = make(map[string]*jwt.Token)
+	}
+	m.perf.verified[raw] = token
+	return token, nil
+}
+
+// headerKey identifies the JOSE header of the tokens a key signs
+type headerKey struct {
+	alg string
+	kid string
+}
+
+// signingHeaders caches the encoded JOSE headers by headerKey, as every
+// token a key signs has the same one
+var signingHeaders sync.Map
+
+// signingBuffers are reused to assemble the signing strings of tokens
+var signingBuffers = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// encodedHeader returns the encoded header segment of a token, as jwt-go
+// renders it
+func encodedHeader(alg, kid string) (string, error) {
+	key := headerKey{alg, kid}
+	if header, ok := signingHeaders.Load(key); ok {
+		return header.(string), nil
+	}
+	data, err := json.Marshal(map[string]interface{}{"alg": alg, "kid": kid, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	header := base64.RawURLEncoding.EncodeToString(data)
+	signingHeaders.Store(key, header)
+	return header, nil
+}
+
+// appendSigningString encodes the claims after the header segment in a
+// pooled buffer, to the same `header.claims` string as jwt-go's
+// SigningString
+func appendSigningString(header string, claims jwt.Claims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	buf := signingBuffers.Get().(*bytes.Buffer)
+	defer signingBuffers.Put(buf)
+	buf.Reset()
+	n := base64.RawURLEncoding.EncodedLen(len(payload))
+	buf.Grow(len(header) + 1 + n)
+	buf.WriteString(header)
+	buf.WriteByte('.')
+	// Grow reserved the capacity to encode the claims in place
+	b := buf.Bytes()
+	b = b[:len(b)+n]
+	base64.RawURLEncoding.Encode(b[len(b)-n:], payload)
+	return string(b), nil
+}
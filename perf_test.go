@@ -0,0 +1,214 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_PerformanceMode(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.PerformanceMode = true
+	handler := m.Handler()
+
+	get := func(endpoint, authorization string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, endpoint, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	discovery := get(mockoidc.DiscoveryEndpoint, "")
+	assert.Equal(t, http.StatusOK, discovery.Code)
+	assert.Equal(t, discovery.Body.String(), get(mockoidc.DiscoveryEndpoint, "").Body.String())
+	m.SetScopesSupported([]string{"openid"})
+	assert.NotEqual(t, discovery.Body.String(), get(mockoidc.DiscoveryEndpoint, "").Body.String())
+
+	jwks, err := m.Keypair.JWKS()
+	assert.NoError(t, err)
+	assert.Equal(t, string(jwks), get(mockoidc.JWKSEndpoint, "").Body.String())
+
+	tokens, err := m.SeedSession(nil, nil, nil)
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, get(mockoidc.UserinfoEndpoint, "Bearer "+tokens.AccessToken).Code)
+	}
+	// Cached signatures don't skip the expiry checks
+	m.FastForward(m.AccessTTL + time.Second)
+	assert.Equal(t, http.StatusUnauthorized,
+		get(mockoidc.UserinfoEndpoint, "Bearer "+tokens.AccessToken).Code)
+
+	assert.Empty(t, m.Requests())
+}
+
+func TestMockOIDC_PerformanceMode_Conformance(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.PerformanceMode = true
+	m.SetTokenEndpointAuthMethodsSupported([]string{"client_secret_post"})
+	handler := m.Handler()
+	discovery := func() string {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, mockoidc.DiscoveryEndpoint, nil))
+		return rr.Body.String()
+	}
+
+	assert.NotContains(t, discovery(), "client_secret_basic")
+	m.ConformanceMode = true
+	assert.Contains(t, discovery(), "client_secret_basic")
+}
+
+func TestKeypair_SignJWT(t *testing.T) {
+	keypair, err := mockoidc.DefaultKeypair()
+	assert.NoError(t, err)
+	claims := jwt.MapClaims{"sub": "user", "aud": "client", "iat": 1609459200}
+
+	// Minting renders the same tokens as jwt-go, RS256 signatures are
+	// deterministic
+	signed, err := keypair.SignJWT(claims)
+	assert.NoError(t, err)
+	assert.Equal(t, jwtGoSign(t, keypair, claims), signed)
+	parsed, err := keypair.VerifyJWT(signed)
+	assert.NoError(t, err)
+	assert.Equal(t, "user", parsed.Claims.(jwt.MapClaims)["sub"])
+}
+
+func jwtGoSign(tb testing.TB, keypair *mockoidc.Keypair, claims jwt.Claims) string {
+	kid, err := keypair.KeyID()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(keypair.PrivateKey)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return signed
+}
+
+func benchmarkEndpoint(b *testing.B, performance bool, endpoint string, authorize func(m *mockoidc.MockOIDC) string) {
+	m, err := mockoidc.NewServer(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	m.PerformanceMode = performance
+	handler := m.Handler()
+	authorization := ""
+	if authorize != nil {
+		authorization = authorize(m)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, endpoint, nil)
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			handler.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				b.Fatalf("unexpected status code %d", rr.Code)
+			}
+		}
+	})
+}
+
+func bearer(m *mockoidc.MockOIDC) string {
+	tokens, err := m.SeedSession(nil, nil, nil)
+	if err != nil {
+		panic(err)
+	}
+	return "Bearer " + tokens.AccessToken
+}
+
+func BenchmarkDiscovery(b *testing.B) {
+	b.Run("default", func(b *testing.B) { benchmarkEndpoint(b, false, mockoidc.DiscoveryEndpoint, nil) })
+	b.Run("performance", func(b *testing.B) { benchmarkEndpoint(b, true, mockoidc.DiscoveryEndpoint, nil) })
+}
+
+func BenchmarkJWKS(b *testing.B) {
+	b.Run("default", func(b *testing.B) { benchmarkEndpoint(b, false, mockoidc.JWKSEndpoint, nil) })
+	b.Run("performance", func(b *testing.B) { benchmarkEndpoint(b, true, mockoidc.JWKSEndpoint, nil) })
+}
+
+func BenchmarkUserinfo(b *testing.B) {
+	b.Run("default", func(b *testing.B) { benchmarkEndpoint(b, false, mockoidc.UserinfoEndpoint, bearer) })
+	b.Run("performance", func(b *testing.B) { benchmarkEndpoint(b, true, mockoidc.UserinfoEndpoint, bearer) })
+}
+
+func BenchmarkSignJWT(b *testing.B) {
+	keypair, err := mockoidc.DefaultKeypair()
+	if err != nil {
+		b.Fatal(err)
+	}
+	claims := jwt.MapClaims{"sub": "user", "aud": "client", "iat": 1609459200}
+
+	b.Run("jwt-go", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			jwtGoSign(b, keypair, claims)
+		}
+	})
+	b.Run("keypair", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := keypair.SignJWT(claims); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func benchmarkRefresh(b *testing.B, performance bool) {
+	m, err := mockoidc.NewServer(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	m.PerformanceMode = performance
+	handler := m.Handler()
+	tokens, err := m.SeedSession(nil, nil, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	form := url.Values{
+		"client_id":     {m.ClientID},
+		"client_secret": {m.ClientSecret},
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {tokens.RefreshToken},
+	}.Encode()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, mockoidc.TokenEndpoint, strings.NewReader(form))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Content-Length", strconv.Itoa(len(form)))
+			handler.ServeHTTP(rr, req)
+			if rr.Code != http.StatusOK {
+				b.Fatalf("unexpected status code %d", rr.Code)
+			}
+		}
+	})
+}
+
+func BenchmarkRefresh(b *testing.B) {
+	b.Run("default", func(b *testing.B) { benchmarkRefresh(b, false) })
+	b.Run("performance", func(b *testing.B) { benchmarkRefresh(b, true) })
+}
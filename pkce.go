@@ -0,0 +1,97 @@
+package mockoidc
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// PKCEChallenge returns the `code_challenge` & `code_challenge_method` the
+// authorization request of the Session sent, to assert a client uses PKCE.
+// Both are empty if it didn't.
+func (m *MockOIDC) PKCEChallenge(sessionID string) (challenge, method string, err error) {
+	session, err := m.SessionStore.GetSessionByID(sessionID)
+	if err != nil {
+		return "", "", err
+	}
+	return session.CodeChallenge, session.CodeChallengeMethod, nil
+}
+
+// VerifyPKCE checks the `code_verifier` matches the `code_challenge` the
+// authorization request of the Session sent.
+func (m *MockOIDC) VerifyPKCE(sessionID, verifier string) error {
+	challenge, method, err := m.PKCEChallenge(sessionID)
+	if err != nil {
+		return err
+	}
+	if challenge == "" {
+		return fmt.Errorf("session %s has no code_challenge", sessionID)
+	}
+	return verifyCodeChallenge(challenge, method, verifier)
+}
+
+// validateCodeChallenge checks the PKCE parameters of an authorization
+// request: a `code_challenge_method` needs a `code_challenge` and must be
+// supported. It returns false if it already responded.
+func (m *MockOIDC) validateCodeChallenge(rw http.ResponseWriter, req *http.Request) bool {
+	challenge, method := req.Form.Get("code_challenge"), req.Form.Get("code_challenge_method")
+	if challenge == "" && method == "" {
+		return true
+	}
+	if challenge == "" {
+		m.authorizeError(rw, req, InvalidRequest,
+			"The request is missing the required parameter: code_challenge", http.StatusBadRequest)
+		return false
+	}
+	if method == "" {
+		method = "plain"
+	}
+	if !containsString(m.supported().codeChallengeMethods, method) {
+		m.authorizeError(rw, req, InvalidRequest,
+			fmt.Sprintf("Unsupported code_challenge_method: %s", method), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// validateCodeVerifier checks the `code_verifier` of a code exchange matches
+// the `code_challenge` of its authorization request, if it sent one. It
+// returns false if it already responded.
+func validateCodeVerifier(session *Session, rw http.ResponseWriter, req *http.Request) bool {
+	if session.CodeChallenge == "" {
+		return true
+	}
+	verifier := req.Form.Get("code_verifier")
+	if verifier == "" {
+		errorResponse(rw, InvalidGrant, "The request is missing the code_verifier",
+			http.StatusBadRequest)
+		return false
+	}
+	if err := verifyCodeChallenge(session.CodeChallenge, session.CodeChallengeMethod, verifier); err != nil {
+		errorResponse(rw, InvalidGrant, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// verifyCodeChallenge implements the checks of RFC 7636 section 4.6. An
+// empty method means `plain`.
+func verifyCodeChallenge(challenge, method, verifier string) error {
+	var expected string
+	switch method {
+	case "", "plain":
+		expected = verifier
+	case "S256":
+		sum := sha256.Sum256([]byte(verifier))
+		expected = base64.RawURLEncoding.EncodeToString(sum[:])
+	default:
+		return fmt.Errorf("unsupported code_challenge_method %s", method)
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) != 1 {
+		return errors.New("code_verifier does not match the code_challenge")
+	}
+	return nil
+}
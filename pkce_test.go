@@ -0,0 +1,192 @@
+package mockoidc_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_PKCE(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	authorize := func(code string, params url.Values) *httptest.ResponseRecorder {
+		m.QueueCode(code)
+		params.Set("scope", "openid")
+		params.Set("response_type", "code")
+		params.Set("redirect_uri", "https://app.example.com/callback")
+		params.Set("state", "state")
+		params.Set("client_id", m.ClientID)
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet,
+			mockoidc.AuthorizationEndpoint+"?"+params.Encode(), nil)
+		m.Authorize(rr, req)
+		assert.Equal(t, http.StatusFound, rr.Code)
+		return rr
+	}
+	exchange := func(code, verifier string) *httptest.ResponseRecorder {
+		data := url.Values{}
+		data.Set("client_id", m.ClientID)
+		data.Set("client_secret", m.ClientSecret)
+		data.Set("code", code)
+		data.Set("grant_type", "authorization_code")
+		if verifier != "" {
+			data.Set("code_verifier", verifier)
+		}
+		return testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	}
+
+	authorize("s256", url.Values{
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	})
+	seen, method, err := m.PKCEChallenge("s256")
+	assert.NoError(t, err)
+	assert.Equal(t, challenge, seen)
+	assert.Equal(t, "S256", method)
+	assert.NoError(t, m.VerifyPKCE("s256", verifier))
+	assert.EqualError(t, m.VerifyPKCE("s256", "wrong"),
+		"code_verifier does not match the code_challenge")
+
+	authorize("plain", url.Values{"code_challenge": {verifier}})
+	assert.NoError(t, m.VerifyPKCE("plain", verifier))
+
+	authorize("none", url.Values{})
+	seen, method, err = m.PKCEChallenge("none")
+	assert.NoError(t, err)
+	assert.Empty(t, seen)
+	assert.Empty(t, method)
+	assert.EqualError(t, m.VerifyPKCE("none", verifier), "session none has no code_challenge")
+
+	// Token exchanges must send the matching verifier
+	rr := exchange("s256", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), mockoidc.InvalidGrant)
+	rr = exchange("s256", "wrong")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "code_verifier does not match the code_challenge")
+	assert.Equal(t, http.StatusOK, exchange("s256", verifier).Code)
+	assert.Equal(t, http.StatusOK, exchange("plain", verifier).Code)
+	assert.Equal(t, http.StatusOK, exchange("none", "").Code)
+
+	// Unsupported methods & methods without a challenge are rejected
+	rr = authorize("unsupported", url.Values{
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S512"},
+	})
+	redirect, err := url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.InvalidRequest, redirect.Query().Get("error"))
+	assert.Equal(t, "Unsupported code_challenge_method: S512", redirect.Query().Get("error_description"))
+
+	rr = authorize("nochallenge", url.Values{"code_challenge_method": {"S256"}})
+	redirect, err = url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.InvalidRequest, redirect.Query().Get("error"))
+
+	m.SetCodeChallengeMethodsSupported([]string{"S256"})
+	rr = authorize("plain-disabled", url.Values{"code_challenge": {verifier}})
+	redirect, err = url.Parse(rr.Header().Get("Location"))
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.InvalidRequest, redirect.Query().Get("error"))
+
+	_, _, err = m.PKCEChallenge("missing")
+	assert.Error(t, err)
+}
+
+func TestMockOIDC_PKCE_PublicClient(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	m.ClientStore.(*mockoidc.MemoryClientStore).Add(&mockoidc.Client{ID: "public-client"})
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	authorize := func(challenge, method string) string {
+		resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+			"client_id":             {"public-client"},
+			"response_type":         {"code"},
+			"redirect_uri":          {"https://app.example.com/callback"},
+			"scope":                 {"openid"},
+			"state":                 {"state"},
+			"code_challenge":        {challenge},
+			"code_challenge_method": {method},
+		}.Encode())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		location, err := resp.Location()
+		assert.NoError(t, err)
+		return location.Query().Get("code")
+	}
+	post := func(endpoint string, form url.Values) (int, map[string]interface{}) {
+		resp, err := httpClient.PostForm(endpoint, form)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body := map[string]interface{}{}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+	exchange := func(code, verifier string) (int, map[string]interface{}) {
+		form := url.Values{
+			"client_id":  {"public-client"},
+			"grant_type": {"authorization_code"},
+			"code":       {code},
+		}
+		if verifier != "" {
+			form.Set("code_verifier", verifier)
+		}
+		return post(m.TokenEndpoint(), form)
+	}
+
+	for method, challenge := range map[string]string{
+		"plain": verifier,
+		"S256":  base64.RawURLEncoding.EncodeToString(sum[:]),
+	} {
+		status, body := exchange(authorize(challenge, method), "")
+		assert.Equal(t, http.StatusBadRequest, status, method)
+		assert.Equal(t, "The request is missing the required parameter: code_verifier",
+			body["error_description"], method)
+
+		status, body = exchange(authorize(challenge, method), verifier)
+		assert.Equal(t, http.StatusOK, status, method)
+		assert.NotEmpty(t, body["id_token"], method)
+
+		// Their tokens are refreshed & revoked without a secret too
+		status, refreshed := post(m.TokenEndpoint(), url.Values{
+			"client_id":     {"public-client"},
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {body["refresh_token"].(string)},
+		})
+		assert.Equal(t, http.StatusOK, status, method)
+		status, _ = post(m.RevocationEndpoint(), url.Values{
+			"client_id": {"public-client"},
+			"token":     {refreshed["refresh_token"].(string)},
+		})
+		assert.Equal(t, http.StatusOK, status, method)
+	}
+
+	// Confidential clients still authenticate
+	status, body := post(m.TokenEndpoint(), url.Values{
+		"client_id":     {m.ClientID},
+		"grant_type":    {"authorization_code"},
+		"code":          {"code"},
+		"code_verifier": {verifier},
+	})
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "The request is missing the required parameter: client_secret",
+		body["error_description"])
+
+	m.SetTokenEndpointAuthMethodsSupported([]string{"client_secret_basic", "client_secret_post"})
+	status, body = exchange(authorize(verifier, "plain"), verifier)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Equal(t, mockoidc.InvalidClient, body["error"])
+}
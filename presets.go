@@ -0,0 +1,204 @@
+package mockoidc
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"time"
+)
+
+// Preset is the personality of a real-world provider MockOIDC can take on,
+// to smoke test a relying party against several providers with one mock.
+// Presets only change settings that are available on their own:
+// `BasePath`, `EndpointPaths`, `TokenType`, `TokenResponseExtras`,
+// `ExpiresInSeconds`, `ShapeClaims` and the catch-all ErrorTemplate.
+type Preset string
+
+const (
+	// PresetAzureAD serves the v2.0 endpoints of the `PresetAzureADTenant`,
+	// adds the `oid`, `tid` & `ver` claims, `ext_expires_in` and Azure AD's
+	// `AADSTS` error payloads
+	PresetAzureAD Preset = "azure_ad"
+	// PresetGoogle serves Google's endpoint paths at the root, adds `azp` to
+	// ID tokens & `sub` to userinfo and keeps the lowercase `bearer`
+	PresetGoogle Preset = "google"
+	// PresetOkta serves the `default` authorization server's `/v1`
+	// endpoints and adds Okta's `ver`, `idp` & `amr` claims
+	PresetOkta Preset = "okta"
+	// PresetKeycloak serves the OpenID Connect endpoints of the
+	// `PresetKeycloakRealm`, releases groups as `realm_access` roles and
+	// adds `refresh_expires_in` & `not-before-policy`
+	PresetKeycloak Preset = "keycloak"
+)
+
+// PresetAzureADTenant & PresetKeycloakRealm are the tenant & realm the
+// presets serve
+const (
+	PresetAzureADTenant = "00000000-0000-4000-8000-000000000000"
+	PresetKeycloakRealm = "mock"
+)
+
+// ParsePreset validates the name of a Preset. An empty name is the zero
+// value, which applies nothing.
+func ParsePreset(name string) (Preset, bool) {
+	switch preset := Preset(name); preset {
+	case "", PresetAzureAD, PresetGoogle, PresetOkta, PresetKeycloak:
+		return preset, true
+	}
+	return "", false
+}
+
+// WithPreset applies the Preset, as with `ApplyPreset`
+func WithPreset(preset Preset) Option {
+	return func(m *MockOIDC) error {
+		return m.ApplyPreset(preset)
+	}
+}
+
+// ApplyPreset reconfigures the MockOIDC to behave like the Preset's
+// provider. It must be called before `Start`, after the TTLs are set, and
+// replaces the settings the Preset changes, including the ErrorTemplate
+// for all errors.
+func (m *MockOIDC) ApplyPreset(preset Preset) error {
+	if preset == "" {
+		return nil
+	}
+	if _, ok := ParsePreset(string(preset)); !ok {
+		return fmt.Errorf("unknown preset %s", preset)
+	}
+
+	var (
+		base          string
+		paths         map[string]string
+		errorTemplate *ErrorTemplate
+	)
+	m.TokenType = "Bearer"
+	m.TokenResponseExtras = nil
+	m.ExpiresInSeconds = true
+
+	switch preset {
+	case PresetAzureAD:
+		tenant := "/" + PresetAzureADTenant
+		base = tenant + "/v2.0"
+		paths = map[string]string{
+			AuthorizationEndpoint:       tenant + "/oauth2/v2.0/authorize",
+			TokenEndpoint:               tenant + "/oauth2/v2.0/token",
+			JWKSEndpoint:                tenant + "/discovery/v2.0/keys",
+			UserinfoEndpoint:            "/oidc/userinfo",
+			EndSessionEndpoint:          tenant + "/oauth2/v2.0/logout",
+			DeviceAuthorizationEndpoint: tenant + "/oauth2/v2.0/devicecode",
+		}
+		m.TokenResponseExtras = map[string]interface{}{
+			"ext_expires_in": int64(m.AccessTTL / time.Second),
+		}
+		m.ShapeClaims = shapeAzureADClaims
+		errorTemplate = &ErrorTemplate{
+			Description: "AADSTS50000: {{.Description}}",
+			Fields: map[string]interface{}{
+				"error_codes":    []int{50000},
+				"timestamp":      `{{.Time.UTC.Format "2006-01-02 15:04:05Z"}}`,
+				"trace_id":       "00000000-0000-4000-8000-000000000001",
+				"correlation_id": "00000000-0000-4000-8000-000000000002",
+			},
+		}
+	case PresetGoogle:
+		paths = map[string]string{
+			AuthorizationEndpoint:       "/o/oauth2/v2/auth",
+			TokenEndpoint:               "/token",
+			JWKSEndpoint:                "/oauth2/v3/certs",
+			UserinfoEndpoint:            "/v1/userinfo",
+			RevocationEndpoint:          "/revoke",
+			DeviceAuthorizationEndpoint: "/device/code",
+		}
+		m.TokenType = "bearer"
+		m.ShapeClaims = shapeGoogleClaims
+	case PresetOkta:
+		base = "/oauth2/default"
+		paths = map[string]string{
+			AuthorizationEndpoint:       base + "/v1/authorize",
+			TokenEndpoint:               base + "/v1/token",
+			JWKSEndpoint:                base + "/v1/keys",
+			UserinfoEndpoint:            base + "/v1/userinfo",
+			EndSessionEndpoint:          base + "/v1/logout",
+			RevocationEndpoint:          base + "/v1/revoke",
+			IntrospectionEndpoint:       base + "/v1/introspect",
+			DeviceAuthorizationEndpoint: base + "/v1/device/authorize",
+			PushedAuthorizationEndpoint: base + "/v1/par",
+		}
+		m.ShapeClaims = shapeOktaClaims
+	case PresetKeycloak:
+		base = "/realms/" + PresetKeycloakRealm
+		protocol := base + "/protocol/openid-connect"
+		paths = map[string]string{
+			AuthorizationEndpoint:       protocol + "/auth",
+			TokenEndpoint:               protocol + "/token",
+			JWKSEndpoint:                protocol + "/certs",
+			UserinfoEndpoint:            protocol + "/userinfo",
+			EndSessionEndpoint:          protocol + "/logout",
+			RevocationEndpoint:          protocol + "/revoke",
+			IntrospectionEndpoint:       protocol + "/token/introspect",
+			DeviceAuthorizationEndpoint: protocol + "/auth/device",
+			PushedAuthorizationEndpoint: protocol + "/ext/par/request",
+		}
+		m.TokenResponseExtras = map[string]interface{}{
+			"refresh_expires_in": int64(m.RefreshTTL / time.Second),
+			"not-before-policy":  0,
+		}
+		m.ShapeClaims = shapeKeycloakClaims
+	}
+
+	if err := m.SetErrorTemplate("", errorTemplate); err != nil {
+		return err
+	}
+	m.BasePath = base
+	m.EndpointPaths = paths
+	m.preset = preset
+	return nil
+}
+
+func shapeAzureADClaims(claims map[string]interface{}, session *Session, target ClaimsTarget) {
+	claims["oid"] = subjectGUID(session.User.ID())
+	claims["tid"] = PresetAzureADTenant
+	if target == ClaimsIDToken {
+		claims["ver"] = "2.0"
+		return
+	}
+	claims["sub"] = session.User.ID()
+}
+
+func shapeGoogleClaims(claims map[string]interface{}, session *Session, target ClaimsTarget) {
+	if target == ClaimsIDToken {
+		claims["azp"] = claims["aud"]
+		return
+	}
+	claims["sub"] = session.User.ID()
+}
+
+func shapeOktaClaims(claims map[string]interface{}, session *Session, target ClaimsTarget) {
+	if target == ClaimsIDToken {
+		claims["ver"] = 1
+		claims["idp"] = "00omockidp0000000000"
+		claims["amr"] = []string{"pwd"}
+		return
+	}
+	claims["sub"] = session.User.ID()
+}
+
+func shapeKeycloakClaims(claims map[string]interface{}, session *Session, target ClaimsTarget) {
+	if groups, ok := claims["groups"]; ok {
+		claims["realm_access"] = map[string]interface{}{"roles": groups}
+		delete(claims, "groups")
+	}
+	if target == ClaimsIDToken {
+		claims["typ"] = "ID"
+		claims["azp"] = claims["aud"]
+		return
+	}
+	claims["sub"] = session.User.ID()
+}
+
+// subjectGUID derives a stable GUID from a subject, for providers whose
+// object IDs are GUIDs
+func subjectGUID(subject string) string {
+	sum := sha256.Sum256([]byte(subject))
+	return fmt.Sprintf("%x-%x-%x-%x-%x", sum[0:4], sum[4:6], sum[6:8], sum[8:10], sum[10:16])
+}
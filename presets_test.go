@@ -0,0 +1,158 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Presets(t *testing.T) {
+	start := func(t *testing.T, preset mockoidc.Preset) *mockoidc.MockOIDC {
+		m, err := mockoidc.New(mockoidc.WithPreset(preset))
+		assert.NoError(t, err)
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		assert.NoError(t, err)
+		assert.NoError(t, m.Start(ln, nil))
+		t.Cleanup(func() { _ = m.Shutdown() })
+		return m
+	}
+	user := &mockoidc.MockUser{
+		Subject: "preset-user",
+		Email:   "preset@example.com",
+		Groups:  []string{"admins"},
+	}
+	scopes := []string{"openid", "email", "groups"}
+	fetchJSON := func(t *testing.T, endpoint string) map[string]interface{} {
+		resp, err := httpClient.Get(endpoint)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return body
+	}
+
+	t.Run("keycloak", func(t *testing.T) {
+		m := start(t, mockoidc.PresetKeycloak)
+		assert.Equal(t, m.Addr()+"/realms/mock", m.Issuer())
+		assert.Equal(t, m.Addr()+"/realms/mock/protocol/openid-connect/token", m.TokenEndpoint())
+
+		discovery := fetchJSON(t, m.DiscoveryEndpoint())
+		assert.Equal(t, m.Issuer(), discovery["issuer"])
+		assert.Equal(t, m.Addr()+"/realms/mock/protocol/openid-connect/auth",
+			discovery["authorization_endpoint"])
+		assert.Equal(t, m.Addr()+"/realms/mock/protocol/openid-connect/certs", discovery["jwks_uri"])
+
+		tokens, err := m.CompleteCodeFlow(user, "https://app.example.com/callback", scopes)
+		assert.NoError(t, err)
+		assert.Equal(t, "Bearer", tokens.TokenType)
+		assert.Equal(t, m.AccessTTL, tokens.ExpiresIn)
+		assert.Equal(t, map[string]interface{}{"roles": []interface{}{"admins"}},
+			tokens.IDTokenClaims["realm_access"])
+		assert.NotContains(t, tokens.IDTokenClaims, "groups")
+		assert.Equal(t, "ID", tokens.IDTokenClaims["typ"])
+		assert.Equal(t, m.ClientID, tokens.IDTokenClaims["azp"])
+
+		resp, err := httpClient.PostForm(m.TokenEndpoint(), url.Values{
+			"client_id":     {m.ClientID},
+			"client_secret": {m.ClientSecret},
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {tokens.RefreshToken},
+		})
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, float64(m.AccessTTL.Seconds()), body["expires_in"])
+		assert.Equal(t, float64(m.RefreshTTL.Seconds()), body["refresh_expires_in"])
+		assert.Equal(t, float64(0), body["not-before-policy"])
+
+		features := fetchJSON(t, m.Addr()+mockoidc.VersionEndpoint)["features"]
+		assert.Contains(t, features, "preset_keycloak")
+	})
+
+	t.Run("azure_ad", func(t *testing.T) {
+		m := start(t, mockoidc.PresetAzureAD)
+		tenant := m.Addr() + "/" + mockoidc.PresetAzureADTenant
+		assert.Equal(t, tenant+"/v2.0", m.Issuer())
+		assert.Equal(t, tenant+"/oauth2/v2.0/authorize", m.AuthorizationEndpoint())
+		assert.Equal(t, tenant+"/v2.0/.well-known/openid-configuration", m.DiscoveryEndpoint())
+
+		tokens, err := m.CompleteCodeFlow(user, "https://app.example.com/callback", scopes)
+		assert.NoError(t, err)
+		assert.Equal(t, "Bearer", tokens.TokenType)
+		assert.Equal(t, mockoidc.PresetAzureADTenant, tokens.IDTokenClaims["tid"])
+		assert.Equal(t, "2.0", tokens.IDTokenClaims["ver"])
+		oid, _ := tokens.IDTokenClaims["oid"].(string)
+		assert.Len(t, strings.Split(oid, "-"), 5)
+
+		token, err := m.Keypair.VerifyJWT(tokens.AccessToken)
+		assert.NoError(t, err)
+		session, err := m.SessionStore.GetSessionByToken(token)
+		assert.NoError(t, err)
+		decisions, err := m.ExplainClaims(session.SessionID, mockoidc.ClaimsIDToken)
+		assert.NoError(t, err)
+		assert.Contains(t, decisions, mockoidc.ClaimDecision{
+			Claim: "tid", As: "tid", Released: true, Reason: "added by ShapeClaims",
+		})
+
+		resp, err := httpClient.PostForm(m.TokenEndpoint(), url.Values{
+			"client_id":     {m.ClientID},
+			"client_secret": {"wrong"},
+			"grant_type":    {"authorization_code"},
+			"code":          {"code"},
+		})
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		body := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		assert.Equal(t, mockoidc.InvalidClient, body["error"])
+		assert.True(t, strings.HasPrefix(body["error_description"].(string), "AADSTS50000: "))
+		assert.Equal(t, []interface{}{float64(50000)}, body["error_codes"])
+		assert.Contains(t, body, "trace_id")
+	})
+
+	t.Run("google", func(t *testing.T) {
+		m := start(t, mockoidc.PresetGoogle)
+		assert.Equal(t, m.Addr(), m.Issuer())
+		assert.Equal(t, m.Addr()+"/o/oauth2/v2/auth", m.AuthorizationEndpoint())
+
+		tokens, err := m.CompleteCodeFlow(user, "https://app.example.com/callback", scopes)
+		assert.NoError(t, err)
+		assert.Equal(t, "bearer", tokens.TokenType)
+		assert.Equal(t, m.ClientID, tokens.IDTokenClaims["azp"])
+
+		req, err := http.NewRequest(http.MethodGet, m.UserinfoEndpoint(), nil)
+		assert.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+		resp, err := httpClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		userinfo := map[string]interface{}{}
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(&userinfo))
+		assert.Equal(t, "preset-user", userinfo["sub"])
+	})
+
+	t.Run("okta", func(t *testing.T) {
+		m := start(t, mockoidc.PresetOkta)
+		assert.Equal(t, m.Addr()+"/oauth2/default", m.Issuer())
+		assert.Equal(t, m.Addr()+"/oauth2/default/v1/token", m.TokenEndpoint())
+
+		tokens, err := m.CompleteCodeFlow(user, "https://app.example.com/callback", scopes)
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{"pwd"}, tokens.IDTokenClaims["amr"])
+		assert.Equal(t, float64(1), tokens.IDTokenClaims["ver"])
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		_, ok := mockoidc.ParsePreset("auth0")
+		assert.False(t, ok)
+		_, err := mockoidc.New(mockoidc.WithPreset("auth0"))
+		assert.Error(t, err)
+	})
+}
@@ -2,6 +2,17 @@ package mockoidc
 
 import "sync"
 
+// UserStore provides the Users logged in by calls to the authorize
+// endpoint. `UserQueue` is the default.
+type UserStore interface {
+	// Push adds a User to log in after the already queued ones
+	Push(user User)
+	// Pop returns the next User to log in
+	Pop() User
+	// Clear removes all queued Users
+	Clear()
+}
+
 // UserQueue manages the queue of Users returned for each
 // call to the authorize endpoint
 type UserQueue struct {
@@ -14,6 +25,9 @@ type UserQueue struct {
 type CodeQueue struct {
 	sync.Mutex
 	Queue []string
+	// NewCode generates the codes returned while the Queue is empty. Random
+	// codes are returned if it's nil.
+	NewCode func() (string, error)
 }
 
 // ErrorQueue manages the queue of errors for handlers to return
@@ -22,11 +36,17 @@ type ErrorQueue struct {
 	Queue []*ServerError
 }
 
+// boundUser is a queued User whose login issues a preset code
+type boundUser struct {
+	User
+	code string
+}
+
 // ServerError is a tester-defined error for a handler to return
 type ServerError struct {
-	Code        int
-	Error       string
-	Description string
+	Code        int    `json:"code"`
+	Error       string `json:"error"`
+	Description string `json:"description"`
 }
 
 // Push adds a User to the Queue to be set in subsequent calls to the
@@ -37,6 +57,20 @@ func (q *UserQueue) Push(user User) {
 	q.Queue = append(q.Queue, user)
 }
 
+// pushFront queues a User ahead of the already queued ones
+func (q *UserQueue) pushFront(user User) {
+	q.Lock()
+	defer q.Unlock()
+	q.Queue = append([]User{user}, q.Queue...)
+}
+
+// Clear removes all queued Users
+func (q *UserQueue) Clear() {
+	q.Lock()
+	defer q.Unlock()
+	q.Queue = nil
+}
+
 // Pop a User from the Queue. If empty, return `DefaultUser()`
 func (q *UserQueue) Pop() User {
 	q.Lock()
@@ -59,12 +93,22 @@ func (q *CodeQueue) Push(code string) {
 	q.Queue = append(q.Queue, code)
 }
 
-// Pop a `code` from the Queue. If empty, return a random code
+// Clear removes all queued codes
+func (q *CodeQueue) Clear() {
+	q.Lock()
+	defer q.Unlock()
+	q.Queue = nil
+}
+
+// Pop a `code` from the Queue. If empty, return a new code
 func (q *CodeQueue) Pop() (string, error) {
 	q.Lock()
 	defer q.Unlock()
 
 	if len(q.Queue) == 0 {
+		if q.NewCode != nil {
+			return q.NewCode()
+		}
 		code, err := randomNonce(24)
 		if err != nil {
 			return "", err
@@ -85,6 +129,13 @@ func (q *ErrorQueue) Push(se *ServerError) {
 	q.Queue = append(q.Queue, se)
 }
 
+// Clear removes all queued ServerErrors
+func (q *ErrorQueue) Clear() {
+	q.Lock()
+	defer q.Unlock()
+	q.Queue = nil
+}
+
 // Pop a ServerError from the Queue. If empty, return nil
 func (q *ErrorQueue) Pop() *ServerError {
 	q.Lock()
@@ -0,0 +1,111 @@
+package mockoidc
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ReadyPollInterval is how often `WaitForReady` polls the discovery endpoint
+var ReadyPollInterval = 50 * time.Millisecond
+
+// WaitForReady polls the discovery endpoint of the issuer until it serves
+// valid metadata or the context is done. Use it to synchronize with a
+// MockOIDC started elsewhere, e.g. in a container. A nil client uses
+// `http.DefaultClient`.
+func WaitForReady(ctx context.Context, client *http.Client, issuer string) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	discoveryURL := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	return waitForDiscovery(ctx, client, issuer, discoveryURL)
+}
+
+// waitForDiscovery polls the discovery URL of the issuer until it serves
+// valid metadata or the context is done
+func waitForDiscovery(ctx context.Context, client *http.Client, issuer, discoveryURL string) error {
+	ticker := time.NewTicker(ReadyPollInterval)
+	defer ticker.Stop()
+
+	for {
+		err := checkDiscovery(ctx, client, discoveryURL)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s not ready: %w", issuer, err)
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitForReady blocks until the MockOIDC, possibly started in another
+// Goroutine, serves valid discovery metadata or the context is done.
+func (m *MockOIDC) WaitForReady(ctx context.Context) error {
+	ticker := time.NewTicker(ReadyPollInterval)
+	defer ticker.Stop()
+
+	for !m.started() {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("server not started: %w", ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	// The discovery endpoint may be moved from under the issuer, e.g. by
+	// `EndpointPaths`
+	return waitForDiscovery(ctx, m.selfClient(), m.Issuer(), m.DiscoveryEndpoint())
+}
+
+// selfClient returns an http.Client able to reach this started MockOIDC
+func (m *MockOIDC) selfClient() *http.Client {
+	client := &http.Client{}
+	switch {
+	case m.Server.Addr == InProcessHost:
+		client = m.Client()
+	case m.tlsConfig != nil:
+		// We only talk to our own server, its CA may be unknown to the system
+		client.Transport = &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}
+	}
+	return client
+}
+
+func (m *MockOIDC) started() bool {
+	m.startMu.Lock()
+	defer m.startMu.Unlock()
+	return m.Server != nil
+}
+
+func checkDiscovery(ctx context.Context, client *http.Client, discoveryURL string) error {
+	req, err := http.NewRequest(http.MethodGet, discoveryURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	discovery := &discoveryResponse{}
+	if err = json.NewDecoder(resp.Body).Decode(discovery); err != nil {
+		return err
+	}
+	if discovery.Issuer == "" || discovery.AuthorizationEndpoint == "" ||
+		discovery.TokenEndpoint == "" || discovery.JWKSUri == "" {
+		return errors.New("incomplete discovery metadata")
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package mockoidc_test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWaitForReady(t *testing.T) {
+	ready := make(chan struct{})
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		select {
+		case <-ready:
+			m.Discovery(rw, req)
+		default:
+			rw.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+	issuer := ts.URL + mockoidc.IssuerBase
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, mockoidc.WaitForReady(ctx, nil, issuer))
+
+	close(ready)
+	ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, mockoidc.WaitForReady(ctx, nil, issuer))
+}
+
+func TestMockOIDC_WaitForReady(t *testing.T) {
+	for name, cfg := range map[string]bool{"http": false, "https": true} {
+		t.Run(name, func(t *testing.T) {
+			m, err := mockoidc.NewServer(nil)
+			assert.NoError(t, err)
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			assert.NoError(t, err)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error)
+			go func() {
+				if !cfg {
+					done <- m.Run(ctx, ln, nil)
+					return
+				}
+				cert, err := mockoidc.NewCertificate()
+				if err != nil {
+					done <- err
+					return
+				}
+				done <- m.Run(ctx, ln, cert.TLSConfig())
+			}()
+
+			waitCtx, waitCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer waitCancel()
+			assert.NoError(t, m.WaitForReady(waitCtx))
+
+			cancel()
+			assert.NoError(t, <-done)
+		})
+	}
+}
+
+func TestMockOIDC_WaitForReady_EndpointPaths(t *testing.T) {
+	for name, configure := range map[string]mockoidc.Option{
+		"base path": mockoidc.WithBasePath("/tenants/acme"),
+		"endpoint paths": func(m *mockoidc.MockOIDC) error {
+			m.EndpointPaths = map[string]string{
+				mockoidc.DiscoveryEndpoint: "/config/openid",
+			}
+			return nil
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := mockoidc.RunTB(t, configure)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			assert.NoError(t, m.WaitForReady(ctx))
+		})
+	}
+}
+
+func TestMockOIDC_WaitForReady_NotStarted(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, m.WaitForReady(ctx))
+
+	// In-process servers are ready right away
+	m.Client()
+	assert.NoError(t, m.WaitForReady(context.Background()))
+}
@@ -0,0 +1,161 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// FixtureKeysFile is the file of a fixture directory holding the JWKS the
+// recorded tokens were signed with
+const FixtureKeysFile = "keys.json"
+
+// Interaction is a request & response recorded to a fixture directory by
+// RecordTo. Each one is written to its own numbered file, e.g.
+// `0002-token.json`, so transcripts diff cleanly.
+type Interaction struct {
+	Endpoint string `json:"endpoint"`
+	Method   string `json:"method"`
+	// Params are the query & form parameters
+	Params        url.Values  `json:"params,omitempty"`
+	RequestHeader http.Header `json:"request_header,omitempty"`
+
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	// Body is the response body, as a JSON string if it isn't JSON itself
+	Body json.RawMessage `json:"body,omitempty"`
+	// Tokens are the claims of the tokens in the response body, by field
+	Tokens map[string]jwt.MapClaims `json:"tokens,omitempty"`
+}
+
+// recorder writes the Interactions of a MockOIDC to a fixture directory
+type recorder struct {
+	sync.Mutex
+	dir string
+	seq int
+}
+
+// RecordTo writes all interactions with the endpoints from now on to the
+// fixture directory, along with the JWKS in FixtureKeysFile. The directory
+// is created if needed; files already in it are overwritten.
+func (m *MockOIDC) RecordTo(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	jwks, err := m.jwks()
+	if err != nil {
+		return err
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, FixtureKeysFile), jwks, 0644); err != nil {
+		return err
+	}
+
+	m.recordMu.Lock()
+	defer m.recordMu.Unlock()
+	m.recorder = &recorder{dir: dir}
+	return nil
+}
+
+// StopRecording stops writing interactions started by RecordTo
+func (m *MockOIDC) StopRecording() {
+	m.recordMu.Lock()
+	defer m.recordMu.Unlock()
+	m.recorder = nil
+}
+
+// record wraps an endpoint handler to write its interactions while
+// recording.
+func (m *MockOIDC) record(endpoint string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		m.recordMu.Lock()
+		rec := m.recorder
+		m.recordMu.Unlock()
+		if rec == nil {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		dr := &dumpRecorder{ResponseWriter: rw, code: http.StatusOK}
+		next.ServeHTTP(dr, req)
+
+		// Handlers have parsed the form by now, unless an error was forced
+		_ = req.ParseForm()
+		interaction := &Interaction{
+			Endpoint:      endpoint,
+			Method:        req.Method,
+			Params:        cloneValues(req.Form),
+			RequestHeader: req.Header.Clone(),
+			StatusCode:    dr.code,
+			Header:        dr.Header().Clone(),
+		}
+		interaction.setBody(dr.body.Bytes())
+		if err := rec.write(interaction); err != nil {
+			m.logger().Error("unable to record interaction",
+				"endpoint", endpointName(endpoint), "error", err)
+		}
+	})
+}
+
+// setBody stores the response body and the claims of the tokens in it
+func (i *Interaction) setBody(body []byte) {
+	if len(body) == 0 {
+		return
+	}
+	if !json.Valid(body) {
+		i.Body, _ = json.Marshal(string(body))
+		return
+	}
+	i.Body = append(json.RawMessage(nil), body...)
+	var fields map[string]interface{}
+	if json.Unmarshal(body, &fields) != nil {
+		return
+	}
+	raw := map[string]string{}
+	for field, value := range fields {
+		if token, ok := value.(string); ok {
+			raw[field] = token
+		}
+	}
+	i.Tokens = parseTokens(raw)
+}
+
+// parseTokens returns the claims of the access, refresh & ID tokens among
+// the raw fields of a response, by field, or nil if there are none
+func parseTokens(raw map[string]string) map[string]jwt.MapClaims {
+	var tokens map[string]jwt.MapClaims
+	for _, field := range []string{"access_token", "refresh_token", "id_token"} {
+		token, ok := raw[field]
+		if !ok {
+			continue
+		}
+		claims := jwt.MapClaims{}
+		if _, _, err := new(jwt.Parser).ParseUnverified(token, claims); err != nil {
+			continue
+		}
+		if tokens == nil {
+			tokens = make(map[string]jwt.MapClaims)
+		}
+		tokens[field] = claims
+	}
+	return tokens
+}
+
+func (r *recorder) write(interaction *Interaction) error {
+	data, err := json.MarshalIndent(interaction, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.seq++
+	name := fmt.Sprintf("%04d-%s.json", r.seq, endpointName(interaction.Endpoint))
+	return ioutil.WriteFile(filepath.Join(r.dir, name), append(data, '\n'), 0644)
+}
@@ -0,0 +1,64 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_RecordTo(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	dir := filepath.Join(t.TempDir(), "fixtures")
+	assert.NoError(t, m.RecordTo(dir))
+
+	user := &mockoidc.MockUser{Subject: "recorded"}
+	_, err := m.CompleteCodeFlow(user, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	m.StopRecording()
+	_, err = m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	var names []string
+	for _, file := range files {
+		names = append(names, file.Name())
+	}
+	assert.Equal(t, []string{"0001-authorize.json", "0002-token.json", mockoidc.FixtureKeysFile}, names)
+
+	jwks, err := m.Keypair.JWKS()
+	assert.NoError(t, err)
+	keys, err := ioutil.ReadFile(filepath.Join(dir, mockoidc.FixtureKeysFile))
+	assert.NoError(t, err)
+	assert.Equal(t, jwks, keys)
+
+	var authorize, token mockoidc.Interaction
+	readInteraction(t, filepath.Join(dir, "0001-authorize.json"), &authorize)
+	assert.Equal(t, mockoidc.AuthorizationEndpoint, authorize.Endpoint)
+	assert.Equal(t, http.MethodGet, authorize.Method)
+	assert.Equal(t, "openid", authorize.Params.Get("scope"))
+	assert.Equal(t, http.StatusFound, authorize.StatusCode)
+	assert.NotEmpty(t, authorize.Header.Get("Location"))
+
+	readInteraction(t, filepath.Join(dir, "0002-token.json"), &token)
+	assert.Equal(t, http.MethodPost, token.Method)
+	assert.Equal(t, "authorization_code", token.Params.Get("grant_type"))
+	assert.Equal(t, http.StatusOK, token.StatusCode)
+	assert.Equal(t, "recorded", token.Tokens["id_token"]["sub"])
+	assert.Contains(t, token.Tokens, "access_token")
+	assert.Contains(t, token.Tokens, "refresh_token")
+	var body map[string]interface{}
+	assert.NoError(t, json.Unmarshal(token.Body, &body))
+	assert.Equal(t, "bearer", body["token_type"])
+}
+
+func readInteraction(t *testing.T, path string, interaction *mockoidc.Interaction) {
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, interaction))
+}
@@ -0,0 +1,199 @@
+package mockoidc
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultRedisKeyPrefix namespaces the session keys written to Redis
+const DefaultRedisKeyPrefix = "mockoidc:session:"
+
+// RedisOptions configure the connection of a Redis backed SessionStore
+type RedisOptions struct {
+	// Addr is the host:port of the Redis server
+	Addr     string
+	Password string
+	DB       int
+	// KeyPrefix defaults to DefaultRedisKeyPrefix
+	KeyPrefix string
+	// TTL expires sessions in Redis. It should exceed the RefreshTTL of the
+	// servers sharing the store; 0 keeps them forever.
+	TTL         time.Duration
+	DialTimeout time.Duration
+}
+
+// NewRedisSessionStore initializes a SessionStore persisted to Redis, so
+// several standalone MockOIDC replicas behind a load balancer share
+// sessions. Replicas must sign with the same Keypair. Only `*MockUser` Users
+// can be persisted.
+func NewRedisSessionStore(opts *RedisOptions) (*MemorySessionStore, error) {
+	if opts.KeyPrefix == "" {
+		opts.KeyPrefix = DefaultRedisKeyPrefix
+	}
+	client := &redisClient{opts: opts}
+	if _, err := client.do("PING"); err != nil {
+		return nil, err
+	}
+
+	ss := NewSessionStore()
+	ss.backend = &redisBackend{client: client}
+	return ss, nil
+}
+
+type redisBackend struct {
+	client *redisClient
+}
+
+func (b *redisBackend) persist(_ map[string]*Session, session *Session) error {
+	ps, err := newPersistedSession(session)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(ps)
+	if err != nil {
+		return err
+	}
+
+	args := []string{"SET", b.client.opts.KeyPrefix + session.SessionID, string(data)}
+	if ttl := b.client.opts.TTL; ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err = b.client.do(args...)
+	return err
+}
+
+func (b *redisBackend) remove(_ map[string]*Session, ids ...string) error {
+	args := []string{"DEL"}
+	for _, id := range ids {
+		args = append(args, b.client.opts.KeyPrefix+id)
+	}
+	_, err := b.client.do(args...)
+	return err
+}
+
+func (b *redisBackend) lookup(id string) (*Session, error) {
+	reply, err := b.client.do("GET", b.client.opts.KeyPrefix+id)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+	data, ok := reply.(string)
+	if !ok {
+		return nil, fmt.Errorf("unexpected redis reply %v", reply)
+	}
+
+	ps := &persistedSession{}
+	if err = json.Unmarshal([]byte(data), ps); err != nil {
+		return nil, err
+	}
+	return ps.session(), nil
+}
+
+// redisClient speaks just enough RESP for the session store over a single
+// lazily (re)established connection.
+type redisClient struct {
+	sync.Mutex
+	opts *RedisOptions
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// do sends a command and returns its reply: a string, an int64, nil for
+// missing values or an error.
+func (c *redisClient) do(args ...string) (interface{}, error) {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.roundTrip(args)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// The connection is in an unknown state, redial on the next command
+		c.conn.Close()
+		c.conn = nil
+	}
+	return reply, err
+}
+
+func (c *redisClient) connect() error {
+	conn, err := net.DialTimeout("tcp", c.opts.Addr, c.opts.DialTimeout)
+	if err != nil {
+		return err
+	}
+	c.conn = conn
+	c.rd = bufio.NewReader(conn)
+
+	if c.opts.Password != "" {
+		_, err = c.roundTrip([]string{"AUTH", c.opts.Password})
+	}
+	if err == nil && c.opts.DB != 0 {
+		_, err = c.roundTrip([]string{"SELECT", strconv.Itoa(c.opts.DB)})
+	}
+	if err != nil {
+		conn.Close()
+		c.conn = nil
+	}
+	return err
+}
+
+func (c *redisClient) roundTrip(args []string) (interface{}, error) {
+	buf := []byte("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		buf = append(buf, "$"+strconv.Itoa(len(arg))+"\r\n"+arg+"\r\n"...)
+	}
+	if _, err := c.conn.Write(buf); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *redisClient) readReply() (interface{}, error) {
+	line, err := c.rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed redis reply %q", line)
+	}
+	kind, payload := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return payload, nil
+	case '-':
+		return nil, redisError(payload)
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil {
+			return nil, err
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		data := make([]byte, size+2)
+		if _, err = io.ReadFull(c.rd, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	default:
+		return nil, fmt.Errorf("unsupported redis reply %q", line)
+	}
+}
@@ -0,0 +1,166 @@
+package mockoidc_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis implements the handful of RESP commands the session store uses
+type fakeRedis struct {
+	sync.Mutex
+	password string
+	values   map[string]string
+	ttls     map[string]string
+}
+
+func runFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	r := &fakeRedis{
+		password: password,
+		values:   make(map[string]string),
+		ttls:     make(map[string]string),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r, ln.Addr().String()
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	authed := r.password == ""
+	for {
+		args, err := readCommand(rd)
+		if err != nil {
+			return
+		}
+
+		r.Lock()
+		var reply string
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "AUTH":
+			authed = args[1] == r.password
+			reply = "+OK\r\n"
+			if !authed {
+				reply = "-WRONGPASS invalid password\r\n"
+			}
+		case !authed:
+			reply = "-NOAUTH Authentication required.\r\n"
+		case cmd == "PING":
+			reply = "+PONG\r\n"
+		case cmd == "SET":
+			r.values[args[1]] = args[2]
+			if len(args) == 5 {
+				r.ttls[args[1]] = args[4]
+			}
+			reply = "+OK\r\n"
+		case cmd == "DEL":
+			for _, key := range args[1:] {
+				delete(r.values, key)
+			}
+			reply = ":1\r\n"
+		case cmd == "GET":
+			value, ok := r.values[args[1]]
+			reply = "$-1\r\n"
+			if ok {
+				reply = fmt.Sprintf("$%d\r\n%s\r\n", len(value), value)
+			}
+		default:
+			reply = "-ERR unknown command\r\n"
+		}
+		r.Unlock()
+
+		if _, err = io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func readCommand(rd *bufio.Reader) ([]string, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if _, err = rd.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		arg, err := rd.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		args[i] = strings.TrimSuffix(arg, "\r\n")
+	}
+	return args, nil
+}
+
+func TestNewRedisSessionStore(t *testing.T) {
+	redis, addr := runFakeRedis(t, "hunter2")
+	opts := &mockoidc.RedisOptions{Addr: addr, Password: "hunter2", TTL: time.Hour}
+
+	replicaA, err := mockoidc.NewRedisSessionStore(opts)
+	assert.NoError(t, err)
+	replicaB, err := mockoidc.NewRedisSessionStore(opts)
+	assert.NoError(t, err)
+
+	session, err := replicaA.NewSession("openid email", "nonce", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+	redis.Lock()
+	assert.Equal(t, "3600000", redis.ttls[mockoidc.DefaultRedisKeyPrefix+session.SessionID])
+	redis.Unlock()
+
+	shared, err := replicaB.GetSessionByID(session.SessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"openid", "email"}, shared.Scopes)
+	assert.Equal(t, mockoidc.DefaultUser(), shared.User)
+	assert.False(t, shared.Granted)
+
+	shared.Granted = true
+	assert.NoError(t, replicaB.Save(shared))
+	granted, err := replicaA.GetSessionByID(session.SessionID)
+	assert.NoError(t, err)
+	assert.True(t, granted.Granted)
+
+	_, err = replicaA.GetSessionByID("missing")
+	assert.Error(t, err)
+
+	assert.NoError(t, replicaB.Delete(session.SessionID))
+	redis.Lock()
+	assert.Empty(t, redis.values)
+	redis.Unlock()
+}
+
+func TestNewRedisSessionStore_Errors(t *testing.T) {
+	_, addr := runFakeRedis(t, "hunter2")
+
+	_, err := mockoidc.NewRedisSessionStore(&mockoidc.RedisOptions{Addr: addr, Password: "wrong"})
+	assert.EqualError(t, err, "redis: WRONGPASS invalid password")
+
+	_, err = mockoidc.NewRedisSessionStore(&mockoidc.RedisOptions{Addr: addr})
+	assert.EqualError(t, err, "redis: NOAUTH Authentication required.")
+}
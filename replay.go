@@ -0,0 +1,308 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// replayedEndpoints serve recorded responses while replaying. Discovery &
+// the JWKS are always live, as they describe this server.
+var replayedEndpoints = []string{AuthorizationEndpoint, TokenEndpoint, UserinfoEndpoint}
+
+// timeClaims are shifted to the MockOIDC's clock in replayed tokens
+var timeClaims = []string{"iat", "exp", "nbf", "auth_time"}
+
+// replayer serves the Interactions of a fixture directory in order
+type replayer struct {
+	sync.Mutex
+	interactions []*Interaction
+	// nonce of the last replayed authorization request
+	nonce string
+}
+
+// LoadFixtures reads the Interactions recorded by RecordTo to the fixture
+// directory, in the order they were recorded.
+func LoadFixtures(dir string) ([]*Interaction, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		if !file.IsDir() && file.Name() != FixtureKeysFile && filepath.Ext(file.Name()) == ".json" {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+
+	interactions := make([]*Interaction, 0, len(names))
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		interaction := &Interaction{}
+		if err = json.Unmarshal(data, interaction); err != nil {
+			return nil, err
+		}
+		interactions = append(interactions, interaction)
+	}
+	return interactions, nil
+}
+
+// ReplayFrom serves the responses recorded to the fixture directory instead
+// of handling requests to the `authorization_endpoint`, `token_endpoint` &
+// `userinfo_endpoint`. Each request is answered with the next recorded
+// interaction of its endpoint & method, normalized so relying parties
+// accept it: the `state` of redirects is the one sent, and tokens, including
+// those in the fragment of implicit & hybrid flow redirects, are re-signed
+// with this server's keys after setting their issuer, shifting their times
+// to the clock and setting the nonce of the last authorization request. The
+// `at_hash` & `c_hash` of ID tokens are recomputed to match. Requests past
+// the end of the recording fail.
+func (m *MockOIDC) ReplayFrom(dir string) error {
+	interactions, err := LoadFixtures(dir)
+	if err != nil {
+		return err
+	}
+	if len(interactions) == 0 {
+		return errors.New("no interactions recorded in " + dir)
+	}
+
+	m.replayMu.Lock()
+	defer m.replayMu.Unlock()
+	m.replayer = &replayer{interactions: interactions}
+	return nil
+}
+
+// StopReplay handles requests live again after ReplayFrom
+func (m *MockOIDC) StopReplay() {
+	m.replayMu.Lock()
+	defer m.replayMu.Unlock()
+	m.replayer = nil
+}
+
+// replaying reports whether ReplayFrom is serving recorded responses
+func (m *MockOIDC) replaying() bool {
+	m.replayMu.Lock()
+	defer m.replayMu.Unlock()
+	return m.replayer != nil
+}
+
+// next pops the next Interaction recorded for the endpoint & method
+func (r *replayer) next(endpoint, method string) *Interaction {
+	r.Lock()
+	defer r.Unlock()
+	for i, interaction := range r.interactions {
+		if interaction.Endpoint == endpoint && interaction.Method == method {
+			r.interactions = append(r.interactions[:i:i], r.interactions[i+1:]...)
+			return interaction
+		}
+	}
+	return nil
+}
+
+// replayed wraps an endpoint handler to serve recorded responses while
+// replaying.
+func (m *MockOIDC) replayed(endpoint string, next http.Handler) http.Handler {
+	if !containsString(replayedEndpoints, endpoint) {
+		return next
+	}
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		m.replayMu.Lock()
+		rep := m.replayer
+		m.replayMu.Unlock()
+		if rep == nil {
+			next.ServeHTTP(rw, req)
+			return
+		}
+
+		if err := req.ParseForm(); err != nil {
+			internalServerError(rw, err.Error())
+			return
+		}
+		interaction := rep.next(endpoint, req.Method)
+		if interaction == nil {
+			internalServerError(rw, "No recorded interaction left for "+endpointName(endpoint))
+			return
+		}
+		if endpoint == AuthorizationEndpoint {
+			rep.Lock()
+			rep.nonce = req.Form.Get("nonce")
+			rep.Unlock()
+		}
+
+		body, err := m.normalizeBody(req, interaction, rep)
+		if err != nil {
+			internalServerError(rw, err.Error())
+			return
+		}
+		location, err := m.normalizeLocation(req, interaction.Header.Get("Location"), rep)
+		if err != nil {
+			internalServerError(rw, err.Error())
+			return
+		}
+		for key, values := range interaction.Header {
+			rw.Header()[key] = copyStrings(values)
+		}
+		if location != "" {
+			rw.Header().Set("Location", location)
+		}
+		rw.WriteHeader(interaction.StatusCode)
+		_, _ = rw.Write(body)
+	})
+}
+
+// normalizeBody re-signs the tokens of a recorded response body
+func (m *MockOIDC) normalizeBody(req *http.Request, interaction *Interaction, rep *replayer) ([]byte, error) {
+	if len(interaction.Body) == 0 {
+		return nil, nil
+	}
+	if interaction.Body[0] == '"' {
+		var text string
+		err := json.Unmarshal(interaction.Body, &text)
+		return []byte(text), err
+	}
+	if len(interaction.Tokens) == 0 {
+		return interaction.Body, nil
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(interaction.Body, &fields); err != nil {
+		return nil, err
+	}
+	tokens, err := m.resignTokens(req, rep, interaction.Tokens, "")
+	if err != nil {
+		return nil, err
+	}
+	for field, token := range tokens {
+		fields[field] = token
+	}
+	return json.Marshal(fields)
+}
+
+// normalizeLocation sets the state of a recorded redirect to the one
+// requested. Implicit & hybrid flow redirects have it in the fragment,
+// along with tokens that are re-signed like those of response bodies.
+func (m *MockOIDC) normalizeLocation(req *http.Request, location string, rep *replayer) (string, error) {
+	if location == "" {
+		return "", nil
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return location, nil
+	}
+	state := req.Form.Get("state")
+	if query := u.Query(); len(query["state"]) > 0 {
+		query.Set("state", state)
+		u.RawQuery = query.Encode()
+	}
+	fragment, err := url.ParseQuery(u.Fragment)
+	if err != nil || u.Fragment == "" {
+		return u.String(), nil
+	}
+
+	raw := map[string]string{}
+	for field := range fragment {
+		raw[field] = fragment.Get(field)
+	}
+	recorded := parseTokens(raw)
+	_, hasState := fragment["state"]
+	if !hasState && recorded == nil {
+		return u.String(), nil
+	}
+	if hasState {
+		fragment.Set("state", state)
+	}
+	tokens, err := m.resignTokens(req, rep, recorded, fragment.Get("code"))
+	if err != nil {
+		return "", err
+	}
+	for field, token := range tokens {
+		fragment.Set(field, token)
+	}
+	u.Fragment = ""
+	return u.String() + "#" + fragment.Encode(), nil
+}
+
+// resignTokens re-signs the claims of recorded tokens, by field, with this
+// server's keys after setting their issuer, shifting their times to the
+// clock and setting the nonce of the last authorization request. The
+// `at_hash`, `c_hash` & `s_hash` of the ID token are recomputed for the
+// re-signed access token, the code & the requested state.
+func (m *MockOIDC) resignTokens(req *http.Request, rep *replayer, recorded map[string]jwt.MapClaims,
+	code string) (map[string]string, error) {
+
+	rep.Lock()
+	nonce := rep.nonce
+	rep.Unlock()
+	issuer := m.requestConfig(req).Issuer
+	now := m.Now()
+	resign := func(recorded jwt.MapClaims, hashed map[string]string) (string, error) {
+		claims := jwt.MapClaims{}
+		for key, value := range recorded {
+			claims[key] = value
+		}
+		if _, ok := claims["iss"]; ok {
+			claims["iss"] = issuer
+		}
+		if _, ok := claims["nonce"]; ok {
+			claims["nonce"] = nonce
+		}
+		for claim, value := range hashed {
+			if _, ok := claims[claim]; ok && value != "" {
+				claims[claim] = tokenHash(value)
+			}
+		}
+		shiftTimes(claims, now)
+		return m.signingKey().SignJWT(claims)
+	}
+
+	tokens := make(map[string]string, len(recorded))
+	for field, claims := range recorded {
+		if field == "id_token" {
+			continue
+		}
+		token, err := resign(claims, nil)
+		if err != nil {
+			return nil, err
+		}
+		tokens[field] = token
+	}
+	// The ID token hashes the access token, so it's signed last
+	if claims, ok := recorded["id_token"]; ok {
+		token, err := resign(claims, map[string]string{
+			"at_hash": tokens["access_token"],
+			"c_hash":  code,
+			"s_hash":  req.Form.Get("state"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		tokens["id_token"] = token
+	}
+	return tokens, nil
+}
+
+// shiftTimes moves the time claims so the token was issued now
+func shiftTimes(claims jwt.MapClaims, now time.Time) {
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return
+	}
+	shift := float64(now.Unix()) - iat
+	for _, claim := range timeClaims {
+		if value, ok := claims[claim].(float64); ok {
+			claims[claim] = value + shift
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package mockoidc_test
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_ReplayFrom(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "fixtures")
+	recorded := mockoidc.RunTB(t)
+	assert.NoError(t, recorded.RecordTo(dir))
+	user := &mockoidc.MockUser{Subject: "recorded"}
+	_, err := recorded.CompleteCodeFlow(user, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+
+	interactions, err := mockoidc.LoadFixtures(dir)
+	assert.NoError(t, err)
+	assert.Len(t, interactions, 2)
+
+	m := mockoidc.RunTB(t)
+	assert.NoError(t, m.ReplayFrom(dir))
+	m.FastForward(time.Hour)
+
+	rr := testResponse(t, mockoidc.VersionEndpoint, m.Version, http.MethodGet, nil)
+	var info map[string]interface{}
+	assert.NoError(t, getJSON(rr, &info))
+	assert.Equal(t, []interface{}{"replay"}, info["fault_modes"])
+
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "recorded", tokens.IDTokenClaims["sub"])
+	assert.Equal(t, m.Issuer(), tokens.IDTokenClaims["iss"])
+	// The clock may tick past a second since the tokens were issued
+	assert.InDelta(t, float64(m.Now().Unix()), tokens.IDTokenClaims["iat"], 1)
+	assert.NoError(t, m.ValidateAgainstJWKS(tokens.IDToken))
+	assert.NoError(t, m.ValidateAgainstJWKS(tokens.AccessToken))
+
+	// Nothing was handled live
+	assert.Equal(t, "", m.Requests(mockoidc.AuthorizationEndpoint)[0].SessionID)
+
+	_, err = m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.EqualError(t, err, "authorize: unexpected status code 500: "+
+		"internal_server_error: No recorded interaction left for authorize")
+
+	m.StopReplay()
+	tokens, err = m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.DefaultUser().ID(), tokens.IDTokenClaims["sub"])
+}
+
+func TestMockOIDC_ReplayFrom_Fragment(t *testing.T) {
+	authorize := func(m *mockoidc.MockOIDC, state, nonce string) url.Values {
+		resp, err := httpClient.Get(m.AuthorizationEndpoint() + "?" + url.Values{
+			"client_id":     {m.ClientID},
+			"response_type": {"code id_token token"},
+			"redirect_uri":  {"https://app.example.com/callback"},
+			"scope":         {"openid"},
+			"state":         {state},
+			"nonce":         {nonce},
+		}.Encode())
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusFound, resp.StatusCode)
+		location, err := resp.Location()
+		assert.NoError(t, err)
+		fragment, err := url.ParseQuery(location.Fragment)
+		assert.NoError(t, err)
+		return fragment
+	}
+	hash := func(value string) string {
+		sum := sha256.Sum256([]byte(value))
+		return base64.RawURLEncoding.EncodeToString(sum[:16])
+	}
+
+	dir := filepath.Join(t.TempDir(), "fixtures")
+	recorded := mockoidc.RunTB(t)
+	assert.NoError(t, recorded.RecordTo(dir))
+	authorize(recorded, "recorded-state", "recorded-nonce")
+
+	m := mockoidc.RunTB(t)
+	assert.NoError(t, m.ReplayFrom(dir))
+	fragment := authorize(m, "state", "nonce")
+	assert.Equal(t, "state", fragment.Get("state"))
+
+	assert.NoError(t, m.ValidateAgainstJWKS(fragment.Get("access_token")))
+	assert.NoError(t, m.ValidateAgainstJWKS(fragment.Get("id_token")))
+	claims := jwt.MapClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(fragment.Get("id_token"), claims)
+	assert.NoError(t, err)
+	assert.Equal(t, m.Issuer(), claims["iss"])
+	assert.Equal(t, "nonce", claims["nonce"])
+	assert.Equal(t, hash(fragment.Get("code")), claims["c_hash"])
+	assert.Equal(t, hash(fragment.Get("access_token")), claims["at_hash"])
+}
+
+func TestMockOIDC_ReplayFrom_Empty(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	assert.Error(t, m.ReplayFrom(t.TempDir()))
+	assert.Error(t, m.ReplayFrom(filepath.Join(t.TempDir(), "missing")))
+}
@@ -0,0 +1,119 @@
+package mockoidc
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// RevocationEndpoint implements RFC 7009 token revocation. It is advertised
+// as the `revocation_endpoint` in the discovery document.
+const RevocationEndpoint = "/oidc/revoke"
+
+// RevocationEndpoint returns the OAuth2 `revocation_endpoint`
+func (m *MockOIDC) RevocationEndpoint() string {
+	if m.Server == nil {
+		return ""
+	}
+	return m.Addr() + m.endpointPath(RevocationEndpoint)
+}
+
+// Revoke implements the `revocation_endpoint`. Revoking any token of a
+// Session revokes all its tokens. Per RFC 7009, unknown & invalid tokens
+// are answered with a `200` as well, but the client must be the one the
+// token was issued to.
+func (m *MockOIDC) Revoke(rw http.ResponseWriter, req *http.Request) {
+	if err := req.ParseForm(); err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+
+	config := m.requestConfig(req)
+	if !m.clientAuthMethod(rw, req) {
+		return
+	}
+	required := []string{"client_id", "client_secret", "token"}
+	if m.publicClient(config, req.Form.Get("client_id")) || m.keyAuthenticated(req) {
+		// RFC 7009 §2.1 lets public clients revoke their tokens with only
+		// their client_id
+		required = []string{"client_id", "token"}
+	}
+	if !assertPresence(required, rw, req) {
+		return
+	}
+	if !m.validateClient(config, true, rw, req) {
+		return
+	}
+
+	token, err := m.verifySignature(req.Form.Get("token"))
+	if err != nil {
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+	if claims, ok := token.Claims.(jwt.MapClaims); !ok || !containsString(audiences(claims), config.ClientID) {
+		errorResponse(rw, UnauthorizedClient,
+			fmt.Sprintf("The token wasn't issued to %s", config.ClientID), http.StatusBadRequest)
+		return
+	}
+	session, err := m.SessionStore.GetSessionByToken(token)
+	if err != nil {
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+	if !session.Revoked {
+		if err = m.revokeSession(session); err != nil {
+			internalServerError(rw, err.Error())
+			return
+		}
+		m.emit(EventSessionRevoked, session, req)
+	}
+	rw.WriteHeader(http.StatusOK)
+}
+
+// RevokeSession revokes the tokens of a Session, like an administrator
+// killing it at the provider: relying parties get an `invalid_grant` when
+// they refresh them and have to send the user through a new login.
+func (m *MockOIDC) RevokeSession(sessionID string) error {
+	session, err := m.SessionStore.GetSessionByID(sessionID)
+	if err != nil {
+		return err
+	}
+	if session.Revoked {
+		return nil
+	}
+	if err = m.revokeSession(session); err != nil {
+		return err
+	}
+	m.emit(EventSessionRevoked, session, nil)
+	return nil
+}
+
+// revokeSession stops the Session's access & refresh tokens from being
+// accepted
+func (m *MockOIDC) revokeSession(session *Session) error {
+	if session.Revoked {
+		return nil
+	}
+	session.Revoked = true
+	if err := m.SessionStore.Save(session); err != nil {
+		return err
+	}
+	m.logger().Info("session revoked", "session_id", session.SessionID)
+	return nil
+}
+
+// codeReused revokes the tokens issued from a code presented again, as RFC
+// 6749 §4.1.2 recommends, since it may have been intercepted. It returns
+// false if it already responded.
+func (m *MockOIDC) codeReused(session *Session, rw http.ResponseWriter, req *http.Request) bool {
+	if err := m.revokeSession(session); err != nil {
+		internalServerError(rw, err.Error())
+		return false
+	}
+	if m.Metrics != nil {
+		m.Metrics.ObserveCodeReuse()
+	}
+	m.emit(EventCodeReused, session, req)
+	return runHook(m.OnCodeReused, session, rw, req)
+}
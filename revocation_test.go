@@ -0,0 +1,175 @@
+package mockoidc_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_CodeReuseRevokesTokens(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.Metrics = mockoidc.NewMetrics()
+	events, unsubscribe := m.Subscribe(8)
+	defer unsubscribe()
+	var hooked []string
+	m.OnCodeReused = func(session *mockoidc.Session, _ *http.Request) error {
+		hooked = append(hooked, session.SessionID)
+		return nil
+	}
+
+	session, err := m.SessionStore.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+	data := url.Values{}
+	data.Set("client_id", m.ClientID)
+	data.Set("client_secret", m.ClientSecret)
+	data.Set("grant_type", "authorization_code")
+	data.Set("code", session.SessionID)
+
+	rr := testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	tokens := map[string]interface{}{}
+	assert.NoError(t, getJSON(rr, &tokens))
+	userinfo := func() int {
+		rr := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, mockoidc.UserinfoEndpoint, nil)
+		req.Header.Set("Authorization", "Bearer "+tokens["access_token"].(string))
+		m.Userinfo(rr, req)
+		return rr.Code
+	}
+	assert.Equal(t, http.StatusOK, userinfo())
+
+	// The replayed code is rejected and its tokens revoked
+	rr = testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, data)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Body.String(), mockoidc.InvalidGrant)
+	assert.Equal(t, http.StatusUnauthorized, userinfo())
+
+	refresh := url.Values{}
+	refresh.Set("client_id", m.ClientID)
+	refresh.Set("client_secret", m.ClientSecret)
+	refresh.Set("grant_type", "refresh_token")
+	refresh.Set("refresh_token", tokens["refresh_token"].(string))
+	rr = testResponse(t, mockoidc.TokenEndpoint, m.Token, http.MethodPost, refresh)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	stored, err := m.SessionStore.GetSessionByID(session.SessionID)
+	assert.NoError(t, err)
+	assert.True(t, stored.Revoked)
+	assert.Equal(t, []string{session.SessionID}, hooked)
+	assert.Equal(t, mockoidc.EventTokenIssued, (<-events).Type)
+	assert.Equal(t, mockoidc.EventCodeReused, (<-events).Type)
+	var b bytes.Buffer
+	_, err = m.Metrics.WriteTo(&b)
+	assert.NoError(t, err)
+	assert.Contains(t, b.String(), "mockoidc_codes_reused_total 1\n")
+}
+
+func TestMockOIDC_RevokedSessionsRejectRefresh(t *testing.T) {
+	for name, revoke := range map[string]func(*mockoidc.MockOIDC, *mockoidc.TokenSet) *http.Response{
+		"revocation endpoint": func(m *mockoidc.MockOIDC, tokens *mockoidc.TokenSet) *http.Response {
+			resp, err := httpClient.PostForm(m.RevocationEndpoint(), url.Values{
+				"client_id":     {m.ClientID},
+				"client_secret": {m.ClientSecret},
+				"token":         {tokens.AccessToken},
+			})
+			assert.NoError(t, err)
+			return resp
+		},
+		"logout": func(m *mockoidc.MockOIDC, tokens *mockoidc.TokenSet) *http.Response {
+			resp, err := httpClient.PostForm(m.EndSessionEndpoint(),
+				url.Values{"id_token_hint": {tokens.IDToken}})
+			assert.NoError(t, err)
+			return resp
+		},
+		"admin kill": func(m *mockoidc.MockOIDC, tokens *mockoidc.TokenSet) *http.Response {
+			assert.NoError(t, m.RevokeSession(tokens.IDTokenClaims["jti"].(string)))
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := mockoidc.RunTB(t)
+			tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", []string{"openid"})
+			assert.NoError(t, err)
+			var rejected []string
+			m.OnRefreshRejected = func(session *mockoidc.Session, _ *http.Request) error {
+				rejected = append(rejected, session.SessionID)
+				return nil
+			}
+			events, unsubscribe := m.Subscribe(8)
+			defer unsubscribe()
+
+			resp := revoke(m, tokens)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			resp, err = httpClient.PostForm(m.TokenEndpoint(), url.Values{
+				"client_id":     {m.ClientID},
+				"client_secret": {m.ClientSecret},
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {tokens.RefreshToken},
+			})
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+			body := make(map[string]interface{})
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.Equal(t, mockoidc.InvalidGrant, body["error"])
+
+			sessionID := tokens.IDTokenClaims["jti"].(string)
+			assert.Equal(t, []string{sessionID}, rejected)
+			event := <-events
+			assert.Contains(t, []mockoidc.EventType{
+				mockoidc.EventSessionRevoked, mockoidc.EventSessionEnded,
+			}, event.Type)
+			assert.Equal(t, sessionID, event.SessionID)
+			assert.Equal(t, mockoidc.EventRefreshRejected, (<-events).Type)
+		})
+	}
+}
+
+func TestMockOIDC_Revoke(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", []string{"openid"})
+	assert.NoError(t, err)
+	m.ClientStore.(*mockoidc.MemoryClientStore).Add(&mockoidc.Client{
+		ID:     "other-client",
+		Secret: "other-secret",
+	})
+
+	revoke := func(clientID, clientSecret, token string) *http.Response {
+		resp, err := httpClient.PostForm(m.RevocationEndpoint(), url.Values{
+			"client_id":     {clientID},
+			"client_secret": {clientSecret},
+			"token":         {token},
+		})
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+	assert.Equal(t, http.StatusOK, revoke(m.ClientID, m.ClientSecret, "unknown").StatusCode)
+	assert.Equal(t, http.StatusUnauthorized, revoke(m.ClientID, "wrong", tokens.RefreshToken).StatusCode)
+	assert.Equal(t, http.StatusBadRequest,
+		revoke("other-client", "other-secret", tokens.RefreshToken).StatusCode)
+
+	// Revoking the refresh token revokes the access token too
+	req, err := http.NewRequest(http.MethodGet, m.UserinfoEndpoint(), nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	resp, err := httpClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	assert.Equal(t, http.StatusOK, revoke(m.ClientID, m.ClientSecret, tokens.RefreshToken).StatusCode)
+	resp, err = httpClient.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
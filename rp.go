@@ -0,0 +1,171 @@
+package mockoidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// RelyingParty endpoints, relative to wherever the RelyingParty is served
+const (
+	RPLoginEndpoint    = "/rp/login"
+	RPCallbackEndpoint = "/rp/callback"
+)
+
+const (
+	rpStateCookie = "mockoidc_rp_state"
+	rpNonceCookie = "mockoidc_rp_nonce"
+)
+
+// RelyingParty is a minimal relying party performing the authorization code
+// flow: `RPLoginEndpoint` redirects to the `authorization_endpoint` and
+// `RPCallbackEndpoint` exchanges the code, verifies the ID token and renders
+// an `RPResult` as JSON. It is useful to self-test a MockOIDC, and as the
+// target of tests of proxies sitting between a relying party and the OP: point
+// the OAuth2 endpoints at the proxy.
+type RelyingParty struct {
+	// OAuth2 is the client configuration. An empty RedirectURL is derived
+	// from the host of the login request.
+	OAuth2 *oauth2.Config
+	// Verifier verifies the ID tokens received at the callback
+	Verifier *oidc.IDTokenVerifier
+	// HTTPClient exchanges codes, http.DefaultClient if nil
+	HTTPClient *http.Client
+}
+
+// RPResult is the outcome of a login rendered by the RelyingParty callback
+type RPResult struct {
+	Subject      string                 `json:"subject"`
+	Claims       map[string]interface{} `json:"claims"`
+	AccessToken  string                 `json:"access_token"`
+	RefreshToken string                 `json:"refresh_token,omitempty"`
+	IDToken      string                 `json:"id_token"`
+}
+
+// RelyingParty returns a RelyingParty for this started MockOIDC's client.
+// Its redirect URL is derived from the requests it serves.
+func (m *MockOIDC) RelyingParty(ctx context.Context) (*RelyingParty, error) {
+	_, verifier, err := m.OIDCProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &RelyingParty{
+		OAuth2:     m.OAuth2Config(""),
+		Verifier:   verifier,
+		HTTPClient: m.selfClient(),
+	}, nil
+}
+
+// ServeHTTP dispatches `RPLoginEndpoint` & `RPCallbackEndpoint` requests
+func (rp *RelyingParty) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	switch {
+	case strings.HasSuffix(req.URL.Path, RPLoginEndpoint):
+		rp.Login(rw, req)
+	case strings.HasSuffix(req.URL.Path, RPCallbackEndpoint):
+		rp.Callback(rw, req)
+	default:
+		http.NotFound(rw, req)
+	}
+}
+
+// Login starts a code flow, keeping its state & nonce in cookies
+func (rp *RelyingParty) Login(rw http.ResponseWriter, req *http.Request) {
+	state, err := randomNonce(16)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	nonce, err := randomNonce(16)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	for name, value := range map[string]string{rpStateCookie: state, rpNonceCookie: nonce} {
+		http.SetCookie(rw, &http.Cookie{
+			Name:     name,
+			Value:    value,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	config := rp.config(req)
+	http.Redirect(rw, req, config.AuthCodeURL(state, oidc.Nonce(nonce)), http.StatusFound)
+}
+
+// Callback checks the state, exchanges the code and verifies the ID token
+// & its nonce. Errors redirected by the OP are rendered as they came.
+func (rp *RelyingParty) Callback(rw http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	if query.Get("error") != "" {
+		errorResponse(rw, query.Get("error"), query.Get("error_description"),
+			http.StatusBadRequest)
+		return
+	}
+	state, err := req.Cookie(rpStateCookie)
+	if err != nil || state.Value != query.Get("state") {
+		errorResponse(rw, InvalidRequest, "State does not match the login", http.StatusBadRequest)
+		return
+	}
+
+	ctx := req.Context()
+	if rp.HTTPClient != nil {
+		ctx = context.WithValue(ctx, oauth2.HTTPClient, rp.HTTPClient)
+	}
+	token, err := rp.config(req).Exchange(ctx, query.Get("code"))
+	if err != nil {
+		errorResponse(rw, InvalidRequest, err.Error(), http.StatusBadGateway)
+		return
+	}
+	rawIDToken, _ := token.Extra("id_token").(string)
+	idToken, err := rp.Verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		errorResponse(rw, InvalidRequest, err.Error(), http.StatusBadGateway)
+		return
+	}
+	nonce, err := req.Cookie(rpNonceCookie)
+	if err != nil || nonce.Value != idToken.Nonce {
+		errorResponse(rw, InvalidRequest, "Nonce does not match the login", http.StatusBadGateway)
+		return
+	}
+
+	result := &RPResult{
+		Subject:      idToken.Subject,
+		AccessToken:  token.AccessToken,
+		RefreshToken: token.RefreshToken,
+		IDToken:      rawIDToken,
+	}
+	if err = idToken.Claims(&result.Claims); err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	resp, err := json.Marshal(result)
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	jsonResponse(rw, resp)
+}
+
+// config defaults the RedirectURL to the `RPCallbackEndpoint` next to the
+// endpoint serving the request
+func (rp *RelyingParty) config(req *http.Request) *oauth2.Config {
+	if rp.OAuth2.RedirectURL != "" {
+		return rp.OAuth2
+	}
+	config := *rp.OAuth2
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+	prefix := req.URL.Path
+	for _, endpoint := range []string{RPLoginEndpoint, RPCallbackEndpoint} {
+		prefix = strings.TrimSuffix(prefix, endpoint)
+	}
+	config.RedirectURL = scheme + "://" + req.Host + prefix + RPCallbackEndpoint
+	return &config
+}
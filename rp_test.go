@@ -0,0 +1,60 @@
+package mockoidc_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRelyingParty(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+	rp, err := m.RelyingParty(context.Background())
+	assert.NoError(t, err)
+	server := httptest.NewServer(rp)
+	defer server.Close()
+
+	m.QueueUser(&mockoidc.MockUser{Subject: "rp-user", Email: "rp@example.com"})
+	jar, err := cookiejar.New(nil)
+	assert.NoError(t, err)
+	browser := &http.Client{Jar: jar}
+	resp, err := browser.Get(server.URL + mockoidc.RPLoginEndpoint)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, mockoidc.RPCallbackEndpoint, resp.Request.URL.Path)
+
+	result := &mockoidc.RPResult{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(result))
+	assert.Equal(t, "rp-user", result.Subject)
+	assert.Equal(t, m.Issuer(), result.Claims["iss"])
+	assert.NotEmpty(t, result.AccessToken)
+	assert.NotEmpty(t, result.IDToken)
+	assert.EqualValues(t, 1, m.RequestCount(mockoidc.TokenEndpoint))
+
+	// A callback that wasn't started by this browser's login
+	resp, err = httpClient.Get(server.URL + mockoidc.RPCallbackEndpoint + "?code=x&state=y")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp, err = httpClient.Get(server.URL + mockoidc.RPCallbackEndpoint + "?error=access_denied")
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	body := map[string]string{}
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "access_denied", body["error"])
+
+	resp, err = httpClient.Get(server.URL + "/rp/other")
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,84 @@
+package mockoidc
+
+import "net/http"
+
+// Scenario is a sequence of logins & failures a MockOIDC plays back in
+// order, e.g.
+//
+//	NewScenario().
+//		Login(userA).
+//		Fail(TokenEndpoint, &ServerError{Code: 503, Error: "temporarily_unavailable"}).
+//		Login(userB)
+//
+// Each step is consumed by the next request to its endpoint once the steps
+// before it were played. Requests that don't match the next step are
+// handled as usual.
+type Scenario struct {
+	steps []scenarioStep
+}
+
+type scenarioStep struct {
+	endpoint string
+	user     User
+	err      *ServerError
+}
+
+// NewScenario starts an empty Scenario
+func NewScenario() *Scenario {
+	return &Scenario{}
+}
+
+// Login adds a step logging in the user at the `authorization_endpoint`
+func (s *Scenario) Login(user User) *Scenario {
+	s.steps = append(s.steps, scenarioStep{endpoint: AuthorizationEndpoint, user: user})
+	return s
+}
+
+// Fail adds a step answering one request to the endpoint (one of the
+// `*Endpoint` constants) with the error
+func (s *Scenario) Fail(endpoint string, se *ServerError) *Scenario {
+	s.steps = append(s.steps, scenarioStep{endpoint: endpoint, err: se})
+	return s
+}
+
+// Play replaces the Scenario being played back. Reset stops it.
+func (m *MockOIDC) Play(s *Scenario) {
+	m.scenarioMu.Lock()
+	defer m.scenarioMu.Unlock()
+	m.scenario = append([]scenarioStep(nil), s.steps...)
+}
+
+// PendingSteps returns the number of steps of the played Scenario that
+// haven't been reached yet.
+func (m *MockOIDC) PendingSteps() int {
+	m.scenarioMu.Lock()
+	defer m.scenarioMu.Unlock()
+	return len(m.scenario)
+}
+
+// nextStep pops the next step of the Scenario if it's for the endpoint
+func (m *MockOIDC) nextStep(endpoint string) (scenarioStep, bool) {
+	m.scenarioMu.Lock()
+	defer m.scenarioMu.Unlock()
+	if len(m.scenario) == 0 || m.scenario[0].endpoint != endpoint {
+		return scenarioStep{}, false
+	}
+	step := m.scenario[0]
+	m.scenario = m.scenario[1:]
+	return step, true
+}
+
+// scripted plays the steps of the Scenario for the endpoint
+func (m *MockOIDC) scripted(endpoint string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		step, ok := m.nextStep(endpoint)
+		switch {
+		case ok && step.err != nil:
+			errorResponse(rw, step.err.Error, step.err.Description, step.err.Code)
+			return
+		case ok && step.user != nil:
+			m.queueUserFirst(step.user)
+		}
+		next.ServeHTTP(rw, req)
+	})
+}
@@ -0,0 +1,51 @@
+package mockoidc_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Play(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	callback := "https://app.example.com/callback"
+
+	m.Play(mockoidc.NewScenario().
+		Login(&mockoidc.MockUser{Subject: "user-a"}).
+		Fail(mockoidc.TokenEndpoint, &mockoidc.ServerError{
+			Code:  http.StatusServiceUnavailable,
+			Error: "temporarily_unavailable",
+		}).
+		Login(&mockoidc.MockUser{Subject: "user-b", Groups: []string{"admins"}}))
+	assert.Equal(t, 3, m.PendingSteps())
+
+	// user-a logs in, then its code exchange fails
+	_, err := m.CompleteCodeFlow(nil, callback, nil)
+	assert.EqualError(t, err, "token: unexpected status code 503: temporarily_unavailable")
+	assert.Equal(t, 1, m.PendingSteps())
+	authorized := m.Requests(mockoidc.AuthorizationEndpoint)
+	assert.Len(t, authorized, 1)
+	session, err := m.SessionStore.GetSessionByID(authorized[0].SessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, "user-a", session.User.ID())
+
+	tokens, err := m.CompleteCodeFlow(nil, callback, []string{"openid", "groups"})
+	assert.NoError(t, err)
+	assert.Equal(t, "user-b", tokens.IDTokenClaims["sub"])
+	assert.Equal(t, []interface{}{"admins"}, tokens.IDTokenClaims["groups"])
+	assert.Equal(t, 0, m.PendingSteps())
+
+	// Played out, requests are handled as usual
+	tokens, err = m.CompleteCodeFlow(nil, callback, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, mockoidc.DefaultUser().ID(), tokens.IDTokenClaims["sub"])
+
+	m.Play(mockoidc.NewScenario().Fail(mockoidc.UserinfoEndpoint, &mockoidc.ServerError{
+		Code:  http.StatusInternalServerError,
+		Error: "server_error",
+	}))
+	assert.NoError(t, m.Reset())
+	assert.Equal(t, 0, m.PendingSteps())
+}
@@ -1,8 +1,10 @@
 package mockoidc
 
 import (
+	"container/list"
 	"errors"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -15,59 +17,300 @@ type Session struct {
 	OIDCNonce string
 	User      User
 	Granted   bool
+
+	// CodeChallenge & CodeChallengeMethod are the PKCE parameters of the
+	// authorization request, if any
+	CodeChallenge       string
+	CodeChallengeMethod string
+
+	// RedirectURI is the `redirect_uri` of the authorization request, that
+	// the code exchange must present too
+	RedirectURI string
+	// State is the `state` of the authorization request, whose `s_hash`
+	// FAPIMode adds to the ID tokens
+	State string
+
+	// UILocales & Display are the `ui_locales` (in order of preference) and
+	// `display` of the authorization request, if any
+	UILocales []string
+	Display   string
+
+	// Hints are the `*_hint` parameters (e.g. `login_hint`, `kc_idp_hint`,
+	// `domain_hint`) and `HintParams` of the authorization request, for
+	// hooks & tests to assert what a relying party forwarded
+	Hints map[string]string
+
+	// ClientID is the `client_id` of the authorization request, whose
+	// `ClaimMappings` apply to the Session's claims
+	ClientID string
+	// ClaimsRequest is the parsed `claims` parameter of the authorization
+	// request, if any
+	ClaimsRequest *ClaimsRequest
+
+	// IntrospectionExtras are added to the introspection responses of the
+	// Session's tokens, overriding the fields MockOIDC derives
+	IntrospectionExtras map[string]interface{}
+
+	// Revoked Sessions don't accept their access & refresh tokens anymore
+	Revoked bool
+
+	// CertificateThumbprint is the `x5t#S256` of the client certificate the
+	// Session's tokens were last requested with, which binds its access
+	// tokens to the certificate (RFC 8705 §3)
+	CertificateThumbprint string
+
+	// IssuedAt is when the code or refresh token of the Session was issued
+	// as seen by MockOIDC's clock. Sessions without it never expire.
+	IssuedAt time.Time
+	// AuthTime is when the User logged in, the `auth_time` of the Session's
+	// ID tokens. Refreshes don't change it.
+	AuthTime time.Time
 }
 
-// SessionStore manages our Session objects
-type SessionStore struct {
+// SessionStore manages our Session objects. `MemorySessionStore` is the
+// default; custom implementations (e.g. embedding it) can script faults like
+// sessions lost between the authorize & token requests.
+type SessionStore interface {
+	// NewSession creates a new Session for a User
+	NewSession(scope string, nonce string, user User) (*Session, error)
+	// GetSessionByID looks up the Session
+	GetSessionByID(id string) (*Session, error)
+	// GetSessionByToken looks up a Session based on the session ID claim
+	GetSessionByToken(token *jwt.Token) (*Session, error)
+	// Save persists changes made to a Session in the store
+	Save(session *Session) error
+	// Delete removes a Session from the store
+	Delete(id string) error
+	// GC deletes all Sessions expired returns true for and returns how
+	// many were deleted
+	GC(expired func(*Session) bool) (int, error)
+	// QueueCode sets the ID of the next new Session, which doubles as its
+	// authorization code
+	QueueCode(code string)
+}
+
+// MemorySessionStore keeps Sessions in a map, optionally persisting them
+type MemorySessionStore struct {
+	sync.Mutex
 	Store     map[string]*Session
 	CodeQueue *CodeQueue
+
+	// MaxSessions caps the Sessions in the store by evicting the least
+	// recently used ones. Zero means no limit.
+	MaxSessions int
+	// OnEvict is called with the store locked for every evicted Session. A
+	// MockOIDC serving the store logs & counts evictions if it isn't set.
+	OnEvict func(*Session)
+
+	// Least recently used session IDs are at the back
+	lru      *list.List
+	elements map[string]*list.Element
+
+	// Set when persisted with `NewFileSessionStore` or `NewRedisSessionStore`
+	backend sessionBackend
+}
+
+// sessionBackend persists Sessions outside of the in-memory Store
+type sessionBackend interface {
+	// persist saves changes to session; store holds all known sessions
+	persist(store map[string]*Session, session *Session) error
+	// remove deletes sessions already removed from store
+	remove(store map[string]*Session, ids ...string) error
+	// lookup returns nil if the backend doesn't know the session
+	lookup(id string) (*Session, error)
 }
 
 // IDTokenClaims are the mandatory claims any User.Claims implementation
 // should use in their jwt.Claims building.
 type IDTokenClaims struct {
-	Nonce string `json:"nonce,omitempty"`
+	Nonce    string `json:"nonce,omitempty"`
+	AuthTime int64  `json:"auth_time,omitempty"`
 	*jwt.StandardClaims
 }
 
-// NewSessionStore initializes the SessionStore for this server
-func NewSessionStore() *SessionStore {
-	return &SessionStore{
+// NewSessionStore initializes the default SessionStore for this server
+func NewSessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
 		Store:     make(map[string]*Session),
 		CodeQueue: &CodeQueue{},
+		lru:       list.New(),
+		elements:  make(map[string]*list.Element),
 	}
 }
 
 // NewSession creates a new Session for a User
-func (ss *SessionStore) NewSession(scope string, nonce string, user User) (*Session, error) {
+func (ss *MemorySessionStore) NewSession(scope string, nonce string, user User) (*Session, error) {
 	sessionID, err := ss.CodeQueue.Pop()
 	if err != nil {
 		return nil, err
 	}
+	return ss.NewSessionWithID(sessionID, scope, nonce, user)
+}
 
+// NewSessionWithID creates a new Session for a User with a preset ID, the
+// code returned by the `authorization_endpoint`.
+func (ss *MemorySessionStore) NewSessionWithID(sessionID, scope, nonce string, user User) (*Session, error) {
 	session := &Session{
 		SessionID: sessionID,
 		Scopes:    strings.Split(scope, " "),
 		OIDCNonce: nonce,
 		User:      user,
 	}
+
+	ss.Lock()
+	defer ss.Unlock()
 	ss.Store[sessionID] = session
+	if err := ss.persist(session); err != nil {
+		delete(ss.Store, sessionID)
+		return nil, err
+	}
+	ss.touch(sessionID)
+	if err := ss.evict(); err != nil {
+		return nil, err
+	}
 
 	return session, nil
 }
 
 // GetSessionByID looks up the Session
-func (ss *SessionStore) GetSessionByID(id string) (*Session, error) {
+func (ss *MemorySessionStore) GetSessionByID(id string) (*Session, error) {
+	ss.Lock()
+	defer ss.Unlock()
+
+	if ss.backend != nil {
+		session, err := ss.backend.lookup(id)
+		if err != nil {
+			return nil, err
+		}
+		if session != nil {
+			ss.Store[id] = session
+			ss.touch(id)
+			return session, nil
+		}
+	}
+
 	session, ok := ss.Store[id]
 	if !ok {
 		return nil, errors.New("session not found")
 	}
+	ss.touch(id)
 	return session, nil
 }
 
+// Save persists changes made to a Session in the store. It is a no-op for
+// in-memory stores.
+func (ss *MemorySessionStore) Save(session *Session) error {
+	ss.Lock()
+	defer ss.Unlock()
+	ss.touch(session.SessionID)
+	return ss.persist(session)
+}
+
+// persist saves session to the backend if set. The caller must hold the lock.
+func (ss *MemorySessionStore) persist(session *Session) error {
+	if ss.backend == nil {
+		return nil
+	}
+	return ss.backend.persist(ss.Store, session)
+}
+
+// Delete removes a Session from the store
+func (ss *MemorySessionStore) Delete(id string) error {
+	ss.Lock()
+	defer ss.Unlock()
+
+	delete(ss.Store, id)
+	ss.untouch(id)
+	return ss.remove(id)
+}
+
+// GC deletes all Sessions expired returns true for
+func (ss *MemorySessionStore) GC(expired func(*Session) bool) (int, error) {
+	ss.Lock()
+	defer ss.Unlock()
+
+	var ids []string
+	for id, session := range ss.Store {
+		if expired(session) {
+			delete(ss.Store, id)
+			ss.untouch(id)
+			ids = append(ids, id)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	return len(ids), ss.remove(ids...)
+}
+
+// QueueCode sets the ID of the next new Session
+func (ss *MemorySessionStore) QueueCode(code string) {
+	ss.CodeQueue.Push(code)
+}
+
+// touch marks the session as most recently used. The caller must hold the
+// lock.
+func (ss *MemorySessionStore) touch(id string) {
+	if ss.lru == nil {
+		ss.lru = list.New()
+		ss.elements = make(map[string]*list.Element)
+	}
+	if element, ok := ss.elements[id]; ok {
+		ss.lru.MoveToFront(element)
+		return
+	}
+	ss.elements[id] = ss.lru.PushFront(id)
+}
+
+// untouch stops tracking the usage of a session. The caller must hold the
+// lock.
+func (ss *MemorySessionStore) untouch(id string) {
+	if element, ok := ss.elements[id]; ok {
+		ss.lru.Remove(element)
+		delete(ss.elements, id)
+	}
+}
+
+// evict deletes the least recently used sessions above MaxSessions. The
+// caller must hold the lock.
+func (ss *MemorySessionStore) evict() error {
+	if ss.MaxSessions <= 0 {
+		return nil
+	}
+
+	var evicted []string
+	for len(ss.Store) > ss.MaxSessions && ss.lru.Len() > 0 {
+		id := ss.lru.Remove(ss.lru.Back()).(string)
+		delete(ss.elements, id)
+
+		session, ok := ss.Store[id]
+		if !ok {
+			continue
+		}
+		delete(ss.Store, id)
+		evicted = append(evicted, id)
+		if ss.OnEvict != nil {
+			ss.OnEvict(session)
+		}
+	}
+	if len(evicted) == 0 {
+		return nil
+	}
+	return ss.remove(evicted...)
+}
+
+// remove deletes sessions from the backend if set. The caller must hold
+// the lock.
+func (ss *MemorySessionStore) remove(ids ...string) error {
+	if ss.backend == nil {
+		return nil
+	}
+	return ss.backend.remove(ss.Store, ids...)
+}
+
 // GetSessionByToken decodes a token and looks up a Session based on the
 // session ID claim.
-func (ss *SessionStore) GetSessionByToken(token *jwt.Token) (*Session, error) {
+func (ss *MemorySessionStore) GetSessionByToken(token *jwt.Token) (*Session, error) {
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok || !token.Valid {
 		return nil, errors.New("invalid token")
@@ -80,7 +323,20 @@ func (ss *SessionStore) GetSessionByToken(token *jwt.Token) (*Session, error) {
 // AccessToken returns the JWT token with the appropriate claims for
 // an access token
 func (s *Session) AccessToken(config *Config, kp *Keypair, now time.Time) (string, error) {
-	claims := s.standardClaims(config, config.AccessTTL, now)
+	standard := s.standardClaims(config, config.AccessTTL, now)
+	var claims jwt.Claims = standard
+	if config.AccessTokenAudience != "" {
+		claims = &accessTokenClaims{
+			StandardClaims: standard,
+			Audience:       []string{standard.Audience, config.AccessTokenAudience},
+		}
+	}
+	if s.CertificateThumbprint != "" {
+		var err error
+		if claims, err = bindToCertificate(claims, s.CertificateThumbprint); err != nil {
+			return "", err
+		}
+	}
 	return kp.SignJWT(claims)
 }
 
@@ -94,11 +350,7 @@ func (s *Session) RefreshToken(config *Config, kp *Keypair, now time.Time) (stri
 // IDToken returns the JWT token with the appropriate claims for a user
 // based on the scopes set.
 func (s *Session) IDToken(config *Config, kp *Keypair, now time.Time) (string, error) {
-	base := &IDTokenClaims{
-		StandardClaims: s.standardClaims(config, config.AccessTTL, now),
-		Nonce:          s.OIDCNonce,
-	}
-	claims, err := s.User.Claims(s.Scopes, base)
+	claims, err := s.User.Claims(s.Scopes, s.idTokenClaims(config, now))
 	if err != nil {
 		return "", err
 	}
@@ -106,6 +358,18 @@ func (s *Session) IDToken(config *Config, kp *Keypair, now time.Time) (string, e
 	return kp.SignJWT(claims)
 }
 
+// idTokenClaims are the base claims of the Session's ID tokens
+func (s *Session) idTokenClaims(config *Config, now time.Time) *IDTokenClaims {
+	claims := &IDTokenClaims{
+		StandardClaims: s.standardClaims(config, config.AccessTTL, now),
+		Nonce:          s.OIDCNonce,
+	}
+	if !s.AuthTime.IsZero() {
+		claims.AuthTime = s.AuthTime.Unix()
+	}
+	return claims
+}
+
 func (s *Session) standardClaims(config *Config, ttl time.Duration, now time.Time) *jwt.StandardClaims {
 	return &jwt.StandardClaims{
 		Audience:  config.ClientID,
@@ -186,3 +186,67 @@ func TestSessionStore_GetSessionFromToken(t *testing.T) {
 	assert.Error(t, err)
 	assert.Nil(t, session)
 }
+
+func TestSessionStore_Delete(t *testing.T) {
+	ss := mockoidc.NewSessionStore()
+	session, err := ss.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+
+	assert.NoError(t, ss.Delete(session.SessionID))
+	_, err = ss.GetSessionByID(session.SessionID)
+	assert.Error(t, err)
+}
+
+func TestSessionStore_GC(t *testing.T) {
+	ss := mockoidc.NewSessionStore()
+	granted, err := ss.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+	granted.Granted = true
+	pending, err := ss.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+
+	count, err := ss.GC(func(s *mockoidc.Session) bool { return s.Granted })
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+
+	_, err = ss.GetSessionByID(granted.SessionID)
+	assert.Error(t, err)
+	_, err = ss.GetSessionByID(pending.SessionID)
+	assert.NoError(t, err)
+}
+
+func TestSessionStore_QueueCode(t *testing.T) {
+	ss := mockoidc.NewSessionStore()
+	ss.QueueCode("queued-code")
+
+	session, err := ss.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+	assert.Equal(t, "queued-code", session.SessionID)
+}
+
+func TestSessionStore_MaxSessions(t *testing.T) {
+	ss := mockoidc.NewSessionStore()
+	ss.MaxSessions = 2
+	var evicted []string
+	ss.OnEvict = func(s *mockoidc.Session) {
+		evicted = append(evicted, s.SessionID)
+	}
+
+	first, err := ss.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+	second, err := ss.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+
+	// first becomes the most recently used
+	_, err = ss.GetSessionByID(first.SessionID)
+	assert.NoError(t, err)
+	_, err = ss.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{second.SessionID}, evicted)
+	assert.Len(t, ss.Store, 2)
+	_, err = ss.GetSessionByID(second.SessionID)
+	assert.Error(t, err)
+	_, err = ss.GetSessionByID(first.SessionID)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,123 @@
+package mockoidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Tenants hosts several independent MockOIDC issuers on a single server.
+// Each tenant is a full MockOIDC with its own BasePath, Keypair, client
+// credentials & queues.
+type Tenants struct {
+	Server *http.Server
+	Logger Logger
+
+	tenants map[string]*MockOIDC
+}
+
+// NewTenants creates an empty Tenants server that isn't started
+func NewTenants() *Tenants {
+	return &Tenants{
+		Logger:  NopLogger(),
+		tenants: make(map[string]*MockOIDC),
+	}
+}
+
+// RunTenants creates a Tenants server with a tenant for each of the passed
+// base paths (e.g. `/tenants/a`) and starts it on `127.0.0.1:0`. Every
+// tenant signs with its own random RSA key so tokens from one issuer aren't
+// valid at another.
+func RunTenants(basePaths ...string) (*Tenants, error) {
+	t := NewTenants()
+	for _, basePath := range basePaths {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = t.Add(basePath, key); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	return t, t.Start(ln, nil)
+}
+
+// Add creates a new MockOIDC tenant served under the base path. Like
+// `NewServer`, a nil rsa.PrivateKey uses the default Keypair.
+func (t *Tenants) Add(basePath string, key *rsa.PrivateKey) (*MockOIDC, error) {
+	if t.Server != nil {
+		return nil, errors.New("server already started")
+	}
+	basePath = strings.TrimSuffix(basePath, "/")
+	if basePath == "" {
+		return nil, errors.New("tenants need a non-root base path")
+	}
+	if _, ok := t.tenants[basePath]; ok {
+		return nil, fmt.Errorf("tenant already exists: %s", basePath)
+	}
+
+	m, err := NewServer(key)
+	if err != nil {
+		return nil, err
+	}
+	m.BasePath = basePath
+	t.tenants[basePath] = m
+	return m, nil
+}
+
+// Tenant returns the MockOIDC served under the base path, or nil if there
+// isn't one.
+func (t *Tenants) Tenant(basePath string) *MockOIDC {
+	return t.tenants[strings.TrimSuffix(basePath, "/")]
+}
+
+// Start starts the server for all tenants in its own Goroutine on the
+// provided net.Listener.
+func (t *Tenants) Start(ln net.Listener, cfg *tls.Config) error {
+	if t.Server != nil {
+		return errors.New("server already started")
+	}
+
+	handler := http.NewServeMux()
+	for basePath, m := range t.tenants {
+		handler.Handle(basePath+"/", m.Handler())
+	}
+
+	t.Server = &http.Server{
+		Addr:      ln.Addr().String(),
+		Handler:   handler,
+		TLSConfig: cfg,
+	}
+	// Tenants share the server to build their endpoint URLs
+	for _, m := range t.tenants {
+		m.Server = t.Server
+		m.tlsConfig = cfg
+	}
+	if cfg != nil {
+		ln = tls.NewListener(ln, cfg)
+	}
+
+	go func() {
+		err := t.Server.Serve(ln)
+		if err != nil && err != http.ErrServerClosed && t.Logger != nil {
+			t.Logger.Error("server stopped", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// Shutdown stops the server for all tenants
+func (t *Tenants) Shutdown() error {
+	return t.Server.Shutdown(context.Background())
+}
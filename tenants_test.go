@@ -0,0 +1,66 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunTenants(t *testing.T) {
+	tenants, err := mockoidc.RunTenants("/tenants/a", "/tenants/b/")
+	assert.NoError(t, err)
+	defer tenants.Shutdown()
+
+	a := tenants.Tenant("/tenants/a")
+	b := tenants.Tenant("/tenants/b")
+	assert.NotNil(t, a)
+	assert.NotNil(t, b)
+	assert.Nil(t, tenants.Tenant("/tenants/c"))
+
+	assert.Equal(t, a.Addr()+"/tenants/a", a.Issuer())
+	assert.Equal(t, b.Addr()+"/tenants/b", b.Issuer())
+	assert.NotEqual(t, a.ClientID, b.ClientID)
+
+	kidA, err := a.Keypair.KeyID()
+	assert.NoError(t, err)
+	kidB, err := b.Keypair.KeyID()
+	assert.NoError(t, err)
+	assert.NotEqual(t, kidA, kidB)
+
+	for _, m := range []*mockoidc.MockOIDC{a, b} {
+		resp, err := httpClient.Get(m.DiscoveryEndpoint())
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+		discovery := make(map[string]interface{})
+		err = json.NewDecoder(resp.Body).Decode(&discovery)
+		assert.NoError(t, err)
+		assert.Equal(t, m.Issuer(), discovery["issuer"])
+		assert.Equal(t, m.JWKSEndpoint(), discovery["jwks_uri"])
+	}
+
+	// Tokens from one tenant aren't valid for another
+	session, err := a.SessionStore.NewSession("openid", "", mockoidc.DefaultUser())
+	assert.NoError(t, err)
+	token, err := session.AccessToken(a.Config(), a.Keypair, a.Now())
+	assert.NoError(t, err)
+	_, err = a.Keypair.VerifyJWT(token)
+	assert.NoError(t, err)
+	_, err = b.Keypair.VerifyJWT(token)
+	assert.Error(t, err)
+}
+
+func TestTenants_Add(t *testing.T) {
+	tenants := mockoidc.NewTenants()
+
+	_, err := tenants.Add("/a", nil)
+	assert.NoError(t, err)
+	_, err = tenants.Add("/a/", nil)
+	assert.Error(t, err)
+	_, err = tenants.Add("", nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,110 @@
+package mockoidc
+
+import (
+	"net"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+// RunTB creates a MockOIDC server configured by the opts, like `New`, and
+// starts it on `127.0.0.1:0`. The test fails if an Option fails or the
+// server can't start, and the server is shut down when the test completes.
+func RunTB(t testing.TB, opts ...Option) *MockOIDC {
+	t.Helper()
+
+	m, err := New(opts...)
+	if err != nil {
+		t.Fatalf("mockoidc: unable to create server: %v", err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("mockoidc: unable to listen: %v", err)
+	}
+	if err = m.Start(ln, m.tlsConfig); err != nil {
+		ln.Close()
+		t.Fatalf("mockoidc: unable to start server: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := m.Shutdown(); err != nil {
+			t.Errorf("mockoidc: unable to shutdown server: %v", err)
+		}
+	})
+	t.Logf("mockoidc: issuer %s", m.Issuer())
+
+	return m
+}
+
+// RunTestServer creates a default MockOIDC server backed by an
+// `httptest.Server`. The server is closed when the test completes. It
+// returns the MockOIDC and the base URL of the server.
+func RunTestServer(t testing.TB) (*MockOIDC, string) {
+	t.Helper()
+	return runTestServer(t, false)
+}
+
+// RunTestTLSServer is the same as RunTestServer, but the `httptest.Server`
+// uses TLS with the `httptest` self-signed certificate. Test clients will
+// need to skip verification; use `NewCertificate` with `RunTLS` if clients
+// need to trust the server.
+func RunTestTLSServer(t testing.TB) (*MockOIDC, string) {
+	t.Helper()
+	return runTestServer(t, true)
+}
+
+func runTestServer(t testing.TB, useTLS bool) (*MockOIDC, string) {
+	t.Helper()
+
+	m, err := NewServer(nil)
+	if err != nil {
+		t.Fatalf("mockoidc: unable to create server: %v", err)
+	}
+
+	ts := httptest.NewUnstartedServer(m.Handler())
+	ts.Config.Addr = ts.Listener.Addr().String()
+	m.Server = ts.Config
+	if useTLS {
+		ts.StartTLS()
+		m.tlsConfig = ts.TLS
+	} else {
+		ts.Start()
+	}
+	t.Cleanup(ts.Close)
+
+	return m, ts.URL
+}
+
+// unsafeClientIDChars are replaced in the test names client IDs derive from
+var unsafeClientIDChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// RegisterTestClient registers a Client with generated credentials and an
+// ID unique to the test in the MemoryClientStore, and removes it when the
+// test completes, so parallel subtests sharing a server don't share client
+// state.
+func (m *MockOIDC) RegisterTestClient(t testing.TB) *Client {
+	t.Helper()
+
+	store, ok := m.ClientStore.(*MemoryClientStore)
+	if !ok {
+		t.Fatalf("mockoidc: test clients can only be registered in a MemoryClientStore")
+	}
+	suffix, err := randomNonce(6)
+	if err != nil {
+		t.Fatalf("mockoidc: unable to generate client id: %v", err)
+	}
+	secret, err := randomNonce(24)
+	if err != nil {
+		t.Fatalf("mockoidc: unable to generate client secret: %v", err)
+	}
+
+	client := &Client{
+		ID:     unsafeClientIDChars.ReplaceAllString(t.Name(), "-") + "-" + suffix,
+		Secret: secret,
+	}
+	store.Add(client)
+	t.Cleanup(func() {
+		store.Remove(client.ID)
+	})
+	return client
+}
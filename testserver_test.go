@@ -0,0 +1,124 @@
+package mockoidc_test
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunTestServer(t *testing.T) {
+	m, baseURL := mockoidc.RunTestServer(t)
+
+	assert.True(t, strings.HasPrefix(baseURL, "http://"))
+	assert.Equal(t, baseURL, m.Addr())
+	assert.Equal(t, baseURL+mockoidc.IssuerBase, m.Issuer())
+
+	resp, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRunTestTLSServer(t *testing.T) {
+	m, baseURL := mockoidc.RunTestTLSServer(t)
+
+	assert.True(t, strings.HasPrefix(baseURL, "https://"))
+	assert.Equal(t, baseURL, m.Addr())
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+	}
+	resp, err := client.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRunTB(t *testing.T) {
+	var m *mockoidc.MockOIDC
+	t.Run("server", func(t *testing.T) {
+		m = mockoidc.RunTB(t, func(m *mockoidc.MockOIDC) error {
+			m.ClientID = "run-tb"
+			return nil
+		})
+		assert.Equal(t, "run-tb", m.Config().ClientID)
+		assert.True(t, strings.HasPrefix(m.Issuer(), "http://127.0.0.1:"))
+
+		resp, err := httpClient.Get(m.DiscoveryEndpoint())
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	})
+
+	// Shut down by the subtest's cleanup
+	_, err := httpClient.Get(m.DiscoveryEndpoint())
+	assert.Error(t, err)
+}
+
+func TestRunTB_Options(t *testing.T) {
+	m := mockoidc.RunTB(t, mockoidc.WithClientCredentials("run-tb", "secret"))
+	assert.Equal(t, "run-tb", m.Config().ClientID)
+
+	tb := &fakeTB{TB: t}
+	tb.run(func() {
+		mockoidc.RunTB(tb, mockoidc.WithClientCredentials("", "secret"))
+	})
+	assert.Equal(t, []string{"mockoidc: unable to create server: client id is empty"}, tb.errors)
+}
+
+func TestRunTB_WithTLS(t *testing.T) {
+	cert, err := mockoidc.NewCertificate()
+	assert.NoError(t, err)
+	m := mockoidc.RunTB(t, mockoidc.WithTLS(cert.TLSConfig()))
+	assert.True(t, strings.HasPrefix(m.Issuer(), "https://"))
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig:   &tls.Config{RootCAs: cert.CertPool()},
+			DisableKeepAlives: true,
+		},
+	}
+	resp, err := client.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestMockOIDC_RegisterTestClient(t *testing.T) {
+	m := mockoidc.RunTB(t)
+
+	for _, name := range []string{"a", "b"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			client := m.RegisterTestClient(t)
+			assert.True(t, strings.HasPrefix(client.ID,
+				"TestMockOIDC_RegisterTestClient-"+name+"-"), client.ID)
+			assert.NotEmpty(t, client.Secret)
+
+			claims, err := loginAs(t, m, client.ID, client.Secret)
+			assert.NoError(t, err)
+			assert.Equal(t, client.ID, claims["aud"])
+		})
+	}
+	t.Cleanup(func() {
+		// Removed with their subtests
+		assert.Empty(t, m.ClientStore.(*mockoidc.MemoryClientStore).List())
+	})
+
+	fake := &fakeTB{}
+	fake.run(func() {
+		m, err := mockoidc.NewServerWithStores(nil, mockoidc.Stores{Clients: brokenClientStore{}})
+		assert.NoError(t, err)
+		m.RegisterTestClient(fake)
+	})
+	assert.Equal(t, []string{
+		"mockoidc: test clients can only be registered in a MemoryClientStore",
+	}, fake.errors)
+}
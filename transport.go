@@ -0,0 +1,60 @@
+package mockoidc
+
+import (
+	"net/http"
+	"net/http/httptest"
+)
+
+// InProcessHost is the host in endpoint URLs when a MockOIDC server is only
+// reachable through its in-process `Transport`.
+const InProcessHost = "mockoidc.local"
+
+type inProcessTransport struct {
+	handler http.Handler
+}
+
+// Transport returns an http.RoundTripper that dispatches every request
+// directly to the MockOIDC handlers without any network listener. If the
+// server wasn't started, it is marked as started with endpoint URLs on
+// `http://mockoidc.local`.
+func (m *MockOIDC) Transport() http.RoundTripper {
+	if m.Server == nil {
+		m.Server = &http.Server{
+			Addr:    InProcessHost,
+			Handler: m.Handler(),
+		}
+	}
+	return &inProcessTransport{handler: m.Server.Handler}
+}
+
+// Client returns an http.Client using the in-process `Transport`. Like any
+// OAuth2 client, it doesn't follow the `authorization_endpoint` redirect.
+func (m *MockOIDC) Client() *http.Client {
+	return &http.Client{
+		Transport: m.Transport(),
+		CheckRedirect: func(_ *http.Request, _ []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// RoundTrip serves the request with the MockOIDC handler and records the
+// response.
+func (t *inProcessTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	inbound := req.Clone(req.Context())
+	inbound.RequestURI = req.URL.RequestURI()
+	inbound.RemoteAddr = "127.0.0.1:0"
+	if inbound.Host == "" {
+		inbound.Host = req.URL.Host
+	}
+	if inbound.Body == nil {
+		inbound.Body = http.NoBody
+	}
+
+	rr := httptest.NewRecorder()
+	t.handler.ServeHTTP(rr, inbound)
+
+	resp := rr.Result()
+	resp.Request = req
+	return resp, nil
+}
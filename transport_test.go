@@ -0,0 +1,60 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Transport(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	client := m.Client()
+
+	assert.Equal(t, "http://"+mockoidc.InProcessHost+mockoidc.IssuerBase, m.Issuer())
+
+	resp, err := client.Get(m.DiscoveryEndpoint())
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	discovery := make(map[string]interface{})
+	err = json.NewDecoder(resp.Body).Decode(&discovery)
+	assert.NoError(t, err)
+	assert.Equal(t, m.Issuer(), discovery["issuer"])
+
+	// Code flow through the transport
+	authorizeQuery := url.Values{}
+	authorizeQuery.Set("client_id", m.ClientID)
+	authorizeQuery.Set("scope", "openid")
+	authorizeQuery.Set("response_type", "code")
+	authorizeQuery.Set("redirect_uri", "http://127.0.0.1/oauth2/callback")
+	authorizeQuery.Set("state", "state")
+
+	resp, err = client.Get(m.AuthorizationEndpoint() + "?" + authorizeQuery.Encode())
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	assert.NoError(t, err)
+
+	tokenForm := url.Values{}
+	tokenForm.Set("client_id", m.ClientID)
+	tokenForm.Set("client_secret", m.ClientSecret)
+	tokenForm.Set("grant_type", "authorization_code")
+	tokenForm.Set("code", location.Query().Get("code"))
+
+	resp, err = client.Post(m.TokenEndpoint(), "application/x-www-form-urlencoded",
+		strings.NewReader(tokenForm.Encode()))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Already started in process
+	assert.Error(t, m.Start(nil, nil))
+}
@@ -24,13 +24,13 @@ type User interface {
 
 // MockUser is a default implementation of the User interface
 type MockUser struct {
-	Subject           string
-	Email             string
-	EmailVerified     bool
-	PreferredUsername string
-	Phone             string
-	Address           string
-	Groups            []string
+	Subject           string   `json:"subject"`
+	Email             string   `json:"email"`
+	EmailVerified     bool     `json:"email_verified"`
+	PreferredUsername string   `json:"preferred_username"`
+	Phone             string   `json:"phone_number"`
+	Address           string   `json:"address"`
+	Groups            []string `json:"groups"`
 }
 
 // DefaultUser returns a default MockUser that is set in
@@ -0,0 +1,75 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"gopkg.in/square/go-jose.v2"
+)
+
+// DecodeToken verifies the signature of a token issued by this MockOIDC and
+// returns its claims, failing the test if it can't. Time based claims aren't
+// validated, so expired tokens can be inspected too.
+func (m *MockOIDC) DecodeToken(t testing.TB, raw string) jwt.MapClaims {
+	t.Helper()
+
+	token, err := verifyKeysSignature(raw, m.verificationKeys())
+	if err != nil {
+		t.Fatalf("mockoidc: unable to decode token: %v", err)
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		t.Fatalf("mockoidc: unable to extract token claims")
+	}
+	return claims
+}
+
+// ValidateAgainstJWKS validates a token like a relying party would: its
+// signature against the keys served at the `jwks_uri` with their `alg`, its
+// issuer, and its time based claims against the MockOIDC's view of time.
+func (m *MockOIDC) ValidateAgainstJWKS(raw string) error {
+	data, err := m.jwks()
+	if err != nil {
+		return err
+	}
+	jwks := &jose.JSONWebKeySet{}
+	if err = json.Unmarshal(data, jwks); err != nil {
+		return err
+	}
+
+	parser := &jwt.Parser{SkipClaimsValidation: true}
+	token, err := parser.Parse(raw, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		keys := jwks.Key(kid)
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("no key in the JWKS for kid %q", kid)
+		}
+		if alg := token.Method.Alg(); alg != keys[0].Algorithm {
+			return nil, fmt.Errorf("signing method %s is not the key's %s", alg, keys[0].Algorithm)
+		}
+		return keys[0].Key, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return errors.New("unable to extract token claims")
+	}
+	issuer := m.Config().Issuer
+	if !claims.VerifyIssuer(issuer, issuer != "") {
+		return fmt.Errorf("token issuer %v is not %s", claims["iss"], issuer)
+	}
+	now := m.Now().Unix()
+	if !claims.VerifyExpiresAt(now, true) {
+		return errors.New("token is expired")
+	}
+	if !claims.VerifyNotBefore(now, false) || !claims.VerifyIssuedAt(now, false) {
+		return errors.New("token is not valid yet")
+	}
+	return nil
+}
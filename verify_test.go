@@ -0,0 +1,76 @@
+package mockoidc_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_DecodeToken(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback",
+		[]string{"openid", "email"})
+	assert.NoError(t, err)
+
+	claims := m.DecodeToken(t, tokens.IDToken)
+	assert.Equal(t, mockoidc.DefaultUser().ID(), claims["sub"])
+	assert.Equal(t, m.Issuer(), claims["iss"])
+
+	// Expired tokens can still be decoded
+	m.FastForward(2 * m.RefreshTTL)
+	assert.Equal(t, claims, m.DecodeToken(t, tokens.IDToken))
+
+	ft := &fakeTB{}
+	ft.run(func() { m.DecodeToken(ft, "not.a.token") })
+	assert.Len(t, ft.errors, 1)
+}
+
+func TestMockOIDC_ValidateAgainstJWKS(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.ValidateAgainstJWKS(tokens.AccessToken))
+	assert.NoError(t, m.ValidateAgainstJWKS(tokens.IDToken))
+
+	m.FastForward(m.AccessTTL + time.Second)
+	assert.EqualError(t, m.ValidateAgainstJWKS(tokens.AccessToken), "token is expired")
+	m.Rewind(m.AccessTTL + time.Hour)
+	assert.EqualError(t, m.ValidateAgainstJWKS(tokens.AccessToken), "token is not valid yet")
+	m.FastForward(time.Hour)
+
+	other, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	foreign, err := other.Keypair.SignJWT(jwt.MapClaims{"iss": "https://elsewhere.example.com"})
+	assert.NoError(t, err)
+	assert.EqualError(t, m.ValidateAgainstJWKS(foreign),
+		"token issuer https://elsewhere.example.com is not "+m.Issuer())
+
+	random, err := mockoidc.RandomKeypair(1024)
+	assert.NoError(t, err)
+	forged, err := random.SignJWT(jwt.MapClaims{"iss": m.Issuer()})
+	assert.NoError(t, err)
+	assert.Error(t, m.ValidateAgainstJWKS(forged))
+}
+
+func TestMockOIDC_ValidateAgainstJWKS_PS256(t *testing.T) {
+	m := mockoidc.RunTB(t, func(m *mockoidc.MockOIDC) error {
+		m.Keypair.Alg = "PS256"
+		return nil
+	})
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	assert.NoError(t, m.ValidateAgainstJWKS(tokens.IDToken))
+
+	// Tokens are only valid with the key's algorithm
+	kid, err := m.Keypair.KeyID()
+	assert.NoError(t, err)
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"iss": m.Issuer()})
+	token.Header["kid"] = kid
+	rs256, err := token.SignedString(m.Keypair.PrivateKey)
+	assert.NoError(t, err)
+	assert.EqualError(t, m.ValidateAgainstJWKS(rs256), "signing method RS256 is not the key's PS256")
+}
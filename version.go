@@ -0,0 +1,130 @@
+package mockoidc
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+)
+
+// VersionEndpoint serves the build & feature info of a MockOIDC server, so
+// e2e environments can assert they run the expected mock.
+const VersionEndpoint = "/version"
+
+// Version & GitSHA identify the build. Set them with e.g.
+// `-ldflags "-X github.com/oauth2-proxy/mockoidc.GitSHA=$(git rev-parse HEAD)"`.
+// Version falls back to the module version recorded in the binary.
+var (
+	Version = ""
+	GitSHA  = ""
+)
+
+const modulePath = "github.com/oauth2-proxy/mockoidc"
+
+type versionResponse struct {
+	Version            string   `json:"version"`
+	GitSHA             string   `json:"git_sha,omitempty"`
+	GoVersion          string   `json:"go_version"`
+	GrantTypes         []string `json:"grant_types"`
+	IDTokenSigningAlgs []string `json:"id_token_signing_algs"`
+	FaultModes         []string `json:"fault_modes"`
+	Features           []string `json:"features"`
+}
+
+// Version implements the `VersionEndpoint`
+func (m *MockOIDC) Version(rw http.ResponseWriter, _ *http.Request) {
+	md := m.supported()
+	resp, err := json.Marshal(&versionResponse{
+		Version:            moduleVersion(),
+		GitSHA:             GitSHA,
+		GoVersion:          runtime.Version(),
+		GrantTypes:         m.grantTypes(md),
+		IDTokenSigningAlgs: md.idTokenSigningAlgs,
+		FaultModes:         m.faultModes(),
+		Features:           m.features(),
+	})
+	if err != nil {
+		internalServerError(rw, err.Error())
+		return
+	}
+	jsonResponse(rw, resp)
+}
+
+// moduleVersion is Version, or the version of this module the running
+// binary was built with.
+func moduleVersion() string {
+	if Version != "" {
+		return Version
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			return dep.Version
+		}
+	}
+	return "unknown"
+}
+
+// features lists the optional behaviours enabled on this MockOIDC
+func (m *MockOIDC) features() []string {
+	features := []string{}
+	for _, feature := range []struct {
+		name    string
+		enabled bool
+	}{
+		{"access_token_audience", m.AccessTokenAudience != ""},
+		{"admin_ui", m.ServeAdminUI},
+		{"compliance_" + string(m.Compliance), m.Compliance != ""},
+		{"conformance_mode", m.ConformanceMode},
+		{"config_reload", m.ConfigFile != ""},
+		{"dump_requests", m.DumpRequests},
+		{"fapi_mode", m.FAPIMode},
+		{"forwarded_headers", m.TrustForwardedHeaders},
+		{"harness_pages", m.ServeHarnessPages},
+		{"json_token_requests", m.AcceptJSONTokenRequests},
+		{"key_rotation", m.KeyRotationInterval > 0},
+		{"metadata_caching", m.MetadataCacheControl != "" || m.MetadataETags},
+		{"metrics", m.Metrics != nil},
+		{"omit_refresh_id_token", m.OmitRefreshIDToken},
+		{"performance_mode", m.PerformanceMode},
+		{"preset_" + string(m.preset), m.preset != ""},
+		{"request_counts", m.RequestCounter != nil},
+		{"require_nonce", m.RequireNonce},
+		{"session_gc", m.GCInterval > 0},
+		{"tls", m.tlsConfig != nil},
+	} {
+		if feature.enabled {
+			features = append(features, feature.name)
+		}
+	}
+	return features
+}
+
+// faultModes lists the kinds of failures this MockOIDC is injecting now
+func (m *MockOIDC) faultModes() []string {
+	m.ErrorQueue.Lock()
+	queued := len(m.ErrorQueue.Queue) > 0
+	m.ErrorQueue.Unlock()
+
+	modes := []string{}
+	for _, mode := range []struct {
+		name   string
+		active bool
+	}{
+		{"held_endpoints", m.holdingEndpoints()},
+		{"queued_errors", queued},
+		{"replay", m.replaying()},
+		{"scenario", m.PendingSteps() > 0},
+	} {
+		if mode.active {
+			modes = append(modes, mode.name)
+		}
+	}
+	return modes
+}
@@ -0,0 +1,66 @@
+package mockoidc_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_Version(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+	m.DumpRequests = true
+
+	mockoidc.GitSHA = "0a1b2c3"
+	defer func() { mockoidc.GitSHA = "" }()
+
+	rr := testResponse(t, mockoidc.VersionEndpoint, m.Version, http.MethodGet, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var info map[string]interface{}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&info))
+	assert.NotEmpty(t, info["version"])
+	assert.Equal(t, "0a1b2c3", info["git_sha"])
+	assert.NotEmpty(t, info["go_version"])
+	assert.Equal(t, []interface{}{"authorization_code", "refresh_token", "client_credentials",
+		"urn:ietf:params:oauth:grant-type:device_code"}, info["grant_types"])
+	assert.Equal(t, []interface{}{"RS256"}, info["id_token_signing_algs"])
+	assert.Equal(t, []interface{}{}, info["fault_modes"])
+	assert.Equal(t, []interface{}{"dump_requests", "metrics", "request_counts"}, info["features"])
+}
+
+func TestMockOIDC_Version_FaultModes(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	faultModes := func() interface{} {
+		rr := testResponse(t, mockoidc.VersionEndpoint, m.Version, http.MethodGet, nil)
+		var info map[string]interface{}
+		assert.NoError(t, json.NewDecoder(rr.Body).Decode(&info))
+		return info["fault_modes"]
+	}
+
+	m.QueueError(&mockoidc.ServerError{Code: http.StatusServiceUnavailable})
+	m.HoldEndpoint(mockoidc.TokenEndpoint)
+	m.Play(mockoidc.NewScenario().Login(mockoidc.DefaultUser()))
+	assert.Equal(t, []interface{}{"held_endpoints", "queued_errors", "scenario"}, faultModes())
+
+	m.ReleaseEndpoint(mockoidc.TokenEndpoint)
+	m.Play(mockoidc.NewScenario())
+	assert.Equal(t, []interface{}{"queued_errors"}, faultModes())
+}
+
+func TestMockOIDC_Version_Served(t *testing.T) {
+	m, err := mockoidc.Run()
+	assert.NoError(t, err)
+	defer m.Shutdown()
+
+	resp, err := httpClient.Get(m.Addr() + mockoidc.VersionEndpoint)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+}
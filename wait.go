@@ -0,0 +1,60 @@
+package mockoidc
+
+import "context"
+
+// waitBuffer is the buffer of the subscriptions of the Wait helpers
+const waitBuffer = 64
+
+// WaitForSession blocks until the next login at the `authorization_endpoint`
+// starts a Session (or the context is done) and returns its ID, which is
+// also its code.
+func (m *MockOIDC) WaitForSession(ctx context.Context) (string, error) {
+	event, err := m.waitForEvent(ctx, nil, func(event Event) bool {
+		return event.Type == EventSessionCreated
+	})
+	return event.SessionID, err
+}
+
+// WaitForTokenExchange blocks until the code has been exchanged at the
+// `token_endpoint`, returning immediately if it already was.
+func (m *MockOIDC) WaitForTokenExchange(ctx context.Context, code string) error {
+	exchanged := func() bool {
+		session, err := m.SessionStore.GetSessionByID(code)
+		return err == nil && session.Granted
+	}
+	_, err := m.waitForEvent(ctx, exchanged, func(event Event) bool {
+		return event.Type == EventTokenIssued && event.SessionID == code &&
+			event.GrantType == "authorization_code"
+	})
+	return err
+}
+
+// WaitForRefresh blocks until the next refresh token exchange of the
+// Session.
+func (m *MockOIDC) WaitForRefresh(ctx context.Context, sessionID string) error {
+	_, err := m.waitForEvent(ctx, nil, func(event Event) bool {
+		return event.Type == EventRefreshUsed && event.SessionID == sessionID
+	})
+	return err
+}
+
+// waitForEvent blocks until an Event matches, unless done reports the wait
+// is already over once subscribed.
+func (m *MockOIDC) waitForEvent(ctx context.Context, done func() bool, match func(Event) bool) (Event, error) {
+	events, unsubscribe := m.Subscribe(waitBuffer)
+	defer unsubscribe()
+	if done != nil && done() {
+		return Event{}, nil
+	}
+
+	for {
+		select {
+		case event := <-events:
+			if match(event) {
+				return event, nil
+			}
+		case <-ctx.Done():
+			return Event{}, ctx.Err()
+		}
+	}
+}
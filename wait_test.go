@@ -0,0 +1,61 @@
+package mockoidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/oauth2-proxy/mockoidc"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMockOIDC_WaitForTokenExchange(t *testing.T) {
+	m := mockoidc.RunTB(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sessions := make(chan string, 1)
+	go func() {
+		code, err := m.WaitForSession(ctx)
+		assert.NoError(t, err)
+		sessions <- code
+	}()
+	// Let the waiter subscribe
+	time.Sleep(50 * time.Millisecond)
+
+	tokens, err := m.CompleteCodeFlow(nil, "https://app.example.com/callback", nil)
+	assert.NoError(t, err)
+	code := <-sessions
+	assert.Equal(t, code, tokens.IDTokenClaims["jti"])
+
+	// Already exchanged
+	assert.NoError(t, m.WaitForTokenExchange(ctx, code))
+
+	refreshed := make(chan error, 1)
+	go func() { refreshed <- m.WaitForRefresh(ctx, code) }()
+	time.Sleep(50 * time.Millisecond)
+	resp, err := httpClient.Post(m.TokenEndpoint(), "application/x-www-form-urlencoded",
+		strings.NewReader(url.Values{
+			"client_id":     {m.ClientID},
+			"client_secret": {m.ClientSecret},
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {tokens.RefreshToken},
+		}.Encode()))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, <-refreshed)
+}
+
+func TestMockOIDC_WaitForTokenExchange_Timeout(t *testing.T) {
+	m, err := mockoidc.NewServer(nil)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = m.WaitForTokenExchange(ctx, "never-issued")
+	assert.Equal(t, context.DeadlineExceeded, err)
+}